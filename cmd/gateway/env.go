@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+// envInt reads an integer environment variable, falling back to def when unset or invalid.
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envFloat reads a float environment variable, falling back to def when unset or invalid.
+func envFloat(name string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// envDuration reads a time.Duration (e.g. "500ms") environment variable, falling back to def.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envList reads a comma-separated environment variable, dropping empty entries.
+func envList(name string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// envMap reads a comma-separated list of key:value pairs, e.g. "a:1,b:2".
+func envMap(name string) map[string]string {
+	out := make(map[string]string)
+	for _, item := range envList(name) {
+		k, v, ok := strings.Cut(item, ":")
+		if !ok {
+			continue
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// parsePercents converts percentage strings to ints, skipping invalid entries.
+func parsePercents(items []string) []int {
+	var out []int
+	for _, item := range items {
+		if pct, err := strconv.Atoi(strings.TrimSpace(item)); err == nil && pct > 0 {
+			out = append(out, pct)
+		}
+	}
+	return out
+}
+
+// dollarsToLimit converts a dollar limit to micro-dollars, treating negative
+// amounts as unlimited.
+func dollarsToLimit(dollars float64) int64 {
+	if dollars < 0 {
+		return gateway.UnlimitedUsage
+	}
+	return int64(math.Round(dollars * 1000000))
+}
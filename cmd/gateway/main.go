@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -26,12 +30,20 @@ func main() {
 	// Config Validation
 	upstreamURLStr := os.Getenv("UPSTREAM_URL")
 	if os.Getenv("MOCK_UPSTREAM") == "true" {
-		logger.Info("Starting Mock Upstream Server on :8081")
-		go startMockUpstreamServer()
-		upstreamURLStr = "http://localhost:8081/v1/chat/completions"
-
-		// Small delay to ensure the mock server starts
-		time.Sleep(500 * time.Millisecond)
+		if upstreamURLStr != "" {
+			logger.Warn("MOCK_UPSTREAM is enabled and takes precedence over UPSTREAM_URL: requests will get simulated responses, not reach the configured upstream",
+				"ignored_upstream_url", upstreamURLStr)
+		}
+		mockPort := os.Getenv("MOCK_UPSTREAM_PORT")
+		if mockPort == "" {
+			mockPort = "8081"
+		}
+		logger.Info("Starting Mock Upstream Server", "port", mockPort)
+		if err := startMockUpstreamServer(":" + mockPort); err != nil {
+			logger.Error("Failed to start mock upstream", "port", mockPort, "error", err)
+			os.Exit(1)
+		}
+		upstreamURLStr = "http://localhost:" + mockPort + "/v1/chat/completions"
 	} else if upstreamURLStr == "" {
 		upstreamURLStr = "https://api.openai.com/v1/chat/completions"
 	}
@@ -44,6 +56,7 @@ func main() {
 
 	// 1. Initialize Circuit Breaker
 	var cb gateway.CircuitBreaker
+	var redisClient *redis.Client
 	if os.Getenv("USE_MEMORY_STORE") == "true" {
 		logger.Info("Using In-Memory Circuit Breaker for local testing")
 		cb = gateway.NewMemoryCircuitBreaker()
@@ -53,80 +66,717 @@ func main() {
 			redisAddr = "localhost:6379"
 		}
 
-		redisClient := redis.NewClient(&redis.Options{
+		redisClient = redis.NewClient(&redis.Options{
 			Addr: redisAddr,
 		})
 		if err := redisClient.Ping(context.Background()).Err(); err != nil {
-			logger.Error("Failed to connect to Redis", "error", err)
-			os.Exit(1)
+			if os.Getenv("BILLING_GRACE_MODE") != "true" {
+				logger.Error("Failed to connect to Redis", "error", err)
+				os.Exit(1)
+			}
+			logger.Warn("Redis unavailable at startup, continuing in billing grace mode", "error", err)
 		}
 		cb = gateway.NewRedisCircuitBreaker(redisClient)
 	}
 
+	// Per-key limits from the environment; the Redis store otherwise reads apikey:<key>:limit
+	if defaultLimit, keyLimits := envFloat("DEFAULT_USAGE_LIMIT", 0), envMap("USAGE_LIMITS"); defaultLimit != 0 || len(keyLimits) > 0 {
+		limits := &gateway.StaticLimits{Default: dollarsToLimit(defaultLimit), Keys: make(map[string]int64)}
+		for k, v := range keyLimits {
+			if v == "unlimited" {
+				limits.Keys[k] = gateway.UnlimitedUsage
+				continue
+			}
+			dollars, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				logger.Error("Invalid USAGE_LIMITS entry, expected dollars or unlimited", observability.APIKeyAttr(k), "limit", v, "error", err)
+				os.Exit(1)
+			}
+			limits.Keys[k] = dollarsToLimit(dollars)
+		}
+		switch store := cb.(type) {
+		case *gateway.MemoryCircuitBreaker:
+			store.Limits = limits
+		case *gateway.RedisCircuitBreaker:
+			store.Limits = limits
+		}
+	}
+
+	// A key registry assigns each key a tier carrying its limit and cost markup,
+	// taking precedence over USAGE_LIMITS
+	var registry gateway.APIKeyRegistry
+	if source := os.Getenv("KEY_REGISTRY"); source == "redis" {
+		if redisClient == nil {
+			logger.Error("KEY_REGISTRY=redis requires the Redis store")
+			os.Exit(1)
+		}
+		redisRegistry := gateway.NewRedisKeyRegistry(redisClient)
+		redisRegistry.DefaultTier = os.Getenv("DEFAULT_KEY_TIER")
+		redisRegistry.CacheTTL = envDuration("KEY_REGISTRY_CACHE_TTL", gateway.DefaultRegistryCacheTTL)
+		registry = redisRegistry
+	} else if source != "" {
+		f, err := os.Open(source)
+		if err != nil {
+			logger.Error("Failed to open KEY_REGISTRY", "error", err)
+			os.Exit(1)
+		}
+		fileRegistry, err := gateway.LoadKeyRegistry(f)
+		f.Close()
+		if err != nil {
+			logger.Error("Invalid KEY_REGISTRY", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Key registry loaded", "tiers", len(fileRegistry.Tiers), "keys", len(fileRegistry.Keys))
+		registry = fileRegistry
+	}
+	if registry != nil {
+		switch store := cb.(type) {
+		case *gateway.MemoryCircuitBreaker:
+			store.Limits = gateway.RegistryLimits{Registry: registry}
+		case *gateway.RedisCircuitBreaker:
+			store.Limits = gateway.RegistryLimits{Registry: registry}
+		}
+	}
+
+	// Budgets refill at each daily or monthly boundary when a window is set
+	window, err := gateway.ParseUsageWindow(os.Getenv("USAGE_WINDOW"))
+	if err != nil {
+		logger.Error("Invalid USAGE_WINDOW", "error", err)
+		os.Exit(1)
+	}
+	switch store := cb.(type) {
+	case *gateway.MemoryCircuitBreaker:
+		store.Window = window
+	case *gateway.RedisCircuitBreaker:
+		store.Window = window
+	}
+
+	// A single node without Redis can keep its budgets across restarts
+	snapshotPath := os.Getenv("USAGE_SNAPSHOT_FILE")
+	snapshotStore, _ := cb.(*gateway.MemoryCircuitBreaker)
+	snapshotCtx, stopSnapshots := context.WithCancel(context.Background())
+	defer stopSnapshots()
+	snapshotsStopped := make(chan struct{})
+	if snapshotStore != nil && snapshotPath != "" {
+		if err := snapshotStore.LoadSnapshot(snapshotPath); err != nil {
+			logger.Error("Failed to load usage snapshot, starting with empty usage", "path", snapshotPath, "error", err)
+		}
+		go func() {
+			defer close(snapshotsStopped)
+			snapshotStore.RunSnapshots(snapshotCtx, snapshotPath, envDuration("USAGE_SNAPSHOT_INTERVAL", gateway.DefaultSnapshotInterval))
+		}()
+	} else if snapshotPath != "" {
+		logger.Warn("USAGE_SNAPSHOT_FILE only applies to the in-memory store, ignoring it")
+	}
+
+	// The unwrapped store also backs fleet stats
+	store := cb
+
+	// Keys grouped into an account share its budget; the store only sees account IDs
+	var accounts gateway.AccountResolver
+	if source := os.Getenv("KEY_ACCOUNTS"); source == "redis" {
+		if redisClient == nil {
+			logger.Error("KEY_ACCOUNTS=redis requires the Redis store")
+			os.Exit(1)
+		}
+		redisAccounts := gateway.NewRedisAccounts(redisClient)
+		redisAccounts.CacheTTL = envDuration("KEY_ACCOUNTS_CACHE_TTL", gateway.DefaultAccountCacheTTL)
+		accounts = redisAccounts
+	} else if mapping := envMap("KEY_ACCOUNTS"); len(mapping) > 0 {
+		accounts = gateway.StaticAccounts(mapping)
+	}
+	if accounts != nil {
+		cb = gateway.NewAccountCircuitBreaker(cb, accounts)
+	}
+	tokenRecorder, _ := cb.(gateway.TokenRecorder)
+
+	// Optionally keep serving and billing through a usage store outage
+	graceCtx, stopGrace := context.WithCancel(context.Background())
+	defer stopGrace()
+	if os.Getenv("BILLING_GRACE_MODE") == "true" {
+		logger.Info("Billing grace mode enabled: usage store outages fail open with buffered billing")
+		graceful := gateway.NewGracefulCircuitBreaker(cb)
+		go graceful.Run(graceCtx, envDuration("BILLING_GRACE_RECONCILE_INTERVAL", 10*time.Second))
+		cb = graceful
+	}
+
+	// Optionally notify customers as they approach their budget
+	var notifier *gateway.ThresholdNotifier
+	if webhookURL, keyWebhooks := os.Getenv("MILESTONE_WEBHOOK_URL"), envMap("MILESTONE_WEBHOOKS"); webhookURL != "" || len(keyWebhooks) > 0 {
+		notifier = gateway.NewThresholdNotifier(gateway.MilestoneConfig{
+			URL:        webhookURL,
+			Thresholds: parsePercents(envList("MILESTONE_THRESHOLDS")),
+		})
+		for k, u := range keyWebhooks {
+			notifier.Keys[k] = gateway.MilestoneConfig{URL: u}
+		}
+		for k, v := range envMap("MILESTONE_KEY_THRESHOLDS") {
+			cfg := notifier.Keys[k]
+			cfg.Thresholds = parsePercents(strings.Split(v, "|"))
+			notifier.Keys[k] = cfg
+		}
+		// Share fired milestones between replicas, so each fires once overall
+		if redisClient != nil {
+			notifier.Store = gateway.NewRedisMilestones(redisClient)
+		}
+		notifier.MaxAttempts = envInt("MILESTONE_WEBHOOK_ATTEMPTS", gateway.DefaultWebhookAttempts)
+	}
+
 	// 2. Start Background Usage Processor
+	pricing := gateway.DefaultPricing
+	if path := os.Getenv("PRICING_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Error("Failed to open PRICING_FILE", "error", err)
+			os.Exit(1)
+		}
+		pricing, err = gateway.LoadPricingTable(f)
+		f.Close()
+		if err != nil {
+			logger.Error("Invalid PRICING_FILE", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Pricing table loaded", "models", len(pricing))
+	}
+	// Every cost, whether reported, reserved or billed, comes from one calculator
+	var costs gateway.CostCalculator = pricing
+	multipliers := &gateway.CostMultipliers{Default: envFloat("COST_MULTIPLIER", 1), Keys: make(map[string]float64), Registry: registry}
+	for k, v := range envMap("COST_MULTIPLIERS") {
+		multiplier, err := strconv.ParseFloat(v, 64)
+		if err != nil || multiplier <= 0 {
+			logger.Error("Invalid COST_MULTIPLIERS entry, expected a positive number", observability.APIKeyAttr(k), "multiplier", v, "error", err)
+			os.Exit(1)
+		}
+		multipliers.Keys[k] = multiplier
+	}
 	usageChan := make(chan gateway.UsageRecord, 1000)
+	usageDrained := make(chan struct{})
 	go func() {
+		defer close(usageDrained)
 		for record := range usageChan {
-			if err := cb.AddUsage(record.APIKey, record.TokenCount); err != nil {
-				logger.Error("Failed to add usage to Redis", "api_key", record.APIKey, "error", err)
+			// The handler prices the record as it finishes; price anything that arrives without a cost
+			if !record.Priced {
+				record.BaseCostMicroDollars = costs.Cost(record)
+				record.CostMicroDollars = multipliers.Apply(record.APIKey, record.BaseCostMicroDollars)
+			}
+			cost, baseCost := record.CostMicroDollars, record.BaseCostMicroDollars
+			// The estimate reserved when the request was admitted has already been charged
+			if err := cb.AddUsage(record.APIKey, record.Charge(cb)); err != nil {
+				logger.Error("Failed to add usage to Redis", "request_id", record.RequestID, observability.APIKeyAttr(record.APIKey), "error", err)
 				metrics.ErrorRate.WithLabelValues("redis_write").Inc()
 			} else {
-				metrics.TotalTokens.WithLabelValues(record.APIKey).Add(float64(record.TokenCount))
-				logger.Info("Usage recorded", "api_key", record.APIKey, "tokens", record.TokenCount)
+				metrics.TotalTokens.WithLabelValues(metrics.HashAPIKey(record.APIKey)).Add(float64(record.TokenCount))
+				metrics.PromptTokens.WithLabelValues(record.Model).Add(float64(record.PromptTokens))
+				metrics.CompletionTokens.WithLabelValues(record.Model).Add(float64(record.CompletionTokens))
+				if record.AudioPromptTokens > 0 || record.AudioCompletionTokens > 0 {
+					metrics.AudioTokens.WithLabelValues("input").Add(float64(record.AudioPromptTokens))
+					metrics.AudioTokens.WithLabelValues("output").Add(float64(record.AudioCompletionTokens))
+				}
+				if tokenRecorder != nil {
+					if err := tokenRecorder.AddTokens(record.APIKey, int64(record.TokenCount)); err != nil {
+						logger.Error("Failed to add token count", "request_id", record.RequestID, observability.APIKeyAttr(record.APIKey), "error", err)
+					}
+				}
+				logger.Info("Usage recorded", "request_id", record.RequestID, observability.APIKeyAttr(record.APIKey), "metadata", record.Metadata, "model", record.Model, "tokens", record.TokenCount, "cost_micro_dollars", cost, "base_cost_micro_dollars", baseCost)
+				if notifier != nil {
+					if limit := gateway.UsageLimit(cb, record.APIKey); limit >= 0 {
+						if usage, err := cb.GetUsage(record.APIKey); err == nil {
+							notifier.Observe(record.APIKey, usage, limit)
+						}
+					}
+				}
 			}
 		}
 	}()
 
+	// Records that overflow the channel are kept for replay rather than dropped
+	var deadLetter gateway.DeadLetterSink
+	switch target := os.Getenv("USAGE_DEAD_LETTER"); {
+	case target == "redis" && redisClient == nil:
+		logger.Error("USAGE_DEAD_LETTER=redis requires the Redis store")
+		os.Exit(1)
+	case target == "redis":
+		deadLetter = gateway.NewRedisDeadLetter(redisClient)
+	case target != "":
+		deadLetter = &gateway.FileDeadLetter{Path: target}
+	}
+	if deadLetter != nil {
+		if replayed, err := gateway.DrainDeadLetter(deadLetter, cb, tokenRecorder); err != nil {
+			logger.Error("Failed to replay dead-lettered usage", "error", err)
+		} else if replayed > 0 {
+			logger.Info("Replayed dead-lettered usage", "records", replayed)
+		}
+	}
+
 	// 3. Initialize Proxy Handler
 	proxyHandler := gateway.NewProxyHandler(upstreamURL, cb, usageChan)
+	proxyHandler.Pricing = costs
+	proxyHandler.DeadLetter = deadLetter
+	// Route models to other providers by prefix; the rest go to UPSTREAM_URL
+	if path := os.Getenv("ROUTES_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Error("Failed to open ROUTES_FILE", "error", err)
+			os.Exit(1)
+		}
+		proxyHandler.Router, err = gateway.LoadRouter(f)
+		f.Close()
+		if err != nil {
+			logger.Error("Invalid ROUTES_FILE", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Upstream routes loaded", "routes", len(proxyHandler.Router))
+	}
+	// Spread the default upstream's traffic across replicas serving the same models
+	if items := envList("UPSTREAM_REPLICAS"); len(items) > 0 {
+		var replicas []gateway.Replica
+		for _, item := range items {
+			replica, err := gateway.ParseReplica(item)
+			if err != nil {
+				logger.Error("Invalid UPSTREAM_REPLICAS", "error", err)
+				os.Exit(1)
+			}
+			replicas = append(replicas, replica)
+		}
+		pool, err := gateway.NewUpstreamPool(replicas, gateway.BalanceStrategy(os.Getenv("UPSTREAM_BALANCE")))
+		if err != nil {
+			logger.Error("Invalid UPSTREAM_BALANCE", "error", err)
+			os.Exit(1)
+		}
+		pool.Cooldown = envDuration("UPSTREAM_REPLICA_COOLDOWN", gateway.DefaultReplicaCooldown)
+		proxyHandler.Upstreams = pool
+		logger.Info("Upstream replicas loaded", "replicas", len(replicas), "strategy", pool.Strategy)
+	}
+	proxyHandler.PreservePath = os.Getenv("UPSTREAM_PRESERVE_PATH") == "true"
+	// Context windows let requests that can't fit be rejected before reaching the upstream
+	if windows := envMap("CONTEXT_WINDOWS"); len(windows) > 0 {
+		proxyHandler.Tokenizers = &gateway.TokenizerRegistry{
+			Default:        gateway.HeuristicTokenizer{},
+			ContextWindows: make(map[string]int),
+		}
+		for model, v := range windows {
+			if window, err := strconv.Atoi(v); err == nil && window > 0 {
+				proxyHandler.Tokenizers.ContextWindows[model] = window
+			}
+		}
+	}
+	proxyHandler.Multipliers = multipliers
+	if fields := envList("USAGE_METADATA_FIELDS"); len(fields) > 0 {
+		proxyHandler.UsageMetadata = &gateway.MetadataCapture{
+			Fields:        fields,
+			MaxValueBytes: envInt("USAGE_METADATA_MAX_BYTES", gateway.DefaultMetadataValueBytes),
+		}
+	}
+	var proxyURL *url.URL
+	if proxyURLStr := os.Getenv("UPSTREAM_PROXY_URL"); proxyURLStr != "" {
+		proxyURL, err = url.Parse(proxyURLStr)
+		if err != nil {
+			logger.Error("Invalid UPSTREAM_PROXY_URL", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Routing upstream traffic through proxy", "proxy", proxyURL.Redacted())
+	}
+	transport := gateway.NewUpstreamTransport(proxyURL)
+	// Bounds the TCP footprint per provider, separately from request concurrency
+	transport.MaxConnsPerHost = envInt("UPSTREAM_MAX_CONNS_PER_HOST", 0)
+	// A hung upstream fails fast instead of pinning connections; stream bodies stay unbounded
+	gateway.UpstreamTimeouts{
+		Dial:           envDuration("UPSTREAM_DIAL_TIMEOUT", 10*time.Second),
+		TLSHandshake:   envDuration("UPSTREAM_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+		ResponseHeader: envDuration("UPSTREAM_RESPONSE_HEADER_TIMEOUT", 60*time.Second),
+	}.Apply(transport)
+	proxyHandler.Client = &http.Client{Transport: transport}
+	proxyHandler.BillingRoutes = make(gateway.BillingRoutes)
+	for route, v := range envMap("BILLING_ROUTES") {
+		if billed, err := strconv.ParseBool(v); err == nil {
+			proxyHandler.BillingRoutes[route] = billed
+		}
+	}
+	proxyHandler.UsageEvent = os.Getenv("USAGE_EVENT") == "true"
+	proxyHandler.UpgradeURL = os.Getenv("UPGRADE_URL")
+	proxyHandler.RejectOverBudget = os.Getenv("REJECT_OVER_BUDGET") == "true"
+	if allow, deny := envList("FORWARD_HEADERS_ALLOW"), envList("FORWARD_HEADERS_DENY"); len(allow) > 0 || len(deny) > 0 {
+		if len(deny) == 0 {
+			deny = []string{"Cookie"}
+		}
+		proxyHandler.RequestHeaders = gateway.NewRequestHeaderPolicy(allow, deny)
+	}
+	proxyHandler.Flush = gateway.FlushPolicy{
+		MaxEvents: envInt("STREAM_FLUSH_EVENTS", 0),
+		MaxDelay:  envDuration("STREAM_FLUSH_INTERVAL", 0),
+	}
+	proxyHandler.GzipStreams = os.Getenv("STREAM_GZIP") == "true"
+
+	keyTiers := envMap("KEY_TIERS")
+	tierFor := func(apiKey string) string {
+		if tier, ok := keyTiers[apiKey]; ok {
+			return tier
+		}
+		if registry != nil {
+			return gateway.RegistryTier(registry, apiKey)
+		}
+		return gateway.DefaultTier
+	}
+	proxyHandler.TierResolver = tierFor
+	if maxConns := envInt("MAX_CONCURRENT_CONNECTIONS", 0); maxConns > 0 {
+		proxyHandler.Admission = gateway.NewAdmissionController(
+			maxConns,
+			envInt("ADMISSION_QUEUE_SIZE", 0),
+			envDuration("ADMISSION_QUEUE_TIMEOUT", 5*time.Second),
+			envList("TIER_PRIORITY"),
+		)
+	}
+
+	// Cap runaway generations, with per-tier ceilings overriding the default
+	if defaultMax, tierMax := envInt("MAX_COMPLETION_TOKENS", 0), envMap("MAX_COMPLETION_TOKENS_TIERS"); defaultMax > 0 || len(tierMax) > 0 {
+		clamp := &gateway.CompletionTokenClamp{Default: defaultMax, Tiers: make(map[string]int)}
+		for tier, v := range tierMax {
+			limit, err := strconv.Atoi(v)
+			if err != nil {
+				logger.Error("Invalid MAX_COMPLETION_TOKENS_TIERS entry", "tier", tier, "max_tokens", v, "error", err)
+				os.Exit(1)
+			}
+			clamp.Tiers[tier] = limit
+		}
+		proxyHandler.MaxCompletionTokens = clamp
+	}
+
+	// Fleet usage gauges walk the whole store, so they're scraped in the background
+	scrapeCtx, stopScrape := context.WithCancel(context.Background())
+	defer stopScrape()
+	if interval := envDuration("USAGE_METRICS_INTERVAL", 0); interval > 0 {
+		if lister, ok := store.(gateway.UsageLister); ok {
+			go gateway.NewUsageScraper(lister, tierFor).Run(scrapeCtx, interval)
+		}
+	}
+
+	if rate := envFloat("UPSTREAM_RATE_LIMIT", 0); rate > 0 {
+		proxyHandler.Egress = gateway.NewEgressLimiter(rate,
+			envInt("UPSTREAM_RATE_BURST", 1),
+			envDuration("UPSTREAM_RATE_MAX_WAIT", time.Second),
+		)
+	}
+
+	// Retry connection errors and 5xx responses before anything reaches the client
+	if attempts := envInt("UPSTREAM_MAX_ATTEMPTS", 1); attempts > 1 {
+		proxyHandler.Retry = &gateway.RetryPolicy{
+			MaxAttempts: attempts,
+			Backoff:     envDuration("UPSTREAM_RETRY_BACKOFF", 200*time.Millisecond),
+		}
+		if ratio := envFloat("RETRY_BUDGET_RATIO", 0); ratio > 0 {
+			proxyHandler.Retry.Budget = gateway.NewRetryBudget(ratio, envInt("RETRY_BUDGET_BURST", 10))
+		}
+	}
+
+	// Fail fast while an upstream keeps failing instead of piling requests onto it
+	if threshold := envInt("UPSTREAM_BREAKER_THRESHOLD", 0); threshold > 0 {
+		proxyHandler.Breaker = gateway.NewUpstreamBreaker(threshold, envDuration("UPSTREAM_BREAKER_COOLDOWN", gateway.DefaultBreakerCooldown))
+	}
+
+	proxyHandler.ForceStream = os.Getenv("FORCE_STREAM") == "true"
+	proxyHandler.NoStreamOptions = os.Getenv("UPSTREAM_NO_STREAM_OPTIONS") == "true"
+	proxyHandler.Raw = os.Getenv("PROXY_RAW") == "true"
+	proxyHandler.ValidateRequests = os.Getenv("VALIDATE_REQUESTS") == "true"
+	if models := envList("NON_STREAMING_MODELS"); len(models) > 0 {
+		proxyHandler.NonStreamingModels = make(map[string]bool)
+		for _, m := range models {
+			proxyHandler.NonStreamingModels[m] = true
+		}
+	}
+
+	proxyHandler.AnnotateInjectedErrors = os.Getenv("INJECTED_FIELD_ERROR_NOTE") != "false"
+
+	if keys, routes := envList("JSON_MODE_KEYS"), envList("JSON_MODE_ROUTES"); len(keys) > 0 || len(routes) > 0 {
+		proxyHandler.JSONMode = &gateway.JSONModePolicy{
+			Keys:     make(map[string]bool),
+			Routes:   make(map[string]bool),
+			Override: os.Getenv("JSON_MODE_OVERRIDE") == "true",
+		}
+		for _, k := range keys {
+			proxyHandler.JSONMode.Keys[k] = true
+		}
+		for _, route := range routes {
+			proxyHandler.JSONMode.Routes[route] = true
+		}
+	}
+
+	if path := os.Getenv("PROMPT_DENYLIST_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Error("Failed to open PROMPT_DENYLIST_FILE", "error", err)
+			os.Exit(1)
+		}
+		rules, err := gateway.LoadPromptRules(f)
+		f.Close()
+		if err != nil {
+			logger.Error("Invalid PROMPT_DENYLIST_FILE", "error", err)
+			os.Exit(1)
+		}
+		proxyHandler.PromptFilter = &gateway.PromptFilter{Rules: rules, MaxScanBytes: envInt("PROMPT_FILTER_MAX_BYTES", 0)}
+		logger.Info("Prompt denylist loaded", "rules", len(rules))
+	}
+
+	if maxRounds := envInt("MAX_TOOL_CALL_ROUNDS", 0); maxRounds > 0 {
+		proxyHandler.ToolCalls = &gateway.ToolCallLimit{
+			MaxRounds: maxRounds,
+			Enforce:   os.Getenv("ENFORCE_TOOL_CALL_ROUNDS") == "true",
+		}
+	}
+
+	if defaultRPM, keyRPM := envInt("DEFAULT_RPM_LIMIT", 0), envMap("RPM_LIMITS"); defaultRPM > 0 || len(keyRPM) > 0 {
+		limits := &gateway.RPMLimits{Default: defaultRPM, Keys: make(map[string]int)}
+		for k, v := range keyRPM {
+			limit, err := strconv.Atoi(v)
+			if err != nil {
+				logger.Error("Invalid RPM_LIMITS entry", observability.APIKeyAttr(k), "limit", v, "error", err)
+				os.Exit(1)
+			}
+			limits.Keys[k] = limit
+		}
+		if redisClient != nil {
+			proxyHandler.RPM = gateway.NewRedisRateLimiter(redisClient, limits)
+		} else {
+			proxyHandler.RPM = gateway.NewMemoryRateLimiter(limits)
+		}
+	}
+
+	if defaultConcurrency, keyConcurrency := envInt("DEFAULT_CONCURRENCY_LIMIT", 0), envMap("CONCURRENCY_LIMITS"); defaultConcurrency > 0 || len(keyConcurrency) > 0 {
+		limits := &gateway.ConcurrencyLimits{Default: defaultConcurrency, Keys: make(map[string]int)}
+		for k, v := range keyConcurrency {
+			limit, err := strconv.Atoi(v)
+			if err != nil {
+				logger.Error("Invalid CONCURRENCY_LIMITS entry", observability.APIKeyAttr(k), "limit", v, "error", err)
+				os.Exit(1)
+			}
+			limits.Keys[k] = limit
+		}
+		if redisClient != nil {
+			proxyHandler.Concurrency = gateway.NewRedisConcurrencyLimiter(redisClient, limits)
+		} else {
+			proxyHandler.Concurrency = gateway.NewMemoryConcurrencyLimiter(limits)
+		}
+	}
+
+	if defaultTPM, keyTPM := envInt("DEFAULT_TPM_LIMIT", 0), envMap("TPM_LIMITS"); defaultTPM > 0 || len(keyTPM) > 0 {
+		proxyHandler.TPMLimits = &gateway.TPMLimits{Default: defaultTPM, Keys: make(map[string]int)}
+		for k, v := range keyTPM {
+			limit, err := strconv.Atoi(v)
+			if err != nil {
+				logger.Error("Invalid TPM_LIMITS entry", observability.APIKeyAttr(k), "limit", v, "error", err)
+				os.Exit(1)
+			}
+			proxyHandler.TPMLimits.Keys[k] = limit
+		}
+		if redisClient != nil {
+			proxyHandler.TPM = gateway.NewRedisTokenRateLimiter(redisClient)
+		} else {
+			proxyHandler.TPM = gateway.NewMemoryTokenRateLimiter()
+		}
+	}
+
+	if cacheTTL := envDuration("RESPONSE_CACHE_TTL", 0); cacheTTL > 0 {
+		if redisClient != nil {
+			proxyHandler.Cache = gateway.NewRedisResponseCache(redisClient, cacheTTL)
+		} else {
+			cache := gateway.NewMemoryResponseCache(cacheTTL)
+			cache.MaxBytes = int64(envInt("RESPONSE_CACHE_MAX_BYTES", gateway.DefaultMemoryCacheBytes))
+			proxyHandler.Cache = cache
+		}
+		proxyHandler.StaleIfError = envDuration("STALE_IF_ERROR", 0)
+		proxyHandler.CacheHits = os.Getenv("RESPONSE_CACHE_HITS") == "true"
+		proxyHandler.SharedCache = os.Getenv("RESPONSE_CACHE_SHARED") == "true"
+		proxyHandler.CacheHitCostRatio = envFloat("RESPONSE_CACHE_HIT_COST", 0)
+	}
+
+	if maxDuration, keyDurations := envDuration("MAX_STREAM_DURATION", 0), envMap("STREAM_DURATION_LIMITS"); maxDuration > 0 || len(keyDurations) > 0 {
+		proxyHandler.StreamDurations = &gateway.StreamDurationLimits{Default: maxDuration, Keys: make(map[string]time.Duration)}
+		for k, v := range keyDurations {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				logger.Error("Invalid STREAM_DURATION_LIMITS entry", observability.APIKeyAttr(k), "duration", v, "error", err)
+				os.Exit(1)
+			}
+			proxyHandler.StreamDurations.Keys[k] = d
+		}
+	}
+
+	proxyHandler.MaxRequestBytes = int64(envInt("MAX_REQUEST_BYTES", gateway.DefaultMaxRequestBytes))
+	proxyHandler.MaxResponseBytes = int64(envInt("MAX_RESPONSE_BYTES", 0))
+	proxyHandler.TruncationEvent = os.Getenv("RESPONSE_TRUNCATION_EVENT") != "false"
+	proxyHandler.StreamErrorMessage = os.Getenv("STREAM_ERROR_MESSAGE")
+	if maxReads := envInt("MAX_CONCURRENT_INGEST", 0); maxReads > 0 {
+		proxyHandler.Ingest = gateway.NewIngestLimiter(maxReads)
+	}
+	if maxBuffered := envInt("MAX_BUFFERED_BYTES", 0); maxBuffered > 0 {
+		proxyHandler.Buffers = gateway.NewBufferBudget(int64(maxBuffered))
+	}
 
 	// Define Routes
-	http.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+	accessLog := observability.AccessLogPolicy{
+		SampleRate:    envFloat("ACCESS_LOG_SAMPLE_RATE", 1),
+		SlowThreshold: envDuration("ACCESS_LOG_SLOW_THRESHOLD", 0),
+	}
+	completions := observability.AccessLog(logger, accessLog, gateway.InstrumentLatency(proxyHandler))
+	http.Handle("/v1/chat/completions", completions)
+	// Extra paths, e.g. canaries, served by the same proxy and unbilled unless BILLING_ROUTES says otherwise
+	for _, route := range envList("PROXY_ROUTES") {
+		if route == gateway.EmbeddingsRoute {
+			logger.Warn("Ignoring PROXY_ROUTES entry: embeddings have their own handler", "route", route)
+			continue
+		}
+		http.Handle(route, completions)
+	}
 
-		// In a fully robust version, we would wrap ResponseWriter to capture the exact status code.
-		// For high-performance passthrough, assuming 200 or failure manually reported.
-		proxyHandler.ServeHTTP(w, r)
+	// Batch jobs and their files are forwarded verbatim; their usage arrives later in the results file
+	apiBase := gateway.UpstreamAPIBase(upstreamURL)
+	if baseStr := os.Getenv("UPSTREAM_API_BASE_URL"); baseStr != "" {
+		if apiBase, err = url.Parse(baseStr); err != nil {
+			logger.Error("Invalid UPSTREAM_API_BASE_URL", "error", err)
+			os.Exit(1)
+		}
+	}
+	passthrough := gateway.NewPassthroughHandler(apiBase, cb)
+	passthrough.Client = proxyHandler.Client
+	passthrough.RequestHeaders = proxyHandler.RequestHeaders
+	passthrough.UpgradeURL = proxyHandler.UpgradeURL
+	for _, route := range gateway.PassthroughRoutes {
+		http.Handle(route, observability.AccessLog(logger, accessLog, passthrough))
+	}
 
-		duration := time.Since(start).Seconds()
-		metrics.RequestLatency.WithLabelValues("200").Observe(duration)
-		logger.Info("Request processed", "method", r.Method, "path", r.URL.Path, "latency_sec", duration)
-	})
+	// Embeddings are never streamed, so they skip the completions rewriting but
+	// share its limits and are billed from the response
+	embeddings := gateway.NewEmbeddingsHandler(gateway.EmbeddingsEndpoint(apiBase), proxyHandler)
+	http.Handle(gateway.EmbeddingsRoute, observability.AccessLog(logger, accessLog, gateway.InstrumentLatency(embeddings)))
+
+	// Model discovery lists every provider's models in one response
+	models := gateway.NewModelsHandler(apiBase, proxyHandler.Router, cb)
+	models.Client = proxyHandler.Client
+	models.RequestHeaders = proxyHandler.RequestHeaders
+	models.UpgradeURL = proxyHandler.UpgradeURL
+	models.CacheTTL = envDuration("MODELS_CACHE_TTL", gateway.DefaultModelsCacheTTL)
+	http.Handle(gateway.ModelsRoute, observability.AccessLog(logger, accessLog, models))
+
+	// Kubernetes probes: liveness only needs the process, readiness needs the usage store
+	http.HandleFunc("/healthz", gateway.Liveness)
+	http.Handle("/readyz", gateway.NewReadinessHandler(cb))
+
+	// Add an endpoint to price a request before sending it
+	http.Handle("/v1/estimate", gateway.NewEstimateHandler(proxyHandler.Tokenizers, costs))
+
+	// Add an endpoint listing the per-model rates each key is billed at
+	http.Handle("/v1/pricing", gateway.NewPricingHandler(pricing, multipliers))
+
+	// Add an endpoint to count tokens without making a completion
+	http.Handle("/v1/tokenize", gateway.NewTokenizeHandler(proxyHandler.Tokenizers))
 
 	// Add an endpoint to check usage budget
-	http.HandleFunc("/v1/usage", func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		var apiKey string
-		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-			apiKey = authHeader[7:]
+	// With known keys configured, a mistyped key is reported instead of showing a full budget
+	var keys gateway.KeyValidator
+	if list := envList("API_KEYS"); len(list) > 0 {
+		static := make(gateway.StaticKeys, len(list))
+		for _, k := range list {
+			static[k] = true
 		}
+		keys = static
+	}
+
+	http.HandleFunc("/v1/usage", func(w http.ResponseWriter, r *http.Request) {
+		apiKey := gateway.ExtractAPIKey(r)
 
 		if apiKey == "" {
-			http.Error(w, "Unauthorized: provide API Key", http.StatusUnauthorized)
+			gateway.WriteError(w, http.StatusUnauthorized, "missing_api_key", "Unauthorized: provide API Key")
+			return
+		}
+		if keys != nil && !keys.ValidKey(apiKey) {
+			gateway.WriteError(w, http.StatusUnauthorized, "invalid_api_key", "Unauthorized: unknown API Key")
 			return
 		}
 
 		usageMicro, err := cb.GetUsage(apiKey)
 		if err != nil {
 			logger.Error("Failed to get usage", "error", err)
-			http.Error(w, "Failed to retrieve usage", http.StatusInternalServerError)
+			gateway.WriteError(w, http.StatusInternalServerError, "usage_store_error", "Failed to retrieve usage")
 			return
 		}
 
 		usageDollars := float64(usageMicro) / 1000000.0
-		limitDollars := float64(gateway.MaxUsageMicroDollars) / 1000000.0
+		// Usage is stored marked up; the base cost assumes the current multiplier
+		multiplier := multipliers.For(apiKey)
+		// Unlimited keys report null for the limit and remaining budget
+		var limitDollars, remainingDollars interface{}
+		if limit := gateway.UsageLimit(cb, apiKey); limit >= 0 {
+			limitDollars = float64(limit) / 1000000.0
+			remainingDollars = float64(limit)/1000000.0 - usageDollars
+		}
+		// Budgets that never refill report null
+		var resetsAt interface{}
+		if t := gateway.ResetTime(cb); t != nil {
+			resetsAt = t.Format(time.RFC3339)
+		}
 
+		response := map[string]interface{}{
+			"api_key":            apiKey,
+			"usage_dollars":      usageDollars,
+			"base_usage_dollars": usageDollars / multiplier,
+			"cost_multiplier":    multiplier,
+			"limit_dollars":      limitDollars,
+			"remaining_dollars":  remainingDollars,
+			"resets_at":          resetsAt,
+		}
+		// Usage and limits are the account's, shared with its other keys
+		if accounts != nil {
+			response["account"] = accounts.AccountFor(apiKey)
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"api_key":           apiKey,
-			"usage_dollars":     usageDollars,
-			"limit_dollars":     limitDollars,
-			"remaining_dollars": limitDollars - usageDollars,
-		})
+		json.NewEncoder(w).Encode(response)
 	})
+	// Daily breakdown of the same usage, for spend trends
+	if _, ok := store.(gateway.UsageHistory); ok {
+		if history, ok := cb.(gateway.UsageHistory); ok {
+			http.Handle(gateway.UsageHistoryRoute, gateway.NewUsageHistoryHandler(history, keys))
+		}
+	}
 
-	// Expose Prometheus Metrics endpoint
-	http.Handle("/metrics", promhttp.Handler())
+	// Admin endpoints are only served when an admin token is configured
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		if lister, ok := store.(gateway.UsageLister); ok {
+			http.Handle("/v1/admin/stats", gateway.NewStatsHandler(lister, adminToken, envDuration("ADMIN_STATS_CACHE_TTL", 30*time.Second)))
+		}
+		http.Handle("/v1/admin/usage/reset", gateway.NewUsageResetHandler(cb, adminToken))
+		// One-shot copy of the in-memory store into Redis when scaling out
+		if targetAddr := os.Getenv("MIGRATION_REDIS_ADDR"); targetAddr != "" && redisClient == nil {
+			if lister, ok := store.(gateway.UsageLister); ok {
+				target := gateway.NewRedisCircuitBreaker(redis.NewClient(&redis.Options{Addr: targetAddr}))
+				http.Handle("/v1/admin/migrate", gateway.NewMigrationHandler(lister, target, adminToken))
+			}
+		}
+	}
+
+	// Prometheus scraping is the default; OTLP push can replace or complement it
+	metricsExporter := os.Getenv("METRICS_EXPORTER")
+	switch metricsExporter {
+	case "":
+		metricsExporter = "prometheus"
+	case "prometheus", "otlp", "both":
+	default:
+		logger.Error("Invalid METRICS_EXPORTER, expected prometheus, otlp or both", "value", metricsExporter)
+		os.Exit(1)
+	}
+	if metricsExporter == "prometheus" || metricsExporter == "both" {
+		http.Handle("/metrics", promhttp.Handler())
+	}
+	stopOTLP := func(context.Context) error { return nil }
+	if metricsExporter == "otlp" || metricsExporter == "both" {
+		stopOTLP, err = metrics.StartOTLPExport(context.Background(), metrics.OTLPConfig{
+			EndpointURL: os.Getenv("OTLP_METRICS_ENDPOINT"),
+			Interval:    envDuration("OTLP_EXPORT_INTERVAL", time.Minute),
+		})
+		if err != nil {
+			logger.Error("Failed to start OTLP metrics export", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Exporting metrics over OTLP", "endpoint", os.Getenv("OTLP_METRICS_ENDPOINT"))
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -134,6 +784,8 @@ func main() {
 	}
 	srv := &http.Server{
 		Addr: ":" + port,
+		// Every route gets a request ID, echoed to clients unless disabled
+		Handler: observability.RequestID(os.Getenv("ECHO_REQUEST_ID") != "false", http.DefaultServeMux),
 	}
 
 	// 4. Start Server
@@ -151,19 +803,55 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
 	defer cancel()
 
+	// In-flight streams get until the deadline to finish. Past it the remaining
+	// connections are closed, which cancels their upstream requests and bills
+	// what they streamed.
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Error("Server forced to shutdown", "error", err)
+		srv.Close()
 	}
 
-	close(usageChan) // Allow usage processor to drain
+	// Handlers outlive their connections briefly while they record usage; the
+	// channel is only closed once none of them, embeddings included, can send on it
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer drainCancel()
+	var drained bool
+	if err := proxyHandler.Drain(drainCtx); err != nil {
+		logger.Error("Requests still running at exit, their usage may be lost", "error", err)
+	} else {
+		close(usageChan)
+		select {
+		case <-usageDrained:
+			drained = true
+		case <-drainCtx.Done():
+			logger.Error("Usage processor did not drain before exit", "pending", len(usageChan))
+		}
+	}
+	if snapshotStore != nil && snapshotPath != "" {
+		// A periodic save still running would race the final one for the file
+		stopSnapshots()
+		<-snapshotsStopped
+		// Undrained usage is missing from the store, but the save still keeps
+		// everything that was recorded, so it's flagged rather than skipped
+		if !drained {
+			logger.Warn("Saving usage snapshot without all usage recorded, it may undercount", "path", snapshotPath)
+		}
+		if err := snapshotStore.SaveSnapshot(snapshotPath); err != nil {
+			logger.Error("Failed to snapshot usage at exit", "path", snapshotPath, "error", err)
+		}
+	}
+	if err := stopOTLP(drainCtx); err != nil {
+		logger.Error("Failed to flush OTLP metrics", "error", err)
+	}
 	logger.Info("Server exiting")
 }
 
 // startMockUpstreamServer simulates a successful OpenAI streaming response for testing.
-func startMockUpstreamServer() {
+// It listens before returning, so the mock is ready once it returns without error.
+func startMockUpstreamServer(addr string) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/event-stream")
@@ -196,7 +884,14 @@ func startMockUpstreamServer() {
 		flusher.Flush()
 	})
 
-	if err := http.ListenAndServe(":8081", mux); err != nil {
-		fmt.Printf("Mock upstream failed: %v\n", err)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
 	}
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			slog.Error("Mock upstream failed", "error", err)
+		}
+	}()
+	return nil
 }
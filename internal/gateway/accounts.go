@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+	"github.com/redis/go-redis/v9"
+)
+
+// AccountResolver groups keys into accounts sharing one budget, e.g. the keys
+// an organization issues to its developers. Keys without an account are their
+// own account.
+type AccountResolver interface {
+	AccountFor(apiKey string) string
+}
+
+// StaticAccounts maps each key to its account.
+type StaticAccounts map[string]string
+
+// AccountFor implements AccountResolver.
+func (s StaticAccounts) AccountFor(apiKey string) string {
+	if account, ok := s[apiKey]; ok && account != "" {
+		return account
+	}
+	return apiKey
+}
+
+// DefaultAccountCacheTTL is how long RedisAccounts reuses a lookup.
+const DefaultAccountCacheTTL = 30 * time.Second
+
+// RedisAccounts reads each key's account from `apikey:<key>:account`. Lookups
+// are cached for CacheTTL, so moving a key takes that long to apply. While
+// Redis can't be reached keys fall back to their own account.
+type RedisAccounts struct {
+	client   *redis.Client
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedAccount
+}
+
+type cachedAccount struct {
+	account string
+	expires time.Time
+}
+
+func NewRedisAccounts(client *redis.Client) *RedisAccounts {
+	return &RedisAccounts{
+		client:   client,
+		CacheTTL: DefaultAccountCacheTTL,
+		cache:    make(map[string]cachedAccount),
+	}
+}
+
+func (r *RedisAccounts) getAccountKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:account", apiKey)
+}
+
+// AccountFor implements AccountResolver.
+func (r *RedisAccounts) AccountFor(apiKey string) string {
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[apiKey]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.account
+	}
+
+	account, err := r.client.Get(context.Background(), r.getAccountKey(apiKey)).Result()
+	if errors.Is(err, redis.Nil) || account == "" {
+		account = apiKey
+	} else if err != nil {
+		slog.Error("Failed to resolve account, billing the key on its own", observability.APIKeyAttr(apiKey), "error", err)
+		metrics.ErrorRate.WithLabelValues("account_lookup").Inc()
+		return apiKey
+	}
+
+	if r.CacheTTL > 0 {
+		r.mu.Lock()
+		r.cache[apiKey] = cachedAccount{account: account, expires: now.Add(r.CacheTTL)}
+		r.mu.Unlock()
+	}
+	return account
+}
+
+// AccountCircuitBreaker keeps usage and limits per account rather than per
+// key, so every key of an account draws on one budget. The wrapped store sees
+// only account IDs, so its limits are set per account.
+type AccountCircuitBreaker struct {
+	CircuitBreaker
+	Accounts AccountResolver
+}
+
+// NewAccountCircuitBreaker wraps cb so keys are charged to their account.
+func NewAccountCircuitBreaker(cb CircuitBreaker, accounts AccountResolver) *AccountCircuitBreaker {
+	return &AccountCircuitBreaker{CircuitBreaker: cb, Accounts: accounts}
+}
+
+// CheckLimit checks the limit of the key's account.
+func (a *AccountCircuitBreaker) CheckLimit(apiKey string) (bool, error) {
+	return a.CircuitBreaker.CheckLimit(a.Accounts.AccountFor(apiKey))
+}
+
+// AddUsage charges the key's account.
+func (a *AccountCircuitBreaker) AddUsage(apiKey string, costMicroDollars int64) error {
+	return a.CircuitBreaker.AddUsage(a.Accounts.AccountFor(apiKey), costMicroDollars)
+}
+
+// SetUsage overwrites the usage of the key's account.
+func (a *AccountCircuitBreaker) SetUsage(apiKey string, costMicroDollars int64) error {
+	return a.CircuitBreaker.SetUsage(a.Accounts.AccountFor(apiKey), costMicroDollars)
+}
+
+// GetUsage returns the usage of the key's account.
+func (a *AccountCircuitBreaker) GetUsage(apiKey string) (int64, error) {
+	return a.CircuitBreaker.GetUsage(a.Accounts.AccountFor(apiKey))
+}
+
+// GetLimit implements LimitProvider with the limit of the key's account.
+func (a *AccountCircuitBreaker) GetLimit(apiKey string) (int64, error) {
+	return UsageLimit(a.CircuitBreaker, a.Accounts.AccountFor(apiKey)), nil
+}
+
+// CheckAndReserve implements CostReserver for the key's account.
+func (a *AccountCircuitBreaker) CheckAndReserve(apiKey string, estimatedCost int64) (bool, error) {
+	return checkAndReserve(a.CircuitBreaker, a.Accounts.AccountFor(apiKey), estimatedCost)
+}
+
+// ResetsAt implements UsageResetter for the wrapped breaker.
+func (a *AccountCircuitBreaker) ResetsAt() time.Time {
+	if resetsAt := ResetTime(a.CircuitBreaker); resetsAt != nil {
+		return *resetsAt
+	}
+	return time.Time{}
+}
+
+// AddTokens implements TokenRecorder, counting tokens per account when the
+// wrapped store counts them at all.
+func (a *AccountCircuitBreaker) AddTokens(apiKey string, tokens int64) error {
+	if recorder, ok := a.CircuitBreaker.(TokenRecorder); ok {
+		return recorder.AddTokens(a.Accounts.AccountFor(apiKey), tokens)
+	}
+	return nil
+}
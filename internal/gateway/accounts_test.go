@@ -0,0 +1,83 @@
+package gateway_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAccountCircuitBreaker_SharedBudget(t *testing.T) {
+	store := gateway.NewMemoryCircuitBreaker()
+	store.Limits = &gateway.StaticLimits{Default: gateway.MaxUsageMicroDollars, Keys: map[string]int64{"acme": 1000}}
+	accounts := gateway.StaticAccounts{"acme-dev-1": "acme", "acme-dev-2": "acme"}
+	cb := gateway.NewAccountCircuitBreaker(store, accounts)
+
+	cb.AddUsage("acme-dev-1", 600)
+	cb.AddUsage("acme-dev-2", 500)
+	cb.AddUsage("solo-key", 300)
+
+	for _, key := range []string{"acme-dev-1", "acme-dev-2"} {
+		if usage, _ := cb.GetUsage(key); usage != 1100 {
+			t.Errorf("expected %s to report the account's combined 1100, got %d", key, usage)
+		}
+		if allowed, _ := cb.CheckLimit(key); allowed {
+			t.Errorf("expected %s to be over the account's shared limit", key)
+		}
+		if limit := gateway.UsageLimit(cb, key); limit != 1000 {
+			t.Errorf("expected %s to get the account's limit, got %d", key, limit)
+		}
+	}
+
+	if usage, _ := cb.GetUsage("solo-key"); usage != 300 {
+		t.Errorf("expected a key without an account to keep its own usage, got %d", usage)
+	}
+	if allowed, _ := cb.CheckLimit("solo-key"); !allowed {
+		t.Error("expected a key without an account to keep its own budget")
+	}
+
+	// The store only ever sees the account
+	if usage, _ := store.GetUsage("acme-dev-1"); usage != 0 {
+		t.Errorf("expected no usage under the key itself, got %d", usage)
+	}
+	if allowed, _ := cb.CheckAndReserve("acme-dev-2", 10); allowed {
+		t.Error("expected the reservation to be refused over the account's limit")
+	}
+}
+
+// TestRedisAccounts requires a running Redis/Valkey instance on localhost:6379 to pass.
+func TestRedisAccounts(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	keys := []string{"apikey:test-org-key-1:account", "apikey:test-org-key-2:account", "apikey:test-org:usage", "apikey:test-org-key-3:usage"}
+	client.Del(ctx, keys...)
+	defer client.Del(ctx, keys...)
+	client.Set(ctx, "apikey:test-org-key-1:account", "test-org", 0)
+	client.Set(ctx, "apikey:test-org-key-2:account", "test-org", 0)
+
+	cb := gateway.NewAccountCircuitBreaker(gateway.NewRedisCircuitBreaker(client), gateway.NewRedisAccounts(client))
+	cb.AddUsage("test-org-key-1", 400)
+	cb.AddUsage("test-org-key-2", 250)
+	cb.AddUsage("test-org-key-3", 100)
+
+	if usage, _ := cb.GetUsage("test-org-key-2"); usage != 650 {
+		t.Errorf("expected both keys' usage to sum into the account, got %d", usage)
+	}
+	if usage, _ := client.Get(ctx, "apikey:test-org:usage").Int64(); usage != 650 {
+		t.Errorf("expected the usage stored under the account, got %d", usage)
+	}
+	if usage, _ := cb.GetUsage("test-org-key-3"); usage != 100 {
+		t.Errorf("expected a key without an account to be billed on its own, got %d", usage)
+	}
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdminTokenHeader carries the token that authorizes admin endpoints.
+const AdminTokenHeader = "X-Admin-Token"
+
+// requireAdmin rejects the request with 403 unless it carries the admin token.
+func requireAdmin(w http.ResponseWriter, r *http.Request, token string) bool {
+	given := r.Header.Get(AdminTokenHeader)
+	if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		WriteError(w, http.StatusForbidden, "forbidden", "Forbidden")
+		return false
+	}
+	return true
+}
+
+// FleetStats are usage totals across every key in the store.
+type FleetStats struct {
+	TotalTokens   int64     `json:"total_tokens"`
+	TotalDollars  float64   `json:"total_dollars"`
+	ActiveKeys    int       `json:"active_keys"`
+	KeysOverLimit int       `json:"keys_over_limit"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// StatsHandler serves GET /v1/admin/stats. Aggregating means walking the whole
+// store, so the result is cached for CacheTTL.
+type StatsHandler struct {
+	Lister     UsageLister
+	AdminToken string
+	CacheTTL   time.Duration
+
+	mu     sync.Mutex
+	cached *FleetStats
+}
+
+// NewStatsHandler initializes a stats handler over the given store.
+func NewStatsHandler(lister UsageLister, adminToken string, cacheTTL time.Duration) *StatsHandler {
+	return &StatsHandler{
+		Lister:     lister,
+		AdminToken: adminToken,
+		CacheTTL:   cacheTTL,
+	}
+}
+
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+	if !requireAdmin(w, r, h.AdminToken) {
+		return
+	}
+
+	stats, err := h.stats()
+	if err != nil {
+		slog.Error("Failed to aggregate usage stats", "error", err)
+		WriteError(w, http.StatusInternalServerError, "usage_store_error", "Failed to retrieve stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// stats returns the cached totals, recomputing them once they are older than
+// CacheTTL. Holding the lock while aggregating keeps concurrent callers from
+// stampeding the store.
+func (h *StatsHandler) stats() (*FleetStats, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cached != nil && time.Since(h.cached.GeneratedAt) < h.CacheTTL {
+		return h.cached, nil
+	}
+
+	usages, err := h.Lister.ListUsage()
+	if err != nil {
+		return nil, err
+	}
+	stats := &FleetStats{GeneratedAt: time.Now()}
+	var totalMicro int64
+	for _, u := range usages {
+		stats.TotalTokens += u.Tokens
+		totalMicro += u.CostMicroDollars
+		if u.CostMicroDollars > 0 {
+			stats.ActiveKeys++
+		}
+		limit := u.LimitMicroDollars
+		if limit == 0 {
+			limit = MaxUsageMicroDollars
+		}
+		if !withinLimit(u.CostMicroDollars, limit) {
+			stats.KeysOverLimit++
+		}
+	}
+	stats.TotalDollars = float64(totalMicro) / 1000000.0
+	h.cached = stats
+	return stats, nil
+}
@@ -0,0 +1,173 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestUsageResetHandler_DuringReservation(t *testing.T) {
+	store := gateway.NewMemoryCircuitBreaker()
+	reset := gateway.NewUsageResetHandler(store, "secret")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Support resets the key while its request holds a reservation
+		req := httptest.NewRequest("POST", "/v1/admin/usage/reset", strings.NewReader(`{"api_key": "test-key", "set_micro_dollars": 0}`))
+		req.Header.Set(gateway.AdminTokenHeader, "secret")
+		reset.ServeHTTP(httptest.NewRecorder(), req)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, store, make(chan gateway.UsageRecord, 1))
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The failed request's refund lands on the reset figure, which stays at zero
+	if usage, _ := store.GetUsage("test-key"); usage != 0 {
+		t.Errorf("expected usage to stay at 0 after the refund, got %d", usage)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	store := gateway.NewMemoryCircuitBreaker()
+	store.AddUsage("key-a", 2000000)
+	store.AddTokens("key-a", 1000)
+	store.AddUsage("key-b", gateway.MaxUsageMicroDollars)
+	store.AddTokens("key-b", 5000)
+
+	handler := gateway.NewStatsHandler(store, "secret", time.Minute)
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/admin/stats", nil)
+		req.Header.Set(gateway.AdminTokenHeader, token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := get("wrong"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 with the wrong admin token, got %d", rr.Code)
+	}
+
+	rr := get("secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var stats gateway.FleetStats
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if stats.TotalTokens != 6000 || stats.TotalDollars != 12 || stats.ActiveKeys != 2 || stats.KeysOverLimit != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// Results are cached, so new usage isn't visible until the TTL passes
+	store.AddUsage("key-c", 1000)
+	json.NewDecoder(get("secret").Body).Decode(&stats)
+	if stats.ActiveKeys != 2 {
+		t.Errorf("expected cached stats within the TTL, got %d active keys", stats.ActiveKeys)
+	}
+}
+
+func TestMigrationHandler(t *testing.T) {
+	source := gateway.NewMemoryCircuitBreaker()
+	source.AddUsage("key-a", 2000000)
+	source.AddTokens("key-a", 1000)
+	source.AddUsage("key-b", 500000)
+
+	target := gateway.NewMemoryCircuitBreaker()
+	target.AddUsage("key-b", 100000) // usage the target already had is kept
+
+	handler := gateway.NewMigrationHandler(source, target, "secret")
+	migrate := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/admin/migrate", nil)
+		req.Header.Set(gateway.AdminTokenHeader, token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := migrate("wrong"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 with the wrong admin token, got %d", rr.Code)
+	}
+
+	rr := migrate("secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var result gateway.MigrationResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if result.Keys != 2 || result.TotalTokens != 1000 || result.TotalDollars != 2.5 {
+		t.Errorf("expected 2 keys, 1000 tokens and $2.50 migrated, got %+v", result)
+	}
+
+	if usage, _ := target.GetUsage("key-a"); usage != 2000000 {
+		t.Errorf("expected key-a's usage in the target, got %d", usage)
+	}
+	if usage, _ := target.GetUsage("key-b"); usage != 600000 {
+		t.Errorf("expected key-b's usage added to the target's, got %d", usage)
+	}
+
+	// A second run would double every key
+	if rr := migrate("secret"); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 on a repeated migration, got %d", rr.Code)
+	}
+	if usage, _ := target.GetUsage("key-a"); usage != 2000000 {
+		t.Errorf("expected a refused migration to leave the target alone, got %d", usage)
+	}
+}
+
+func TestUsageResetHandler(t *testing.T) {
+	store := gateway.NewMemoryCircuitBreaker()
+	store.AddUsage("key-a", gateway.MaxUsageMicroDollars)
+	handler := gateway.NewUsageResetHandler(store, "secret")
+
+	post := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/admin/usage/reset", strings.NewReader(body))
+		req.Header.Set(gateway.AdminTokenHeader, token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("wrong", `{"api_key": "key-a", "set_micro_dollars": 0}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 with the wrong admin token, got %d", rr.Code)
+	}
+	if usage, _ := store.GetUsage("key-a"); usage != gateway.MaxUsageMicroDollars {
+		t.Errorf("expected a forbidden reset to leave usage alone, got %d", usage)
+	}
+
+	// Reset to zero lets the key back in
+	rr := post("secret", `{"api_key": "key-a", "set_micro_dollars": 0}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp gateway.UsageResetResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.PreviousMicroDollars != gateway.MaxUsageMicroDollars || resp.UsageMicroDollars != 0 {
+		t.Errorf("expected the previous and new usage, got %+v", resp)
+	}
+	if allowed, _ := store.CheckLimit("key-a"); !allowed {
+		t.Error("expected the key to be allowed after a reset")
+	}
+
+	// An arbitrary figure replaces the usage rather than adding to it
+	post("secret", `{"api_key": "key-a", "set_micro_dollars": 1234567}`)
+	if usage, _ := store.GetUsage("key-a"); usage != 1234567 {
+		t.Errorf("expected usage set to 1234567, got %d", usage)
+	}
+
+	if rr := post("secret", `{"api_key": "key-a"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without set_micro_dollars, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// DefaultTier is used for requests whose tier can't be resolved.
+const DefaultTier = "default"
+
+// AdmissionController bounds the number of concurrently proxied connections.
+// Requests over the limit wait in a per-tier queue; when a slot frees up it is
+// handed to the oldest waiter of the highest-priority tier.
+type AdmissionController struct {
+	mu           sync.Mutex
+	maxInFlight  int
+	maxQueue     int
+	queueTimeout time.Duration
+	inFlight     int
+	queued       int
+	priority     []string                   // tiers from highest to lowest priority
+	waiters      map[string][]chan struct{} // tier -> FIFO of waiting requests
+}
+
+// NewAdmissionController creates a controller admitting up to maxInFlight concurrent
+// requests. At most maxQueue requests may wait (0 means unbounded) for up to queueTimeout.
+// Tiers listed earlier in priority are served first; unlisted tiers come last.
+func NewAdmissionController(maxInFlight, maxQueue int, queueTimeout time.Duration, priority []string) *AdmissionController {
+	return &AdmissionController{
+		maxInFlight:  maxInFlight,
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+		priority:     priority,
+		waiters:      make(map[string][]chan struct{}),
+	}
+}
+
+// Acquire reserves a connection slot for the given tier, queueing if necessary.
+// It returns false if the request was rejected; otherwise release must be called
+// once the request is finished.
+func (a *AdmissionController) Acquire(ctx context.Context, tier string) (release func(), ok bool) {
+	if tier == "" {
+		tier = DefaultTier
+	}
+	start := time.Now()
+
+	a.mu.Lock()
+	if a.inFlight < a.maxInFlight && a.queued == 0 {
+		a.inFlight++
+		a.mu.Unlock()
+		metrics.AdmissionQueueWait.WithLabelValues(tier).Observe(0)
+		return a.release, true
+	}
+	if a.maxQueue > 0 && a.queued >= a.maxQueue {
+		a.mu.Unlock()
+		metrics.AdmissionRejections.WithLabelValues(tier, "queue_full").Inc()
+		return nil, false
+	}
+
+	granted := make(chan struct{})
+	a.waiters[tier] = append(a.waiters[tier], granted)
+	a.queued++
+	metrics.AdmissionQueueDepth.WithLabelValues(tier).Inc()
+	a.mu.Unlock()
+
+	timer := time.NewTimer(a.queueTimeout)
+	defer timer.Stop()
+
+	var reason string
+	select {
+	case <-granted:
+		metrics.AdmissionQueueWait.WithLabelValues(tier).Observe(time.Since(start).Seconds())
+		return a.release, true
+	case <-timer.C:
+		reason = "timeout"
+	case <-ctx.Done():
+		reason = "canceled"
+	}
+
+	a.mu.Lock()
+	removed := a.removeWaiter(tier, granted)
+	a.mu.Unlock()
+	if !removed {
+		// The slot was handed over while we were giving up; pass it on.
+		a.release()
+	}
+	metrics.AdmissionRejections.WithLabelValues(tier, reason).Inc()
+	return nil, false
+}
+
+// release frees a slot, handing it directly to the next waiter if there is one.
+func (a *AdmissionController) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if tier, next := a.nextWaiter(); next != nil {
+		metrics.AdmissionQueueDepth.WithLabelValues(tier).Dec()
+		close(next)
+		return
+	}
+	a.inFlight--
+}
+
+// nextWaiter pops the oldest waiter of the highest-priority non-empty tier.
+// Callers must hold a.mu.
+func (a *AdmissionController) nextWaiter() (string, chan struct{}) {
+	if a.queued == 0 {
+		return "", nil
+	}
+	for _, tier := range a.priority {
+		if q := a.waiters[tier]; len(q) > 0 {
+			return tier, a.popWaiter(tier)
+		}
+	}
+	for tier, q := range a.waiters {
+		if len(q) > 0 {
+			return tier, a.popWaiter(tier)
+		}
+	}
+	return "", nil
+}
+
+func (a *AdmissionController) popWaiter(tier string) chan struct{} {
+	q := a.waiters[tier]
+	next := q[0]
+	a.waiters[tier] = q[1:]
+	a.queued--
+	return next
+}
+
+// removeWaiter drops a waiter that gave up. It reports false if the waiter had
+// already been granted a slot. Callers must hold a.mu.
+func (a *AdmissionController) removeWaiter(tier string, waiter chan struct{}) bool {
+	q := a.waiters[tier]
+	for i, w := range q {
+		if w == waiter {
+			a.waiters[tier] = append(q[:i], q[i+1:]...)
+			a.queued--
+			metrics.AdmissionQueueDepth.WithLabelValues(tier).Dec()
+			return true
+		}
+	}
+	return false
+}
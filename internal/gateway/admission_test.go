@@ -0,0 +1,71 @@
+package gateway_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestAdmissionController_PriorityOrder(t *testing.T) {
+	ac := gateway.NewAdmissionController(1, 0, time.Second, []string{"premium", "free"})
+
+	release, ok := ac.Acquire(context.Background(), "free")
+	if !ok {
+		t.Fatalf("expected first request to be admitted")
+	}
+
+	admitted := make(chan string, 2)
+	acquire := func(tier string) {
+		rel, ok := ac.Acquire(context.Background(), tier)
+		if !ok {
+			admitted <- "rejected:" + tier
+			return
+		}
+		admitted <- tier
+		rel()
+	}
+
+	// Queue a free request first, then a premium one; premium must win the freed slot.
+	go acquire("free")
+	time.Sleep(20 * time.Millisecond)
+	go acquire("premium")
+	time.Sleep(20 * time.Millisecond)
+
+	release()
+
+	if first := <-admitted; first != "premium" {
+		t.Errorf("expected premium tier to be admitted first, got %s", first)
+	}
+	if second := <-admitted; second != "free" {
+		t.Errorf("expected free tier to be admitted second, got %s", second)
+	}
+}
+
+func TestAdmissionController_Rejections(t *testing.T) {
+	ac := gateway.NewAdmissionController(1, 1, 50*time.Millisecond, nil)
+
+	release, ok := ac.Acquire(context.Background(), "")
+	if !ok {
+		t.Fatalf("expected first request to be admitted")
+	}
+	defer release()
+
+	done := make(chan bool)
+	go func() {
+		_, ok := ac.Acquire(context.Background(), "")
+		done <- ok
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The single queue slot is taken, so this one is rejected immediately.
+	if _, ok := ac.Acquire(context.Background(), ""); ok {
+		t.Errorf("expected request to be rejected with a full queue")
+	}
+
+	// The queued request gives up after the queue timeout.
+	if ok := <-done; ok {
+		t.Errorf("expected queued request to time out")
+	}
+}
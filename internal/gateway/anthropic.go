@@ -0,0 +1,322 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Adapter translates between the OpenAI chat completions format clients use
+// and a provider's own API, so routes can reach providers that don't speak it.
+type Adapter interface {
+	// TranslateRequest encodes an OpenAI chat completions payload for the provider.
+	TranslateRequest(payload map[string]interface{}) ([]byte, error)
+	// TranslateResponse rewrites the provider's response into OpenAI's format.
+	TranslateResponse(resp *http.Response) *http.Response
+}
+
+// endpointAdapter is implemented by adapters whose provider selects the
+// operation by URL, such as streaming or not, rather than by a body field.
+type endpointAdapter interface {
+	// Endpoint returns the URL to send a request to, given the route's URL.
+	Endpoint(url string, stream bool) string
+}
+
+// adapters are the provider formats a Route may select by name.
+var adapters = map[string]Adapter{
+	"anthropic": AnthropicAdapter{},
+	"gemini":    GeminiAdapter{},
+}
+
+// anthropicDefaultMaxTokens is sent when the client sets no limit, since the
+// Messages API requires one.
+const anthropicDefaultMaxTokens = 4096
+
+// AnthropicAdapter speaks Anthropic's Messages API (/v1/messages). System
+// messages move to the top-level system prompt, and streamed
+// content_block_delta events come back as OpenAI chat.completion.chunk
+// deltas, with the usage from message_start and message_delta reported in a
+// final usage chunk.
+type AnthropicAdapter struct{}
+
+// TranslateRequest implements Adapter. Fields without an Anthropic
+// equivalent, such as stream_options, are dropped.
+func (AnthropicAdapter) TranslateRequest(payload map[string]interface{}) ([]byte, error) {
+	req := map[string]interface{}{
+		"model":      payload["model"],
+		"max_tokens": anthropicDefaultMaxTokens,
+	}
+	for _, field := range []string{"max_completion_tokens", "max_tokens"} {
+		if v, ok := payload[field].(float64); ok && v > 0 {
+			req["max_tokens"] = int(v)
+		}
+	}
+	for _, field := range []string{"stream", "temperature", "top_p"} {
+		if v, ok := payload[field]; ok {
+			req[field] = v
+		}
+	}
+	switch stop := payload["stop"].(type) {
+	case string:
+		req["stop_sequences"] = []string{stop}
+	case []interface{}:
+		req["stop_sequences"] = stop
+	}
+
+	messages, _ := payload["messages"].([]interface{})
+	var system []string
+	converted := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		msg, ok := m.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid message: %v", m)
+		}
+		role, _ := msg["role"].(string)
+		switch role {
+		case "system", "developer":
+			system = append(system, messageText(msg["content"]))
+		case "user", "assistant":
+			converted = append(converted, map[string]interface{}{"role": role, "content": msg["content"]})
+		default:
+			return nil, fmt.Errorf("unsupported message role for Anthropic: %q", role)
+		}
+	}
+	if len(system) > 0 {
+		req["system"] = strings.Join(system, "\n\n")
+	}
+	req["messages"] = converted
+	return json.Marshal(req)
+}
+
+// messageText flattens message content, a string or an array of text parts.
+func messageText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var parts []string
+		for _, p := range c {
+			if part, ok := p.(map[string]interface{}); ok {
+				if text, ok := part["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// TranslateResponse implements Adapter. Responses that are neither JSON nor
+// an event stream are left as they are.
+func (AnthropicAdapter) TranslateResponse(resp *http.Response) *http.Response {
+	switch {
+	case isJSONResponse(resp):
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxUsageBodyBytes))
+		resp.Body.Close()
+		if err == nil {
+			body = translateAnthropicJSON(body)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	case strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		resp.Body = &anthropicStream{body: resp.Body, scanner: scanner}
+	default:
+		return resp
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return resp
+}
+
+// anthropicUsage is the usage object of Messages API responses and events.
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// openAIUsage converts usage to OpenAI's field names.
+func (u anthropicUsage) openAIUsage() map[string]int {
+	return map[string]int{
+		"prompt_tokens":     u.InputTokens,
+		"completion_tokens": u.OutputTokens,
+		"total_tokens":      u.InputTokens + u.OutputTokens,
+	}
+}
+
+// anthropicError is the body of Messages API errors, streamed or not.
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// finishReasons maps Anthropic stop reasons to OpenAI finish reasons.
+var finishReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+}
+
+// translateAnthropicJSON converts a complete message, or an error, to OpenAI's
+// shape. Bodies it doesn't recognise are returned unchanged.
+func translateAnthropicJSON(body []byte) []byte {
+	var msg struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Model   string `json:"model"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string          `json:"stop_reason"`
+		Usage      anthropicUsage  `json:"usage"`
+		Error      *anthropicError `json:"error"`
+	}
+	if json.Unmarshal(body, &msg) != nil {
+		return body
+	}
+
+	var out interface{}
+	switch msg.Type {
+	case "message":
+		var text strings.Builder
+		for _, block := range msg.Content {
+			if block.Type == "text" {
+				text.WriteString(block.Text)
+			}
+		}
+		out = map[string]interface{}{
+			"id":     msg.ID,
+			"object": "chat.completion",
+			"model":  msg.Model,
+			"choices": []interface{}{map[string]interface{}{
+				"index":         0,
+				"message":       map[string]interface{}{"role": "assistant", "content": text.String()},
+				"finish_reason": finishReasons[msg.StopReason],
+			}},
+			"usage": msg.Usage.openAIUsage(),
+		}
+	case "error":
+		if msg.Error == nil {
+			return body
+		}
+		out = ErrorResponse{Error: APIError{Message: msg.Error.Message, Type: msg.Error.Type}}
+	default:
+		return body
+	}
+	translated, err := json.Marshal(out)
+	if err != nil {
+		return body
+	}
+	return translated
+}
+
+// anthropicStream reads a Messages API event stream as OpenAI SSE chunks.
+type anthropicStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	pending bytes.Buffer
+
+	id, model string
+	usage     anthropicUsage
+}
+
+func (s *anthropicStream) Read(p []byte) (int, error) {
+	for s.pending.Len() == 0 {
+		if !s.scanner.Scan() {
+			if err := s.scanner.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		if data, ok := bytes.CutPrefix(s.scanner.Bytes(), []byte("data: ")); ok {
+			s.translate(data)
+		}
+	}
+	return s.pending.Read(p)
+}
+
+func (s *anthropicStream) Close() error {
+	return s.body.Close()
+}
+
+// translate converts one event's data to the chunks it becomes, if any.
+func (s *anthropicStream) translate(data []byte) {
+	var event struct {
+		Type    string `json:"type"`
+		Message struct {
+			ID    string         `json:"id"`
+			Model string         `json:"model"`
+			Usage anthropicUsage `json:"usage"`
+		} `json:"message"`
+		Delta struct {
+			Type       string `json:"type"`
+			Text       string `json:"text"`
+			StopReason string `json:"stop_reason"`
+		} `json:"delta"`
+		Usage *anthropicUsage `json:"usage"`
+		Error *anthropicError `json:"error"`
+	}
+	if json.Unmarshal(data, &event) != nil {
+		return
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.id, s.model, s.usage = event.Message.ID, event.Message.Model, event.Message.Usage
+		s.writeChunk(map[string]interface{}{"role": "assistant", "content": ""}, nil)
+	case "content_block_delta":
+		if event.Delta.Type == "text_delta" {
+			s.writeChunk(map[string]interface{}{"content": event.Delta.Text}, nil)
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			// Output tokens are cumulative; input tokens only arrive with message_start
+			s.usage.OutputTokens = event.Usage.OutputTokens
+			if event.Usage.InputTokens > 0 {
+				s.usage.InputTokens = event.Usage.InputTokens
+			}
+		}
+		if reason, ok := finishReasons[event.Delta.StopReason]; ok {
+			s.writeChunk(map[string]interface{}{}, reason)
+		}
+	case "message_stop":
+		s.write(map[string]interface{}{
+			"id":      s.id,
+			"object":  "chat.completion.chunk",
+			"model":   s.model,
+			"choices": []interface{}{},
+			"usage":   s.usage.openAIUsage(),
+		})
+		s.pending.WriteString("data: [DONE]\n\n")
+	case "error":
+		if event.Error != nil {
+			s.write(ErrorResponse{Error: APIError{Message: event.Error.Message, Type: event.Error.Type}})
+		}
+	}
+}
+
+// writeChunk queues a chat.completion.chunk with a single choice.
+func (s *anthropicStream) writeChunk(delta map[string]interface{}, finishReason interface{}) {
+	s.write(map[string]interface{}{
+		"id":     s.id,
+		"object": "chat.completion.chunk",
+		"model":  s.model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	})
+}
+
+// write queues v as an SSE data line.
+func (s *anthropicStream) write(v interface{}) {
+	writeSSEData(&s.pending, v)
+}
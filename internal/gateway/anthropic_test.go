@@ -0,0 +1,165 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestAnthropicAdapter_TranslateRequest(t *testing.T) {
+	var payload map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"model": "claude-3-5-sonnet-20241022",
+		"stream": true,
+		"stream_options": {"include_usage": true},
+		"max_tokens": 256,
+		"stop": "END",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Hello"}
+		]
+	}`), &payload)
+
+	body, err := gateway.AnthropicAdapter{}.TranslateRequest(payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var req map[string]interface{}
+	json.Unmarshal(body, &req)
+
+	if req["system"] != "Be brief." {
+		t.Errorf("expected the system message as the system prompt, got %v", req["system"])
+	}
+	if messages, _ := req["messages"].([]interface{}); len(messages) != 1 {
+		t.Errorf("expected only the user message in messages, got %v", req["messages"])
+	}
+	if req["max_tokens"] != float64(256) || req["stream"] != true {
+		t.Errorf("expected max_tokens and stream to be kept, got %v", req)
+	}
+	if _, ok := req["stream_options"]; ok {
+		t.Error("expected stream_options to be dropped")
+	}
+	if stop, _ := req["stop_sequences"].([]interface{}); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("expected stop as stop_sequences, got %v", req["stop_sequences"])
+	}
+}
+
+func TestProxyHandler_AnthropicRoute(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/anthropic_stream.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var upstreamBody map[string]interface{}
+	var upstreamPath, apiKey string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath, apiKey = r.URL.Path, r.Header.Get("x-api-key")
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write(fixture)
+	}))
+	defer upstreamServer.Close()
+
+	router, err := gateway.LoadRouter(strings.NewReader(`{"claude-": {"url": "` + upstreamServer.URL +
+		`/v1/messages", "adapter": "anthropic", "auth_header": "x-api-key", "headers": {"anthropic-version": "2023-06-01"}}}`))
+	if err != nil {
+		t.Fatalf("unexpected error loading routes: %v", err)
+	}
+	defaultURL, _ := url.Parse("http://127.0.0.1:1/v1/chat/completions")
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(defaultURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.Router = router
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(
+		`{"model": "claude-3-5-sonnet-20241022", "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if upstreamPath != "/v1/messages" || apiKey != "test-key" {
+		t.Errorf("expected the Messages API with x-api-key, got path %q key %q", upstreamPath, apiKey)
+	}
+	if upstreamBody["max_tokens"] == nil {
+		t.Errorf("expected max_tokens to be filled in, got %v", upstreamBody)
+	}
+
+	// The client sees OpenAI chunks
+	var content strings.Builder
+	var finishReason string
+	var sawDone bool
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			sawDone = true
+			continue
+		}
+		var chunk struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Delta        struct{ Content string } `json:"delta"`
+				FinishReason *string                  `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || chunk.Object != "chat.completion.chunk" {
+			t.Fatalf("expected a chat.completion.chunk, got %q", data)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	if content.String() != "Hello!" || finishReason != "stop" || !sawDone {
+		t.Errorf("expected \"Hello!\" finishing with stop and [DONE], got %q %q done=%v", content.String(), finishReason, sawDone)
+	}
+
+	select {
+	case record := <-usageChan:
+		if record.PromptTokens != 25 || record.CompletionTokens != 15 || record.TokenCount != 40 {
+			t.Errorf("expected usage from message_start and message_delta, got %+v", record)
+		}
+	default:
+		t.Error("expected usage to be recorded")
+	}
+}
+
+func TestAnthropicAdapter_TranslateJSONResponse(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body: io.NopCloser(strings.NewReader(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-5-haiku-20241022",` +
+			`"content":[{"type":"text","text":"Hi there"}],"stop_reason":"max_tokens","usage":{"input_tokens":10,"output_tokens":4}}`)),
+	}
+	resp = gateway.AnthropicAdapter{}.TranslateResponse(resp)
+	body, _ := io.ReadAll(resp.Body)
+
+	var completion struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message      struct{ Content string } `json:"message"`
+			FinishReason string                   `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil || completion.Object != "chat.completion" {
+		t.Fatalf("expected a chat.completion, got %s", body)
+	}
+	if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Hi there" || completion.Choices[0].FinishReason != "length" {
+		t.Errorf("expected the message text with finish_reason length, got %s", body)
+	}
+	if completion.Usage.TotalTokens != 14 {
+		t.Errorf("expected 14 total tokens, got %d", completion.Usage.TotalTokens)
+	}
+}
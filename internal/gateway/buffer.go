@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"sync/atomic"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// BufferBudget caps the bytes held in memory across all in-flight requests:
+// request bodies read for rewriting and responses captured for caching. A nil
+// budget is unlimited.
+type BufferBudget struct {
+	max  int64
+	used atomic.Int64
+}
+
+// NewBufferBudget creates a budget allowing up to maxBytes to be buffered at once.
+func NewBufferBudget(maxBytes int64) *BufferBudget {
+	return &BufferBudget{max: maxBytes}
+}
+
+// Reserve accounts for n more buffered bytes. It reports false, reserving
+// nothing, if that would take the total over the ceiling.
+func (b *BufferBudget) Reserve(n int64) bool {
+	if b == nil || n <= 0 {
+		return true
+	}
+	for {
+		used := b.used.Load()
+		if used+n > b.max {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+n) {
+			metrics.BufferedBytes.Add(float64(n))
+			return true
+		}
+	}
+}
+
+// Release returns n bytes to the budget.
+func (b *BufferBudget) Release(n int64) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.used.Add(-n)
+	metrics.BufferedBytes.Sub(float64(n))
+}
+
+// Used returns the bytes currently buffered.
+func (b *BufferBudget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
@@ -0,0 +1,60 @@
+package gateway_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestBufferBudget(t *testing.T) {
+	budget := gateway.NewBufferBudget(100)
+
+	if !budget.Reserve(60) {
+		t.Fatal("expected 60 bytes to fit in a 100 byte budget")
+	}
+	if budget.Reserve(50) {
+		t.Error("expected a reservation over the ceiling to be refused")
+	}
+	if budget.Used() != 60 {
+		t.Errorf("expected a refused reservation to reserve nothing, used %d", budget.Used())
+	}
+	budget.Release(60)
+	if !budget.Reserve(100) {
+		t.Error("expected released bytes to be reusable")
+	}
+}
+
+func TestProxyHandler_BufferLimit(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Buffers = gateway.NewBufferBudget(256)
+
+	small := []byte(`{"model": "gpt-4", "messages": [{"role": "user", "content": "Hi"}]}`)
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(small)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected a small request to fit the budget, got %d", rr.Code)
+	}
+	if used := proxyHandler.Buffers.Used(); used != 0 {
+		t.Errorf("expected buffers to be released after the request, %d bytes still held", used)
+	}
+
+	large := []byte(`{"model": "gpt-4", "messages": [{"role": "user", "content": "` + string(bytes.Repeat([]byte("a"), 512)) + `"}]}`)
+	rr = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(large)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once the buffer budget is exceeded, got %d", rr.Code)
+	}
+	if used := proxyHandler.Buffers.Used(); used != 0 {
+		t.Errorf("expected nothing to stay reserved after shedding, %d bytes held", used)
+	}
+}
@@ -0,0 +1,242 @@
+package gateway
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultCacheMaxBytes bounds how much of a response is buffered for caching.
+const DefaultCacheMaxBytes = 1 << 20
+
+// DefaultMemoryCacheBytes bounds the response bodies the in-memory cache holds.
+const DefaultMemoryCacheBytes = 64 << 20
+
+// CachedResponse is a complete upstream response stored for replay.
+type CachedResponse struct {
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	StoredAt    time.Time `json:"stored_at"`
+	// Usage is what the response consumed, for billing cache hits. Entries
+	// stored without it are served free.
+	Usage *CachedUsage `json:"usage,omitempty"`
+}
+
+// CachedUsage is the usage reported with a cached response.
+type CachedUsage struct {
+	Model                 string `json:"model"`
+	TokenCount            int    `json:"token_count"`
+	PromptTokens          int    `json:"prompt_tokens"`
+	CompletionTokens      int    `json:"completion_tokens"`
+	AudioPromptTokens     int    `json:"audio_prompt_tokens,omitempty"`
+	AudioCompletionTokens int    `json:"audio_completion_tokens,omitempty"`
+}
+
+// ResponseCache stores complete responses to deterministic requests.
+type ResponseCache interface {
+	Get(key string) (*CachedResponse, bool, error)
+	Set(key string, resp *CachedResponse) error
+}
+
+// CacheKey derives a cache key from the request path and the normalized
+// payload, so the same body sent to another endpoint gets its own entry.
+// scope, e.g. the API key, keeps each tenant's entries to itself; an empty
+// scope shares them. Only deterministic requests (temperature 0 and a single
+// choice) are cacheable.
+func CacheKey(scope, path string, payload map[string]interface{}) (string, bool) {
+	if temperature, ok := PayloadFloat(payload, "temperature"); !ok || temperature != 0 {
+		return "", false
+	}
+	if _, present := payload["n"]; present {
+		if n, ok := PayloadInt(payload, "n"); !ok || n != 1 {
+			return "", false
+		}
+	}
+
+	// json.Marshal sorts map keys, so equivalent payloads hash identically
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	h.Write([]byte(scope))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(normalized)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// MemoryResponseCache implements ResponseCache in process memory. Once the
+// bodies held exceed MaxBytes the least recently used entries are evicted,
+// so distinct requests can't grow the cache without bound.
+type MemoryResponseCache struct {
+	// MaxBytes bounds the cached bodies. Zero or less is unlimited.
+	MaxBytes int64
+
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*list.Element
+	lru     *list.List // most recently used first
+	size    int64
+}
+
+// memoryCacheEntry is an element of the LRU list.
+type memoryCacheEntry struct {
+	key  string
+	resp *CachedResponse
+}
+
+func NewMemoryResponseCache(ttl time.Duration) *MemoryResponseCache {
+	return &MemoryResponseCache{
+		MaxBytes: DefaultMemoryCacheBytes,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get implements ResponseCache, lazily evicting expired entries.
+func (m *MemoryResponseCache) Get(key string) (*CachedResponse, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	resp := elem.Value.(*memoryCacheEntry).resp
+	if time.Since(resp.StoredAt) > m.ttl {
+		m.remove(elem)
+		return nil, false, nil
+	}
+	m.lru.MoveToFront(elem)
+	return resp, true, nil
+}
+
+// Set implements ResponseCache, evicting the least recently used entries
+// beyond MaxBytes.
+func (m *MemoryResponseCache) Set(key string, resp *CachedResponse) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	}
+	m.entries[key] = m.lru.PushFront(&memoryCacheEntry{key: key, resp: resp})
+	m.size += int64(len(resp.Body))
+	for m.MaxBytes > 0 && m.size > m.MaxBytes && m.lru.Len() > 0 {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries held, expired or not.
+func (m *MemoryResponseCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// remove drops an entry. m.mu must be held.
+func (m *MemoryResponseCache) remove(elem *list.Element) {
+	entry := m.lru.Remove(elem).(*memoryCacheEntry)
+	delete(m.entries, entry.key)
+	m.size -= int64(len(entry.resp.Body))
+}
+
+// RedisResponseCache implements ResponseCache with JSON values and a TTL.
+type RedisResponseCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisResponseCache(client *redis.Client, ttl time.Duration) *RedisResponseCache {
+	return &RedisResponseCache{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (r *RedisResponseCache) getCacheKey(key string) string {
+	return fmt.Sprintf("cache:response:%s", key)
+}
+
+// Get implements ResponseCache.
+func (r *RedisResponseCache) Get(key string) (*CachedResponse, bool, error) {
+	ctx := context.Background()
+	val, err := r.client.Get(ctx, r.getCacheKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("redis get error: %w", err)
+	}
+
+	var resp CachedResponse
+	if err := json.Unmarshal(val, &resp); err != nil {
+		return nil, false, fmt.Errorf("invalid cached response in redis: %w", err)
+	}
+	return &resp, true, nil
+}
+
+// Set implements ResponseCache.
+func (r *RedisResponseCache) Set(key string, resp *CachedResponse) error {
+	val, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	return r.client.Set(ctx, r.getCacheKey(key), val, r.ttl).Err()
+}
+
+// captureReader copies what is read from an upstream body into a bounded buffer
+// so a complete response can be cached after it has been streamed.
+type captureReader struct {
+	io.ReadCloser
+	buf      []byte
+	limit    int
+	overflow bool // the body exceeded limit or the buffer budget
+	failed   bool // the body ended with an error rather than EOF
+
+	budget   *BufferBudget
+	reserved int64
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if !c.overflow {
+		if len(c.buf)+n > c.limit || !c.budget.Reserve(int64(n)) {
+			// Give up on caching rather than on the response
+			c.overflow = true
+			c.buf = nil
+			c.release()
+		} else {
+			c.reserved += int64(n)
+			c.buf = append(c.buf, p[:n]...)
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.failed = true
+	}
+	return n, err
+}
+
+// release returns the captured bytes to the buffer budget.
+func (c *captureReader) release() {
+	c.budget.Release(c.reserved)
+	c.reserved = 0
+}
+
+// complete reports whether the whole body was captured.
+func (c *captureReader) complete() bool {
+	return !c.overflow && !c.failed
+}
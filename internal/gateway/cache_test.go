@@ -0,0 +1,233 @@
+package gateway_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestProxyHandler_StaleIfError(t *testing.T) {
+	var failing atomic.Bool
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "upstream down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(usageStream))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Cache = gateway.NewMemoryResponseCache(time.Hour)
+	proxyHandler.StaleIfError = time.Hour
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+	deterministic := `{"model": "gpt-4o", "temperature": 0, "messages": [{"role": "user", "content": "Hi"}]}`
+	sampled := `{"model": "gpt-4o", "temperature": 0.7, "messages": [{"role": "user", "content": "Hi"}]}`
+
+	// Healthy upstream: responses are fresh and deterministic ones are captured
+	for _, body := range []string{deterministic, sampled} {
+		if rr := send(body); rr.Code != http.StatusOK || rr.Header().Get(gateway.StaleHeader) != "" {
+			t.Fatalf("expected fresh 200 response, got %d (stale=%q)", rr.Code, rr.Header().Get(gateway.StaleHeader))
+		}
+	}
+
+	failing.Store(true)
+
+	rr := send(deterministic)
+	if rr.Code != http.StatusOK || rr.Header().Get(gateway.StaleHeader) != "true" {
+		t.Fatalf("expected stale 200 response during outage, got %d (stale=%q)", rr.Code, rr.Header().Get(gateway.StaleHeader))
+	}
+	if rr.Body.String() != usageStream {
+		t.Errorf("expected cached stream to be replayed, got %q", rr.Body.String())
+	}
+
+	// Non-deterministic requests are never cached, so the failure surfaces
+	if rr := send(sampled); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected upstream 503 for uncached request, got %d", rr.Code)
+	}
+
+	// Entries older than the max-stale bound are not served
+	proxyHandler.StaleIfError = time.Nanosecond
+	if rr := send(deterministic); rr.Header().Get(gateway.StaleHeader) != "" {
+		t.Errorf("expected no stale response beyond the max-stale age")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	decode := func(body string) map[string]interface{} {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+		return decodePayload(t, req)
+	}
+
+	a, ok := gateway.CacheKey("test-key", "/v1/chat/completions", decode(`{"model": "gpt-4o", "temperature": 0, "messages": []}`))
+	if !ok {
+		t.Fatalf("expected temperature 0 request to be cacheable")
+	}
+	b, _ := gateway.CacheKey("test-key", "/v1/chat/completions", decode(`{"messages": [], "temperature": 0, "model": "gpt-4o"}`))
+	if a != b {
+		t.Errorf("expected key order not to affect the cache key")
+	}
+	if c, _ := gateway.CacheKey("test-key", "/v1/responses", decode(`{"model": "gpt-4o", "temperature": 0, "messages": []}`)); c == a {
+		t.Errorf("expected the same body sent to another path to get its own key")
+	}
+	if d, _ := gateway.CacheKey("other-key", "/v1/chat/completions", decode(`{"model": "gpt-4o", "temperature": 0, "messages": []}`)); d == a {
+		t.Errorf("expected another key's request to get its own key")
+	}
+	if _, ok := gateway.CacheKey("test-key", "/v1/chat/completions", decode(`{"model": "gpt-4o", "temperature": 0, "n": 2}`)); ok {
+		t.Errorf("expected n > 1 to be uncacheable")
+	}
+	if _, ok := gateway.CacheKey("test-key", "/v1/chat/completions", decode(`{"model": "gpt-4o"}`)); ok {
+		t.Errorf("expected default temperature to be uncacheable")
+	}
+}
+
+func TestMemoryResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := gateway.NewMemoryResponseCache(time.Hour)
+	cache.MaxBytes = 30
+	entry := func() *gateway.CachedResponse {
+		return &gateway.CachedResponse{StatusCode: http.StatusOK, Body: make([]byte, 10), StoredAt: time.Now()}
+	}
+
+	cache.Set("a", entry())
+	cache.Set("b", entry())
+	cache.Set("c", entry())
+	// Reading a makes b the least recently used
+	if _, ok, _ := cache.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	cache.Set("d", entry())
+
+	if _, ok, _ := cache.Get("b"); ok {
+		t.Errorf("expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok, _ := cache.Get(key); !ok {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+	if cache.Len() != 3 {
+		t.Errorf("expected the cache to stay within 30 bytes, got %d entries", cache.Len())
+	}
+}
+
+func TestProxyHandler_CacheHits(t *testing.T) {
+	var hits atomic.Int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(usageStream))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 10)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.Cache = gateway.NewMemoryResponseCache(time.Hour)
+	proxyHandler.CacheHits = true
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+	deterministic := `{"model": "gpt-4o", "stream": true, "temperature": 0, "messages": [{"role": "user", "content": "Hi"}]}`
+	sampled := `{"model": "gpt-4o", "stream": true, "temperature": 0.7, "messages": [{"role": "user", "content": "Hi"}]}`
+
+	// The first request misses and is billed in full
+	if rr := send(deterministic); rr.Header().Get(gateway.CacheHeader) != "" {
+		t.Fatalf("expected a miss on the first request, got %q", rr.Header().Get(gateway.CacheHeader))
+	}
+	if record := <-usageChan; record.CostMicroDollars == 0 {
+		t.Errorf("expected the miss to be billed, got %+v", record)
+	}
+
+	// The repeat is replayed from the cache, free by default
+	rr := send(deterministic)
+	if rr.Code != http.StatusOK || rr.Header().Get(gateway.CacheHeader) != "hit" {
+		t.Fatalf("expected a cache hit, got %d (cache=%q)", rr.Code, rr.Header().Get(gateway.CacheHeader))
+	}
+	if rr.Body.String() != usageStream || rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("expected the cached stream to be replayed, got %q", rr.Body.String())
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected the hit not to reach the upstream, got %d upstream requests", hits.Load())
+	}
+	if len(usageChan) != 0 {
+		t.Errorf("expected a free hit not to be billed, got %+v", <-usageChan)
+	}
+
+	// Hits can be billed at a discount of the original cost
+	proxyHandler.CacheHitCostRatio = 0.5
+	send(deterministic)
+	select {
+	case record := <-usageChan:
+		// 18 tokens at gpt-4o list price is 105 micro-dollars, halved and rounded up
+		if record.TokenCount != 18 || record.CostMicroDollars != 53 {
+			t.Errorf("expected half the original cost for 18 tokens, got %+v", record)
+		}
+	default:
+		t.Fatal("expected the discounted hit to be billed")
+	}
+
+	// Sampled requests always go upstream
+	if rr := send(sampled); rr.Header().Get(gateway.CacheHeader) != "" || hits.Load() != 2 {
+		t.Errorf("expected a sampled request to skip the cache, got %d upstream requests", hits.Load())
+	}
+}
+
+func TestProxyHandler_CacheHitsScopedPerKey(t *testing.T) {
+	var hits atomic.Int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(usageStream))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, make(chan gateway.UsageRecord, 10))
+	proxyHandler.Cache = gateway.NewMemoryResponseCache(time.Hour)
+	proxyHandler.CacheHits = true
+
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		body := `{"model": "gpt-4o", "stream": true, "temperature": 0, "messages": [{"role": "user", "content": "Hi"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	send("tenant-a")
+	// Another tenant's identical prompt neither hits nor learns it was sent
+	if rr := send("tenant-b"); rr.Header().Get(gateway.CacheHeader) != "" || hits.Load() != 2 {
+		t.Errorf("expected another key to miss, got cache=%q after %d upstream requests", rr.Header().Get(gateway.CacheHeader), hits.Load())
+	}
+	if rr := send("tenant-a"); rr.Header().Get(gateway.CacheHeader) != "hit" {
+		t.Errorf("expected the same key to hit its own entry")
+	}
+
+	// Sharing across keys is an explicit opt-in
+	proxyHandler.SharedCache = true
+	send("tenant-a")
+	if rr := send("tenant-c"); rr.Header().Get(gateway.CacheHeader) != "hit" {
+		t.Errorf("expected a shared cache to serve any key")
+	}
+}
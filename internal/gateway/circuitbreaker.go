@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -13,14 +15,24 @@ const (
 	// $10.00 * 1,000,000 = 10,000,000 micro-dollars
 	MaxUsageMicroDollars = 10000000
 
-	// Assuming a flat rate heuristic for calculation: $0.002 per 1000 tokens (gpt-3.5-turbo equivalent)
-	// 1 token = 0.000002 dollars = 2 micro-dollars
+	// Flat fallback rate for models missing from the PricingTable: $0.002 per 1000 tokens
+	// (gpt-3.5-turbo equivalent). 1 token = 0.000002 dollars = 2 micro-dollars
 	CostPerTokenMicroDollars = 2
 )
 
 // RedisCircuitBreaker implements the CircuitBreaker interface using Redis.
+// Per-key limits are read from `apikey:<key>:limit` unless Limits is set.
 type RedisCircuitBreaker struct {
 	client *redis.Client
+
+	// Limits overrides the limits stored in Redis.
+	Limits LimitProvider
+
+	// Window expires usage keys at each window boundary, so a missing key
+	// reads as a fresh budget.
+	Window UsageWindow
+	// Now is the clock used for windows, time.Now when nil.
+	Now func() time.Time
 }
 
 func NewRedisCircuitBreaker(client *redis.Client) *RedisCircuitBreaker {
@@ -33,31 +45,144 @@ func (r *RedisCircuitBreaker) getUsageKey(apiKey string) string {
 	return fmt.Sprintf("apikey:%s:usage", apiKey)
 }
 
-// CheckLimit verifies if the given API key has exceeded the $10.00 limit.
-// Checks are extremely fast O(1) string lookups in Redis.
+func (r *RedisCircuitBreaker) getTokensKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:tokens", apiKey)
+}
+
+func (r *RedisCircuitBreaker) getLimitKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:limit", apiKey)
+}
+
+// CheckLimit verifies if the given API key has exceeded its limit.
+// Checks are extremely fast O(1) string lookups in Redis, reading the usage
+// and the stored limit in a single round trip.
 func (r *RedisCircuitBreaker) CheckLimit(apiKey string) (bool, error) {
 	ctx := context.Background()
-	val, err := r.client.Get(ctx, r.getUsageKey(apiKey)).Result()
-	if err == redis.Nil {
+	if r.Limits != nil {
+		usage, err := r.GetUsage(apiKey)
+		if err != nil {
+			return false, err
+		}
+		limit, err := r.Limits.GetLimit(apiKey)
+		if err != nil {
+			return false, err
+		}
+		return withinLimit(usage, limit), nil
+	}
+
+	vals, err := r.client.MGet(ctx, r.getUsageKey(apiKey), r.getLimitKey(apiKey)).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis mget error: %w", err)
+	}
+	if vals[0] == nil {
 		// Key does not exist, usage is 0, allow request
 		return true, nil
-	} else if err != nil {
-		return false, fmt.Errorf("redis get error: %w", err)
 	}
 
-	usage, err := strconv.ParseInt(val, 10, 64)
+	usage, err := strconv.ParseInt(vals[0].(string), 10, 64)
 	if err != nil {
 		return false, fmt.Errorf("invalid usage value in redis: %w", err)
 	}
+	limit, err := parseLimit(vals[1])
+	if err != nil {
+		return false, err
+	}
 
-	return usage < MaxUsageMicroDollars, nil
+	return withinLimit(usage, limit), nil
 }
 
-// AddUsage asynchronously increments the usage cost for the API key.
-func (r *RedisCircuitBreaker) AddUsage(apiKey string, tokenCount int) error {
-	cost := int64(tokenCount) * CostPerTokenMicroDollars
-	ctx := context.Background()
-	return r.client.IncrBy(ctx, r.getUsageKey(apiKey), cost).Err()
+// GetLimit implements LimitProvider, reading the key's stored limit or
+// MaxUsageMicroDollars when it has none.
+func (r *RedisCircuitBreaker) GetLimit(apiKey string) (int64, error) {
+	if r.Limits != nil {
+		return r.Limits.GetLimit(apiKey)
+	}
+	val, err := r.client.Get(context.Background(), r.getLimitKey(apiKey)).Result()
+	if err == redis.Nil {
+		return MaxUsageMicroDollars, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("redis get error: %w", err)
+	}
+	return parseLimit(val)
+}
+
+// SetLimit stores the key's limit in micro-dollars; UnlimitedUsage removes the cap.
+func (r *RedisCircuitBreaker) SetLimit(apiKey string, limit int64) error {
+	return r.client.Set(context.Background(), r.getLimitKey(apiKey), limit, 0).Err()
+}
+
+// parseLimit reads a stored limit, defaulting to MaxUsageMicroDollars when unset.
+func parseLimit(val interface{}) (int64, error) {
+	s, ok := val.(string)
+	if !ok {
+		return MaxUsageMicroDollars, nil
+	}
+	limit, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid limit value in redis: %w", err)
+	}
+	return limit, nil
+}
+
+// Ping checks the Redis connection.
+func (r *RedisCircuitBreaker) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisCircuitBreaker) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// ResetsAt implements UsageResetter.
+func (r *RedisCircuitBreaker) ResetsAt() time.Time {
+	return r.Window.ResetsAt(r.now())
+}
+
+// addUsageScript adds ARGV[1] to the usage key KEYS[1], clamping it at zero.
+// A nonzero ARGV[2] is the Unix time at which the usage key expires. The
+// change is also counted in the day's key KEYS[2], kept for ARGV[3] seconds.
+var addUsageScript = redis.NewScript(`
+local usage = redis.call('INCRBY', KEYS[1], ARGV[1])
+if usage < 0 then
+	redis.call('SET', KEYS[1], 0, 'KEEPTTL')
+end
+if ARGV[2] ~= '0' then
+	redis.call('EXPIREAT', KEYS[1], ARGV[2])
+end
+redis.call('INCRBY', KEYS[2], ARGV[1])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+// AddUsage asynchronously increments the usage cost (in micro-dollars) for the
+// API key, and the key's usage for the day. Usage never goes below zero: a
+// refund or settlement of a reservation made before a SetUsage would
+// otherwise leave the key with free budget.
+func (r *RedisCircuitBreaker) AddUsage(apiKey string, costMicroDollars int64) error {
+	// Expire with the window so the next one starts from zero
+	var expireAt int64
+	if resetsAt := r.ResetsAt(); !resetsAt.IsZero() {
+		expireAt = resetsAt.Unix()
+	}
+	keys := []string{r.getUsageKey(apiKey), r.getHistoryKey(apiKey, dayOf(r.now()))}
+	if err := addUsageScript.Run(context.Background(), r.client, keys, costMicroDollars, expireAt,
+		int64(historyTTL.Seconds())).Err(); err != nil {
+		return fmt.Errorf("redis add usage error: %w", err)
+	}
+	return nil
+}
+
+// SetUsage overwrites the usage cost tracked for an API key, keeping the
+// expiry of the current window.
+func (r *RedisCircuitBreaker) SetUsage(apiKey string, costMicroDollars int64) error {
+	var ttl time.Duration
+	if resetsAt := r.ResetsAt(); !resetsAt.IsZero() {
+		ttl = time.Until(resetsAt)
+	}
+	return r.client.Set(context.Background(), r.getUsageKey(apiKey), costMicroDollars, ttl).Err()
 }
 
 // GetUsage retrieves the total usage cost tracked for an API key.
@@ -78,3 +203,97 @@ func (r *RedisCircuitBreaker) GetUsage(apiKey string) (int64, error) {
 
 	return usage, nil
 }
+
+// AddTokens implements TokenRecorder.
+func (r *RedisCircuitBreaker) AddTokens(apiKey string, tokens int64) error {
+	ctx := context.Background()
+	return r.client.IncrBy(ctx, r.getTokensKey(apiKey), tokens).Err()
+}
+
+// ListUsage implements UsageLister. It SCANs the whole keyspace for usage keys,
+// which costs O(total keys) and should not be called per request.
+func (r *RedisCircuitBreaker) ListUsage() ([]KeyUsage, error) {
+	ctx := context.Background()
+	var result []KeyUsage
+	iter := r.client.Scan(ctx, 0, "apikey:*:usage", 1000).Iterator()
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		keys := make([]string, 0, 3*len(batch))
+		for _, apiKey := range batch {
+			keys = append(keys, r.getUsageKey(apiKey), r.getTokensKey(apiKey), r.getLimitKey(apiKey))
+		}
+		vals, err := r.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return fmt.Errorf("redis mget error: %w", err)
+		}
+		for i, apiKey := range batch {
+			usage := KeyUsage{
+				APIKey:           apiKey,
+				CostMicroDollars: parseRedisInt(vals[3*i]),
+				Tokens:           parseRedisInt(vals[3*i+1]),
+			}
+			if r.Limits != nil {
+				usage.LimitMicroDollars, _ = r.Limits.GetLimit(apiKey)
+			} else {
+				usage.LimitMicroDollars, _ = parseLimit(vals[3*i+2])
+			}
+			result = append(result, usage)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for iter.Next(ctx) {
+		key := iter.Val()
+		batch = append(batch, strings.TrimSuffix(strings.TrimPrefix(key, "apikey:"), ":usage"))
+		if len(batch) == 500 {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis scan error: %w", err)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ImportUsage implements UsageImporter, incrementing usage and token counts in
+// pipelined batches of 500 keys.
+func (r *RedisCircuitBreaker) ImportUsage(usages []KeyUsage) error {
+	ctx := context.Background()
+	resetsAt := r.ResetsAt()
+	for start := 0; start < len(usages); start += 500 {
+		end := min(start+500, len(usages))
+		pipe := r.client.Pipeline()
+		for _, u := range usages[start:end] {
+			pipe.IncrBy(ctx, r.getUsageKey(u.APIKey), u.CostMicroDollars)
+			if !resetsAt.IsZero() {
+				pipe.ExpireAt(ctx, r.getUsageKey(u.APIKey), resetsAt)
+			}
+			if u.Tokens != 0 {
+				pipe.IncrBy(ctx, r.getTokensKey(u.APIKey), u.Tokens)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("redis import error: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseRedisInt reads an MGET value, treating missing or malformed values as zero.
+func parseRedisInt(val interface{}) int64 {
+	s, ok := val.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
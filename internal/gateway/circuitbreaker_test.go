@@ -41,7 +41,7 @@ func TestRedisCircuitBreaker(t *testing.T) {
 	}
 
 	// 2. Add Usage
-	err = cb.AddUsage(apiKey, 500)
+	err = cb.AddUsage(apiKey, 500*gateway.CostPerTokenMicroDollars)
 	if err != nil {
 		t.Fatalf("unexpected error on AddUsage: %v", err)
 	}
@@ -54,4 +54,187 @@ func TestRedisCircuitBreaker(t *testing.T) {
 	if usage != expectedCost {
 		t.Errorf("expected usage %d, got %d", expectedCost, usage)
 	}
+
+	// A refund larger than the usage, as after a reset, stops at zero
+	cb.SetUsage(apiKey, 0)
+	cb.AddUsage(apiKey, -expectedCost)
+	if usage, _ := cb.GetUsage(apiKey); usage != 0 {
+		t.Errorf("expected usage clamped at 0, got %d", usage)
+	}
+}
+
+func TestRedisCircuitBreaker_ListUsage(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	cb := gateway.NewRedisCircuitBreaker(client)
+	apiKey := "test-redis-list-key"
+	client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":tokens")
+	defer client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":tokens")
+
+	cb.AddUsage(apiKey, 3000)
+	cb.AddTokens(apiKey, 1500)
+
+	usages, err := cb.ListUsage()
+	if err != nil {
+		t.Fatalf("unexpected error on ListUsage: %v", err)
+	}
+	for _, u := range usages {
+		if u.APIKey == apiKey {
+			if u.CostMicroDollars != 3000 || u.Tokens != 1500 {
+				t.Errorf("expected 3000 micro-dollars and 1500 tokens, got %+v", u)
+			}
+			return
+		}
+	}
+	t.Errorf("expected %s to be listed, got %+v", apiKey, usages)
+}
+
+func TestRedisCircuitBreaker_ImportUsage(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	cb := gateway.NewRedisCircuitBreaker(client)
+	apiKey := "test-redis-import-key"
+	client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":tokens")
+	defer client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":tokens")
+
+	cb.AddUsage(apiKey, 1000)
+	if err := cb.ImportUsage([]gateway.KeyUsage{{APIKey: apiKey, CostMicroDollars: 4000, Tokens: 2000}}); err != nil {
+		t.Fatalf("unexpected error on ImportUsage: %v", err)
+	}
+
+	usage, _ := cb.GetUsage(apiKey)
+	if usage != 5000 {
+		t.Errorf("expected imported usage to be added to the existing 1000, got %d", usage)
+	}
+	if tokens, _ := client.Get(ctx, "apikey:"+apiKey+":tokens").Int64(); tokens != 2000 {
+		t.Errorf("expected 2000 imported tokens, got %d", tokens)
+	}
+}
+
+func TestRedisCircuitBreaker_PerKeyLimit(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	cb := gateway.NewRedisCircuitBreaker(client)
+	apiKey := "test-redis-limit-key"
+	client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":limit")
+	defer client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":limit")
+
+	cb.AddUsage(apiKey, 7000000)
+	if allowed, _ := cb.CheckLimit(apiKey); !allowed {
+		t.Error("expected $7 of usage to be under the default limit")
+	}
+
+	// A $5 limit below the current usage cuts the key off
+	if err := cb.SetLimit(apiKey, 5000000); err != nil {
+		t.Fatalf("unexpected error on SetLimit: %v", err)
+	}
+	if allowed, err := cb.CheckLimit(apiKey); err != nil || allowed {
+		t.Errorf("expected the key to be denied under a $5 limit, got allowed=%v err=%v", allowed, err)
+	}
+
+	// A $100 limit above it lets the key through again
+	cb.SetLimit(apiKey, 100000000)
+	if allowed, _ := cb.CheckLimit(apiKey); !allowed {
+		t.Error("expected the key to be allowed under a $100 limit")
+	}
+	if limit, err := cb.GetLimit(apiKey); err != nil || limit != 100000000 {
+		t.Errorf("expected the stored limit to be read back, got %d (err=%v)", limit, err)
+	}
+}
+
+func TestRedisCircuitBreaker_UsageWindow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	cb := gateway.NewRedisCircuitBreaker(client)
+	cb.Window = gateway.WindowDaily
+	apiKey := "test-redis-window-key"
+	client.Del(ctx, "apikey:"+apiKey+":usage")
+	defer client.Del(ctx, "apikey:"+apiKey+":usage")
+
+	// The usage key expires at the next UTC midnight
+	cb.AddUsage(apiKey, gateway.MaxUsageMicroDollars)
+	ttl := client.TTL(ctx, "apikey:"+apiKey+":usage").Val()
+	if want := time.Until(cb.ResetsAt()); ttl <= 0 || ttl > want+time.Second || ttl < want-5*time.Second {
+		t.Errorf("expected the usage key to expire in about %v, got %v", want, ttl)
+	}
+	if allowed, _ := cb.CheckLimit(apiKey); allowed {
+		t.Error("expected the key to be over its budget")
+	}
+
+	// A charge from a window that has already ended expires the key at once,
+	// as Redis would have at the boundary
+	cb.Now = func() time.Time { return time.Now().AddDate(0, 0, -2) }
+	cb.AddUsage(apiKey, 100)
+	if usage, err := cb.GetUsage(apiKey); err != nil || usage != 0 {
+		t.Errorf("expected an expired usage key to read as 0, got %d (err=%v)", usage, err)
+	}
+	if allowed, _ := cb.CheckLimit(apiKey); !allowed {
+		t.Error("expected an expired usage key to refill the budget")
+	}
+}
+
+func TestRedisCircuitBreaker_SetUsage(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	cb := gateway.NewRedisCircuitBreaker(client)
+	apiKey := "test-redis-set-key"
+	client.Del(ctx, "apikey:"+apiKey+":usage")
+	defer client.Del(ctx, "apikey:"+apiKey+":usage")
+
+	cb.AddUsage(apiKey, gateway.MaxUsageMicroDollars)
+	if err := cb.SetUsage(apiKey, 0); err != nil {
+		t.Fatalf("unexpected error on SetUsage: %v", err)
+	}
+	if allowed, _ := cb.CheckLimit(apiKey); !allowed {
+		t.Error("expected the key to be allowed after a reset")
+	}
+	cb.SetUsage(apiKey, 4200)
+	if usage, _ := cb.GetUsage(apiKey); usage != 4200 {
+		t.Errorf("expected usage set to 4200, got %d", usage)
+	}
 }
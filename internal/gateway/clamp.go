@@ -0,0 +1,44 @@
+package gateway
+
+// CompletionTokenClamp caps how many tokens a single request may generate, so
+// one runaway completion can't spend a key's whole budget. Requests asking
+// for more are rewritten down to the ceiling, and requests that don't say are
+// given it.
+type CompletionTokenClamp struct {
+	// Default is the ceiling for every tier without its own. Zero doesn't clamp.
+	Default int
+	// Tiers overrides the ceiling per key tier; zero exempts the tier.
+	Tiers map[string]int
+}
+
+// For returns the ceiling for the tier, zero when it isn't clamped.
+func (c *CompletionTokenClamp) For(tier string) int {
+	if c == nil {
+		return 0
+	}
+	if limit, ok := c.Tiers[tier]; ok {
+		return limit
+	}
+	return c.Default
+}
+
+// Apply caps the payload's completion tokens at limit. Clients asking with
+// max_completion_tokens are clamped on that field, since models that take it
+// may reject max_tokens; otherwise max_tokens is clamped or added. It returns
+// the field it set and what was requested, zero if nothing was, or "" when
+// the request was already within the limit.
+func (c *CompletionTokenClamp) Apply(payload map[string]interface{}, limit int) (field string, requested int64) {
+	if limit <= 0 {
+		return "", 0
+	}
+	field = "max_tokens"
+	if _, ok := payload["max_completion_tokens"]; ok {
+		field = "max_completion_tokens"
+	}
+	requested, ok := PayloadInt(payload, field)
+	if ok && requested > 0 && requested <= int64(limit) {
+		return "", requested
+	}
+	payload[field] = limit
+	return field, requested
+}
@@ -0,0 +1,69 @@
+package gateway_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestProxyHandler_MaxCompletionTokens(t *testing.T) {
+	var forwarded string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, completionJSON)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.MaxCompletionTokens = &gateway.CompletionTokenClamp{Default: 1000, Tiers: map[string]int{"premium": 0}}
+	proxyHandler.TierResolver = func(apiKey string) string {
+		if apiKey == "premium-key" {
+			return "premium"
+		}
+		return gateway.DefaultTier
+	}
+
+	send := func(apiKey, body string) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	// Within the ceiling, the body is forwarded untouched
+	below := `{"model": "gpt-4o", "max_tokens": 500}`
+	send("test-key", below)
+	if forwarded != below {
+		t.Errorf("expected a request below the clamp to be left untouched, got %s", forwarded)
+	}
+
+	tests := []struct {
+		name, apiKey, body, want, unwanted string
+	}{
+		{"above", "test-key", `{"model": "gpt-4o", "max_tokens": 100000}`, `"max_tokens":1000`, ""},
+		{"absent", "test-key", `{"model": "gpt-4o"}`, `"max_tokens":1000`, ""},
+		// Models taking max_completion_tokens may reject max_tokens, so it isn't added
+		{"max_completion_tokens", "test-key", `{"model": "o3", "max_completion_tokens": 5000}`, `"max_completion_tokens":1000`, `"max_tokens"`},
+		{"exempt tier", "premium-key", `{"model": "gpt-4o", "max_tokens": 100000}`, `"max_tokens": 100000`, ""},
+	}
+	for _, tt := range tests {
+		send(tt.apiKey, tt.body)
+		if !strings.Contains(forwarded, tt.want) {
+			t.Errorf("%s: expected %s upstream, got %s", tt.name, tt.want, forwarded)
+		}
+		if tt.unwanted != "" && strings.Contains(forwarded, tt.unwanted) {
+			t.Errorf("%s: expected no %s upstream, got %s", tt.name, tt.unwanted, forwarded)
+		}
+	}
+}
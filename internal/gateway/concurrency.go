@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/observability"
+	"github.com/redis/go-redis/v9"
+)
+
+// ConcurrencyLimiter caps how many requests each key may have in flight at
+// once, so one key's streams can't starve the others.
+type ConcurrencyLimiter interface {
+	// Acquire takes one of the key's slots, reporting false when all are in use.
+	Acquire(apiKey string) (bool, error)
+	// Release returns a slot taken by Acquire.
+	Release(apiKey string)
+}
+
+// ConcurrencyLimits holds the concurrent request limit for each key. Zero means unlimited.
+type ConcurrencyLimits struct {
+	Default int
+	Keys    map[string]int
+}
+
+// For returns the concurrency limit for the key.
+func (l *ConcurrencyLimits) For(apiKey string) int {
+	if l == nil {
+		return 0
+	}
+	if limit, ok := l.Keys[apiKey]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// MemoryConcurrencyLimiter implements ConcurrencyLimiter with a counter per key in process memory.
+type MemoryConcurrencyLimiter struct {
+	Limits *ConcurrencyLimits
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func NewMemoryConcurrencyLimiter(limits *ConcurrencyLimits) *MemoryConcurrencyLimiter {
+	return &MemoryConcurrencyLimiter{
+		Limits:   limits,
+		inFlight: make(map[string]int),
+	}
+}
+
+// Acquire implements ConcurrencyLimiter.
+func (m *MemoryConcurrencyLimiter) Acquire(apiKey string) (bool, error) {
+	limit := m.Limits.For(apiKey)
+	if limit <= 0 {
+		return true, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.inFlight[apiKey] >= limit {
+		return false, nil
+	}
+	m.inFlight[apiKey]++
+	return true, nil
+}
+
+// Release implements ConcurrencyLimiter.
+func (m *MemoryConcurrencyLimiter) Release(apiKey string) {
+	if m.Limits.For(apiKey) <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Counters are dropped at zero so idle keys don't accumulate
+	if m.inFlight[apiKey] <= 1 {
+		delete(m.inFlight, apiKey)
+		return
+	}
+	m.inFlight[apiKey]--
+}
+
+// concurrencyTTL expires a key's Redis counter once no request has been
+// admitted for this long, so slots held by a replica that died mid-stream
+// aren't lost for good.
+const concurrencyTTL = 10 * time.Minute
+
+// acquireSlotScript takes a slot if fewer than the limit are in use.
+var acquireSlotScript = redis.NewScript(`
+local inflight = redis.call('INCR', KEYS[1])
+if inflight > tonumber(ARGV[1]) then
+	redis.call('DECR', KEYS[1])
+	return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// releaseSlotScript returns a slot, never below zero in case the counter expired meanwhile.
+var releaseSlotScript = redis.NewScript(`
+local inflight = tonumber(redis.call('GET', KEYS[1]) or '0')
+if inflight > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// RedisConcurrencyLimiter implements ConcurrencyLimiter with a counter per key
+// in Redis, shared by every replica.
+type RedisConcurrencyLimiter struct {
+	client *redis.Client
+	Limits *ConcurrencyLimits
+}
+
+func NewRedisConcurrencyLimiter(client *redis.Client, limits *ConcurrencyLimits) *RedisConcurrencyLimiter {
+	return &RedisConcurrencyLimiter{
+		client: client,
+		Limits: limits,
+	}
+}
+
+func (r *RedisConcurrencyLimiter) getConcurrencyKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:concurrent", apiKey)
+}
+
+// Acquire implements ConcurrencyLimiter in a single round trip.
+func (r *RedisConcurrencyLimiter) Acquire(apiKey string) (bool, error) {
+	limit := r.Limits.For(apiKey)
+	if limit <= 0 {
+		return true, nil
+	}
+	acquired, err := acquireSlotScript.Run(context.Background(), r.client, []string{r.getConcurrencyKey(apiKey)},
+		limit, concurrencyTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis concurrency acquire error: %w", err)
+	}
+	return acquired == 1, nil
+}
+
+// Release implements ConcurrencyLimiter. A failed release leaves the slot
+// taken until the counter expires.
+func (r *RedisConcurrencyLimiter) Release(apiKey string) {
+	if r.Limits.For(apiKey) <= 0 {
+		return
+	}
+	if err := releaseSlotScript.Run(context.Background(), r.client, []string{r.getConcurrencyKey(apiKey)}).Err(); err != nil {
+		slog.Error("Failed to release concurrency slot", observability.APIKeyAttr(apiKey), "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+func testConcurrencyLimiter(t *testing.T, limiter gateway.ConcurrencyLimiter, apiKey string) {
+	for i := 0; i < 2; i++ {
+		acquired, err := limiter.Acquire(apiKey)
+		if err != nil {
+			t.Fatalf("unexpected error on Acquire: %v", err)
+		}
+		if !acquired {
+			t.Fatalf("expected request %d within the limit to be admitted", i+1)
+		}
+	}
+	if acquired, _ := limiter.Acquire(apiKey); acquired {
+		t.Fatal("expected the request over the limit to be denied")
+	}
+
+	// A released slot can be taken again
+	limiter.Release(apiKey)
+	if acquired, _ := limiter.Acquire(apiKey); !acquired {
+		t.Error("expected the released slot to be available")
+	}
+	limiter.Release(apiKey)
+	limiter.Release(apiKey)
+
+	// Keys without a limit are never capped
+	for i := 0; i < 5; i++ {
+		if acquired, _ := limiter.Acquire(apiKey + "-unlimited"); !acquired {
+			t.Fatal("expected an unlimited key to be admitted")
+		}
+	}
+}
+
+func concurrencyLimits(apiKey string) *gateway.ConcurrencyLimits {
+	return &gateway.ConcurrencyLimits{Keys: map[string]int{apiKey: 2}}
+}
+
+func TestMemoryConcurrencyLimiter(t *testing.T) {
+	testConcurrencyLimiter(t, gateway.NewMemoryConcurrencyLimiter(concurrencyLimits("test-key")), "test-key")
+}
+
+// TestRedisConcurrencyLimiter requires a running Redis/Valkey instance on localhost:6379 to pass.
+func TestRedisConcurrencyLimiter(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	apiKey := "test-redis-concurrency-key"
+	client.Del(ctx, "apikey:"+apiKey+":concurrent")
+	defer client.Del(ctx, "apikey:"+apiKey+":concurrent")
+
+	testConcurrencyLimiter(t, gateway.NewRedisConcurrencyLimiter(client, concurrencyLimits(apiKey)), apiKey)
+
+	// Releasing more than was acquired never frees slots in advance
+	limiter := gateway.NewRedisConcurrencyLimiter(client, concurrencyLimits(apiKey))
+	limiter.Release(apiKey)
+	limiter.Release(apiKey)
+	if n, _ := client.Get(ctx, "apikey:"+apiKey+":concurrent").Int(); n != 0 {
+		t.Errorf("expected the counter to stop at zero, got %d", n)
+	}
+}
+
+func TestProxyHandler_ConcurrencyLimit(t *testing.T) {
+	// Streams stay open until the test lets them finish
+	started := make(chan struct{}, 10)
+	finish := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[]}\n\n"))
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-finish
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Concurrency = gateway.NewMemoryConcurrencyLimiter(&gateway.ConcurrencyLimits{Default: 2})
+
+	send := func(apiKey string) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- send("test-key")
+		}()
+	}
+	<-started
+	<-started
+
+	// Both slots are held by open streams
+	for i := 0; i < 3; i++ {
+		if code := send("test-key"); code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 over the concurrency limit, got %d", code)
+		}
+	}
+	// Other keys have slots of their own
+	otherDone := make(chan int, 1)
+	go func() { otherDone <- send("other-key") }()
+	<-started
+
+	close(finish)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expected the streams within the limit to succeed, got %d", code)
+		}
+	}
+	if code := <-otherDone; code != http.StatusOK {
+		t.Errorf("expected another key to be admitted, got %d", code)
+	}
+
+	// Finished streams release their slots, including streams the upstream failed
+	if code := send("test-key"); code != http.StatusOK {
+		t.Errorf("expected a slot to be free once the streams ended, got %d", code)
+	}
+	upstreamServer.Close()
+	for i := 0; i < 3; i++ {
+		if code := send("test-key"); code == http.StatusTooManyRequests {
+			t.Fatal("expected failed requests to release their slots")
+		}
+	}
+}
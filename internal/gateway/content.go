@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// contentBuffer accumulates the streamed delta content of a completion. An
+// upstream may split a character across chunks, either as raw UTF-8 bytes or
+// as a \u-escaped surrogate pair, and decoding each chunk on its own would
+// turn both halves into U+FFFD. The buffer unescapes the raw JSON strings
+// itself and joins the pieces, so the reconstructed text is only checked once
+// it's complete.
+type contentBuffer struct {
+	buf []byte
+	// highSurrogate is the first half of a surrogate pair awaiting its second half.
+	highSurrogate rune
+}
+
+// Append adds the content of a raw JSON string. Anything else, such as a null
+// content in a tool-call chunk, is ignored.
+func (c *contentBuffer) Append(raw json.RawMessage) {
+	if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' {
+		return
+	}
+	s := raw[1 : len(raw)-1]
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			c.appendByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'b':
+			c.appendByte('\b')
+		case 'f':
+			c.appendByte('\f')
+		case 'n':
+			c.appendByte('\n')
+		case 'r':
+			c.appendByte('\r')
+		case 't':
+			c.appendByte('\t')
+		case 'u':
+			if i+4 >= len(s) {
+				c.appendRune(utf8.RuneError)
+				i = len(s)
+				continue
+			}
+			code, err := strconv.ParseUint(string(s[i+1:i+5]), 16, 16)
+			i += 4
+			if err != nil {
+				c.appendRune(utf8.RuneError)
+				continue
+			}
+			c.appendRune(rune(code))
+		default:
+			// \" \\ \/
+			c.appendByte(s[i])
+		}
+	}
+}
+
+func (c *contentBuffer) appendByte(b byte) {
+	c.flushSurrogate()
+	c.buf = append(c.buf, b)
+}
+
+func (c *contentBuffer) appendRune(r rune) {
+	switch {
+	case r >= 0xD800 && r < 0xDC00:
+		c.flushSurrogate()
+		c.highSurrogate = r
+	case utf16.IsSurrogate(r) && c.highSurrogate != 0:
+		c.buf = utf8.AppendRune(c.buf, utf16.DecodeRune(c.highSurrogate, r))
+		c.highSurrogate = 0
+	default:
+		c.flushSurrogate()
+		c.buf = utf8.AppendRune(c.buf, r)
+	}
+}
+
+// flushSurrogate replaces a high surrogate that wasn't followed by its pair.
+func (c *contentBuffer) flushSurrogate() {
+	if c.highSurrogate != 0 {
+		c.buf = utf8.AppendRune(c.buf, utf8.RuneError)
+		c.highSurrogate = 0
+	}
+}
+
+// String returns the content so far. Bytes that still don't form valid UTF-8,
+// such as a character the stream was cut off in the middle of, become U+FFFD.
+func (c *contentBuffer) String() string {
+	s := string(c.buf)
+	if c.highSurrogate != 0 {
+		s += string(utf8.RuneError)
+	}
+	return strings.ToValidUTF8(s, string(utf8.RuneError))
+}
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+
+	"aura-ai-gateway/internal/observability"
+	"github.com/redis/go-redis/v9"
+)
+
+// DeadLetterKey is the Redis list holding usage records the processor couldn't take.
+const DeadLetterKey = "usage:deadletter"
+
+// DeadLetterSink persists usage records that couldn't be queued for billing,
+// so they can be charged later instead of lost.
+type DeadLetterSink interface {
+	Put(record UsageRecord) error
+	// Drain removes and returns every persisted record.
+	Drain() ([]UsageRecord, error)
+}
+
+// FileDeadLetter appends records to a file as JSON lines.
+type FileDeadLetter struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Put implements DeadLetterSink.
+func (f *FileDeadLetter) Put(record UsageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Drain implements DeadLetterSink, truncating the file once it's read.
+// Malformed lines are logged and skipped.
+func (f *FileDeadLetter) Drain() ([]UsageRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.Open(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []UsageRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			slog.Error("Skipping malformed dead-letter record", "path", f.Path, "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, os.Truncate(f.Path, 0)
+}
+
+// RedisDeadLetter pushes records onto the DeadLetterKey list.
+type RedisDeadLetter struct {
+	client *redis.Client
+}
+
+func NewRedisDeadLetter(client *redis.Client) *RedisDeadLetter {
+	return &RedisDeadLetter{client: client}
+}
+
+// Put implements DeadLetterSink.
+func (r *RedisDeadLetter) Put(record UsageRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.client.RPush(context.Background(), DeadLetterKey, data).Err()
+}
+
+// Drain implements DeadLetterSink, reading and deleting the list atomically
+// so two gateways starting together don't both replay it.
+func (r *RedisDeadLetter) Drain() ([]UsageRecord, error) {
+	ctx := context.Background()
+	pipe := r.client.TxPipeline()
+	lrange := pipe.LRange(ctx, DeadLetterKey, 0, -1)
+	pipe.Del(ctx, DeadLetterKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("redis dead-letter drain error: %w", err)
+	}
+
+	var records []UsageRecord
+	for _, data := range lrange.Val() {
+		var record UsageRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			slog.Error("Skipping malformed dead-letter record", "key", DeadLetterKey, "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// DrainDeadLetter charges every record persisted in sink to cb, and counts its
+// tokens to tokens when set, as the usage processor would have, and returns how
+// many were replayed. tokens is passed separately because a wrapped cb, such as
+// a GracefulCircuitBreaker, no longer implements TokenRecorder itself. Records
+// that fail to apply are put back for the next drain.
+func DrainDeadLetter(sink DeadLetterSink, cb CircuitBreaker, tokens TokenRecorder) (int, error) {
+	records, err := sink.Drain()
+	if err != nil {
+		return 0, err
+	}
+	var replayed int
+	for _, record := range records {
+		if err := cb.AddUsage(record.APIKey, record.Charge(cb)); err != nil {
+			if putErr := sink.Put(record); putErr != nil {
+				slog.Error("Lost dead-letter usage record", "request_id", record.RequestID, observability.APIKeyAttr(record.APIKey), "error", putErr)
+			}
+			continue
+		}
+		if tokens != nil {
+			tokens.AddTokens(record.APIKey, int64(record.TokenCount))
+		}
+		replayed++
+	}
+	return replayed, nil
+}
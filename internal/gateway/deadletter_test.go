@@ -0,0 +1,82 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+// fillUsageChannel streams a response while usageChan has no room for its record.
+func fillUsageChannel(t *testing.T, sink gateway.DeadLetterSink) {
+	t.Helper()
+	usageChan := make(chan gateway.UsageRecord, 1)
+	usageChan <- gateway.UsageRecord{APIKey: "other-key", TokenCount: 1}
+
+	gateway.StreamResponse(httptest.NewRecorder(), newStreamResponse(usageStream), "test-key", usageChan, gateway.StreamOptions{
+		RequestID:  "req_1",
+		DeadLetter: sink,
+	})
+}
+
+func TestFileDeadLetter(t *testing.T) {
+	sink := &gateway.FileDeadLetter{Path: filepath.Join(t.TempDir(), "usage.jsonl")}
+	fillUsageChannel(t, sink)
+	fillUsageChannel(t, sink)
+
+	// The wrapper hides the store's TokenRecorder, so it's passed on its own
+	store := gateway.NewMemoryCircuitBreaker()
+	cb := gateway.NewGracefulCircuitBreaker(store)
+	replayed, err := gateway.DrainDeadLetter(sink, cb, store)
+	if err != nil || replayed != 2 {
+		t.Fatalf("expected both overflowing records to be replayed, got %d (err=%v)", replayed, err)
+	}
+	if usage, _ := cb.GetUsage("test-key"); usage != 2*18*gateway.CostPerTokenMicroDollars {
+		t.Errorf("expected the replayed records to be charged, got %d", usage)
+	}
+	usages, _ := store.ListUsage()
+	if len(usages) != 1 || usages[0].Tokens != 2*18 {
+		t.Errorf("expected the replayed records' tokens to be counted, got %+v", usages)
+	}
+
+	// The sink is empty once drained
+	if replayed, _ := gateway.DrainDeadLetter(sink, cb, store); replayed != 0 {
+		t.Errorf("expected a drained sink to replay nothing, got %d", replayed)
+	}
+}
+
+func TestRedisDeadLetter(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+	client.Del(ctx, gateway.DeadLetterKey)
+	defer client.Del(ctx, gateway.DeadLetterKey)
+
+	sink := gateway.NewRedisDeadLetter(client)
+	fillUsageChannel(t, sink)
+
+	entries := client.LRange(ctx, gateway.DeadLetterKey, 0, -1).Val()
+	if len(entries) != 1 || !strings.Contains(entries[0], `"RequestID":"req_1"`) {
+		t.Fatalf("expected the record on %s, got %v", gateway.DeadLetterKey, entries)
+	}
+
+	records, err := sink.Drain()
+	if err != nil || len(records) != 1 || records[0].TokenCount != 18 {
+		t.Errorf("expected the record to be drained intact, got %+v (err=%v)", records, err)
+	}
+	if n := client.LLen(ctx, gateway.DeadLetterKey).Val(); n != 0 {
+		t.Errorf("expected the list to be emptied, got %d entries", n)
+	}
+}
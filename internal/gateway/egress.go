@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// EgressLimiter smooths requests to the upstream with a token bucket: up to
+// burst requests go out at once, then dispatch is paced at the sustained rate.
+// Requests wait their turn for up to maxWait rather than bursting into the
+// provider's own rate limiter. A nil limiter never waits.
+type EgressLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // requests per second
+	burst   float64
+	maxWait time.Duration
+	tokens  float64
+	last    time.Time
+}
+
+// NewEgressLimiter creates a limiter dispatching ratePerSecond requests on
+// average, with bursts of up to burst requests.
+func NewEgressLimiter(ratePerSecond float64, burst int, maxWait time.Duration) *EgressLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	metrics.EgressRateLimit.Set(ratePerSecond)
+	return &EgressLimiter{
+		rate:    ratePerSecond,
+		burst:   float64(burst),
+		maxWait: maxWait,
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+// Wait blocks until the request may be dispatched. It reports false, without
+// waiting, if that would take longer than maxWait, or if ctx ends first.
+func (l *EgressLimiter) Wait(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	delay, ok := l.reserve(time.Now())
+	if !ok {
+		metrics.EgressRejections.Inc()
+		return false
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			l.cancel()
+			return false
+		}
+	}
+	metrics.EgressQueueWait.Observe(delay.Seconds())
+	return true
+}
+
+// reserve takes a token, possibly going into debt, and returns how long until
+// the debt is repaid. It takes nothing if that would exceed maxWait.
+func (l *EgressLimiter) reserve(now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0, true
+	}
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	if delay > l.maxWait {
+		l.tokens++
+		return 0, false
+	}
+	return delay, true
+}
+
+// cancel returns the token of a request that gave up waiting.
+func (l *EgressLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
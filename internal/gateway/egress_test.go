@@ -0,0 +1,54 @@
+package gateway_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestEgressLimiter_PacesAfterBurst(t *testing.T) {
+	limiter := gateway.NewEgressLimiter(20, 2, time.Second)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if !limiter.Wait(ctx) {
+			t.Fatalf("expected request %d within the burst to be dispatched", i)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("expected the burst to go out immediately, took %v", elapsed)
+	}
+
+	// The third request waits for a token at 20/s, about 50ms
+	start = time.Now()
+	if !limiter.Wait(ctx) {
+		t.Fatal("expected a request within maxWait to be dispatched")
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected the request past the burst to be paced, took %v", elapsed)
+	}
+}
+
+func TestEgressLimiter_RejectsLongWaits(t *testing.T) {
+	limiter := gateway.NewEgressLimiter(1, 1, 100*time.Millisecond)
+	ctx := context.Background()
+
+	if !limiter.Wait(ctx) {
+		t.Fatal("expected the first request to be dispatched")
+	}
+	start := time.Now()
+	if limiter.Wait(ctx) {
+		t.Error("expected a request that would wait about a second to be rejected")
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("expected the rejection to be immediate, took %v", elapsed)
+	}
+
+	var unlimited *gateway.EgressLimiter
+	if !unlimited.Wait(ctx) {
+		t.Error("expected a nil limiter to dispatch everything")
+	}
+}
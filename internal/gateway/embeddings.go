@@ -0,0 +1,197 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+)
+
+// EmbeddingsRoute is the path of the OpenAI embeddings endpoint.
+const EmbeddingsRoute = "/v1/embeddings"
+
+// EmbeddingsHandler forwards embeddings requests. Embeddings are never
+// streamed, so the body is sent exactly as the client wrote it, with none of
+// the stream injection completions get, and the usage is read from the JSON
+// response. Embedding models are priced by their prompt rate.
+//
+// Requests pass the completions handler's limits, admission, cost
+// reservation, upstream breaker and retries, and are billed with its pricing,
+// so embeddings can't spend a budget completions enforce.
+type EmbeddingsHandler struct {
+	Client         *http.Client
+	RequestHeaders *RequestHeaderPolicy
+	// MaxRequestBytes rejects larger request bodies with a 413. Zero or less is unlimited.
+	MaxRequestBytes int64
+
+	endpoint *url.URL
+	proxy    *ProxyHandler
+}
+
+// NewEmbeddingsHandler forwards embeddings requests to endpoint, e.g.
+// https://api.openai.com/v1/embeddings, sharing the completions handler's
+// circuit breaker, limits and usage channel. Its Drain waits for embeddings
+// requests too.
+func NewEmbeddingsHandler(endpoint *url.URL, proxy *ProxyHandler) *EmbeddingsHandler {
+	return &EmbeddingsHandler{
+		Client:          proxy.Client,
+		RequestHeaders:  proxy.RequestHeaders,
+		MaxRequestBytes: proxy.MaxRequestBytes,
+		endpoint:        endpoint,
+		proxy:           proxy,
+	}
+}
+
+// EmbeddingsEndpoint derives the embeddings endpoint from the API root.
+func EmbeddingsEndpoint(base *url.URL) *url.URL {
+	endpoint := *base
+	endpoint.Path = strings.TrimSuffix(base.Path, "/") + strings.TrimPrefix(EmbeddingsRoute, "/v1")
+	endpoint.RawPath = ""
+	return &endpoint
+}
+
+func (h *EmbeddingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	p := h.proxy
+	// Usage goes out on the completions channel, which mustn't close under us
+	p.inFlight.Add(1)
+	defer p.inFlight.Done()
+
+	apiKey := ExtractAPIKey(r)
+
+	if apiKey != "" && p.circuitBreaker != nil {
+		allowed, err := p.circuitBreaker.CheckLimit(apiKey)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
+			return
+		}
+		if !allowed {
+			p.writeLimitExceeded(w, apiKey)
+			return
+		}
+	}
+
+	done, ok := p.admit(w, r, apiKey, true)
+	if !ok {
+		return
+	}
+	defer done()
+
+	if h.MaxRequestBytes > 0 {
+		if r.ContentLength > h.MaxRequestBytes {
+			writeRequestTooLarge(w, h.MaxRequestBytes)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.MaxRequestBytes)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeRequestTooLarge(w, tooLarge.Limit)
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "request_read_failed", "Error reading request body")
+		return
+	}
+	defer r.Body.Close()
+
+	// The model is the fallback when the response doesn't name one, and the
+	// input is estimated for the reservations
+	var request struct {
+		Model string      `json:"model"`
+		Input interface{} `json:"input"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON payload")
+		return
+	}
+	tokenizer := p.Tokenizers.For(request.Model)
+	promptEstimate := estimateEmbeddingInput(tokenizer, request.Input)
+
+	reserved, ok := p.reserve(w, apiKey, request.Model, promptEstimate, true)
+	if !ok {
+		return
+	}
+
+	upstreamReq, err := http.NewRequestWithContext(r.Context(), r.Method, h.endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		p.release(reserved)
+		WriteError(w, http.StatusInternalServerError, "internal_error", "Error creating upstream request")
+		return
+	}
+	copyRequestHeaders(upstreamReq.Header, r.Header, h.RequestHeaders)
+	forwardAPIKey(upstreamReq, apiKey)
+
+	upstream := upstreamReq.URL.Host
+	if allowed, wait := p.Breaker.Allow(upstream); !allowed {
+		p.release(reserved)
+		metrics.ErrorRate.WithLabelValues("circuit_open").Inc()
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		WriteError(w, http.StatusServiceUnavailable, "circuit_open", "Service Unavailable: upstream circuit open")
+		return
+	}
+	if !p.Egress.Wait(r.Context()) {
+		p.Breaker.Cancel(upstream)
+		p.release(reserved)
+		metrics.ErrorRate.WithLabelValues("egress_limit").Inc()
+		WriteError(w, http.StatusServiceUnavailable, "egress_limit", "Service Unavailable: upstream request rate exceeded")
+		return
+	}
+
+	resp, err := p.Retry.do(h.Client, upstreamReq, p.Egress)
+	p.Breaker.observe(r.Context(), upstream, resp, err)
+	if err != nil {
+		p.release(reserved)
+		WriteError(w, http.StatusBadGateway, "upstream_error", "Bad Gateway")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		p.release(reserved)
+		forwardUpstreamError(w, resp)
+		return
+	}
+	record := forwardJSONResponse(w, resp, apiKey, p.usageChan, StreamOptions{
+		RequestID:            r.Header.Get(observability.RequestIDHeader),
+		Model:                request.Model,
+		Pricing:              p.Pricing,
+		CostMultiplier:       p.Multipliers.For(apiKey),
+		Start:                start,
+		Tokenizer:            tokenizer,
+		PromptTokens:         promptEstimate,
+		ReservedMicroDollars: reserved.cost,
+		ReservationResetsAt:  reserved.resetsAt,
+		DeadLetter:           p.DeadLetter,
+	})
+	p.settle(reserved, record)
+}
+
+// estimateEmbeddingInput estimates the tokens of an embeddings input: a
+// string, an array of strings, or pre-tokenized arrays of token IDs.
+func estimateEmbeddingInput(tok Tokenizer, input interface{}) int {
+	switch v := input.(type) {
+	case string:
+		return tok.CountTokens(v)
+	case []interface{}:
+		var tokens int
+		for _, item := range v {
+			switch item := item.(type) {
+			case float64:
+				tokens++ // one token ID of a single pre-tokenized input
+			default:
+				tokens += estimateEmbeddingInput(tok, item)
+			}
+		}
+		return tokens
+	}
+	return 0
+}
@@ -0,0 +1,177 @@
+package gateway_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestEmbeddingsHandler(t *testing.T) {
+	requestBody := `{"model": "text-embedding-3-small", "input": ["first", "second"], "encoding_format": "float"}`
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("expected the embeddings endpoint, got %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != requestBody {
+			t.Errorf("expected the body to be forwarded unmodified, got %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1]}],`+
+			`"model":"text-embedding-3-small","usage":{"prompt_tokens":5000,"total_tokens":5000}}`)
+	}))
+	defer upstreamServer.Close()
+
+	base, _ := url.Parse(upstreamServer.URL + "/v1")
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxy := gateway.NewProxyHandler(base, &MockCircuitBreaker{Allowed: true}, usageChan)
+	handler := gateway.NewEmbeddingsHandler(gateway.EmbeddingsEndpoint(base), proxy)
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(requestBody))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"embedding":[0.1]`) {
+		t.Errorf("expected the embeddings to be relayed, got %q", rr.Body.String())
+	}
+
+	select {
+	case record := <-usageChan:
+		if record.TokenCount != 5000 || record.PromptTokens != 5000 {
+			t.Errorf("expected 5000 prompt tokens, got %+v", record)
+		}
+		// 5000 tokens at 20 micro-dollars per 1K
+		if record.CostMicroDollars != 100 {
+			t.Errorf("expected the embeddings rate of 100 micro-dollars, got %d", record.CostMicroDollars)
+		}
+		if record.APIKey != "test-key" || record.Model != "text-embedding-3-small" {
+			t.Errorf("expected usage for test-key and the embedding model, got %+v", record)
+		}
+	default:
+		t.Fatal("expected usage to be recorded")
+	}
+}
+
+func TestEmbeddingsHandler_LimitExceeded(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected a key over its limit not to reach the upstream")
+	}))
+	defer upstreamServer.Close()
+
+	base, _ := url.Parse(upstreamServer.URL)
+	proxy := gateway.NewProxyHandler(base, &MockCircuitBreaker{Allowed: false}, nil)
+	handler := gateway.NewEmbeddingsHandler(gateway.EmbeddingsEndpoint(base), proxy)
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model": "text-embedding-3-small", "input": "hi"}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("expected status 402, got %d", rr.Code)
+	}
+}
+
+func TestEmbeddingsHandler_SharesCompletionLimits(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"list","data":[],"usage":{"prompt_tokens":1,"total_tokens":1}}`)
+	}))
+	defer upstreamServer.Close()
+
+	base, _ := url.Parse(upstreamServer.URL)
+	proxy := gateway.NewProxyHandler(base, &MockCircuitBreaker{Allowed: true}, make(chan gateway.UsageRecord, 10))
+	proxy.RPM = gateway.NewMemoryRateLimiter(&gateway.RPMLimits{Default: 1})
+	handler := gateway.NewEmbeddingsHandler(gateway.EmbeddingsEndpoint(base), proxy)
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model": "text-embedding-3-small", "input": "hi"}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Errorf("request %d: expected status %d, got %d", i+1, want, rr.Code)
+		}
+	}
+}
+
+func TestEmbeddingsHandler_ReleasesReservationOnFailure(t *testing.T) {
+	var reservedAtUpstream int64
+	cb := gateway.NewMemoryCircuitBreaker()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reservedAtUpstream, _ = cb.GetUsage("test-key")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstreamServer.Close()
+
+	base, _ := url.Parse(upstreamServer.URL)
+	proxy := gateway.NewProxyHandler(base, cb, make(chan gateway.UsageRecord, 1))
+	handler := gateway.NewEmbeddingsHandler(gateway.EmbeddingsEndpoint(base), proxy)
+
+	// 40000 characters estimate at 10000 tokens, $0.0002 at the embeddings rate
+	input := strings.Repeat("a", 40000)
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model": "text-embedding-3-small", "input": ["`+input+`"]}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the upstream's 500 to be relayed, got %d", rr.Code)
+	}
+	if reservedAtUpstream != 200 {
+		t.Errorf("expected the estimate of 200 micro-dollars reserved while upstream, got %d", reservedAtUpstream)
+	}
+	if usage, _ := cb.GetUsage("test-key"); usage != 0 {
+		t.Errorf("expected the reservation to be released after the failure, got %d", usage)
+	}
+}
+
+func TestEmbeddingsHandler_DrainedWithCompletions(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"list","data":[],"usage":{"prompt_tokens":5,"total_tokens":5}}`)
+	}))
+	defer upstreamServer.Close()
+
+	base, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxy := gateway.NewProxyHandler(base, &MockCircuitBreaker{Allowed: true}, usageChan)
+	handler := gateway.NewEmbeddingsHandler(gateway.EmbeddingsEndpoint(base), proxy)
+
+	go func() {
+		req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model": "text-embedding-3-small", "input": "hi"}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := proxy.Drain(ctx); err == nil {
+		t.Fatal("expected Drain to wait for the embeddings request")
+	}
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := proxy.Drain(ctx); err != nil {
+		t.Fatalf("expected the embeddings request to drain, got %v", err)
+	}
+	close(usageChan)
+	if record, ok := <-usageChan; !ok || record.TokenCount != 5 {
+		t.Errorf("expected the embeddings usage to be recorded before the channel closed, got %+v", record)
+	}
+}
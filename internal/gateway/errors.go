@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+)
+
+// APIError is the OpenAI-style `error` object returned to clients.
+type APIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+}
+
+// ErrorResponse wraps an APIError as a response body. RequestID echoes the
+// request's ID, when it is returned to clients, for support tickets.
+type ErrorResponse struct {
+	Error     APIError `json:"error"`
+	RequestID string   `json:"request_id,omitempty"`
+}
+
+// LimitExceededResponse is the 402 body sent when a key has spent its budget,
+// carrying what a client needs to show an "out of credits" prompt.
+type LimitExceededResponse struct {
+	Error        APIError   `json:"error"`
+	LimitDollars float64    `json:"limit_dollars"`
+	UsageDollars float64    `json:"usage_dollars"`
+	ResetsAt     *time.Time `json:"resets_at"` // nil when budgets never refill
+	UpgradeURL   string     `json:"upgrade_url,omitempty"`
+	RequestID    string     `json:"request_id,omitempty"`
+}
+
+// writeJSONError writes body as a JSON error response with the given status.
+// A request ID already echoed in the response headers is copied into the body.
+func writeJSONError(w http.ResponseWriter, status int, body interface{}) {
+	if requestID := w.Header().Get(observability.RequestIDHeader); requestID != "" {
+		switch b := body.(type) {
+		case ErrorResponse:
+			b.RequestID = requestID
+			body = b
+		case LimitExceededResponse:
+			b.RequestID = requestID
+			body = b
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// WriteError writes a rejection without a body of its own as an OpenAI-style
+// JSON error, so it carries the request ID like every other error. The
+// error's type follows the status.
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	errorType := "invalid_request_error"
+	switch {
+	case status == http.StatusUnauthorized:
+		errorType = "authentication_error"
+	case status == http.StatusForbidden:
+		errorType = "permission_error"
+	case status == http.StatusTooManyRequests:
+		errorType = "rate_limit_error"
+	case status >= 500:
+		errorType = "server_error"
+	}
+	writeJSONError(w, status, ErrorResponse{Error: APIError{Message: message, Type: errorType, Code: code}})
+}
+
+// writeLimitExceeded writes the structured 402 response for a key over its budget.
+func (h *ProxyHandler) writeLimitExceeded(w http.ResponseWriter, apiKey string) {
+	writeLimitExceeded(w, h.circuitBreaker, apiKey, h.UpgradeURL)
+}
+
+// writeLimitExceeded writes the 402 body, reading the key's usage and limit from cb.
+func writeLimitExceeded(w http.ResponseWriter, cb CircuitBreaker, apiKey, upgradeURL string) {
+	metrics.LimitExceeded.WithLabelValues(metrics.HashAPIKey(apiKey)).Inc()
+	limit := float64(UsageLimit(cb, apiKey)) / 1000000.0
+	body := LimitExceededResponse{
+		Error: APIError{
+			Message: fmt.Sprintf("Limit Exceeded: Usage > $%.2f", limit),
+			Type:    "insufficient_quota",
+			Code:    "usage_limit_exceeded",
+		},
+		LimitDollars: limit,
+		UsageDollars: limit,
+		ResetsAt:     ResetTime(cb),
+		UpgradeURL:   upgradeURL,
+	}
+	// CheckLimit only answers yes or no, so fetch the figure for the body
+	if usage, err := cb.GetUsage(apiKey); err == nil {
+		body.UsageDollars = float64(usage) / 1000000.0
+	}
+	writeJSONError(w, http.StatusPaymentRequired, body)
+}
+
+// writeRequestTooLarge rejects a request body over the limit with a 413.
+func writeRequestTooLarge(w http.ResponseWriter, limit int64) {
+	metrics.ErrorRate.WithLabelValues("request_too_large").Inc()
+	writeJSONError(w, http.StatusRequestEntityTooLarge, ErrorResponse{Error: APIError{
+		Message: fmt.Sprintf("Request body exceeds the maximum of %d bytes", limit),
+		Type:    "invalid_request_error",
+		Code:    "request_too_large",
+	}})
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// EstimateHandler serves POST /v1/estimate, pricing a chat completion payload's
+// prompt without contacting the upstream or billing the caller.
+type EstimateHandler struct {
+	Tokenizers *TokenizerRegistry
+	Pricing    CostCalculator
+}
+
+// NewEstimateHandler initializes an estimate handler with the given tokenizers and pricing.
+func NewEstimateHandler(tokenizers *TokenizerRegistry, pricing CostCalculator) *EstimateHandler {
+	return &EstimateHandler{
+		Tokenizers: tokenizers,
+		Pricing:    pricing,
+	}
+}
+
+// EstimateResponse is the JSON body returned by the estimate endpoint.
+type EstimateResponse struct {
+	Model                     string  `json:"model"`
+	EstimatedPromptTokens     int     `json:"estimated_prompt_tokens"`
+	EstimatedCostMicroDollars int64   `json:"estimated_cost_micro_dollars"`
+	EstimatedCostDollars      float64 `json:"estimated_cost_dollars"`
+}
+
+func (h *EstimateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+
+	var payload struct {
+		Model    string        `json:"model"`
+		Messages []interface{} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON payload")
+		return
+	}
+
+	tokens := EstimatePromptTokens(h.Tokenizers.For(payload.Model), payload.Messages)
+	cost := h.Pricing.Cost(UsageRecord{Model: payload.Model, TokenCount: tokens, PromptTokens: tokens})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EstimateResponse{
+		Model:                     payload.Model,
+		EstimatedPromptTokens:     tokens,
+		EstimatedCostMicroDollars: cost,
+		EstimatedCostDollars:      float64(cost) / 1000000.0,
+	})
+}
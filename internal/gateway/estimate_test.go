@@ -0,0 +1,51 @@
+package gateway_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestEstimateHandler(t *testing.T) {
+	pricing := gateway.PricingTable{
+		"gpt-4o": {PromptMicroDollarsPer1K: 2500, CompletionMicroDollarsPer1K: 10000},
+	}
+	handler := gateway.NewEstimateHandler(gateway.DefaultTokenizers, pricing)
+
+	// "user" (1 token) + 40 chars of content (10 tokens) + 3 message overhead + 3 reply priming
+	reqBody := []byte(`{"model": "gpt-4o", "messages": [{"role": "user", "content": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}]}`)
+	req := httptest.NewRequest("POST", "/v1/estimate", bytes.NewReader(reqBody))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var resp gateway.EstimateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.EstimatedPromptTokens != 17 {
+		t.Errorf("expected 17 estimated prompt tokens, got %d", resp.EstimatedPromptTokens)
+	}
+	// 17 tokens * 2500 micro-dollars / 1K, rounded up
+	if resp.EstimatedCostMicroDollars != 43 {
+		t.Errorf("expected estimated cost of 43 micro-dollars, got %d", resp.EstimatedCostMicroDollars)
+	}
+}
+
+func TestEstimateHandler_RejectsGet(t *testing.T) {
+	handler := gateway.NewEstimateHandler(gateway.DefaultTokenizers, gateway.DefaultPricing)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/v1/estimate", nil))
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+}
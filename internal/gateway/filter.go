@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// DefaultFilterScanBytes bounds how much of a prompt the filter scans.
+const DefaultFilterScanBytes = 256 * 1024
+
+// PromptRule rejects prompts matching Pattern.
+type PromptRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// PromptFilter is a cheap local denylist matched against the concatenated prompt
+// messages. Go's RE2 regexps run in linear time, and only the first MaxScanBytes
+// of the prompt are scanned, so huge prompts can't make matching expensive.
+type PromptFilter struct {
+	Rules        []PromptRule
+	MaxScanBytes int
+}
+
+// Match returns the name of the first rule matching the messages, if any.
+func (f *PromptFilter) Match(messages []interface{}) (string, bool) {
+	if f == nil || len(f.Rules) == 0 {
+		return "", false
+	}
+	limit := f.MaxScanBytes
+	if limit <= 0 {
+		limit = DefaultFilterScanBytes
+	}
+
+	var prompt strings.Builder
+	for _, m := range messages {
+		if msg, ok := m.(map[string]interface{}); ok {
+			prompt.WriteString(MessageText(msg))
+			prompt.WriteByte('\n')
+		}
+		if prompt.Len() >= limit {
+			break
+		}
+	}
+	text := prompt.String()
+	if len(text) > limit {
+		text = text[:limit]
+	}
+
+	for _, rule := range f.Rules {
+		if rule.Pattern.MatchString(text) {
+			metrics.PromptFilterRejections.WithLabelValues(rule.Name).Inc()
+			return rule.Name, true
+		}
+	}
+	return "", false
+}
+
+// LoadPromptRules parses one `name: regexp` rule per line. Blank lines and lines
+// starting with # are ignored.
+func LoadPromptRules(r io.Reader) ([]PromptRule, error) {
+	var rules []PromptRule
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected `name: pattern`", line)
+		}
+		pattern, err := regexp.Compile(strings.TrimSpace(expr))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, PromptRule{Name: strings.TrimSpace(name), Pattern: pattern})
+	}
+	return rules, scanner.Err()
+}
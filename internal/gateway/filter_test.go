@@ -0,0 +1,76 @@
+package gateway_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestLoadPromptRules(t *testing.T) {
+	rules, err := gateway.LoadPromptRules(strings.NewReader("# banned terms\n\nsecrets: (?i)internal[- ]only\ncards: \\b4[0-9]{15}\\b\n"))
+	if err != nil {
+		t.Fatalf("failed to load rules: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Name != "secrets" || rules[1].Name != "cards" {
+		t.Errorf("expected rules secrets and cards, got %+v", rules)
+	}
+
+	if _, err := gateway.LoadPromptRules(strings.NewReader("broken: (unclosed\n")); err == nil {
+		t.Error("expected an invalid pattern to be reported")
+	}
+}
+
+func TestProxyHandler_PromptFilter(t *testing.T) {
+	upstreamCalled := false
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	rules, _ := gateway.LoadPromptRules(strings.NewReader("secrets: (?i)internal[- ]only\n"))
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.PromptFilter = &gateway.PromptFilter{Rules: rules}
+
+	reqBody := []byte(`{"model": "gpt-4", "messages": [{"role": "user", "content": "Summarize this INTERNAL ONLY memo"}]}`)
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(reqBody)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+	if upstreamCalled {
+		t.Error("expected a filtered prompt not to reach the upstream")
+	}
+	var body gateway.ErrorResponse
+	json.NewDecoder(rr.Body).Decode(&body)
+	if body.Error.Code != "content_filtered" || !strings.Contains(body.Error.Message, "secrets") {
+		t.Errorf("expected the rejection to name the rule, got %+v", body.Error)
+	}
+
+	clean := []byte(`{"model": "gpt-4", "messages": [{"role": "user", "content": "Summarize this public memo"}]}`)
+	rr = httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(clean)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a clean prompt to be forwarded, got %d", rr.Code)
+	}
+}
+
+func TestPromptFilter_ScanIsBounded(t *testing.T) {
+	rules, _ := gateway.LoadPromptRules(strings.NewReader("banned: forbidden\n"))
+	filter := &gateway.PromptFilter{Rules: rules, MaxScanBytes: 1024}
+
+	messages := []interface{}{
+		map[string]interface{}{"role": "user", "content": strings.Repeat("a", 4096) + " forbidden"},
+	}
+	if _, matched := filter.Match(messages); matched {
+		t.Error("expected text beyond MaxScanBytes not to be scanned")
+	}
+}
@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FlushPolicy controls how often StreamResponse flushes to the client. The zero
+// value flushes after every line for the lowest possible latency. Otherwise a
+// flush happens after MaxEvents complete SSE events or MaxDelay since the first
+// unflushed write, whichever comes first, and always when the stream ends.
+type FlushPolicy struct {
+	MaxEvents int
+	MaxDelay  time.Duration
+}
+
+func (p FlushPolicy) perLine() bool {
+	return p.MaxEvents <= 0 && p.MaxDelay <= 0
+}
+
+// streamWriter serializes writes to the client so buffered output can be flushed
+// from a timer without racing the streaming goroutine.
+type streamWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	sent    *countingWriter // the client's writer, below any compression
+	gz      *gzip.Writer    // set when the stream is compressed; w writes through it
+	flusher http.Flusher
+	policy  FlushPolicy
+	events  int         // complete SSE events since the last flush
+	dirty   bool        // unflushed bytes pending
+	timer   *time.Timer // pending MaxDelay flush
+	closed  bool        // the handler has returned; the ResponseWriter must not be touched
+}
+
+// nopFlusher stands in for writers that can't flush, leaving their output
+// buffered until they send it.
+type nopFlusher struct{}
+
+func (nopFlusher) Flush() {}
+
+func newStreamWriter(w http.ResponseWriter, flusher http.Flusher, policy FlushPolicy) *streamWriter {
+	sent := &countingWriter{w: w}
+	return &streamWriter{w: sent, sent: sent, flusher: flusher, policy: policy}
+}
+
+// countingWriter counts the bytes passed through to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Sent returns how many bytes have been written to the client.
+func (s *streamWriter) Sent() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent.n
+}
+
+// compress gzips everything written from now on. The caller must already have
+// set Content-Encoding.
+func (s *streamWriter) compress() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gz = gzip.NewWriter(s.w)
+	s.w = s.gz
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			// q=0 explicitly refuses the coding
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				weight, err := strconv.ParseFloat(q, 64)
+				return err == nil && weight > 0
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Write implements io.Writer without flushing.
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = true
+	return s.w.Write(p)
+}
+
+// WriteLine forwards one line of the upstream stream and flushes according to the policy.
+func (s *streamWriter) WriteLine(line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.w.Write(line)
+	s.w.Write([]byte("\n"))
+	s.dirty = true
+
+	if s.policy.perLine() {
+		s.flushLocked()
+		return
+	}
+
+	// A blank line terminates an SSE event
+	if len(line) == 0 {
+		s.events++
+	}
+	if s.policy.MaxEvents > 0 && s.events >= s.policy.MaxEvents {
+		s.flushLocked()
+		return
+	}
+	if s.policy.MaxDelay > 0 && s.timer == nil {
+		s.timer = time.AfterFunc(s.policy.MaxDelay, s.Flush)
+	}
+}
+
+// Flush sends any buffered output to the client immediately.
+func (s *streamWriter) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+// Close performs the final flush, ending the gzip stream if there is one, and
+// stops any pending timer from touching the writer.
+func (s *streamWriter) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gz != nil {
+		s.gz.Close()
+		s.dirty = true
+	}
+	s.flushLocked()
+	s.closed = true
+}
+
+func (s *streamWriter) flushLocked() {
+	if s.closed {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.events = 0
+	if s.dirty {
+		// gzip holds back output until flushed itself, which would stall the stream
+		if s.gz != nil {
+			s.gz.Flush()
+		}
+		s.flusher.Flush()
+		s.dirty = false
+	}
+}
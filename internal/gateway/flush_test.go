@@ -0,0 +1,185 @@
+package gateway_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+// flushCounter records how many times the stream was flushed.
+type flushCounter struct {
+	*httptest.ResponseRecorder
+	flushes atomic.Int32
+}
+
+func (f *flushCounter) Flush() {
+	f.flushes.Add(1)
+	f.ResponseRecorder.Flush()
+}
+
+func eventStream(events int) string {
+	var sb strings.Builder
+	for i := 0; i < events; i++ {
+		fmt.Fprintf(&sb, "data: {\"choices\":[{\"delta\":{\"content\":\"%d\"}}]}\n\n", i)
+	}
+	sb.WriteString("data: [DONE]\n\n")
+	return sb.String()
+}
+
+func TestStreamResponse_FlushPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  gateway.FlushPolicy
+		flushes int32
+	}{
+		// 10 content events + [DONE], two lines each
+		{name: "per line by default", policy: gateway.FlushPolicy{}, flushes: 22},
+		{name: "every 4 events plus final flush", policy: gateway.FlushPolicy{MaxEvents: 4}, flushes: 3},
+		{name: "interval only flushes at end of fast stream", policy: gateway.FlushPolicy{MaxDelay: time.Minute}, flushes: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+			body := eventStream(10)
+			gateway.StreamResponse(rr, newStreamResponse(body), "", nil, gateway.StreamOptions{Flush: tt.policy})
+
+			if got := rr.flushes.Load(); got != tt.flushes {
+				t.Errorf("expected %d flushes, got %d", tt.flushes, got)
+			}
+			if rr.Body.String() != body {
+				t.Errorf("expected full stream to be delivered, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestStreamResponse_FlushInterval(t *testing.T) {
+	pr, pw := io.Pipe()
+	resp := newStreamResponse("")
+	resp.Body = pr
+
+	rr := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+	done := make(chan struct{})
+	go func() {
+		gateway.StreamResponse(rr, resp, "", nil, gateway.StreamOptions{Flush: gateway.FlushPolicy{MaxEvents: 100, MaxDelay: 10 * time.Millisecond}})
+		close(done)
+	}()
+
+	// A slow upstream must still see its first event flushed after MaxDelay.
+	pw.Write([]byte("data: {}\n\n"))
+	time.Sleep(50 * time.Millisecond)
+	if rr.flushes.Load() == 0 {
+		t.Errorf("expected a timed flush while the upstream is idle")
+	}
+
+	pw.Close()
+	<-done
+}
+
+// BenchmarkStreamResponse_Flush compares per-line flushing against batched flushing
+// over real connections, where every flush is a write syscall.
+func BenchmarkStreamResponse_Flush(b *testing.B) {
+	body := eventStream(200)
+	policies := map[string]gateway.FlushPolicy{
+		"per_line":  {},
+		"events_16": {MaxEvents: 16, MaxDelay: 20 * time.Millisecond},
+	}
+
+	for name, policy := range policies {
+		b.Run(name, func(b *testing.B) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gateway.StreamResponse(w, newStreamResponse(body), "", nil, gateway.StreamOptions{Flush: policy})
+			}))
+			defer srv.Close()
+
+			b.SetParallelism(16) // 16 * GOMAXPROCS concurrent streams
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					resp, err := http.Get(srv.URL)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			})
+		})
+	}
+}
+
+// snapshotRecorder keeps a copy of the body as of the first flush.
+type snapshotRecorder struct {
+	*httptest.ResponseRecorder
+	first []byte
+}
+
+func (s *snapshotRecorder) Flush() {
+	if s.first == nil {
+		s.first = append([]byte{}, s.Body.Bytes()...)
+	}
+	s.ResponseRecorder.Flush()
+}
+
+func TestProxyHandler_GzipStream(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, eventStream(5))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.GzipStreams = true
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rr := &snapshotRecorder{ResponseRecorder: httptest.NewRecorder()}
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip stream, got Content-Encoding %q", rr.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(rr.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("expected a decodable gzip body: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("expected a complete gzip stream: %v", err)
+	}
+	if string(body) != eventStream(5) {
+		t.Errorf("expected every chunk intact, got %q", body)
+	}
+
+	// What was flushed first decodes on its own, so the client isn't left waiting on the compressor
+	zr, err = gzip.NewReader(bytes.NewReader(rr.first))
+	if err != nil {
+		t.Fatalf("expected the first flush to carry a gzip header: %v", err)
+	}
+	partial, _ := io.ReadAll(zr)
+	if !strings.HasPrefix(string(partial), "data: {") {
+		t.Errorf("expected the first flush to decode to the first chunk, got %q", partial)
+	}
+
+	// Clients that don't ask for gzip get the stream as is
+	req = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+	plain := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(plain, req)
+	if plain.Header().Get("Content-Encoding") != "" || plain.Body.String() != eventStream(5) {
+		t.Errorf("expected an uncompressed stream without Accept-Encoding, got %q", plain.Body.String())
+	}
+}
@@ -0,0 +1,382 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GeminiAdapter speaks Google's Gemini API. Routes point at the model, e.g.
+// https://generativelanguage.googleapis.com/v1beta/models/{model}, and the
+// adapter picks :streamGenerateContent or :generateContent per request. The
+// streamed JSON array comes back as OpenAI chat.completion.chunk deltas, with
+// the usage from the last usageMetadata reported in a final usage chunk.
+type GeminiAdapter struct{}
+
+// Endpoint implements endpointAdapter.
+func (GeminiAdapter) Endpoint(rawURL string, stream bool) string {
+	method := ":generateContent"
+	if stream {
+		method = ":streamGenerateContent"
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL + method
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + method
+	u.RawPath = ""
+	return u.String()
+}
+
+// TranslateRequest implements Adapter. System messages become the system
+// instruction and assistant turns the "model" role. Fields without a Gemini
+// equivalent, such as stream_options, are dropped.
+func (GeminiAdapter) TranslateRequest(payload map[string]interface{}) ([]byte, error) {
+	config := map[string]interface{}{}
+	for _, field := range []string{"max_completion_tokens", "max_tokens"} {
+		if v, ok := payload[field].(float64); ok && v > 0 {
+			config["maxOutputTokens"] = int(v)
+		}
+	}
+	if v, ok := payload["temperature"]; ok {
+		config["temperature"] = v
+	}
+	if v, ok := payload["top_p"]; ok {
+		config["topP"] = v
+	}
+	switch stop := payload["stop"].(type) {
+	case string:
+		config["stopSequences"] = []string{stop}
+	case []interface{}:
+		config["stopSequences"] = stop
+	}
+
+	messages, _ := payload["messages"].([]interface{})
+	var system []string
+	contents := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		msg, ok := m.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid message: %v", m)
+		}
+		role, _ := msg["role"].(string)
+		switch role {
+		case "system", "developer":
+			system = append(system, messageText(msg["content"]))
+			continue
+		case "user":
+		case "assistant":
+			role = "model"
+		default:
+			return nil, fmt.Errorf("unsupported message role for Gemini: %q", role)
+		}
+		contents = append(contents, map[string]interface{}{
+			"role":  role,
+			"parts": []map[string]string{{"text": messageText(msg["content"])}},
+		})
+	}
+
+	req := map[string]interface{}{"contents": contents}
+	if len(system) > 0 {
+		req["systemInstruction"] = map[string]interface{}{
+			"parts": []map[string]string{{"text": strings.Join(system, "\n\n")}},
+		}
+	}
+	if len(config) > 0 {
+		req["generationConfig"] = config
+	}
+	return json.Marshal(req)
+}
+
+// TranslateResponse implements Adapter. Responses that are neither JSON nor
+// an event stream are left as they are.
+func (GeminiAdapter) TranslateResponse(resp *http.Response) *http.Response {
+	streamed := resp.Request != nil && strings.HasSuffix(resp.Request.URL.Path, ":streamGenerateContent")
+	ok := resp.StatusCode < http.StatusMultipleChoices
+	switch {
+	case ok && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		// alt=sse streams carry one response per data line
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		resp.Body = &geminiStream{body: resp.Body, next: sseObjects(scanner)}
+	case ok && streamed && isJSONResponse(resp):
+		resp.Body = &geminiStream{body: resp.Body, next: jsonArrayObjects(json.NewDecoder(resp.Body))}
+		resp.Header.Set("Content-Type", "text/event-stream")
+	case isJSONResponse(resp):
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxUsageBodyBytes))
+		resp.Body.Close()
+		if err == nil {
+			body = translateGeminiJSON(body)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	default:
+		return resp
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return resp
+}
+
+// geminiUsage is the usageMetadata of Gemini responses. Thinking models bill
+// their thoughts as output alongside the candidates.
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+}
+
+// openAIUsage converts usage to OpenAI's field names.
+func (u geminiUsage) openAIUsage() map[string]int {
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	return map[string]int{
+		"prompt_tokens":     u.PromptTokenCount,
+		"completion_tokens": completion,
+		"total_tokens":      u.PromptTokenCount + completion,
+	}
+}
+
+// geminiError is the body of Gemini API errors.
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// geminiResponse is one generateContent response, or one element of a stream.
+type geminiResponse struct {
+	ResponseID   string `json:"responseId"`
+	ModelVersion string `json:"modelVersion"`
+	Candidates   []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"`
+	Error         *geminiError `json:"error"`
+}
+
+// text joins the first candidate's text parts.
+func (r *geminiResponse) text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// finishReason maps the first candidate's finish reason to OpenAI's, or nil
+// while it is still generating.
+func (r *geminiResponse) finishReason() interface{} {
+	if len(r.Candidates) == 0 || r.Candidates[0].FinishReason == "" {
+		return nil
+	}
+	switch r.Candidates[0].FinishReason {
+	case "STOP":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// translateGeminiJSON converts a complete response, or an error, to OpenAI's
+// shape. Errors from the streaming method arrive wrapped in an array. Bodies
+// it doesn't recognise are returned unchanged.
+func translateGeminiJSON(body []byte) []byte {
+	var msg geminiResponse
+	if json.Unmarshal(body, &msg) != nil {
+		var wrapped []geminiResponse
+		if json.Unmarshal(body, &wrapped) != nil || len(wrapped) != 1 {
+			return body
+		}
+		msg = wrapped[0]
+	}
+
+	var out interface{}
+	switch {
+	case msg.Error != nil:
+		out = ErrorResponse{Error: APIError{Message: msg.Error.Message, Type: msg.Error.Status}}
+	case msg.Candidates != nil:
+		completion := map[string]interface{}{
+			"id":     msg.ResponseID,
+			"object": "chat.completion",
+			"model":  msg.ModelVersion,
+			"choices": []interface{}{map[string]interface{}{
+				"index":         0,
+				"message":       map[string]interface{}{"role": "assistant", "content": msg.text()},
+				"finish_reason": msg.finishReason(),
+			}},
+		}
+		if msg.UsageMetadata != nil {
+			completion["usage"] = msg.UsageMetadata.openAIUsage()
+		}
+		out = completion
+	default:
+		return body
+	}
+	translated, err := json.Marshal(out)
+	if err != nil {
+		return body
+	}
+	return translated
+}
+
+// jsonArrayObjects returns the elements of a streamed JSON array one at a
+// time, then io.EOF once the array is closed.
+func jsonArrayObjects(dec *json.Decoder) func() ([]byte, error) {
+	opened := false
+	return func() ([]byte, error) {
+		if !opened {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return nil, fmt.Errorf("expected a JSON array from Gemini, got %v", tok)
+			}
+			opened = true
+		}
+		if !dec.More() {
+			// A body cut off between elements never reaches the closing bracket
+			if _, err := dec.Token(); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, io.EOF
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+}
+
+// sseObjects returns the data of each SSE event, then io.EOF.
+func sseObjects(scanner *bufio.Scanner) func() ([]byte, error) {
+	var event sseEvent
+	return func() ([]byte, error) {
+		for scanner.Scan() {
+			if data, ok := event.feed(scanner.Bytes()); ok {
+				return data, nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		if data, ok := event.flush(); ok {
+			return data, nil
+		}
+		return nil, io.EOF
+	}
+}
+
+// geminiStream reads a Gemini response stream as OpenAI SSE chunks.
+type geminiStream struct {
+	body    io.ReadCloser
+	next    func() ([]byte, error)
+	pending bytes.Buffer
+	done    bool
+
+	started   bool
+	id, model string
+	usage     *geminiUsage
+}
+
+func (s *geminiStream) Read(p []byte) (int, error) {
+	for s.pending.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		data, err := s.next()
+		if err == io.EOF {
+			s.finish()
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		s.translate(data)
+	}
+	return s.pending.Read(p)
+}
+
+func (s *geminiStream) Close() error {
+	return s.body.Close()
+}
+
+// translate converts one streamed response to the chunks it becomes, if any.
+func (s *geminiStream) translate(data []byte) {
+	var chunk geminiResponse
+	if json.Unmarshal(data, &chunk) != nil {
+		return
+	}
+	if chunk.Error != nil {
+		writeSSEData(&s.pending, ErrorResponse{Error: APIError{Message: chunk.Error.Message, Type: chunk.Error.Status}})
+		return
+	}
+	if chunk.ResponseID != "" {
+		s.id = chunk.ResponseID
+	}
+	if chunk.ModelVersion != "" {
+		s.model = chunk.ModelVersion
+	}
+	// Usage is cumulative, so the last report is the total
+	if chunk.UsageMetadata != nil {
+		s.usage = chunk.UsageMetadata
+	}
+
+	delta := map[string]interface{}{"content": chunk.text()}
+	if !s.started {
+		delta["role"] = "assistant"
+		s.started = true
+	}
+	writeSSEData(&s.pending, map[string]interface{}{
+		"id":     s.id,
+		"object": "chat.completion.chunk",
+		"model":  s.model,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": chunk.finishReason(),
+		}},
+	})
+}
+
+// finish queues the usage chunk and [DONE] once the stream has ended.
+func (s *geminiStream) finish() {
+	s.done = true
+	if s.usage != nil {
+		writeSSEData(&s.pending, map[string]interface{}{
+			"id":      s.id,
+			"object":  "chat.completion.chunk",
+			"model":   s.model,
+			"choices": []interface{}{},
+			"usage":   s.usage.openAIUsage(),
+		})
+	}
+	s.pending.WriteString("data: [DONE]\n\n")
+}
+
+// writeSSEData queues v as an SSE data line.
+func writeSSEData(buf *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+}
@@ -0,0 +1,206 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestGeminiAdapter_TranslateRequest(t *testing.T) {
+	var payload map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"model": "gemini-1.5-flash",
+		"stream": true,
+		"stream_options": {"include_usage": true},
+		"max_tokens": 256,
+		"temperature": 0.2,
+		"stop": ["END"],
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Hello"},
+			{"role": "assistant", "content": "Hi!"},
+			{"role": "user", "content": [{"type": "text", "text": "How are you?"}]}
+		]
+	}`), &payload)
+
+	body, err := gateway.GeminiAdapter{}.TranslateRequest(payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var req struct {
+		Contents []struct {
+			Role  string
+			Parts []struct{ Text string }
+		}
+		SystemInstruction struct {
+			Parts []struct{ Text string }
+		}
+		GenerationConfig map[string]interface{}
+		StreamOptions    interface{} `json:"stream_options"`
+	}
+	json.Unmarshal(body, &req)
+
+	if len(req.SystemInstruction.Parts) != 1 || req.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("expected the system message as the system instruction, got %s", body)
+	}
+	if len(req.Contents) != 3 || req.Contents[1].Role != "model" || req.Contents[2].Parts[0].Text != "How are you?" {
+		t.Errorf("expected user and model turns with text parts, got %s", body)
+	}
+	config := req.GenerationConfig
+	if config["maxOutputTokens"] != float64(256) || config["temperature"] != 0.2 {
+		t.Errorf("expected max_tokens and temperature in generationConfig, got %v", config)
+	}
+	if stop, _ := config["stopSequences"].([]interface{}); len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("expected stop as stopSequences, got %v", config["stopSequences"])
+	}
+	if req.StreamOptions != nil {
+		t.Error("expected stream_options to be dropped")
+	}
+
+	payload["messages"] = []interface{}{map[string]interface{}{"role": "tool", "content": "42"}}
+	if _, err := (gateway.GeminiAdapter{}).TranslateRequest(payload); err == nil {
+		t.Error("expected an error for a role Gemini doesn't support")
+	}
+}
+
+func TestProxyHandler_GeminiRoute(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/gemini_stream.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var upstreamBody map[string]interface{}
+	var upstreamPath, apiKey string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath, apiKey = r.URL.Path, r.Header.Get("x-goog-api-key")
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write(fixture)
+	}))
+	defer upstreamServer.Close()
+
+	router, err := gateway.LoadRouter(strings.NewReader(`{"gemini-": {"url": "` + upstreamServer.URL +
+		`/v1beta/models/{model}", "adapter": "gemini", "auth_header": "x-goog-api-key"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error loading routes: %v", err)
+	}
+	defaultURL, _ := url.Parse("http://127.0.0.1:1/v1/chat/completions")
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(defaultURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.Router = router
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(
+		`{"model": "gemini-1.5-flash", "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if upstreamPath != "/v1beta/models/gemini-1.5-flash:streamGenerateContent" || apiKey != "test-key" {
+		t.Errorf("expected streamGenerateContent with x-goog-api-key, got path %q key %q", upstreamPath, apiKey)
+	}
+	if _, ok := upstreamBody["contents"]; !ok {
+		t.Errorf("expected a generateContent body, got %v", upstreamBody)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("expected an event stream for the client, got %q", got)
+	}
+
+	// The client sees OpenAI chunks
+	var content strings.Builder
+	var finishReason string
+	var sawDone bool
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			sawDone = true
+			continue
+		}
+		var chunk struct {
+			Object  string `json:"object"`
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta        struct{ Content string } `json:"delta"`
+				FinishReason *string                  `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || chunk.Object != "chat.completion.chunk" {
+			t.Fatalf("expected a chat.completion.chunk, got %q", data)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	if content.String() != "Hello there! How can I help?" || finishReason != "stop" || !sawDone {
+		t.Errorf("expected the full text finishing with stop and [DONE], got %q %q done=%v", content.String(), finishReason, sawDone)
+	}
+
+	select {
+	case record := <-usageChan:
+		if record.PromptTokens != 9 || record.CompletionTokens != 8 || record.TokenCount != 17 {
+			t.Errorf("expected usage from the last usageMetadata, got %+v", record)
+		}
+		if record.Model != "gemini-1.5-flash-002" {
+			t.Errorf("expected the model version Gemini reported, got %q", record.Model)
+		}
+	default:
+		t.Error("expected usage to be recorded")
+	}
+}
+
+func TestGeminiAdapter_TranslateJSONResponse(t *testing.T) {
+	upstreamURL, _ := url.Parse("https://generativelanguage.googleapis.com/v1beta/models/gemini-1.5-pro:generateContent")
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json; charset=UTF-8"}},
+		Request:    &http.Request{URL: upstreamURL},
+		Body: io.NopCloser(strings.NewReader(`{"candidates":[{"content":{"parts":[{"text":"Hi there"}],"role":"model"},"finishReason":"MAX_TOKENS"}],` +
+			`"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":4,"totalTokenCount":14},"modelVersion":"gemini-1.5-pro-002"}`)),
+	}
+	resp = gateway.GeminiAdapter{}.TranslateResponse(resp)
+	body, _ := io.ReadAll(resp.Body)
+
+	var completion struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message      struct{ Content string } `json:"message"`
+			FinishReason string                   `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil || completion.Object != "chat.completion" {
+		t.Fatalf("expected a chat.completion, got %s", body)
+	}
+	if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Hi there" || completion.Choices[0].FinishReason != "length" {
+		t.Errorf("expected the candidate text with finish_reason length, got %s", body)
+	}
+	if completion.Usage.TotalTokens != 14 {
+		t.Errorf("expected 14 total tokens, got %d", completion.Usage.TotalTokens)
+	}
+
+	// Errors from the streaming method arrive wrapped in an array
+	resp = &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{"Content-Type": []string{"application/json; charset=UTF-8"}},
+		Request:    &http.Request{URL: upstreamURL},
+		Body:       io.NopCloser(strings.NewReader(`[{"error":{"code":400,"message":"API key not valid.","status":"INVALID_ARGUMENT"}}]`)),
+	}
+	body, _ = io.ReadAll(gateway.GeminiAdapter{}.TranslateResponse(resp).Body)
+	var apiErr gateway.ErrorResponse
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Error.Message != "API key not valid." || apiErr.Error.Type != "INVALID_ARGUMENT" {
+		t.Errorf("expected an OpenAI-style error, got %s", body)
+	}
+}
@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// GracefulCircuitBreaker keeps the gateway serving and billing through a usage
+// store outage. While the wrapped breaker errors, limit checks fail open and
+// usage is buffered in memory; Reconcile replays the buffer once the store
+// recovers, so neither availability nor billing data is lost.
+type GracefulCircuitBreaker struct {
+	CircuitBreaker
+
+	mu       sync.Mutex
+	pending  map[string]int64 // apiKey -> buffered micro-dollars
+	degraded bool
+}
+
+// NewGracefulCircuitBreaker wraps cb with fail-open checks and buffered billing.
+func NewGracefulCircuitBreaker(cb CircuitBreaker) *GracefulCircuitBreaker {
+	return &GracefulCircuitBreaker{
+		CircuitBreaker: cb,
+		pending:        make(map[string]int64),
+	}
+}
+
+// CheckLimit allows the request when the store can't be reached.
+func (g *GracefulCircuitBreaker) CheckLimit(apiKey string) (bool, error) {
+	allowed, err := g.CircuitBreaker.CheckLimit(apiKey)
+	if err != nil {
+		g.enterDegraded(err)
+		return true, nil
+	}
+	return allowed, nil
+}
+
+// GetLimit implements LimitProvider for the wrapped breaker. Limits come from
+// the store too, so while it's unreachable the default applies.
+func (g *GracefulCircuitBreaker) GetLimit(apiKey string) (int64, error) {
+	return UsageLimit(g.CircuitBreaker, apiKey), nil
+}
+
+// Ping always succeeds: the gateway keeps serving while the store is down, so
+// it stays ready rather than taking every replica out of rotation at once.
+func (g *GracefulCircuitBreaker) Ping(ctx context.Context) error {
+	return nil
+}
+
+// ResetsAt implements UsageResetter for the wrapped breaker.
+func (g *GracefulCircuitBreaker) ResetsAt() time.Time {
+	if resetsAt := ResetTime(g.CircuitBreaker); resetsAt != nil {
+		return *resetsAt
+	}
+	return time.Time{}
+}
+
+// AddUsage buffers the cost locally when the store can't be reached.
+func (g *GracefulCircuitBreaker) AddUsage(apiKey string, costMicroDollars int64) error {
+	g.mu.Lock()
+	buffering := g.degraded
+	g.mu.Unlock()
+
+	// Keep ordering simple while degraded: everything goes through the buffer
+	if !buffering {
+		err := g.CircuitBreaker.AddUsage(apiKey, costMicroDollars)
+		if err == nil {
+			return nil
+		}
+		g.enterDegraded(err)
+	}
+
+	g.mu.Lock()
+	g.pending[apiKey] += costMicroDollars
+	metrics.BufferedUsage.Add(float64(costMicroDollars))
+	g.mu.Unlock()
+	return nil
+}
+
+// SetUsage overwrites the key's usage in the store, discarding any usage still
+// buffered for it so the replay doesn't add to the new figure. It fails while
+// the store can't be reached rather than buffering the change.
+func (g *GracefulCircuitBreaker) SetUsage(apiKey string, costMicroDollars int64) error {
+	if err := g.CircuitBreaker.SetUsage(apiKey, costMicroDollars); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if pending, ok := g.pending[apiKey]; ok {
+		delete(g.pending, apiKey)
+		metrics.BufferedUsage.Sub(float64(pending))
+	}
+	return nil
+}
+
+// GetUsage includes usage that is still buffered for the key.
+func (g *GracefulCircuitBreaker) GetUsage(apiKey string) (int64, error) {
+	usage, err := g.CircuitBreaker.GetUsage(apiKey)
+	if err != nil {
+		return 0, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return usage + g.pending[apiKey], nil
+}
+
+// Degraded reports whether the store is currently considered unavailable.
+func (g *GracefulCircuitBreaker) Degraded() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.degraded
+}
+
+// Reconcile replays buffered usage into the store. It leaves degraded mode once
+// the buffer has been fully written.
+//
+// The buffer is swapped out before it's replayed, so requests keep buffering
+// rather than queueing behind store round trips; usage buffered meanwhile is
+// replayed in the next pass, and whatever fails to replay is merged back.
+func (g *GracefulCircuitBreaker) Reconcile() {
+	g.mu.Lock()
+	if !g.degraded {
+		g.mu.Unlock()
+		return
+	}
+
+	var replayed int64
+	for len(g.pending) > 0 {
+		batch := g.pending
+		g.pending = make(map[string]int64)
+		g.mu.Unlock()
+
+		var err error
+		for apiKey, cost := range batch {
+			if err = g.CircuitBreaker.AddUsage(apiKey, cost); err != nil {
+				break
+			}
+			delete(batch, apiKey)
+			metrics.BufferedUsage.Sub(float64(cost))
+			replayed += cost
+		}
+
+		g.mu.Lock()
+		if err != nil {
+			for apiKey, cost := range batch {
+				g.pending[apiKey] += cost
+			}
+			buffered := len(g.pending)
+			g.mu.Unlock()
+			slog.Warn("Usage store still unavailable, keeping usage buffered", "buffered_keys", buffered, "error", err)
+			return
+		}
+	}
+
+	g.degraded = false
+	metrics.DegradedMode.Set(0)
+	g.mu.Unlock()
+	slog.Info("Usage store recovered, leaving degraded billing mode", "replayed_micro_dollars", replayed)
+}
+
+// Run calls Reconcile every interval until ctx is cancelled.
+func (g *GracefulCircuitBreaker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.Reconcile()
+		}
+	}
+}
+
+func (g *GracefulCircuitBreaker) enterDegraded(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.degraded {
+		return
+	}
+	g.degraded = true
+	metrics.DegradedMode.Set(1)
+	slog.Error("USAGE STORE UNAVAILABLE: entering degraded billing mode; limits are not enforced and usage is buffered in memory until the store recovers", "error", err)
+}
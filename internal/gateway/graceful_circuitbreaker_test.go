@@ -0,0 +1,141 @@
+package gateway_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+// flakyCircuitBreaker fails every call while Down is set.
+type flakyCircuitBreaker struct {
+	*gateway.MemoryCircuitBreaker
+	Down bool
+}
+
+var errStoreDown = errors.New("connection refused")
+
+func (f *flakyCircuitBreaker) CheckLimit(apiKey string) (bool, error) {
+	if f.Down {
+		return false, errStoreDown
+	}
+	return f.MemoryCircuitBreaker.CheckLimit(apiKey)
+}
+
+func (f *flakyCircuitBreaker) AddUsage(apiKey string, costMicroDollars int64) error {
+	if f.Down {
+		return errStoreDown
+	}
+	return f.MemoryCircuitBreaker.AddUsage(apiKey, costMicroDollars)
+}
+
+func TestGracefulCircuitBreaker(t *testing.T) {
+	store := &flakyCircuitBreaker{MemoryCircuitBreaker: gateway.NewMemoryCircuitBreaker()}
+	cb := gateway.NewGracefulCircuitBreaker(store)
+	apiKey := "test-key"
+
+	// Push the key over its limit, then take the store down
+	cb.AddUsage(apiKey, gateway.MaxUsageMicroDollars)
+	store.Down = true
+
+	allowed, err := cb.CheckLimit(apiKey)
+	if err != nil || !allowed {
+		t.Fatalf("expected limit check to fail open while degraded, got allowed=%v err=%v", allowed, err)
+	}
+	if !cb.Degraded() {
+		t.Fatalf("expected degraded mode after a store error")
+	}
+
+	if err := cb.AddUsage(apiKey, 500); err != nil {
+		t.Fatalf("expected usage to be buffered without error, got %v", err)
+	}
+
+	// Still down: the buffer is kept
+	cb.Reconcile()
+	if !cb.Degraded() {
+		t.Errorf("expected to stay degraded while the store is down")
+	}
+
+	store.Down = false
+	cb.Reconcile()
+	if cb.Degraded() {
+		t.Errorf("expected to leave degraded mode after reconciling")
+	}
+
+	usage, err := cb.GetUsage(apiKey)
+	if err != nil {
+		t.Fatalf("unexpected error on GetUsage: %v", err)
+	}
+	if usage != gateway.MaxUsageMicroDollars+500 {
+		t.Errorf("expected buffered usage to be replayed, got %d", usage)
+	}
+
+	allowed, _ = cb.CheckLimit(apiKey)
+	if allowed {
+		t.Errorf("expected limits to be enforced again after recovery")
+	}
+}
+
+// slowCircuitBreaker blocks its first AddUsage until Release is closed.
+type slowCircuitBreaker struct {
+	*gateway.MemoryCircuitBreaker
+	Down     bool
+	Writing  chan struct{}
+	Release  chan struct{}
+	blocking sync.Once
+}
+
+func (s *slowCircuitBreaker) AddUsage(apiKey string, costMicroDollars int64) error {
+	if s.Down {
+		return errStoreDown
+	}
+	s.blocking.Do(func() {
+		close(s.Writing)
+		<-s.Release
+	})
+	return s.MemoryCircuitBreaker.AddUsage(apiKey, costMicroDollars)
+}
+
+func TestGracefulCircuitBreaker_ReconcileDoesNotBlockUsage(t *testing.T) {
+	store := &slowCircuitBreaker{
+		MemoryCircuitBreaker: gateway.NewMemoryCircuitBreaker(),
+		Down:                 true,
+		Writing:              make(chan struct{}),
+		Release:              make(chan struct{}),
+	}
+	cb := gateway.NewGracefulCircuitBreaker(store)
+	cb.AddUsage("key-a", 100)
+	store.Down = false
+
+	reconciled := make(chan struct{})
+	go func() {
+		cb.Reconcile()
+		close(reconciled)
+	}()
+	<-store.Writing
+
+	// The replay is stuck on the store, but usage still buffers immediately
+	buffered := make(chan struct{})
+	go func() {
+		cb.AddUsage("key-b", 50)
+		close(buffered)
+	}()
+	select {
+	case <-buffered:
+	case <-time.After(time.Second):
+		t.Fatal("expected AddUsage not to wait for the replay")
+	}
+
+	close(store.Release)
+	<-reconciled
+	if cb.Degraded() {
+		t.Errorf("expected to leave degraded mode once everything is replayed")
+	}
+	for apiKey, want := range map[string]int64{"key-a": 100, "key-b": 50} {
+		if usage, _ := cb.GetUsage(apiKey); usage != want {
+			t.Errorf("expected %d micro-dollars replayed for %s, got %d", want, apiKey, usage)
+		}
+	}
+}
@@ -2,19 +2,59 @@ package gateway
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
 )
 
 // CircuitBreaker defines the interface for the Redis-backed circuit breaker.
 // We declare it here so the proxy package is decoupled and easily testable via mocks.
 type CircuitBreaker interface {
 	CheckLimit(apiKey string) (bool, error)
-	AddUsage(apiKey string, tokenCount int) error
+	AddUsage(apiKey string, costMicroDollars int64) error
+	// SetUsage overwrites the key's usage, e.g. to settle a billing dispute.
+	SetUsage(apiKey string, costMicroDollars int64) error
 	GetUsage(apiKey string) (int64, error)
+	// Ping reports whether the usage store can be reached.
+	Ping(ctx context.Context) error
+}
+
+// KeyUsage is one key's accumulated usage.
+type KeyUsage struct {
+	APIKey           string
+	CostMicroDollars int64
+	Tokens           int64
+	// LimitMicroDollars is the key's usage limit; zero means the default MaxUsageMicroDollars.
+	LimitMicroDollars int64
+}
+
+// UsageLister is implemented by stores that can enumerate every tracked key.
+type UsageLister interface {
+	ListUsage() ([]KeyUsage, error)
+}
+
+// UsageImporter is implemented by stores that can load usage in bulk, adding
+// it to whatever the store already holds.
+type UsageImporter interface {
+	ImportUsage(usages []KeyUsage) error
+}
+
+// TokenRecorder is implemented by stores that also count tokens per key.
+type TokenRecorder interface {
+	AddTokens(apiKey string, tokens int64) error
 }
 
 // ProxyHandler is responsible for intercepting and forwarding OpenAI-compatible requests.
@@ -22,101 +62,954 @@ type ProxyHandler struct {
 	upstreamURL    *url.URL
 	circuitBreaker CircuitBreaker
 	usageChan      chan<- UsageRecord // Buffered channel for asynchronous billing
+	inFlight       sync.WaitGroup     // Requests that may still send on usageChan
+
+	// Client sends upstream requests. It is shared so connections are reused.
+	Client *http.Client
+	// Router optionally sends each model to its own provider. Models without a
+	// route go to the default upstream.
+	Router Router
+	// Upstreams optionally spreads requests to the default upstream across
+	// replicas, failing over when one can't be reached. Routed models aren't pooled.
+	Upstreams *UpstreamPool
+	// PreservePath sends requests to the default upstream at their own path,
+	// relative to its API root, rather than always to its completions
+	// endpoint, so extra proxied routes reach the matching upstream endpoint.
+	PreservePath bool
+	// RequestHeaders controls which client headers are forwarded upstream.
+	RequestHeaders *RequestHeaderPolicy
+
+	// BillingRoutes controls which paths are limit-checked and billed. Completion
+	// routes are billed by default; other paths pass through unbilled.
+	BillingRoutes BillingRoutes
+
+	// UsageEvent enables the terminal `aura.usage` SSE event for every request.
+	// Clients can also opt in per request with the UsageEventHeader.
+	UsageEvent bool
+
+	// Admission optionally bounds concurrent connections, queueing requests by tier.
+	Admission *AdmissionController
+	// TierResolver maps an API key to its tier, for admission priority and
+	// per-tier completion ceilings. Defaults to DefaultTier.
+	TierResolver func(apiKey string) string
+
+	// ForceStream turns non-streaming requests into streams, so every response is
+	// relayed as SSE. By default only requests with stream:true are streamed.
+	ForceStream bool
+	// NonStreamingModels are never forced to stream, for models that reject stream:true.
+	NonStreamingModels map[string]bool
+	// NoStreamOptions stops stream_options being injected for the default
+	// upstream, for upstreams that reject the field; routes set it per route.
+	// Their streams are billed from a tokenizer estimate of the streamed content.
+	NoStreamOptions bool
+	// AnnotateInjectedErrors adds a note to upstream 400s that reject a field the
+	// gateway injected, so clients aren't confused by a field they never sent.
+	// Such rejections are logged either way.
+	AnnotateInjectedErrors bool
+
+	// ValidateRequests rejects requests without a model, or chat completions
+	// without messages, with a 400 instead of forwarding them for the upstream
+	// to reject. Bodies that aren't a JSON object are never validated.
+	ValidateRequests bool
+
+	// JSONMode optionally forces JSON output for selected keys or routes.
+	JSONMode *JSONModePolicy
+	// PromptFilter optionally rejects prompts matching a denylist of patterns.
+	PromptFilter *PromptFilter
+
+	// ToolCalls optionally flags or rejects agent loops running too many tool-call rounds.
+	ToolCalls *ToolCallLimit
+	// MaxCompletionTokens optionally caps the tokens each request may generate,
+	// per key tier.
+	MaxCompletionTokens *CompletionTokenClamp
+
+	// UsageMetadata optionally tags usage records with fields of the request payload.
+	UsageMetadata *MetadataCapture
+	// DeadLetter keeps usage records the background processor is too backed up
+	// to accept, for DrainDeadLetter to charge later.
+	DeadLetter DeadLetterSink
+
+	// Pricing computes the cost of each request, marked up per key by Multipliers.
+	Pricing     CostCalculator
+	Multipliers *CostMultipliers
+
+	// Flush controls how often streamed output is flushed. Defaults to every line.
+	Flush FlushPolicy
+	// GzipStreams compresses event streams for clients sending Accept-Encoding: gzip.
+	GzipStreams bool
+	// MaxRequestBytes rejects request bodies larger than this with a 413 before
+	// they are read in full. Zero or less is unlimited.
+	MaxRequestBytes int64
+	// MaxResponseBytes cuts off responses larger than this, billing the usage seen
+	// so far. TruncationEvent tells streaming clients why with a final error event.
+	MaxResponseBytes int64
+	TruncationEvent  bool
+	// StreamErrorMessage replaces the message of the error event ending a failed stream.
+	StreamErrorMessage string
+
+	// Tokenizers estimates prompt tokens before forwarding.
+	Tokenizers *TokenizerRegistry
+	// RPM optionally throttles keys on requests per minute.
+	RPM RateLimiter
+	// Concurrency optionally caps the requests each key has in flight.
+	Concurrency ConcurrencyLimiter
+	// TPM optionally throttles keys on tokens per minute, using the limits in TPMLimits.
+	TPM       TokenRateLimiter
+	TPMLimits *TPMLimits
+
+	// Cache stores complete responses to deterministic requests. When StaleIfError
+	// is set, a cached response up to that age is served (with X-Aura-Stale: true)
+	// if the upstream fails, trading freshness for availability during outages.
+	Cache        ResponseCache
+	StaleIfError time.Duration
+	// CacheHits answers deterministic requests found in Cache without contacting
+	// the upstream. A hit is billed at CacheHitCostRatio of the original
+	// response's cost; zero makes hits free.
+	CacheHits         bool
+	CacheHitCostRatio float64
+	// SharedCache lets every key hit entries cached for any other. By default
+	// entries are kept per key, so a hit can't reveal another tenant's prompt
+	// or hand over its completion.
+	SharedCache bool
+
+	// StreamDurations caps how long a key's request may run, canceling the upstream
+	// (and billing the usage estimated so far) for clients that never time out.
+	StreamDurations *StreamDurationLimits
+
+	// Buffers bounds the request and response bytes buffered across all requests,
+	// shedding load with 503 instead of running out of memory.
+	Buffers *BufferBudget
+	// Egress paces requests to the upstream so bursts don't trip its rate limiter.
+	Egress *EgressLimiter
+	// Breaker optionally fails requests fast with 503 while their upstream keeps failing.
+	Breaker *UpstreamBreaker
+	// Retry optionally retries connection errors and 5xx responses before
+	// anything is relayed to the client.
+	Retry *RetryPolicy
+	// Ingest bounds how many request bodies are read concurrently, rejecting the
+	// excess with 503 before their bodies are read.
+	Ingest *IngestLimiter
+
+	// Raw forwards every request body exactly as sent, never injecting
+	// stream_options or other fields; usage is still read from the response.
+	// Bodies that aren't a JSON object are always forwarded this way.
+	Raw bool
+
+	// UpgradeURL is included in 402 responses so clients can send users to buy more credit.
+	UpgradeURL string
+	// RejectOverBudget answers 402 up front when a request's estimated prompt cost
+	// alone exceeds the key's remaining budget, instead of admitting any request
+	// made while the key is still under its limit.
+	RejectOverBudget bool
 }
 
+// StaleHeader marks a response replayed from cache because the upstream failed.
+const StaleHeader = "X-Aura-Stale"
+
+// CacheHeader marks a response answered from cache, with the value "hit".
+const CacheHeader = "X-Aura-Cache"
+
+// UsageEventHeader lets a client opt in to the terminal `aura.usage` SSE event.
+const UsageEventHeader = "X-Aura-Usage-Event"
+
+// DefaultMaxRequestBytes caps request bodies at 10MB, well above any chat prompt.
+const DefaultMaxRequestBytes = 10 << 20
+
 // NewProxyHandler initializes a new HTTP handler for the proxy.
 func NewProxyHandler(upstream *url.URL, cb CircuitBreaker, usageChan chan<- UsageRecord) *ProxyHandler {
 	return &ProxyHandler{
-		upstreamURL:    upstream,
-		circuitBreaker: cb,
-		usageChan:      usageChan,
+		upstreamURL:     upstream,
+		circuitBreaker:  cb,
+		usageChan:       usageChan,
+		Client:          &http.Client{Transport: NewUpstreamTransport(nil)},
+		RequestHeaders:  DefaultRequestHeaderPolicy,
+		Pricing:         DefaultPricing,
+		Tokenizers:      DefaultTokenizers,
+		MaxRequestBytes: DefaultMaxRequestBytes,
+	}
+}
+
+// Drain waits for in-flight requests to finish and dispatch their usage, so
+// the usage channel can be closed safely afterwards. Call it once the server
+// has stopped accepting requests. It returns ctx's error if requests are still
+// running when ctx ends.
+func (h *ProxyHandler) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// 1. Extract API Key from Authorization header
-	authHeader := r.Header.Get("Authorization")
-	var apiKey string
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		apiKey = authHeader[7:]
+	start := time.Now()
+	h.inFlight.Add(1)
+	defer h.inFlight.Done()
+
+	// 1. Extract API Key
+	apiKey := ExtractAPIKey(r)
+
+	// Utility routes skip the billing machinery entirely
+	billed := h.BillingRoutes.Bills(r.URL.Path)
+	usageChan := h.usageChan
+	if !billed {
+		usageChan = nil
 	}
 
 	// 2. Check Circuit Breaker (Block request if over $10.00 limit)
-	if apiKey != "" && h.circuitBreaker != nil {
+	if billed && apiKey != "" && h.circuitBreaker != nil {
 		allowed, err := h.circuitBreaker.CheckLimit(apiKey)
 		if err != nil {
-			http.Error(w, "Error validating rate limit", http.StatusInternalServerError)
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
 			return
 		}
 		if !allowed {
-			http.Error(w, "Limit Exceeded: Usage > $10.00", http.StatusPaymentRequired)
+			h.writeLimitExceeded(w, apiKey)
 			return
 		}
 	}
 
+	done, ok := h.admit(w, r, apiKey, billed)
+	if !ok {
+		return
+	}
+	defer done()
+
+	// Account for buffered bodies against the global memory ceiling
+	var buffered int64
+	defer func() { h.Buffers.Release(buffered) }()
+	reserveBuffer := func(n int64) bool {
+		if !h.Buffers.Reserve(n) {
+			metrics.ErrorRate.WithLabelValues("buffer_limit").Inc()
+			WriteError(w, http.StatusServiceUnavailable, "buffer_limit", "Service Unavailable: memory buffer limit reached")
+			return false
+		}
+		buffered += n
+		return true
+	}
+	// Refuse oversized bodies up front when their length is declared, and cap the read otherwise
+	if h.MaxRequestBytes > 0 {
+		if r.ContentLength > h.MaxRequestBytes {
+			writeRequestTooLarge(w, h.MaxRequestBytes)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.MaxRequestBytes)
+	}
+	if r.ContentLength > 0 && !reserveBuffer(r.ContentLength) {
+		return
+	}
+
+	// Shed excess uploads before reading their bodies
+	if !h.Ingest.Acquire() {
+		metrics.ErrorRate.WithLabelValues("ingest_limit").Inc()
+		WriteError(w, http.StatusServiceUnavailable, "ingest_limit", "Service Unavailable: too many request bodies being read")
+		return
+	}
+
 	// 3. Read incoming request body to inject `stream_options`
 	bodyBytes, err := io.ReadAll(r.Body)
+	h.Ingest.Release()
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeRequestTooLarge(w, tooLarge.Limit)
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "request_read_failed", "Error reading request body")
 		return
 	}
 	defer r.Body.Close()
+	// Chunked bodies are only accounted once their size is known
+	if r.ContentLength <= 0 && !reserveBuffer(int64(len(bodyBytes))) {
+		return
+	}
 
+	// Bodies that aren't a JSON object, e.g. compressed ones, are opaque to the
+	// gateway and forwarded byte for byte like every body in Raw mode; their
+	// usage is still read from the response
 	var payload map[string]interface{}
+	var opaque bool
 	if len(bodyBytes) > 0 {
 		// Use a json Decoder with UseNumber so we don't convert int to float64 silently
 		decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
 		decoder.UseNumber()
 		if err := decoder.Decode(&payload); err != nil {
-			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
-			return
+			payload, opaque = nil, true
 		}
 	}
+	raw := h.Raw || opaque
 
 	if payload == nil {
 		payload = make(map[string]interface{})
 	}
+	model, _ := payload["model"].(string)
+	messages, _ := payload["messages"].([]interface{})
+	tokenizer := h.Tokenizers.For(model)
+	// Opaque bodies can't be estimated, so they reserve nothing up front
+	var promptEstimate int
+	if !opaque {
+		promptEstimate = EstimatePromptTokens(tokenizer, messages)
+	}
 
-	// Inject stream_options: {"include_usage": true} so the upstream sends back token usage
-	// Also ensure "stream": true is set for this workflow
-	payload["stream"] = true
-	payload["stream_options"] = map[string]interface{}{
-		"include_usage": true,
+	if h.ValidateRequests && !opaque {
+		if reason := validateRequest(r.URL.Path, payload); reason != "" {
+			metrics.ErrorRate.WithLabelValues("invalid_request").Inc()
+			writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: APIError{
+				Message: reason,
+				Type:    "invalid_request_error",
+				Code:    "missing_required_parameter",
+			}})
+			return
+		}
 	}
 
-	modifiedBody, err := json.Marshal(payload)
-	if err != nil {
-		http.Error(w, "Error marshaling modified payload", http.StatusInternalServerError)
+	if rule, matched := h.PromptFilter.Match(messages); matched {
+		writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: APIError{
+			Message: fmt.Sprintf("Prompt rejected by content filter rule %q", rule),
+			Type:    "invalid_request_error",
+			Code:    "content_filtered",
+		}})
+		return
+	}
+
+	if h.ToolCalls.Check(apiKey, r.Header.Get(observability.RequestIDHeader), messages) {
+		writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: APIError{
+			Message: fmt.Sprintf("Conversation exceeds the limit of %d tool-call rounds", h.ToolCalls.MaxRounds),
+			Type:    "invalid_request_error",
+			Code:    "tool_call_rounds_exceeded",
+		}})
+		return
+	}
+
+	// Remember what the gateway adds to the payload, so an upstream rejecting it can be explained
+	var injected []string
+	var modified bool
+
+	// Runaway generations are cut down to the tier's ceiling before anything is estimated from them
+	if limit := h.MaxCompletionTokens.For(h.tier(apiKey)); !raw && limit > 0 {
+		if field, requested := h.MaxCompletionTokens.Apply(payload, limit); field != "" {
+			slog.Info("Clamped completion tokens",
+				"request_id", r.Header.Get(observability.RequestIDHeader),
+				observability.APIKeyAttr(apiKey),
+				"model", model,
+				"field", field,
+				"requested", requested,
+				"limit", limit,
+			)
+			if requested == 0 {
+				injected = append(injected, field)
+			}
+			modified = true
+		}
+	}
+
+	// Fail requests that can't fit the model's context window without an upstream round trip
+	if window, ok := h.Tokenizers.ContextWindow(model); ok {
+		completionTokens, _ := PayloadInt(payload, "max_completion_tokens")
+		if completionTokens == 0 {
+			completionTokens, _ = PayloadInt(payload, "max_tokens")
+		}
+		if requested := int64(promptEstimate) + completionTokens; requested > int64(window) {
+			metrics.ErrorRate.WithLabelValues("context_length").Inc()
+			writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: APIError{
+				Message: fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested about %d tokens "+
+					"(%d estimated in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+					window, requested, promptEstimate, completionTokens),
+				Type: "invalid_request_error",
+				Code: "context_length_exceeded",
+			}})
+			return
+		}
+	}
+
+	reserved, ok := h.reserve(w, apiKey, model, promptEstimate, billed)
+	if !ok {
+		return
+	}
+	costReserved := reserved
+	// Nothing was consumed on the early returns below, so both reservations are released
+	release := func() { h.release(reserved) }
+
+	route, routed := h.Router.Lookup(model)
+	noStreamOptions := route.NoStreamOptions || (!routed && h.NoStreamOptions)
+
+	// Inject stream_options: {"include_usage": true} into streaming requests so the
+	// upstream sends back token usage. Non-streaming requests are forwarded as sent
+	// and report usage in the JSON body, unless ForceStream turns them into streams;
+	// models that can't stream are never forced. Upstreams that reject the field
+	// get neither, so their streams are estimated instead.
+	clientStreams, _ := payload["stream"].(bool)
+	if !raw && !noStreamOptions && !h.NonStreamingModels[model] && (clientStreams || h.ForceStream) && !streamsWithUsage(payload) {
+		// The client's own options are kept, only include_usage is turned on
+		options := make(map[string]interface{})
+		if clientOptions, ok := payload["stream_options"].(map[string]interface{}); ok {
+			for k, v := range clientOptions {
+				options[k] = v
+			}
+		} else {
+			injected = append(injected, "stream_options")
+		}
+		if !clientStreams {
+			injected = append(injected, "stream")
+		}
+		options["include_usage"] = true
+		payload["stream"] = true
+		payload["stream_options"] = options
+		modified = true
+	}
+
+	// Guarantee JSON output for integrations that require it
+	if !raw && h.JSONMode.Applies(apiKey, r.URL.Path) && h.JSONMode.Apply(payload) {
+		injected = append(injected, "response_format")
+		modified = true
+	}
+
+	// Providers with their own format get the payload translated
+	adapter := route.adapter()
+	if opaque && adapter != nil {
+		release()
+		writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: APIError{
+			Message: "Request can't be translated for the upstream: the body is not a JSON object",
+			Type:    "invalid_request_error",
+		}})
 		return
 	}
 
+	// Well-behaved clients already ask for everything we need, so their body is
+	// forwarded as sent rather than re-encoded
+	modifiedBody := bodyBytes
+	if modified || adapter != nil {
+		if adapter != nil {
+			modifiedBody, err = adapter.TranslateRequest(payload)
+		} else {
+			modifiedBody, err = json.Marshal(payload)
+		}
+		if err != nil {
+			release()
+			writeJSONError(w, http.StatusBadRequest, ErrorResponse{Error: APIError{
+				Message: fmt.Sprintf("Request can't be translated for the upstream: %v", err),
+				Type:    "invalid_request_error",
+			}})
+			return
+		}
+		if !reserveBuffer(int64(len(modifiedBody))) {
+			release()
+			return
+		}
+	}
+
+	var cacheKey string
+	var cacheable bool
+	if h.Cache != nil && !opaque {
+		scope := apiKey
+		if h.SharedCache {
+			scope = ""
+		}
+		cacheKey, cacheable = CacheKey(scope, r.URL.Path, payload)
+	}
+
+	// Identical deterministic requests are answered without an upstream round trip
+	if cacheable && h.CacheHits {
+		if charged, hit := h.serveCached(w, r, apiKey, cacheKey, usageChan, payload, costReserved); hit {
+			if charged {
+				reserved.cost = 0
+			}
+			h.release(reserved)
+			return
+		}
+	}
+
+	// The upstream request ends with the client's, so a disconnected client
+	// stops the generation it would have paid for without reading
+	ctx := r.Context()
+	if maxDuration := h.StreamDurations.For(apiKey); maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxDuration)
+		defer cancel()
+	}
+
 	// 4. Construct Upstream Request
-	upstreamReq, err := http.NewRequest(r.Method, h.upstreamURL.String(), bytes.NewReader(modifiedBody))
+	metrics.RequestBytes.Observe(float64(len(modifiedBody)))
+	endpoint := h.upstreamURL.String()
+	if routed {
+		stream, _ := payload["stream"].(bool)
+		endpoint = route.endpoint(model, relativePath(r.URL.Path), stream)
+	} else if h.PreservePath {
+		endpoint = preservedPath(h.upstreamURL, r.URL.Path).String()
+	}
+	upstreamReq, err := http.NewRequestWithContext(ctx, r.Method, endpoint, bytes.NewReader(modifiedBody))
 	if err != nil {
-		http.Error(w, "Error creating upstream request", http.StatusInternalServerError)
+		release()
+		WriteError(w, http.StatusInternalServerError, "internal_error", "Error creating upstream request")
 		return
 	}
 
-	// Copy headers, avoiding Content-Length since body length has changed
-	for k, vv := range r.Header {
-		if k == "Content-Length" {
-			continue
+	// Copy the permitted headers, avoiding Content-Length since body length has changed
+	copyRequestHeaders(upstreamReq.Header, r.Header, h.RequestHeaders)
+	forwardAPIKey(upstreamReq, apiKey)
+	if routed {
+		route.rewriteHeaders(upstreamReq.Header)
+	}
+	// The rewritten body has a fixed length, so it's never sent chunked even if the
+	// client's was; Transfer-Encoding is dropped with the other hop-by-hop headers.
+	upstreamReq.ContentLength = int64(len(modifiedBody))
+	upstreamReq.Header.Set("Content-Length", fmt.Sprintf("%d", len(modifiedBody)))
+	// Redacting copies the payload, so it's skipped unless debug logging is on
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		slog.Debug("Forwarding request upstream",
+			"request_id", r.Header.Get(observability.RequestIDHeader),
+			observability.APIKeyAttr(apiKey),
+			"model", model,
+			"upstream", upstreamReq.URL.Host+upstreamReq.URL.Path,
+			"routed", routed,
+			"body_bytes", len(modifiedBody),
+			"rewritten", modified || adapter != nil,
+			"injected", injected,
+			"headers", observability.RedactHeaders(upstreamReq.Header),
+			"payload", observability.RedactPayload(payload),
+		)
+	}
+
+	// Fail fast while the upstream is known to be down. Pooled replicas each
+	// have their own circuit, checked as the pool picks them, so one failing
+	// replica doesn't take the others out of rotation.
+	pooled := h.Upstreams != nil && !routed
+	upstream := upstreamReq.URL.Host
+	circuitOpen := func(wait time.Duration, code, message string) {
+		release()
+		if cacheable && h.serveStale(w, cacheKey) {
+			return
 		}
-		for _, v := range vv {
-			upstreamReq.Header.Add(k, v)
+		metrics.ErrorRate.WithLabelValues(code).Inc()
+		w.Header().Set("Retry-After", retryAfterSeconds(wait))
+		WriteError(w, http.StatusServiceUnavailable, code, message)
+	}
+	if !pooled {
+		if allowed, wait := h.Breaker.Allow(upstream); !allowed {
+			circuitOpen(wait, "circuit_open", "Service Unavailable: upstream circuit open")
+			return
 		}
 	}
-	upstreamReq.Header.Set("Content-Length", fmt.Sprintf("%d", len(modifiedBody)))
+
+	// Queue briefly rather than bursting past the provider's rate limit, but
+	// not beyond the key's stream duration
+	if !h.Egress.Wait(ctx) {
+		if !pooled {
+			h.Breaker.Cancel(upstream)
+		}
+		release()
+		metrics.ErrorRate.WithLabelValues("egress_limit").Inc()
+		WriteError(w, http.StatusServiceUnavailable, "egress_limit", "Service Unavailable: upstream request rate exceeded")
+		return
+	}
 
 	// 5. Send to Upstream
-	client := &http.Client{}
-	resp, err := client.Do(upstreamReq)
+	send := func(req *http.Request) (*http.Response, error) {
+		return h.Retry.do(h.Client, req, h.Egress)
+	}
+	var resp *http.Response
+	if pooled {
+		var soonest time.Duration // until the first open replica circuit lets a probe through
+		resp, err = h.Upstreams.do(upstreamReq, func(req *http.Request) (*http.Response, error) {
+			if h.PreservePath {
+				// Replicas are configured by their completions endpoint too
+				req.URL = preservedPath(req.URL, r.URL.Path)
+				req.Host = req.URL.Host
+			}
+			replica := req.URL.Host
+			if allowed, wait := h.Breaker.Allow(replica); !allowed {
+				if soonest == 0 || wait < soonest {
+					soonest = wait
+				}
+				return nil, errCircuitOpen
+			}
+			resp, err := send(req)
+			h.Breaker.observe(ctx, replica, resp, err)
+			return resp, err
+		})
+		if errors.Is(err, errCircuitOpen) {
+			// Every replica left to try was open; retry once the first can be probed
+			circuitOpen(soonest, "all_circuits_open", "Service Unavailable: every upstream replica's circuit is open")
+			return
+		}
+	} else {
+		resp, err = send(upstreamReq)
+		h.Breaker.observe(ctx, upstream, resp, err)
+	}
 	if err != nil {
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		// Nothing was consumed, so release the reservations
+		release()
+		if cacheable && h.serveStale(w, cacheKey) {
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			metrics.StreamTimeouts.Inc()
+			WriteError(w, http.StatusGatewayTimeout, "upstream_timeout", "Gateway Timeout")
+			return
+		}
+		// The upstream was too slow to connect or send headers
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			metrics.ErrorRate.WithLabelValues("upstream_timeout").Inc()
+			WriteError(w, http.StatusGatewayTimeout, "upstream_timeout", "Gateway Timeout")
+			return
+		}
+		WriteError(w, http.StatusBadGateway, "upstream_error", "Bad Gateway")
 		return
 	}
 	defer resp.Body.Close()
+	if adapter != nil {
+		resp = adapter.TranslateResponse(resp)
+	}
+	if resp.StatusCode >= 500 {
+		metrics.ErrorRate.WithLabelValues("upstream_5xx").Inc()
+	} else if resp.StatusCode >= 400 {
+		metrics.ErrorRate.WithLabelValues("upstream_4xx").Inc()
+	}
+
+	if resp.StatusCode >= 500 && cacheable && h.serveStale(w, cacheKey) {
+		release()
+		return
+	}
+
+	if resp.StatusCode == http.StatusBadRequest && len(injected) > 0 {
+		release()
+		forwardInjectedFieldError(w, resp, apiKey, injected, h.AnnotateInjectedErrors)
+		return
+	}
+
+	// Errors consume nothing and carry no usage, so they skip the stream path
+	if resp.StatusCode >= 400 {
+		release()
+		forwardUpstreamError(w, resp)
+		return
+	}
+
+	// Capture successful deterministic responses so they can be replayed later
+	var capture *captureReader
+	if cacheable && resp.StatusCode == http.StatusOK {
+		capture = &captureReader{ReadCloser: resp.Body, limit: DefaultCacheMaxBytes, budget: h.Buffers}
+		defer capture.release()
+		resp.Body = capture
+	}
 
 	// 6. Pass response to stream handler
-	StreamResponse(w, resp, apiKey, h.usageChan)
+	opts := StreamOptions{
+		EmitUsageEvent: h.UsageEvent || r.Header.Get(UsageEventHeader) == "true",
+		RequestID:      r.Header.Get(observability.RequestIDHeader),
+		Metadata:       h.UsageMetadata.Capture(payload),
+		Model:          model,
+		Pricing:        h.Pricing,
+		CostMultiplier: h.Multipliers.For(apiKey),
+		Flush:          h.Flush,
+		Start:          start,
+		Tokenizer:      tokenizer,
+		PromptTokens:   promptEstimate,
+		EstimateUsage:  noStreamOptions,
+
+		MaxBytes:        h.MaxResponseBytes,
+		TruncationEvent: h.TruncationEvent,
+		ErrorMessage:    h.StreamErrorMessage,
+
+		ReservedMicroDollars: costReserved.cost,
+		ReservationResetsAt:  costReserved.resetsAt,
+		DeadLetter:           h.DeadLetter,
+		Gzip:                 h.GzipStreams && acceptsGzip(r.Header.Get("Accept-Encoding")),
+	}
+	record := StreamResponse(w, resp, apiKey, usageChan, opts)
+
+	if capture != nil && capture.complete() && !record.Partial {
+		err := h.Cache.Set(cacheKey, &CachedResponse{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        capture.buf,
+			StoredAt:    time.Now(),
+			Usage: &CachedUsage{
+				Model:                 record.Model,
+				TokenCount:            record.TokenCount,
+				PromptTokens:          record.PromptTokens,
+				CompletionTokens:      record.CompletionTokens,
+				AudioPromptTokens:     record.AudioPromptTokens,
+				AudioCompletionTokens: record.AudioCompletionTokens,
+			},
+		})
+		if err != nil {
+			slog.Error("Failed to cache response", "request_id", opts.RequestID, "error", err)
+		}
+	}
+
+	h.settle(reserved, record)
+}
+
+// admit applies the per-key request limits every billed endpoint shares:
+// requests per minute and concurrent requests, then the connection queue. It
+// writes the rejection itself; otherwise done must be called once the
+// response has been relayed.
+func (h *ProxyHandler) admit(w http.ResponseWriter, r *http.Request, apiKey string, billed bool) (done func(), ok bool) {
+	var releases []func()
+	done = func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	// Throttle bursts of requests regardless of the budget left
+	if billed && apiKey != "" && h.RPM != nil {
+		allowed, err := h.RPM.Allow(apiKey)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
+			return nil, false
+		}
+		if !allowed {
+			metrics.RateLimited.WithLabelValues("rpm").Inc()
+			w.Header().Set("Retry-After", retryAfterSeconds(h.RPM.RetryAfter(apiKey)))
+			WriteError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate Limit Exceeded: requests per minute")
+			return nil, false
+		}
+	}
+
+	// One key's streams may not take every connection. The slot is held until
+	// the response has been relayed, however it ends.
+	if billed && apiKey != "" && h.Concurrency != nil {
+		acquired, err := h.Concurrency.Acquire(apiKey)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
+			return nil, false
+		}
+		if !acquired {
+			metrics.RateLimited.WithLabelValues("concurrency").Inc()
+			WriteError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate Limit Exceeded: too many concurrent requests")
+			return nil, false
+		}
+		inFlight := metrics.ConcurrentRequests.WithLabelValues(metrics.HashAPIKey(apiKey))
+		inFlight.Inc()
+		releases = append(releases, func() {
+			inFlight.Dec()
+			h.Concurrency.Release(apiKey)
+		})
+	}
+
+	// Bound concurrent connections, letting higher-priority tiers jump the queue
+	if h.Admission != nil {
+		release, ok := h.Admission.Acquire(r.Context(), h.tier(apiKey))
+		if !ok {
+			done()
+			WriteError(w, http.StatusServiceUnavailable, "admission_queue_full", "Service Unavailable: too many concurrent connections")
+			return nil, false
+		}
+		releases = append(releases, release)
+	}
+	return done, true
+}
+
+// reservation is what a request holds against its key's limits until its
+// usage is known.
+type reservation struct {
+	apiKey   string
+	tpmLimit int
+	tokens   int   // reserved against the TPM limit
+	cost     int64 // charged against the budget
+	// resetsAt is when the usage window the cost was charged in ends, zero if never
+	resetsAt time.Time
+}
+
+// reserve throttles the key on tokens per minute, reserving the prompt
+// estimate until the real usage is known, then charges the prompt's
+// estimated cost up front, atomically with the limit check, so concurrent
+// requests can't all slip under the limit before any usage lands. The usage
+// record carries the cost reservation so only the difference is added later.
+// It writes the rejection itself.
+func (h *ProxyHandler) reserve(w http.ResponseWriter, apiKey, model string, promptEstimate int, billed bool) (reservation, bool) {
+	reserved := reservation{apiKey: apiKey, tpmLimit: h.TPMLimits.For(apiKey)}
+	if !billed || apiKey == "" {
+		return reserved, true
+	}
+
+	if h.TPM != nil && reserved.tpmLimit > 0 {
+		// Retrying can't help a prompt larger than the whole minute's budget
+		if promptEstimate > reserved.tpmLimit {
+			metrics.ErrorRate.WithLabelValues("tpm_limit").Inc()
+			writeJSONError(w, http.StatusRequestEntityTooLarge, ErrorResponse{Error: APIError{
+				Message: fmt.Sprintf("This request is about %d tokens, more than this key's limit of %d tokens per minute. "+
+					"Please reduce the length of the messages.", promptEstimate, reserved.tpmLimit),
+				Type: "invalid_request_error",
+				Code: "tpm_limit_exceeded",
+			}})
+			return reserved, false
+		}
+		allowed, retryAfter, err := h.TPM.Reserve(apiKey, promptEstimate, reserved.tpmLimit)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
+			return reserved, false
+		}
+		if !allowed {
+			metrics.RateLimited.WithLabelValues("tpm").Inc()
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			WriteError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate Limit Exceeded: tokens per minute")
+			return reserved, false
+		}
+		reserved.tokens = promptEstimate
+	}
+
+	if h.circuitBreaker != nil && h.usageChan != nil {
+		estimate := (&StreamOptions{Pricing: h.Pricing, CostMultiplier: h.Multipliers.For(apiKey)}).cost(
+			UsageRecord{Model: model, PromptTokens: promptEstimate, TokenCount: promptEstimate})
+		if h.RejectOverBudget && !fitsBudget(h.circuitBreaker, apiKey, estimate) {
+			h.release(reserved)
+			h.writeLimitExceeded(w, apiKey)
+			return reserved, false
+		}
+		// Read before charging: should the window roll over in between, the
+		// reservation is then kept rather than refunded into the new window
+		if resetsAt := ResetTime(h.circuitBreaker); resetsAt != nil {
+			reserved.resetsAt = *resetsAt
+		}
+		allowed, err := checkAndReserve(h.circuitBreaker, apiKey, estimate)
+		if err != nil {
+			h.release(reserved)
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
+			return reserved, false
+		}
+		if !allowed {
+			h.release(reserved)
+			h.writeLimitExceeded(w, apiKey)
+			return reserved, false
+		}
+		reserved.cost = estimate
+	}
+	return reserved, true
+}
+
+// release gives back a reservation for a request that consumed nothing.
+func (h *ProxyHandler) release(reserved reservation) {
+	h.reconcileTPM(reserved.apiKey, reserved.tpmLimit, reserved.tokens, 0)
+	h.releaseCost(reserved)
+}
+
+// settle replaces the TPM estimate with the request's real token count. Without
+// reported usage the estimate stays in place as the best available figure,
+// and the cost reservation is released as no usage record settles it.
+func (h *ProxyHandler) settle(reserved reservation, record UsageRecord) {
+	if record.TokenCount > 0 {
+		h.reconcileTPM(reserved.apiKey, reserved.tpmLimit, reserved.tokens, record.TokenCount)
+	} else {
+		h.releaseCost(reserved)
+	}
+}
+
+// tier returns the key's tier, DefaultTier without a TierResolver.
+func (h *ProxyHandler) tier(apiKey string) string {
+	if h.TierResolver == nil {
+		return DefaultTier
+	}
+	return h.TierResolver(apiKey)
+}
+
+// releaseCost refunds a cost reservation for a request that consumed nothing.
+// A reservation whose window has ended was cleared with it, so refunding it
+// would take the key below zero in the new window.
+func (h *ProxyHandler) releaseCost(reserved reservation) {
+	if reserved.cost == 0 || windowEnded(h.circuitBreaker, reserved.resetsAt) {
+		return
+	}
+	if err := h.circuitBreaker.AddUsage(reserved.apiKey, -reserved.cost); err != nil {
+		slog.Error("Failed to release cost reservation", observability.APIKeyAttr(reserved.apiKey), "error", err)
+	}
+}
+
+// reconcileTPM corrects a TPM reservation to the actual token count and refreshes
+// the key's utilization metric.
+func (h *ProxyHandler) reconcileTPM(apiKey string, limit, reserved, actual int) {
+	if reserved == 0 {
+		return
+	}
+	if err := h.TPM.Adjust(apiKey, actual-reserved); err != nil {
+		slog.Error("Failed to reconcile TPM usage", observability.APIKeyAttr(apiKey), "error", err)
+		return
+	}
+	if usage, err := h.TPM.Usage(apiKey); err == nil {
+		metrics.TPMUtilization.WithLabelValues(metrics.HashAPIKey(apiKey)).Set(float64(usage) / float64(limit))
+	}
+}
+
+// serveStale replays a cached response while the upstream is failing, provided one
+// exists within the StaleIfError bound. It reports whether a response was served.
+func (h *ProxyHandler) serveStale(w http.ResponseWriter, cacheKey string) bool {
+	if h.StaleIfError <= 0 {
+		return false
+	}
+	cached, ok, err := h.Cache.Get(cacheKey)
+	if err != nil || !ok {
+		return false
+	}
+	age := time.Since(cached.StoredAt)
+	if age > h.StaleIfError {
+		return false
+	}
+
+	metrics.StaleResponses.Inc()
+	w.Header().Set("Content-Type", cached.ContentType)
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+	w.Header().Set(StaleHeader, "true")
+	w.WriteHeader(cached.StatusCode)
+	w.Write(cached.Body)
+	return true
+}
+
+// serveCached replays a cached response to a deterministic request, reporting
+// whether there was one. Unless hits are free, the original usage is billed at
+// CacheHitCostRatio, settling the reservation; charged reports whether a
+// usage record was dispatched to do so.
+func (h *ProxyHandler) serveCached(w http.ResponseWriter, r *http.Request, apiKey, cacheKey string, usageChan chan<- UsageRecord, payload map[string]interface{}, reserved reservation) (charged, hit bool) {
+	cached, ok, err := h.Cache.Get(cacheKey)
+	if err != nil {
+		slog.Error("Failed to read response cache", "request_id", r.Header.Get(observability.RequestIDHeader), "error", err)
+		return false, false
+	}
+	if !ok {
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
+		return false, false
+	}
+
+	metrics.CacheLookups.WithLabelValues("hit").Inc()
+	w.Header().Set("Content-Type", cached.ContentType)
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+	w.Header().Set(CacheHeader, "hit")
+	w.WriteHeader(cached.StatusCode)
+	w.Write(cached.Body)
+
+	if h.CacheHitCostRatio <= 0 || cached.Usage == nil || usageChan == nil || apiKey == "" || cached.Usage.TokenCount <= 0 {
+		return false, true
+	}
+	opts := StreamOptions{
+		RequestID:            r.Header.Get(observability.RequestIDHeader),
+		Metadata:             h.UsageMetadata.Capture(payload),
+		Model:                cached.Usage.Model,
+		Pricing:              h.Pricing,
+		CostMultiplier:       h.Multipliers.For(apiKey),
+		ReservedMicroDollars: reserved.cost,
+		ReservationResetsAt:  reserved.resetsAt,
+	}
+	record := opts.newRecord(apiKey)
+	record.TokenCount = cached.Usage.TokenCount
+	record.PromptTokens = cached.Usage.PromptTokens
+	record.CompletionTokens = cached.Usage.CompletionTokens
+	record.AudioPromptTokens = cached.Usage.AudioPromptTokens
+	record.AudioCompletionTokens = cached.Usage.AudioCompletionTokens
+	opts.price(&record)
+	record.CostMicroDollars = markup(record.CostMicroDollars, h.CacheHitCostRatio)
+	record.BaseCostMicroDollars = markup(record.BaseCostMicroDollars, h.CacheHitCostRatio)
+	dispatchUsage(record, usageChan, h.DeadLetter)
+	return true, true
+}
+
+// retryAfterSeconds formats a Retry-After header value, rounding up to whole seconds.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds()))))
 }
@@ -2,14 +2,22 @@ package gateway_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"aura-ai-gateway/internal/gateway"
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // MockCircuitBreaker is a simple mock for testing the proxy handler
@@ -23,8 +31,13 @@ func (m *MockCircuitBreaker) CheckLimit(apiKey string) (bool, error) {
 	return m.Allowed, m.Err
 }
 
-func (m *MockCircuitBreaker) AddUsage(apiKey string, tokenCount int) error {
-	m.Usage += int64(tokenCount) * gateway.CostPerTokenMicroDollars
+func (m *MockCircuitBreaker) AddUsage(apiKey string, costMicroDollars int64) error {
+	m.Usage += costMicroDollars
+	return nil
+}
+
+func (m *MockCircuitBreaker) SetUsage(apiKey string, costMicroDollars int64) error {
+	m.Usage = costMicroDollars
 	return nil
 }
 
@@ -32,6 +45,10 @@ func (m *MockCircuitBreaker) GetUsage(apiKey string) (int64, error) {
 	return m.Usage, nil
 }
 
+func (m *MockCircuitBreaker) Ping(ctx context.Context) error {
+	return m.Err
+}
+
 func TestProxyHandler_ServeHTTP(t *testing.T) {
 	// Setup a mock upstream server
 	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -62,7 +79,7 @@ func TestProxyHandler_ServeHTTP(t *testing.T) {
 	proxyHandler := gateway.NewProxyHandler(upstreamURL, cb, usageChan)
 
 	// Create test request
-	reqBody := []byte(`{"model": "gpt-3.5-turbo", "messages": [{"role": "user", "content": "Hello!"}]}`)
+	reqBody := []byte(`{"model": "gpt-3.5-turbo", "stream": true, "messages": [{"role": "user", "content": "Hello!"}]}`)
 	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(reqBody))
 	req.Header.Set("Authorization", "Bearer test-key")
 
@@ -91,3 +108,352 @@ func TestProxyHandler_RateLimit(t *testing.T) {
 		t.Errorf("expected status 402 Payment Required, got %d", rr.Code)
 	}
 }
+
+func TestProxyHandler_RequestTooLarge(t *testing.T) {
+	contacted := false
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted = true
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.MaxRequestBytes = 64
+	body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": "` + strings.Repeat("a", 100) + `"}]}`
+
+	// Declared length, and chunked with the length unknown until read
+	for _, contentLength := range []int64{int64(len(body)), -1} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.ContentLength = contentLength
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("content length %d: expected 413, got %d", contentLength, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), "request_too_large") {
+			t.Errorf("content length %d: expected a request_too_large error, got %q", contentLength, rr.Body.String())
+		}
+	}
+	if contacted {
+		t.Error("expected the upstream not to be contacted")
+	}
+}
+
+func TestProxyHandler_LimitExceededBody(t *testing.T) {
+	upstreamURL, _ := url.Parse("http://dummy.com")
+	cb := &MockCircuitBreaker{Allowed: false, Usage: 10000120}
+
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, cb, nil)
+	proxyHandler.UpgradeURL = "https://example.com/billing"
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte("{}")))
+	req.Header.Set("Authorization", "Bearer test-key")
+
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected status 402 Payment Required, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON body, got Content-Type %q", ct)
+	}
+
+	var body gateway.LimitExceededResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode 402 body: %v", err)
+	}
+	if body.Error.Code != "usage_limit_exceeded" {
+		t.Errorf("expected error code usage_limit_exceeded, got %q", body.Error.Code)
+	}
+	if body.LimitDollars != 10 || body.UsageDollars != 10.00012 {
+		t.Errorf("expected limit 10 and usage 10.00012, got %v and %v", body.LimitDollars, body.UsageDollars)
+	}
+	if body.UpgradeURL != "https://example.com/billing" {
+		t.Errorf("expected the configured upgrade URL, got %q", body.UpgradeURL)
+	}
+}
+
+func TestProxyHandler_LimitExceededMetricHashesKey(t *testing.T) {
+	upstreamURL, _ := url.Parse("http://dummy.com")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: false}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte("{}")))
+	req.Header.Set("Authorization", "Bearer sk-metrics-secret")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	hashed := metrics.HashAPIKey("sk-metrics-secret")
+	if got := testutil.ToFloat64(metrics.LimitExceeded.WithLabelValues(hashed)); got != 1 {
+		t.Errorf("expected one rejection under the hashed key %q, got %v", hashed, got)
+	}
+	if metrics.LimitExceeded.DeleteLabelValues("sk-metrics-secret") {
+		t.Error("expected no series labeled with the plaintext key")
+	}
+}
+
+func TestProxyHandler_UsageRecordCorrelation(t *testing.T) {
+	var forwardedID string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedID = r.Header.Get(observability.RequestIDHeader)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"model\":\"gpt-4o-2024-08-06\",\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":1000,\"total_tokens\":2000}}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.Multipliers = &gateway.CostMultipliers{Keys: map[string]float64{"test-key": 2}}
+	handler := observability.AccessLog(slog.New(slog.NewJSONHandler(io.Discard, nil)), observability.AccessLogPolicy{}, proxyHandler)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4o"}`)))
+	req.Header.Set("Authorization", "Bearer test-key")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if forwardedID == "" {
+		t.Fatal("expected a request ID to be assigned and forwarded upstream")
+	}
+	select {
+	case record := <-usageChan:
+		if record.RequestID != forwardedID {
+			t.Errorf("expected the record to carry request ID %q, got %q", forwardedID, record.RequestID)
+		}
+		if record.Model != "gpt-4o-2024-08-06" || record.TokenCount != 2000 {
+			t.Errorf("expected the upstream model and token count, got %+v", record)
+		}
+		// 12500 micro-dollars at list price, doubled by the key's multiplier
+		if record.CostMicroDollars != 25000 || record.BaseCostMicroDollars != 12500 || !record.Priced {
+			t.Errorf("expected a marked-up cost of 25000 over a base of 12500, got %+v", record)
+		}
+	default:
+		t.Fatal("expected a usage record")
+	}
+}
+
+func TestProxyHandler_RequestIDBypassesHeaderPolicy(t *testing.T) {
+	var forwardedID string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedID = r.Header.Get(observability.RequestIDHeader)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.RequestHeaders = gateway.NewRequestHeaderPolicy([]string{"Authorization"}, nil)
+	handler := observability.RequestID(true, proxyHandler)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4o"}`)))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	echoed := rr.Header().Get(observability.RequestIDHeader)
+	if echoed == "" {
+		t.Fatal("expected the response to carry a generated request ID")
+	}
+	if forwardedID != echoed {
+		t.Errorf("expected the request ID %q forwarded despite the allowlist, got %q", echoed, forwardedID)
+	}
+}
+
+func TestProxyHandler_ErrorEchoesRequestID(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req_upstream")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"bad","type":"invalid_request_error"}}`)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: false}, nil)
+	handler := observability.RequestID(true, proxyHandler)
+
+	// Rejected by the gateway itself
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte("{}")))
+	req.Header.Set("Authorization", "Bearer test-key")
+	req.Header.Set(observability.RequestIDHeader, "req_123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get(observability.RequestIDHeader); got != "req_123" {
+		t.Errorf("expected the request ID header on the 402, got %q", got)
+	}
+	var body gateway.LimitExceededResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode 402 body: %v", err)
+	}
+	if body.RequestID != "req_123" {
+		t.Errorf("expected the request ID in the 402 body, got %q", body.RequestID)
+	}
+
+	// Relayed from the upstream, which has its own request ID
+	proxyHandler = gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	req = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"stream": true, "stream_options": {}}`)))
+	req.Header.Set(observability.RequestIDHeader, "req_456")
+	rr = httptest.NewRecorder()
+	observability.RequestID(true, proxyHandler).ServeHTTP(rr, req)
+
+	if got := rr.Header().Get(observability.RequestIDHeader); got != "req_456" {
+		t.Errorf("expected the gateway's request ID to win over the upstream's, got %q", got)
+	}
+	if got := rr.Header().Get(gateway.UpstreamRequestIDHeader); got != "req_upstream" {
+		t.Errorf("expected the upstream's request ID under %s, got %q", gateway.UpstreamRequestIDHeader, got)
+	}
+}
+
+func TestGatewayErrors_CarryRequestID(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.RPM = gateway.NewMemoryRateLimiter(&gateway.RPMLimits{Default: 1})
+	models := gateway.NewModelsHandler(upstreamURL, nil, &MockCircuitBreaker{Allowed: true})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		status  int
+	}{
+		{"401 without a key", models, "/v1/models", http.StatusUnauthorized},
+		{"429 over the RPM limit", proxyHandler, "/v1/chat/completions", http.StatusTooManyRequests},
+	}
+	// The first request uses up the RPM limit
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o"}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, strings.NewReader(`{"model": "gpt-4o"}`))
+			if tt.status != http.StatusUnauthorized {
+				req.Method = "POST"
+				req.Header.Set("Authorization", "Bearer test-key")
+			}
+			req.Header.Set(observability.RequestIDHeader, "req_789")
+			rr := httptest.NewRecorder()
+			observability.RequestID(true, tt.handler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, rr.Code)
+			}
+			var body gateway.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("expected a JSON error body: %v", err)
+			}
+			if body.RequestID != "req_789" {
+				t.Errorf("expected the request ID in the body, got %q", body.RequestID)
+			}
+			if body.Error.Message == "" || body.Error.Type == "" {
+				t.Errorf("expected a typed error with a message, got %+v", body.Error)
+			}
+		})
+	}
+}
+
+// decodePayload decodes a request body the way ProxyHandler does, preserving numbers.
+func decodePayload(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+	var payload map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	return payload
+}
+
+func TestProxyHandler_DrainDuringShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		close(started)
+		<-release
+		io.WriteString(w, "data: {\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":18}}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	gatewayServer := httptest.NewServer(proxyHandler)
+	defer gatewayServer.Close()
+
+	go func() {
+		req, _ := http.NewRequest("POST", gatewayServer.URL+"/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	// Shutdown waits for the stream, which finishes after shutdown has begun
+	shutdown := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() { shutdown <- gatewayServer.Config.Shutdown(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-shutdown; err != nil {
+		t.Fatalf("expected the server to shut down cleanly, got %v", err)
+	}
+	if err := proxyHandler.Drain(ctx); err != nil {
+		t.Fatalf("expected in-flight requests to drain, got %v", err)
+	}
+	close(usageChan)
+	record, ok := <-usageChan
+	if !ok || record.TokenCount != 18 {
+		t.Errorf("expected the stream's usage to be recorded before the channel closed, got %+v", record)
+	}
+}
+
+func TestProxyHandler_LogsNeverContainKeyOrPrompt(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// Inconsistent usage is logged with the key
+		io.WriteString(w, "data: {\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":1}}\n\ndata: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+
+	body := `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "my password is hunter2"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer sk-raw-secret-key")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := logs.String()
+	if !strings.Contains(out, "Forwarding request upstream") || !strings.Contains(out, "inconsistent usage") {
+		t.Fatalf("expected the debug and usage logs to be written, got %q", out)
+	}
+	for _, secret := range []string{"sk-raw-secret-key", "hunter2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q never to be logged, got %q", secret, out)
+		}
+	}
+	if !strings.Contains(out, metrics.HashAPIKey("sk-raw-secret-key")) {
+		t.Errorf("expected the key to be identified by its hash, got %q", out)
+	}
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+
+	"aura-ai-gateway/internal/observability"
+)
+
+// hopByHopHeaders apply to a single connection and must not be forwarded by a proxy (RFC 9110 §7.6.1).
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// singletonHeaders may only appear once in a response. They are copied with Set
+// semantics so a value already present on the writer (e.g. from a middleware)
+// is replaced rather than duplicated, which strict clients reject.
+var singletonHeaders = map[string]bool{
+	"Content-Type":     true,
+	"Content-Length":   true,
+	"Content-Encoding": true,
+	"Cache-Control":    true,
+	"Date":             true,
+	"Etag":             true,
+	"Last-Modified":    true,
+	"Location":         true,
+	"Retry-After":      true,
+	"Server":           true,
+	"X-Request-Id":     true,
+}
+
+// UpstreamRequestIDHeader carries the upstream's request ID when the gateway echoes its own.
+const UpstreamRequestIDHeader = "X-Upstream-Request-Id"
+
+// copyResponseHeaders copies upstream response headers to the client, dropping
+// hop-by-hop headers and using Set semantics for singleton headers. Multi-valued
+// headers such as Set-Cookie or Vary keep Add semantics.
+func copyResponseHeaders(dst, src http.Header) {
+	for k, vv := range src {
+		k = http.CanonicalHeaderKey(k)
+		if hopByHopHeaders[k] || len(vv) == 0 {
+			continue
+		}
+		// The gateway's own request ID, when echoed, is what its logs know the
+		// request by, so the upstream's is passed on under another name.
+		if k == "X-Request-Id" && dst.Get(k) != "" {
+			dst.Set(UpstreamRequestIDHeader, vv[0])
+			continue
+		}
+		if singletonHeaders[k] {
+			dst.Set(k, vv[0])
+			continue
+		}
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// RequestHeaderPolicy controls which client request headers are forwarded to the
+// upstream. Hop-by-hop headers are never forwarded. When Allow is non-empty only
+// the headers it lists are forwarded; headers in Deny are always dropped.
+type RequestHeaderPolicy struct {
+	Allow map[string]bool
+	Deny  map[string]bool
+}
+
+// DefaultRequestHeaderPolicy forwards everything except cookies, which are meant
+// for the gateway's own domain rather than the provider.
+var DefaultRequestHeaderPolicy = NewRequestHeaderPolicy(nil, []string{"Cookie"})
+
+// NewRequestHeaderPolicy builds a policy from header names in any case.
+func NewRequestHeaderPolicy(allow, deny []string) *RequestHeaderPolicy {
+	p := &RequestHeaderPolicy{
+		Allow: make(map[string]bool),
+		Deny:  make(map[string]bool),
+	}
+	for _, name := range allow {
+		p.Allow[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range deny {
+		p.Deny[http.CanonicalHeaderKey(name)] = true
+	}
+	return p
+}
+
+// Forwards reports whether the canonical header name may be sent upstream.
+func (p *RequestHeaderPolicy) Forwards(name string) bool {
+	if hopByHopHeaders[name] {
+		return false
+	}
+	if p == nil {
+		return true
+	}
+	if len(p.Allow) > 0 && !p.Allow[name] {
+		return false
+	}
+	return !p.Deny[name]
+}
+
+// copyRequestHeaders copies client request headers to the upstream request per
+// the policy. Content-Length is dropped because the body is rewritten, as are any
+// headers the client marked hop-by-hop in its Connection header. The request ID
+// is forwarded regardless of the policy.
+func copyRequestHeaders(dst, src http.Header, policy *RequestHeaderPolicy) {
+	connection := make(map[string]bool)
+	for _, v := range src.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			connection[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+
+	for k, vv := range src {
+		k = http.CanonicalHeaderKey(k)
+		if k == observability.RequestIDHeader {
+			// Always sent, so provider-side logs can be matched to ours
+			dst[k] = vv
+			continue
+		}
+		if k == "Content-Length" || connection[k] || !policy.Forwards(k) {
+			continue
+		}
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gateway_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+// forwardedHeaders proxies a request with the given headers and returns what the upstream received.
+func forwardedHeaders(t *testing.T, policy *gateway.RequestHeaderPolicy, headers http.Header) http.Header {
+	t.Helper()
+	var received http.Header
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	if policy != nil {
+		proxyHandler.RequestHeaders = policy
+	}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4"}`)))
+	for k, vv := range headers {
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	return received
+}
+
+func TestProxyHandler_DefaultRequestHeaderPolicy(t *testing.T) {
+	received := forwardedHeaders(t, nil, http.Header{
+		"Authorization":       {"Bearer test-key"},
+		"Cookie":              {"session=secret"},
+		"Proxy-Authorization": {"Basic abc"},
+		"Connection":          {"X-Internal-Hop"},
+		"X-Internal-Hop":      {"1"},
+		"Openai-Organization": {"org-123"},
+	})
+
+	for _, denied := range []string{"Cookie", "Proxy-Authorization", "X-Internal-Hop"} {
+		if v := received.Get(denied); v != "" {
+			t.Errorf("expected %s not to reach the upstream, got %q", denied, v)
+		}
+	}
+	for _, allowed := range []string{"Authorization", "Openai-Organization"} {
+		if received.Get(allowed) == "" {
+			t.Errorf("expected %s to be forwarded", allowed)
+		}
+	}
+}
+
+func TestProxyHandler_RequestHeaderAllowlist(t *testing.T) {
+	policy := gateway.NewRequestHeaderPolicy([]string{"authorization", "content-type"}, nil)
+	received := forwardedHeaders(t, policy, http.Header{
+		"Authorization": {"Bearer test-key"},
+		"Content-Type":  {"application/json"},
+		"X-B3-Traceid":  {"abc123"},
+	})
+
+	if received.Get("X-B3-Traceid") != "" {
+		t.Errorf("expected headers outside the allowlist to be dropped")
+	}
+	if received.Get("Authorization") == "" || received.Get("Content-Type") == "" {
+		t.Errorf("expected allowlisted headers to be forwarded, got %v", received)
+	}
+}
+
+func TestProxyHandler_ChunkedRequestBody(t *testing.T) {
+	var contentLength int64
+	var transferEncoding []string
+	var forwarded []byte
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		transferEncoding = r.TransferEncoding
+		forwarded, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	gatewayServer := httptest.NewServer(proxyHandler)
+	defer gatewayServer.Close()
+
+	// A pipe has no known length, so the client sends the body chunked
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte(`{"model": "gpt-4", `))
+		pw.Write([]byte(`"messages": [{"role": "user", "content": "Hi"}]}`))
+		pw.Close()
+	}()
+	req, _ := http.NewRequest("POST", gatewayServer.URL+"/v1/chat/completions", pr)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(transferEncoding) != 0 {
+		t.Errorf("expected the upstream request not to be chunked, got Transfer-Encoding %v", transferEncoding)
+	}
+	if contentLength != int64(len(forwarded)) || contentLength == 0 {
+		t.Errorf("expected Content-Length %d to match the forwarded body, got %d", len(forwarded), contentLength)
+	}
+}
@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DefaultReadinessTimeout bounds the usage store check behind /readyz.
+const DefaultReadinessTimeout = 2 * time.Second
+
+// ReadinessHandler serves GET /readyz, answering 503 while the usage store
+// can't be reached so the orchestrator stops routing traffic to this replica.
+type ReadinessHandler struct {
+	cb      CircuitBreaker
+	Timeout time.Duration
+}
+
+// NewReadinessHandler initializes a readiness handler checking cb.
+func NewReadinessHandler(cb CircuitBreaker) *ReadinessHandler {
+	return &ReadinessHandler{
+		cb:      cb,
+		Timeout: DefaultReadinessTimeout,
+	}
+}
+
+func (h *ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+	if err := h.cb.Ping(ctx); err != nil {
+		slog.Warn("Readiness check failed", "error", err)
+		WriteError(w, http.StatusServiceUnavailable, "usage_store_unavailable", "Service Unavailable: usage store unreachable")
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+// Liveness serves GET /healthz, answering 200 whenever the process can serve
+// HTTP at all. It checks no dependencies, so an outage elsewhere never gets
+// the gateway restarted.
+func Liveness(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "ok")
+}
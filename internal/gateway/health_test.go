@@ -0,0 +1,35 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	gateway.NewReadinessHandler(gateway.NewMemoryCircuitBreaker()).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the memory store to be ready, got %d", rr.Code)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	client.Close()
+	rr = httptest.NewRecorder()
+	gateway.NewReadinessHandler(gateway.NewRedisCircuitBreaker(client)).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with the Redis client closed, got %d", rr.Code)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	rr := httptest.NewRecorder()
+	gateway.Liveness(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,203 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UsageHistoryRoute is the path of the daily usage breakdown endpoint.
+const UsageHistoryRoute = "/v1/usage/history"
+
+// HistoryDays is how many days of daily usage the stores keep.
+const HistoryDays = 90
+
+// DefaultHistoryDays is how many days /v1/usage/history returns when not asked.
+const DefaultHistoryDays = 7
+
+// errNoHistory is returned by wrappers around stores that keep no history.
+var errNoHistory = errors.New("usage store keeps no daily history")
+
+// DailyUsage is a key's usage on one UTC day.
+type DailyUsage struct {
+	Date             string // YYYY-MM-DD
+	CostMicroDollars int64
+}
+
+// UsageHistory is implemented by stores that count each day's usage
+// alongside the running total, so spend can be broken down over time.
+type UsageHistory interface {
+	// History returns the key's usage for each of the last days days, oldest
+	// first and ending today. Days without usage are included as zero.
+	History(apiKey string, days int) ([]DailyUsage, error)
+}
+
+// dayOf returns the number of UTC days since the Unix epoch.
+func dayOf(t time.Time) int64 {
+	return t.Unix() / 86400
+}
+
+// dayDate formats a day number as YYYY-MM-DD.
+func dayDate(day int64) string {
+	return time.Unix(day*86400, 0).UTC().Format("2006-01-02")
+}
+
+// dayBucket is one day's usage in a key's ring.
+type dayBucket struct {
+	day  int64
+	cost int64
+}
+
+// usageRing holds a key's last HistoryDays days, each day overwriting the
+// bucket of the day HistoryDays before it.
+type usageRing [HistoryDays]dayBucket
+
+// recordHistory adds cost to the key's bucket for today.
+func (r *MemoryCircuitBreaker) recordHistory(apiKey string, cost int64) {
+	day := dayOf(r.now())
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	if r.history == nil {
+		r.history = make(map[string]*usageRing)
+	}
+	ring, ok := r.history[apiKey]
+	if !ok {
+		ring = &usageRing{}
+		r.history[apiKey] = ring
+	}
+	bucket := &ring[day%HistoryDays]
+	if bucket.day != day {
+		*bucket = dayBucket{day: day}
+	}
+	bucket.cost += cost
+}
+
+// History implements UsageHistory from the key's ring buffer.
+func (r *MemoryCircuitBreaker) History(apiKey string, days int) ([]DailyUsage, error) {
+	days = min(days, HistoryDays)
+	if days <= 0 {
+		return []DailyUsage{}, nil
+	}
+	today := dayOf(r.now())
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	ring := r.history[apiKey]
+	result := make([]DailyUsage, 0, days)
+	for day := today - int64(days) + 1; day <= today; day++ {
+		usage := DailyUsage{Date: dayDate(day)}
+		if ring != nil && ring[day%HistoryDays].day == day {
+			usage.CostMicroDollars = ring[day%HistoryDays].cost
+		}
+		result = append(result, usage)
+	}
+	return result, nil
+}
+
+// historyTTL keeps a daily key for as long as the history reaches back.
+const historyTTL = (HistoryDays + 1) * 24 * time.Hour
+
+func (r *RedisCircuitBreaker) getHistoryKey(apiKey string, day int64) string {
+	return fmt.Sprintf("apikey:%s:usage:%s", apiKey, dayDate(day))
+}
+
+// History implements UsageHistory, reading every day's key in one round trip.
+func (r *RedisCircuitBreaker) History(apiKey string, days int) ([]DailyUsage, error) {
+	days = min(days, HistoryDays)
+	if days <= 0 {
+		return []DailyUsage{}, nil
+	}
+	today := dayOf(r.now())
+	keys := make([]string, 0, days)
+	for day := today - int64(days) + 1; day <= today; day++ {
+		keys = append(keys, r.getHistoryKey(apiKey, day))
+	}
+	vals, err := r.client.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis mget error: %w", err)
+	}
+	result := make([]DailyUsage, 0, days)
+	for i, val := range vals {
+		result = append(result, DailyUsage{Date: dayDate(today - int64(days) + 1 + int64(i)), CostMicroDollars: parseRedisInt(val)})
+	}
+	return result, nil
+}
+
+// History implements UsageHistory for the key's account.
+func (a *AccountCircuitBreaker) History(apiKey string, days int) ([]DailyUsage, error) {
+	if history, ok := a.CircuitBreaker.(UsageHistory); ok {
+		return history.History(a.Accounts.AccountFor(apiKey), days)
+	}
+	return nil, errNoHistory
+}
+
+// History implements UsageHistory for the wrapped breaker. Usage buffered
+// while the store is unreachable shows up once it has been replayed.
+func (g *GracefulCircuitBreaker) History(apiKey string, days int) ([]DailyUsage, error) {
+	if history, ok := g.CircuitBreaker.(UsageHistory); ok {
+		return history.History(apiKey, days)
+	}
+	return nil, errNoHistory
+}
+
+// dailyUsageResponse is one day of GET /v1/usage/history.
+type dailyUsageResponse struct {
+	Date         string  `json:"date"`
+	UsageDollars float64 `json:"usage_dollars"`
+}
+
+// UsageHistoryHandler serves GET /v1/usage/history?days=7, the caller's usage
+// for each of the last days, oldest first, up to HistoryDays.
+type UsageHistoryHandler struct {
+	History UsageHistory
+	// Keys optionally rejects unknown keys instead of showing them no usage.
+	Keys KeyValidator
+}
+
+// NewUsageHistoryHandler serves the daily usage kept by history.
+func NewUsageHistoryHandler(history UsageHistory, keys KeyValidator) *UsageHistoryHandler {
+	return &UsageHistoryHandler{History: history, Keys: keys}
+}
+
+func (h *UsageHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+	apiKey := ExtractAPIKey(r)
+	if apiKey == "" {
+		WriteError(w, http.StatusUnauthorized, "missing_api_key", "Unauthorized: provide API Key")
+		return
+	}
+	if h.Keys != nil && !h.Keys.ValidKey(apiKey) {
+		WriteError(w, http.StatusUnauthorized, "invalid_api_key", "Unauthorized: unknown API Key")
+		return
+	}
+
+	days := DefaultHistoryDays
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > HistoryDays {
+			WriteError(w, http.StatusBadRequest, "invalid_days", fmt.Sprintf("Bad Request: days must be between 1 and %d", HistoryDays))
+			return
+		}
+		days = n
+	}
+
+	history, err := h.History.History(apiKey, days)
+	if err != nil {
+		slog.Error("Failed to get usage history", "error", err)
+		WriteError(w, http.StatusInternalServerError, "usage_store_error", "Failed to retrieve usage history")
+		return
+	}
+	response := make([]dailyUsageResponse, 0, len(history))
+	for _, day := range history {
+		response = append(response, dailyUsageResponse{Date: day.Date, UsageDollars: float64(day.CostMicroDollars) / 1000000.0})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
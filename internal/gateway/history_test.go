@@ -0,0 +1,165 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+// historyStore is a breaker with daily history whose clock the test moves.
+type historyStore interface {
+	gateway.CircuitBreaker
+	gateway.UsageHistory
+	gateway.CostReserver
+}
+
+func testUsageHistory(t *testing.T, cb historyStore, now *time.Time, apiKey string) {
+	*now = time.Date(2024, 1, 13, 9, 0, 0, 0, time.UTC)
+	cb.AddUsage(apiKey, 1000000)
+	*now = now.Add(2 * 24 * time.Hour)
+	cb.AddUsage(apiKey, 250000)
+	// Reservations count towards the day they were made on, refunds included
+	cb.CheckAndReserve(apiKey, 500000)
+	cb.AddUsage(apiKey, -100000)
+
+	history, err := cb.History(apiKey, 4)
+	if err != nil {
+		t.Fatalf("unexpected error reading history: %v", err)
+	}
+	want := []gateway.DailyUsage{
+		{Date: "2024-01-12"},
+		{Date: "2024-01-13", CostMicroDollars: 1000000},
+		{Date: "2024-01-14"},
+		{Date: "2024-01-15", CostMicroDollars: 650000},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d days, got %+v", len(want), history)
+	}
+	for i := range want {
+		if history[i] != want[i] {
+			t.Errorf("day %d: expected %+v, got %+v", i, want[i], history[i])
+		}
+	}
+
+	// Days older than the history are forgotten, even where the ring wraps around
+	*now = now.Add(gateway.HistoryDays * 24 * time.Hour)
+	cb.AddUsage(apiKey, 1)
+	history, _ = cb.History(apiKey, gateway.HistoryDays)
+	var total int64
+	for _, day := range history {
+		total += day.CostMicroDollars
+	}
+	if total != 1 || history[len(history)-1].CostMicroDollars != 1 {
+		t.Errorf("expected only today's usage in the last %d days, got a total of %d", gateway.HistoryDays, total)
+	}
+}
+
+func TestMemoryCircuitBreaker_History(t *testing.T) {
+	var now time.Time
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.Now = func() time.Time { return now }
+	testUsageHistory(t, cb, &now, "test-key")
+}
+
+// TestRedisCircuitBreaker_History requires a running Redis/Valkey instance on localhost:6379 to pass.
+func TestRedisCircuitBreaker_History(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	var now time.Time
+	cb := gateway.NewRedisCircuitBreaker(client)
+	cb.Now = func() time.Time { return now }
+	apiKey := "test-redis-history-key"
+	cleanup := func() {
+		keys, _ := client.Keys(ctx, "apikey:"+apiKey+":usage*").Result()
+		if len(keys) > 0 {
+			client.Del(ctx, keys...)
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	testUsageHistory(t, cb, &now, apiKey)
+
+	// Each day's key expires once it falls out of the history
+	ttl := client.TTL(ctx, "apikey:"+apiKey+":usage:"+now.Format("2006-01-02")).Val()
+	if ttl < gateway.HistoryDays*24*time.Hour {
+		t.Errorf("expected the day's key to outlive the history, got a TTL of %v", ttl)
+	}
+}
+
+func TestUsageHistoryHandler(t *testing.T) {
+	now := time.Now()
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.Now = func() time.Time { return now }
+	cb.AddUsage("test-key", 1500000)
+	yesterday := now.AddDate(0, 0, -1)
+	cb.Now = func() time.Time { return yesterday }
+	cb.AddUsage("test-key", 250000)
+	cb.Now = func() time.Time { return now }
+	handler := gateway.NewUsageHistoryHandler(cb, gateway.StaticKeys{"test-key": true})
+
+	get := func(apiKey, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", gateway.UsageHistoryRoute+query, nil)
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("test-key", "?days=3")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var history []struct {
+		Date         string  `json:"date"`
+		UsageDollars float64 `json:"usage_dollars"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&history); err != nil {
+		t.Fatalf("expected a JSON array, got error: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 days, got %+v", history)
+	}
+	if history[1].Date != yesterday.UTC().Format("2006-01-02") || history[1].UsageDollars != 0.25 {
+		t.Errorf("expected yesterday's $0.25, got %+v", history[1])
+	}
+	if history[2].Date != now.UTC().Format("2006-01-02") || history[2].UsageDollars != 1.5 {
+		t.Errorf("expected today's $1.50 last, got %+v", history[2])
+	}
+
+	// Seven days unless asked otherwise
+	json.NewDecoder(get("test-key", "").Body).Decode(&history)
+	if len(history) != gateway.DefaultHistoryDays {
+		t.Errorf("expected %d days by default, got %d", gateway.DefaultHistoryDays, len(history))
+	}
+
+	if rr := get("test-key", "?days=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for days=0, got %d", rr.Code)
+	}
+	if rr := get("test-key", "?days=1000"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 beyond the kept history, got %d", rr.Code)
+	}
+	if rr := get("", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", rr.Code)
+	}
+	if rr := get("unknown-key", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown key, got %d", rr.Code)
+	}
+}
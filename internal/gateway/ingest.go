@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"sync/atomic"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// IngestLimiter bounds how many request bodies are read at once, so a burst
+// of large uploads can't amplify memory before any other limit sees them.
+// Unlike admission control it covers only the read, not the proxied request.
+// A nil limiter is unlimited.
+type IngestLimiter struct {
+	max    int64
+	active atomic.Int64
+}
+
+// NewIngestLimiter creates a limiter allowing up to maxReads concurrent body reads.
+func NewIngestLimiter(maxReads int) *IngestLimiter {
+	return &IngestLimiter{max: int64(maxReads)}
+}
+
+// Acquire claims a read slot without waiting. It reports false if all are taken;
+// otherwise Release must be called once the body has been read.
+func (l *IngestLimiter) Acquire() bool {
+	if l == nil {
+		return true
+	}
+	for {
+		active := l.active.Load()
+		if active >= l.max {
+			return false
+		}
+		if l.active.CompareAndSwap(active, active+1) {
+			metrics.IngestInFlight.Inc()
+			return true
+		}
+	}
+}
+
+// Release frees a read slot.
+func (l *IngestLimiter) Release() {
+	if l == nil {
+		return
+	}
+	l.active.Add(-1)
+	metrics.IngestInFlight.Dec()
+}
+
+// Active returns the number of bodies currently being read.
+func (l *IngestLimiter) Active() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.active.Load()
+}
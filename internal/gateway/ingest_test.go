@@ -0,0 +1,86 @@
+package gateway_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestIngestLimiter(t *testing.T) {
+	limiter := gateway.NewIngestLimiter(1)
+
+	if !limiter.Acquire() {
+		t.Fatal("expected the first read to be admitted")
+	}
+	if limiter.Acquire() {
+		t.Error("expected a read over the limit to be refused")
+	}
+	limiter.Release()
+	if !limiter.Acquire() {
+		t.Error("expected a released slot to be reusable")
+	}
+
+	var unlimited *gateway.IngestLimiter
+	if !unlimited.Acquire() {
+		t.Error("expected a nil limiter to admit everything")
+	}
+}
+
+// countingReader records whether it was read from.
+type countingReader struct {
+	io.Reader
+	read bool
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.read = true
+	return c.Reader.Read(p)
+}
+
+func TestProxyHandler_IngestLimit(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Ingest = gateway.NewIngestLimiter(1)
+
+	// Hold the only slot with an upload that hasn't finished arriving
+	slowBody, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", slowBody))
+	}()
+	for deadline := time.Now().Add(time.Second); proxyHandler.Ingest.Active() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the slow upload to occupy the ingest slot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	body := &countingReader{Reader: bytes.NewReader([]byte(`{"model": "gpt-4"}`))}
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/chat/completions", body))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while the ingest slot is taken, got %d", rr.Code)
+	}
+	if body.read {
+		t.Error("expected the rejected request's body not to be read")
+	}
+
+	writer.Write([]byte(`{"model": "gpt-4"}`))
+	writer.Close()
+	<-done
+	if active := proxyHandler.Ingest.Active(); active != 0 {
+		t.Errorf("expected the slot to be released after the read, %d still active", active)
+	}
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+)
+
+// maxInjectedErrorBytes bounds how much of an upstream 400 is read to look for injected fields.
+const maxInjectedErrorBytes = 64 << 10
+
+// injectedFieldNote is appended to upstream errors that name a field the gateway added.
+const injectedFieldNote = " (note: %q was added to the request by the gateway, not sent by the client)"
+
+// injectedFieldPatterns match the fields the gateway may inject by whole name,
+// so "stream" doesn't match "stream_options".
+var injectedFieldPatterns = map[string]*regexp.Regexp{
+	"stream":          regexp.MustCompile(`\bstream\b`),
+	"stream_options":  regexp.MustCompile(`\bstream_options\b`),
+	"response_format": regexp.MustCompile(`\bresponse_format\b`),
+}
+
+// forwardInjectedFieldError relays an upstream 400, first checking whether it
+// rejects one of the fields the gateway injected into the request. Such a
+// rejection is logged prominently since it means the injection is incompatible
+// with the upstream, and with annotate set the error message is amended so the
+// client isn't left puzzling over a field it never sent.
+func forwardInjectedFieldError(w http.ResponseWriter, resp *http.Response, apiKey string, injected []string, annotate bool) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxInjectedErrorBytes+1))
+	complete := err == nil && len(body) <= maxInjectedErrorBytes
+
+	var rejected string
+	for _, field := range injected {
+		if injectedFieldPatterns[field].Match(body) {
+			rejected = field
+			break
+		}
+	}
+
+	if rejected != "" {
+		slog.Warn("Upstream rejected a field injected by the gateway; the upstream may not support it",
+			"field", rejected, observability.APIKeyAttr(apiKey), "upstream_error", string(body))
+		metrics.InjectedFieldRejections.WithLabelValues(rejected).Inc()
+
+		if annotate && complete {
+			if rewritten, ok := annotateInjectedField(body, rejected); ok {
+				copyResponseHeaders(w.Header(), resp.Header)
+				w.Header().Set("Content-Length", strconv.Itoa(len(rewritten)))
+				w.WriteHeader(resp.StatusCode)
+				w.Write(rewritten)
+				return
+			}
+		}
+	}
+
+	copyResponseHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+	io.Copy(w, resp.Body)
+}
+
+// annotateInjectedField appends a note about field to the message of an
+// OpenAI-style error body. It reports false if the body isn't one.
+func annotateInjectedField(body []byte, field string) ([]byte, bool) {
+	var errBody map[string]json.RawMessage
+	if json.Unmarshal(body, &errBody) != nil {
+		return nil, false
+	}
+	var apiErr map[string]interface{}
+	if json.Unmarshal(errBody["error"], &apiErr) != nil || apiErr == nil {
+		return nil, false
+	}
+	message, ok := apiErr["message"].(string)
+	if !ok {
+		return nil, false
+	}
+
+	apiErr["message"] = message + fmt.Sprintf(injectedFieldNote, field)
+	encoded, err := json.Marshal(apiErr)
+	if err != nil {
+		return nil, false
+	}
+	errBody["error"] = encoded
+	rewritten, err := json.Marshal(errBody)
+	if err != nil {
+		return nil, false
+	}
+	return rewritten, true
+}
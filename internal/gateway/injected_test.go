@@ -0,0 +1,97 @@
+package gateway_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+const streamOptionsRejection = `{"error":{"message":"Unrecognized request argument supplied: stream_options",` +
+	`"type":"invalid_request_error","param":null,"code":null}}`
+
+func serveRejection(t *testing.T, annotate bool, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, streamOptionsRejection)
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.AnnotateInjectedErrors = annotate
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestProxyHandler_InjectedFieldRejectionAnnotated(t *testing.T) {
+	rr := serveRejection(t, true, `{"model": "gpt-4o", "stream": true}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected the upstream 400 to be relayed, got %d", rr.Code)
+	}
+
+	var body struct {
+		Error map[string]interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected a JSON error body, got %q", rr.Body.String())
+	}
+	message, _ := body.Error["message"].(string)
+	if !strings.HasPrefix(message, "Unrecognized request argument supplied: stream_options") {
+		t.Errorf("expected the upstream message to be kept, got %q", message)
+	}
+	if !strings.Contains(message, `"stream_options" was added to the request by the gateway`) {
+		t.Errorf("expected a note about the injected field, got %q", message)
+	}
+	if body.Error["type"] != "invalid_request_error" {
+		t.Errorf("expected the other error fields to be kept, got %v", body.Error)
+	}
+}
+
+func TestProxyHandler_InjectedFieldRejectionPassthrough(t *testing.T) {
+	// Annotation disabled
+	rr := serveRejection(t, false, `{"model": "gpt-4o", "stream": true}`)
+	if rr.Body.String() != streamOptionsRejection {
+		t.Errorf("expected the error unchanged with annotation off, got %q", rr.Body.String())
+	}
+
+	// The client sent the field itself, so it wasn't injected
+	rr = serveRejection(t, true, `{"model": "gpt-4o", "stream": true, "stream_options": {"include_usage": true}}`)
+	if rr.Body.String() != streamOptionsRejection {
+		t.Errorf("expected the error unchanged for a client-sent field, got %q", rr.Body.String())
+	}
+}
+
+func TestProxyHandler_InjectedFieldUnrelatedError(t *testing.T) {
+	const rejection = `{"error":{"message":"Invalid value for 'temperature'","type":"invalid_request_error"}}`
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, rejection)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.AnnotateInjectedErrors = true
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4o"}`)))
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Body.String() != rejection {
+		t.Errorf("expected an unrelated error to pass through unchanged, got %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,25 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+)
+
+// InstrumentLatency observes each request's latency in RequestLatency, labelled
+// with the status code actually sent to the client, and counts requests per
+// client SDK.
+func InstrumentLatency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := observability.NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+
+		metrics.RequestLatency.WithLabelValues(strconv.Itoa(sw.Status())).Observe(time.Since(start).Seconds())
+		sdk := observability.ParseUserAgent(r.UserAgent())
+		metrics.ClientSDKRequests.WithLabelValues(sdk.Name).Inc()
+	})
+}
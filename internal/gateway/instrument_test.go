@@ -0,0 +1,99 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+	"aura-ai-gateway/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// latencySamples returns how many latencies were observed with the status label.
+func latencySamples(t *testing.T, status string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.RequestLatency.WithLabelValues(status).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentLatency_UpstreamStatus(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	handler := gateway.InstrumentLatency(proxyHandler)
+
+	before, beforeOK := latencySamples(t, "502"), latencySamples(t, "200")
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o"}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("expected the upstream 502 to be relayed, got %d", rr.Code)
+	}
+	if got := latencySamples(t, "502"); got != before+1 {
+		t.Errorf("expected one latency observed with status 502, got %d", got-before)
+	}
+	if got := latencySamples(t, "200"); got != beforeOK {
+		t.Errorf("expected no latency observed with status 200, got %d", got-beforeOK)
+	}
+}
+
+func TestInstrumentLatency_KeepsFlusher(t *testing.T) {
+	handler := gateway.InstrumentLatency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("expected the wrapped writer to implement http.Flusher")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// histogramTotals returns a histogram's sample count and sum.
+func histogramTotals(t *testing.T, h prometheus.Histogram) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestProxyHandler_PayloadSizes(t *testing.T) {
+	var forwarded int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.ContentLength
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(usageStream))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+
+	requests, requestBytes := histogramTotals(t, metrics.RequestBytes)
+	responses, responseBytes := histogramTotals(t, metrics.ResponseBytes)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	// The request is measured as forwarded, with stream_options injected
+	count, sum := histogramTotals(t, metrics.RequestBytes)
+	if count != requests+1 || sum-requestBytes != float64(forwarded) || forwarded == 0 {
+		t.Errorf("expected one request of %d bytes observed, got %d of %v bytes", forwarded, count-requests, sum-requestBytes)
+	}
+	count, sum = histogramTotals(t, metrics.ResponseBytes)
+	if count != responses+1 || sum-responseBytes != float64(rr.Body.Len()) || rr.Body.Len() == 0 {
+		t.Errorf("expected one response of %d bytes observed, got %d of %v bytes", rr.Body.Len(), count-responses, sum-responseBytes)
+	}
+}
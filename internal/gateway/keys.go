@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader carries the key for Azure-style clients that don't send a bearer token.
+const APIKeyHeader = "Api-Key"
+
+// APIKeyParam carries the key in the query string for clients that can't set headers.
+const APIKeyParam = "api_key"
+
+// ExtractAPIKey returns the key a request identifies itself with, or "" if it
+// has none. A bearer token in the Authorization header wins, then the api-key
+// header, then the api_key query parameter. The scheme is matched case
+// insensitively and surrounding whitespace is ignored.
+func ExtractAPIKey(r *http.Request) string {
+	if key, ok := bearerToken(r.Header.Get("Authorization")); ok {
+		return key
+	}
+	if key := strings.TrimSpace(r.Header.Get(APIKeyHeader)); key != "" {
+		return key
+	}
+	return strings.TrimSpace(r.URL.Query().Get(APIKeyParam))
+}
+
+// forwardAPIKey makes apiKey the upstream request's credential. The gateway
+// passes the client's key through, so however it was sent it goes upstream as
+// a bearer token, and the api-key header and query parameter are stripped so
+// the key isn't sent twice or left in the upstream URL.
+func forwardAPIKey(req *http.Request, apiKey string) {
+	req.Header.Del(APIKeyHeader)
+	if query := req.URL.Query(); query.Has(APIKeyParam) {
+		query.Del(APIKeyParam)
+		req.URL.RawQuery = query.Encode()
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// bearerToken parses an Authorization header value of the Bearer scheme.
+func bearerToken(authHeader string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authHeader), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// KeyValidator reports whether an API key was issued by the operator. Without
+// one, any bearer token is accepted and simply tracked as its own key.
+type KeyValidator interface {
+	ValidKey(apiKey string) bool
+}
+
+// StaticKeys validates keys against a fixed set.
+type StaticKeys map[string]bool
+
+// ValidKey reports whether apiKey is in the set.
+func (k StaticKeys) ValidKey(apiKey string) bool {
+	return k[apiKey]
+}
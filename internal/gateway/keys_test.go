@@ -0,0 +1,111 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestStaticKeys(t *testing.T) {
+	var validator gateway.KeyValidator = gateway.StaticKeys{"key-a": true}
+	if !validator.ValidKey("key-a") {
+		t.Error("expected a configured key to be valid")
+	}
+	if validator.ValidKey("key-b") || validator.ValidKey("") {
+		t.Error("expected unknown keys to be invalid")
+	}
+}
+
+func TestExtractAPIKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		apiKeyHeader  string
+		target        string
+		want          string
+	}{
+		{name: "bearer", authorization: "Bearer sk-abc", want: "sk-abc"},
+		{name: "lowercase scheme", authorization: "bearer sk-abc", want: "sk-abc"},
+		{name: "extra whitespace", authorization: "  Bearer   sk-abc  ", want: "sk-abc"},
+		{name: "api-key header", apiKeyHeader: " sk-azure ", want: "sk-azure"},
+		{name: "query parameter", target: "/v1/usage?api_key=sk-query", want: "sk-query"},
+		{name: "bearer wins", authorization: "Bearer sk-abc", apiKeyHeader: "sk-azure", target: "/v1/usage?api_key=sk-query", want: "sk-abc"},
+		{name: "header before query", apiKeyHeader: "sk-azure", target: "/v1/usage?api_key=sk-query", want: "sk-azure"},
+		{name: "other scheme falls back", authorization: "Basic dXNlcjpwYXNz", apiKeyHeader: "sk-azure", want: "sk-azure"},
+		{name: "scheme without token", authorization: "Bearer ", want: ""},
+		{name: "token without scheme", authorization: "sk-abc", want: ""},
+		{name: "scheme prefix only", authorization: "Bearersk-abc", want: ""},
+		{name: "nothing", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/v1/usage"
+			}
+			req := httptest.NewRequest("GET", target, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.apiKeyHeader != "" {
+				req.Header.Set("api-key", tt.apiKeyHeader)
+			}
+			if got := gateway.ExtractAPIKey(req); got != tt.want {
+				t.Errorf("ExtractAPIKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedAPIKey(t *testing.T) {
+	var gotAuth, gotAPIKey, gotQuery string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotAPIKey, gotQuery = r.Header.Get("Authorization"), r.Header.Get(gateway.APIKeyHeader), r.URL.RawQuery
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(usageStream))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL + "/v1/chat/completions")
+	handlers := map[string]http.Handler{
+		"/v1/chat/completions": gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil),
+		"/v1/batches":          gateway.NewPassthroughHandler(gateway.UpstreamAPIBase(upstreamURL), &MockCircuitBreaker{Allowed: true}),
+	}
+	variants := []struct {
+		name  string
+		query string
+		set   func(h http.Header)
+	}{
+		{name: "bearer", set: func(h http.Header) { h.Set("Authorization", "Bearer sk-client") }},
+		{name: "api-key header", set: func(h http.Header) { h.Set(gateway.APIKeyHeader, "sk-client") }},
+		{name: "query parameter", query: "?limit=1&api_key=sk-client", set: func(h http.Header) {}},
+	}
+
+	for path, handler := range handlers {
+		for _, v := range variants {
+			t.Run(path+" "+v.name, func(t *testing.T) {
+				gotAuth, gotAPIKey, gotQuery = "", "", ""
+				req := httptest.NewRequest("POST", path+v.query, strings.NewReader(`{"model": "gpt-4o", "messages": []}`))
+				v.set(req.Header)
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				if rr.Code != http.StatusOK {
+					t.Fatalf("expected the request to be forwarded, got %d: %s", rr.Code, rr.Body.String())
+				}
+				// The client's key is the upstream credential, sent only as a bearer token
+				if gotAuth != "Bearer sk-client" {
+					t.Errorf("expected the key as a bearer token upstream, got %q", gotAuth)
+				}
+				if gotAPIKey != "" || strings.Contains(gotQuery, "api_key") {
+					t.Errorf("expected the key not to be forwarded elsewhere, got header %q and query %q", gotAPIKey, gotQuery)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package gateway
+
+// UnlimitedUsage is the limit of keys that are never cut off, e.g. internal ones.
+const UnlimitedUsage int64 = -1
+
+// LimitProvider supplies each key's usage limit in micro-dollars, so customers
+// on different plans get different budgets. A negative limit means unlimited.
+type LimitProvider interface {
+	GetLimit(apiKey string) (int64, error)
+}
+
+// StaticLimits is a fixed set of per-key limits. Keys without an override get
+// Default, or MaxUsageMicroDollars when Default is zero.
+type StaticLimits struct {
+	Default int64
+	Keys    map[string]int64
+}
+
+// GetLimit implements LimitProvider.
+func (s *StaticLimits) GetLimit(apiKey string) (int64, error) {
+	if s == nil {
+		return MaxUsageMicroDollars, nil
+	}
+	if limit, ok := s.Keys[apiKey]; ok {
+		return limit, nil
+	}
+	if s.Default != 0 {
+		return s.Default, nil
+	}
+	return MaxUsageMicroDollars, nil
+}
+
+// UsageLimit returns the key's limit from cb when it provides per-key limits,
+// and MaxUsageMicroDollars otherwise or when the limit can't be read.
+func UsageLimit(cb interface{}, apiKey string) int64 {
+	if provider, ok := cb.(LimitProvider); ok {
+		if limit, err := provider.GetLimit(apiKey); err == nil {
+			return limit
+		}
+	}
+	return MaxUsageMicroDollars
+}
+
+// fitsBudget reports whether cost fits in the key's remaining budget. It fails
+// open when usage can't be read, leaving the reservation to decide.
+func fitsBudget(cb CircuitBreaker, apiKey string, cost int64) bool {
+	limit := UsageLimit(cb, apiKey)
+	if limit < 0 {
+		return true
+	}
+	usage, err := cb.GetUsage(apiKey)
+	if err != nil {
+		return true
+	}
+	return usage+cost <= limit
+}
+
+// withinLimit reports whether usage still leaves the key room to spend.
+func withinLimit(usage, limit int64) bool {
+	return limit < 0 || usage < limit
+}
@@ -1,14 +1,33 @@
 package gateway
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // MemoryCircuitBreaker implements the CircuitBreaker interface using an in-memory sync.Map.
 type MemoryCircuitBreaker struct {
 	// usageMap stores apiKey (string) -> *int64 (pointer to micro-dollars atomic counter)
 	usageMap syncMap
+	// tokenMap stores apiKey (string) -> *int64 (pointer to token atomic counter)
+	tokenMap syncMap
+
+	// Limits sets per-key limits. Without it every key gets MaxUsageMicroDollars.
+	Limits LimitProvider
+
+	// Window resets every key's usage at each window boundary. Usage is zeroed
+	// lazily by the first access after the boundary.
+	Window UsageWindow
+	// Now is the clock used for windows, time.Now when nil.
+	Now func() time.Time
+
+	resetMu  sync.Mutex
+	resetsAt atomic.Int64 // end of the current window in Unix nanoseconds, 0 before first use
+
+	historyMu sync.Mutex
+	history   map[string]*usageRing // apiKey -> daily usage, kept across windows
 }
 
 // syncMap is a custom generic wrapper around sync.Map for type safety
@@ -29,41 +48,155 @@ func (s *syncMap) Load(key string) (*int64, bool) {
 	return val.(*int64), true
 }
 
+func (s *syncMap) Range(f func(key string, value *int64) bool) {
+	s.m.Range(func(k, v any) bool {
+		return f(k.(string), v.(*int64))
+	})
+}
+
 func NewMemoryCircuitBreaker() *MemoryCircuitBreaker {
 	return &MemoryCircuitBreaker{}
 }
 
-// CheckLimit verifies if the given API key has exceeded the $10.00 limit.
+// rollover zeroes all usage once the current window has ended. Windows are
+// aligned to calendar boundaries, so every key shares the same reset time.
+func (r *MemoryCircuitBreaker) rollover() {
+	if r.Window == "" || r.Window == WindowNone {
+		return
+	}
+	now := r.now()
+	if resetsAt := r.resetsAt.Load(); resetsAt != 0 && now.UnixNano() < resetsAt {
+		return
+	}
+
+	r.resetMu.Lock()
+	defer r.resetMu.Unlock()
+	resetsAt := r.resetsAt.Load()
+	if resetsAt != 0 && now.UnixNano() < resetsAt {
+		return
+	}
+	if resetsAt != 0 {
+		// Zero in place so concurrent holders of a counter keep a live pointer
+		r.usageMap.Range(func(_ string, valRef *int64) bool {
+			atomic.StoreInt64(valRef, 0)
+			return true
+		})
+	}
+	r.resetsAt.Store(r.Window.ResetsAt(now).UnixNano())
+}
+
+// ResetsAt implements UsageResetter.
+func (r *MemoryCircuitBreaker) ResetsAt() time.Time {
+	r.rollover()
+	resetsAt := r.resetsAt.Load()
+	if resetsAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, resetsAt).UTC()
+}
+
+func (r *MemoryCircuitBreaker) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// CheckLimit verifies if the given API key has exceeded its limit.
 // Checks are extremely fast in-memory map lookups.
 func (r *MemoryCircuitBreaker) CheckLimit(apiKey string) (bool, error) {
+	r.rollover()
 	valRef, ok := r.usageMap.Load(apiKey)
 	if !ok {
 		// Key does not exist, usage is 0, allow request
 		return true, nil
 	}
 
+	limit, err := r.GetLimit(apiKey)
+	if err != nil {
+		return false, err
+	}
 	usage := atomic.LoadInt64(valRef)
-	return usage < MaxUsageMicroDollars, nil
+	return withinLimit(usage, limit), nil
 }
 
-// AddUsage asynchronously increments the usage cost for the API key in memory.
-func (r *MemoryCircuitBreaker) AddUsage(apiKey string, tokenCount int) error {
-	cost := int64(tokenCount) * CostPerTokenMicroDollars
+// GetLimit implements LimitProvider, deferring to Limits when set.
+func (r *MemoryCircuitBreaker) GetLimit(apiKey string) (int64, error) {
+	if r.Limits == nil {
+		return MaxUsageMicroDollars, nil
+	}
+	return r.Limits.GetLimit(apiKey)
+}
 
+// AddUsage asynchronously increments the usage cost (in micro-dollars) for the API key in memory.
+// Usage never goes below zero: a refund or settlement of a reservation made
+// before a SetUsage would otherwise leave the key with free budget.
+func (r *MemoryCircuitBreaker) AddUsage(apiKey string, costMicroDollars int64) error {
+	r.rollover()
 	// Ensure the key exists in the map
 	valRef := r.usageMap.LoadOrStore(apiKey, 0)
 
-	// Atomically add the cost to avoid race conditions from concurrent requests
-	atomic.AddInt64(valRef, cost)
+	// Compare-and-swap so concurrent requests can't race the clamp
+	for {
+		usage := atomic.LoadInt64(valRef)
+		if atomic.CompareAndSwapInt64(valRef, usage, max(usage+costMicroDollars, 0)) {
+			break
+		}
+	}
+	r.recordHistory(apiKey, costMicroDollars)
+
+	return nil
+}
+
+// Ping always succeeds; the store is the process itself.
+func (r *MemoryCircuitBreaker) Ping(ctx context.Context) error {
+	return nil
+}
 
+// SetUsage overwrites the usage recorded for the API key.
+func (r *MemoryCircuitBreaker) SetUsage(apiKey string, costMicroDollars int64) error {
+	r.rollover()
+	atomic.StoreInt64(r.usageMap.LoadOrStore(apiKey, 0), costMicroDollars)
 	return nil
 }
 
 // GetUsage retrieves the usage. If none is recorded, defaults to 0.
 func (r *MemoryCircuitBreaker) GetUsage(apiKey string) (int64, error) {
+	r.rollover()
 	valRef, ok := r.usageMap.Load(apiKey)
 	if !ok {
 		return 0, nil
 	}
 	return atomic.LoadInt64(valRef), nil
 }
+
+// AddTokens implements TokenRecorder.
+func (r *MemoryCircuitBreaker) AddTokens(apiKey string, tokens int64) error {
+	atomic.AddInt64(r.tokenMap.LoadOrStore(apiKey, 0), tokens)
+	return nil
+}
+
+// ListUsage implements UsageLister.
+func (r *MemoryCircuitBreaker) ListUsage() ([]KeyUsage, error) {
+	r.rollover()
+	var result []KeyUsage
+	r.usageMap.Range(func(apiKey string, valRef *int64) bool {
+		usage := KeyUsage{APIKey: apiKey, CostMicroDollars: atomic.LoadInt64(valRef)}
+		usage.LimitMicroDollars, _ = r.GetLimit(apiKey)
+		if tokRef, ok := r.tokenMap.Load(apiKey); ok {
+			usage.Tokens = atomic.LoadInt64(tokRef)
+		}
+		result = append(result, usage)
+		return true
+	})
+	return result, nil
+}
+
+// ImportUsage implements UsageImporter.
+func (r *MemoryCircuitBreaker) ImportUsage(usages []KeyUsage) error {
+	for _, u := range usages {
+		r.AddUsage(u.APIKey, u.CostMicroDollars)
+		r.AddTokens(u.APIKey, u.Tokens)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package gateway_test
 import (
 	"aura-ai-gateway/internal/gateway"
 	"testing"
+	"time"
 )
 
 func TestMemoryCircuitBreaker(t *testing.T) {
@@ -27,7 +28,7 @@ func TestMemoryCircuitBreaker(t *testing.T) {
 	}
 
 	// 2. Add Usage
-	err = cb.AddUsage(apiKey, 1000)
+	err = cb.AddUsage(apiKey, 1000*gateway.CostPerTokenMicroDollars)
 	if err != nil {
 		t.Fatalf("unexpected error on AddUsage: %v", err)
 	}
@@ -43,8 +44,8 @@ func TestMemoryCircuitBreaker(t *testing.T) {
 
 	// 3. Exceed Limit
 	// Calculate tokens needed to exceed MaxUsageMicroDollars
-	tokensToExceed := int(gateway.MaxUsageMicroDollars/gateway.CostPerTokenMicroDollars) + 1
-	err = cb.AddUsage(apiKey, tokensToExceed)
+	tokensToExceed := int64(gateway.MaxUsageMicroDollars/gateway.CostPerTokenMicroDollars) + 1
+	err = cb.AddUsage(apiKey, tokensToExceed*gateway.CostPerTokenMicroDollars)
 	if err != nil {
 		t.Fatalf("unexpected error on AddUsage: %v", err)
 	}
@@ -57,3 +58,63 @@ func TestMemoryCircuitBreaker(t *testing.T) {
 		t.Errorf("expected key to be denied after exceeding limit, got allowed")
 	}
 }
+
+func TestMemoryCircuitBreaker_PerKeyLimits(t *testing.T) {
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.Limits = &gateway.StaticLimits{Keys: map[string]int64{
+		"trial":    5000000,
+		"paid":     100000000,
+		"internal": gateway.UnlimitedUsage,
+	}}
+
+	// $7 of usage each: over the trial limit, under the paid one
+	for _, apiKey := range []string{"trial", "paid", "internal", "default"} {
+		cb.AddUsage(apiKey, 7000000)
+	}
+	for apiKey, want := range map[string]bool{"trial": false, "paid": true, "internal": true, "default": true} {
+		if allowed, _ := cb.CheckLimit(apiKey); allowed != want {
+			t.Errorf("expected %s allowed=%v at $7 usage, got %v", apiKey, want, allowed)
+		}
+	}
+
+	// Keys without an override keep the $10 default
+	cb.AddUsage("default", 3000000)
+	if allowed, _ := cb.CheckLimit("default"); allowed {
+		t.Error("expected a key without an override to be cut off at the default limit")
+	}
+	if limit := gateway.UsageLimit(cb, "paid"); limit != 100000000 {
+		t.Errorf("expected the paid key's limit to be reported, got %d", limit)
+	}
+}
+
+func TestMemoryCircuitBreaker_UsageWindow(t *testing.T) {
+	now := time.Date(2026, time.March, 31, 23, 0, 0, 0, time.UTC)
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.Window = gateway.WindowMonthly
+	cb.Now = func() time.Time { return now }
+
+	cb.AddUsage("test-key", gateway.MaxUsageMicroDollars)
+	if allowed, _ := cb.CheckLimit("test-key"); allowed {
+		t.Fatal("expected the key to be over its budget")
+	}
+	if want := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC); !cb.ResetsAt().Equal(want) {
+		t.Errorf("expected the window to end at %v, got %v", want, cb.ResetsAt())
+	}
+
+	// Crossing the boundary refills the budget
+	now = now.Add(2 * time.Hour)
+	if allowed, _ := cb.CheckLimit("test-key"); !allowed {
+		t.Error("expected the key to be allowed in the new window")
+	}
+	if usage, _ := cb.GetUsage("test-key"); usage != 0 {
+		t.Errorf("expected usage to reset to 0, got %d", usage)
+	}
+	if want := time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC); !cb.ResetsAt().Equal(want) {
+		t.Errorf("expected the next window to end at %v, got %v", want, cb.ResetsAt())
+	}
+
+	cb.AddUsage("test-key", 500)
+	if usage, _ := cb.GetUsage("test-key"); usage != 500 {
+		t.Errorf("expected usage to accrue in the new window, got %d", usage)
+	}
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMetadataValueBytes bounds each captured metadata value.
+const DefaultMetadataValueBytes = 256
+
+// MetadataCapture copies selected request payload fields, such as `user` or
+// `metadata.project`, onto the usage record for attribution. Nested fields are
+// named with dots. Only scalar values are captured, each truncated to
+// MaxValueBytes, so a client can't bloat usage records.
+type MetadataCapture struct {
+	Fields        []string
+	MaxValueBytes int
+}
+
+// Capture returns the configured fields present in the payload, or nil if none are.
+func (c *MetadataCapture) Capture(payload map[string]interface{}) map[string]string {
+	if c == nil {
+		return nil
+	}
+	maxBytes := c.MaxValueBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMetadataValueBytes
+	}
+
+	var captured map[string]string
+	for _, field := range c.Fields {
+		value, ok := lookupField(payload, field)
+		if !ok {
+			continue
+		}
+		if captured == nil {
+			captured = make(map[string]string, len(c.Fields))
+		}
+		captured[field] = truncateUTF8(value, maxBytes)
+	}
+	return captured
+}
+
+// lookupField reads a dotted path of object keys and formats the scalar found there.
+func lookupField(payload map[string]interface{}, path string) (string, bool) {
+	var value interface{} = payload
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = obj[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		if v {
+			return "true", true
+		}
+		return "false", true
+	}
+	return "", false
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
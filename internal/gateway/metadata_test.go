@@ -0,0 +1,71 @@
+package gateway_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestMetadataCapture(t *testing.T) {
+	capture := &gateway.MetadataCapture{
+		Fields:        []string{"user", "metadata.project", "metadata.tier", "metadata", "missing.field"},
+		MaxValueBytes: 8,
+	}
+	payload := map[string]interface{}{
+		"user":     "user-1234567890",
+		"metadata": map[string]interface{}{"project": "alpha", "tier": true},
+	}
+
+	got := capture.Capture(payload)
+	want := map[string]string{"user": "user-123", "metadata.project": "alpha", "metadata.tier": "true"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("expected %s=%q, got %q", field, value, got[field])
+		}
+	}
+
+	var nilCapture *gateway.MetadataCapture
+	if nilCapture.Capture(payload) != nil {
+		t.Error("expected a nil capture to record nothing")
+	}
+}
+
+func TestProxyHandler_UsageMetadata(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":5,\"total_tokens\":15}}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.UsageMetadata = &gateway.MetadataCapture{Fields: []string{"user", "metadata.project"}}
+
+	body := `{"model": "gpt-4o", "user": "u-42", "metadata": {"project": "alpha", "cost_center": 7}}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer test-key")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record gateway.UsageRecord
+	select {
+	case record = <-usageChan:
+	default:
+		t.Fatal("expected a usage record")
+	}
+	if record.Metadata["user"] != "u-42" || record.Metadata["metadata.project"] != "alpha" {
+		t.Errorf("expected the configured fields on the usage record, got %v", record.Metadata)
+	}
+	if _, ok := record.Metadata["metadata.cost_center"]; ok {
+		t.Errorf("expected only configured fields, got %v", record.Metadata)
+	}
+}
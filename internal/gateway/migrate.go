@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// MigrationResult summarizes the usage copied by a migration.
+type MigrationResult struct {
+	Keys         int     `json:"keys"`
+	TotalTokens  int64   `json:"total_tokens"`
+	TotalDollars float64 `json:"total_dollars"`
+}
+
+// MigrationHandler serves POST /v1/admin/migrate, copying every key's usage
+// from Source into Target, e.g. from the in-memory store into Redis when a
+// single node scales out. The copy adds to the target's counts, so it runs at
+// most once per process; repeating it would double-bill every key.
+type MigrationHandler struct {
+	Source     UsageLister
+	Target     UsageImporter
+	AdminToken string
+
+	mu   sync.Mutex
+	done bool
+}
+
+// NewMigrationHandler initializes a migration handler between two stores.
+func NewMigrationHandler(source UsageLister, target UsageImporter, adminToken string) *MigrationHandler {
+	return &MigrationHandler{
+		Source:     source,
+		Target:     target,
+		AdminToken: adminToken,
+	}
+}
+
+func (h *MigrationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+	if !requireAdmin(w, r, h.AdminToken) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.done {
+		WriteError(w, http.StatusConflict, "already_migrated", "Conflict: usage has already been migrated")
+		return
+	}
+
+	usages, err := h.Source.ListUsage()
+	if err != nil {
+		slog.Error("Failed to read usage for migration", "error", err)
+		WriteError(w, http.StatusInternalServerError, "usage_store_error", "Failed to read usage")
+		return
+	}
+	if err := h.Target.ImportUsage(usages); err != nil {
+		// A partial import can't be told apart from a complete one, so don't allow a retry to double it
+		h.done = true
+		slog.Error("Usage migration failed part way; check the target before retrying by hand", "error", err)
+		WriteError(w, http.StatusInternalServerError, "usage_store_error", "Failed to write usage to the target store")
+		return
+	}
+	h.done = true
+
+	result := MigrationResult{Keys: len(usages)}
+	var totalMicro int64
+	for _, u := range usages {
+		result.TotalTokens += u.Tokens
+		totalMicro += u.CostMicroDollars
+	}
+	result.TotalDollars = float64(totalMicro) / 1000000.0
+	slog.Info("Usage migrated", "keys", result.Keys, "total_dollars", result.TotalDollars)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,245 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelsRoute is the path of the OpenAI model listing endpoint.
+const ModelsRoute = "/v1/models"
+
+// DefaultModelsCacheTTL is how long the merged model list is reused.
+const DefaultModelsCacheTTL = time.Minute
+
+// maxModelsBytes bounds how much of an upstream's model list is read.
+const maxModelsBytes = 4 << 20
+
+// modelsSource is one upstream whose models are listed.
+type modelsSource struct {
+	url   string
+	route Route // header rewrites for routed providers
+}
+
+// ModelsHandler serves GET /v1/models. It lists the default upstream's
+// models and, with multi-provider routing, those of every OpenAI-compatible
+// route too, merged into one list. Providers with their own format, or with
+// a templated endpoint, have no list to merge and are skipped. A
+// model listed by several upstreams appears once, as the first listed it.
+// Complete lists are cached for CacheTTL.
+type ModelsHandler struct {
+	Client         *http.Client
+	RequestHeaders *RequestHeaderPolicy
+	CacheTTL       time.Duration
+
+	// UpgradeURL is included in 402 responses, as for completions.
+	UpgradeURL string
+
+	sources        []modelsSource
+	circuitBreaker CircuitBreaker
+
+	mu       sync.Mutex
+	cached   []byte
+	cachedAt time.Time
+}
+
+// NewModelsHandler lists the models of the API at base, e.g.
+// https://api.openai.com/v1, and of the router's upstreams.
+func NewModelsHandler(base *url.URL, router Router, cb CircuitBreaker) *ModelsHandler {
+	h := &ModelsHandler{
+		Client:         &http.Client{Transport: NewUpstreamTransport(nil)},
+		RequestHeaders: DefaultRequestHeaderPolicy,
+		CacheTTL:       DefaultModelsCacheTTL,
+		circuitBreaker: cb,
+	}
+	seen := make(map[string]bool)
+	add := func(endpoint string, route Route) {
+		if !seen[endpoint] {
+			seen[endpoint] = true
+			h.sources = append(h.sources, modelsSource{url: endpoint, route: route})
+		}
+	}
+	add(ModelsEndpoint(base).String(), Route{})
+
+	prefixes := make([]string, 0, len(router))
+	for prefix := range router {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		route := router[prefix]
+		if route.Adapter != "" || route.templated() {
+			continue
+		}
+		completions, err := url.Parse(route.URL)
+		if err != nil {
+			continue
+		}
+		add(ModelsEndpoint(UpstreamAPIBase(completions)).String(), route)
+	}
+	return h
+}
+
+// ModelsEndpoint derives the models endpoint from the API root.
+func ModelsEndpoint(base *url.URL) *url.URL {
+	endpoint := *base
+	endpoint.Path = strings.TrimSuffix(base.Path, "/") + strings.TrimPrefix(ModelsRoute, "/v1")
+	endpoint.RawPath = ""
+	return &endpoint
+}
+
+// modelList is the OpenAI list object. Entries are kept as sent, so fields
+// the gateway doesn't know survive the merge.
+type modelList struct {
+	Object string            `json:"object"`
+	Data   []json.RawMessage `json:"data"`
+}
+
+// upstreamListError is a non-200 answer to a model listing.
+type upstreamListError struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+func (e *upstreamListError) Error() string {
+	return fmt.Sprintf("upstream answered %d", e.status)
+}
+
+func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+	apiKey := ExtractAPIKey(r)
+	if apiKey == "" {
+		WriteError(w, http.StatusUnauthorized, "missing_api_key", "Unauthorized: provide API Key")
+		return
+	}
+	if h.circuitBreaker != nil {
+		allowed, err := h.circuitBreaker.CheckLimit(apiKey)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
+			return
+		}
+		if !allowed {
+			writeLimitExceeded(w, h.circuitBreaker, apiKey, h.UpgradeURL)
+			return
+		}
+	}
+
+	h.mu.Lock()
+	cached := h.cached
+	fresh := cached != nil && time.Since(h.cachedAt) < h.CacheTTL
+	h.mu.Unlock()
+	if fresh {
+		writeModelList(w, cached)
+		return
+	}
+
+	// Upstreams are asked concurrently, so one slow provider doesn't add up with the others
+	lists := make([][]json.RawMessage, len(h.sources))
+	errs := make([]error, len(h.sources))
+	var wg sync.WaitGroup
+	for i, source := range h.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[i], errs[i] = h.fetch(r.Context(), source, r.Header, apiKey)
+		}()
+	}
+	wg.Wait()
+
+	merged := modelList{Object: "list", Data: []json.RawMessage{}}
+	seen := make(map[string]bool)
+	complete := true
+	var firstErr error
+	for i, list := range lists {
+		if errs[i] != nil {
+			slog.Warn("Failed to list upstream models", "upstream", h.sources[i].url, "error", errs[i])
+			complete = false
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		for _, entry := range list {
+			var model struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(entry, &model) != nil || model.ID == "" || seen[model.ID] {
+				continue
+			}
+			seen[model.ID] = true
+			merged.Data = append(merged.Data, entry)
+		}
+	}
+
+	// With no list at all, the upstream's own answer is more useful than an empty one
+	if len(seen) == 0 && firstErr != nil {
+		if listErr, ok := firstErr.(*upstreamListError); ok {
+			w.Header().Set("Content-Type", listErr.contentType)
+			w.WriteHeader(listErr.status)
+			w.Write(listErr.body)
+			return
+		}
+		WriteError(w, http.StatusBadGateway, "upstream_error", "Bad Gateway")
+		return
+	}
+
+	body, err := json.Marshal(merged)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "internal_error", "Error encoding model list")
+		return
+	}
+	// A partial list is served but not cached, so the missing upstream is asked again
+	if complete && h.CacheTTL > 0 {
+		h.mu.Lock()
+		h.cached, h.cachedAt = body, time.Now()
+		h.mu.Unlock()
+	}
+	writeModelList(w, body)
+}
+
+// fetch reads one upstream's model list with the client's credentials.
+func (h *ModelsHandler) fetch(ctx context.Context, source modelsSource, header http.Header, apiKey string) ([]json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	copyRequestHeaders(req.Header, header, h.RequestHeaders)
+	forwardAPIKey(req, apiKey)
+	source.route.rewriteHeaders(req.Header)
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxModelsBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &upstreamListError{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: body}
+	}
+
+	var list modelList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("invalid model list: %w", err)
+	}
+	return list.Data, nil
+}
+
+func writeModelList(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,123 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+// modelsUpstream serves a fixed model list, counting the requests it gets.
+func modelsUpstream(t *testing.T, hits *atomic.Int32, list string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path != "/v1/models" {
+			t.Errorf("expected the models endpoint, got %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, list)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestModelsHandler_MergesUpstreams(t *testing.T) {
+	var openaiHits, vllmHits atomic.Int32
+	var vllmAuth string
+	openai := modelsUpstream(t, &openaiHits,
+		`{"object":"list","data":[{"id":"gpt-4o","object":"model","owned_by":"openai"},{"id":"shared-model","object":"model","owned_by":"openai"}]}`)
+	vllm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vllmHits.Add(1)
+		vllmAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"list","data":[{"id":"llama-3-70b","object":"model","owned_by":"vllm","max_model_len":8192},{"id":"shared-model","object":"model","owned_by":"vllm"}]}`)
+	}))
+	defer vllm.Close()
+
+	base, _ := url.Parse(openai.URL + "/v1")
+	router := gateway.Router{
+		"llama-":  {URL: vllm.URL + "/v1/chat/completions", Headers: map[string]string{"Authorization": "Bearer vllm-token"}},
+		"claude-": {URL: "https://api.anthropic.invalid/v1/messages", Adapter: "anthropic"},
+	}
+	handler := gateway.NewModelsHandler(base, router, &MockCircuitBreaker{Allowed: true})
+
+	list := func() ([]map[string]interface{}, int) {
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var body struct {
+			Object string                   `json:"object"`
+			Data   []map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(rr.Body).Decode(&body)
+		if body.Object != "list" {
+			t.Errorf("expected a list object, got %q", body.Object)
+		}
+		return body.Data, rr.Code
+	}
+
+	models, code := list()
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var ids []string
+	for _, m := range models {
+		ids = append(ids, m["id"].(string))
+	}
+	if len(ids) != 3 || ids[0] != "gpt-4o" || ids[1] != "shared-model" || ids[2] != "llama-3-70b" {
+		t.Fatalf("expected each model once, default upstream first, got %v", ids)
+	}
+	if models[1]["owned_by"] != "openai" {
+		t.Errorf("expected the first upstream's entry for a shared model, got %v", models[1])
+	}
+	if models[2]["max_model_len"] != float64(8192) {
+		t.Errorf("expected unknown fields to survive the merge, got %v", models[2])
+	}
+	if vllmAuth != "Bearer vllm-token" {
+		t.Errorf("expected the route's headers on its listing, got %q", vllmAuth)
+	}
+
+	// The merged list is served from the cache
+	list()
+	if openaiHits.Load() != 1 || vllmHits.Load() != 1 {
+		t.Errorf("expected one request per upstream, got %d and %d", openaiHits.Load(), vllmHits.Load())
+	}
+}
+
+func TestModelsHandler_BudgetAndErrors(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`)
+	}))
+	defer upstreamServer.Close()
+	base, _ := url.Parse(upstreamServer.URL + "/v1")
+
+	send := func(handler http.Handler, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(gateway.NewModelsHandler(base, nil, &MockCircuitBreaker{Allowed: true}), ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", rr.Code)
+	}
+	if rr := send(gateway.NewModelsHandler(base, nil, &MockCircuitBreaker{Allowed: false}), "spent-key"); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("expected 402 for a key over its budget, got %d", rr.Code)
+	}
+	// With nothing to list, the upstream's own error is relayed
+	rr := send(gateway.NewModelsHandler(base, nil, &MockCircuitBreaker{Allowed: true}), "bad-key")
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the upstream's 401, got %d", rr.Code)
+	}
+}
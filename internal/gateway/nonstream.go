@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// maxUsageBodyBytes bounds how much of a JSON response is kept to read its usage.
+const maxUsageBodyBytes = 4 << 20
+
+// isJSONResponse reports whether the upstream sent a single JSON document rather than SSE.
+func isJSONResponse(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// forwardJSONResponse passes a non-streaming response through unchanged, then
+// reads the usage object from the complete body. A body too large to parse, or
+// cut off at opts.MaxBytes, is billed an estimate instead: the prompt estimate
+// plus the bytes relayed at the HeuristicTokenizer's four per token.
+func forwardJSONResponse(w http.ResponseWriter, resp *http.Response, apiKey string, usageChan chan<- UsageRecord, opts StreamOptions) UsageRecord {
+	copyResponseHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	if !opts.Start.IsZero() {
+		metrics.TimeToFirstByte.Observe(time.Since(opts.Start).Seconds())
+	}
+
+	body := &limitedBuffer{limit: maxUsageBodyBytes}
+	src := io.TeeReader(resp.Body, body)
+	if opts.MaxBytes > 0 {
+		src = io.LimitReader(src, opts.MaxBytes)
+	}
+	n, _ := io.Copy(w, src)
+	metrics.ResponseBytes.Observe(float64(n))
+	var truncated bool
+	if opts.MaxBytes > 0 && n == opts.MaxBytes {
+		// The limit was hit; an incomplete body carries no usable usage object
+		if extra, _ := resp.Body.Read(make([]byte, 1)); extra > 0 {
+			metrics.ResponseTruncated.Inc()
+			body.overflow = true
+			truncated = true
+		}
+	}
+
+	record := opts.newRecord(apiKey)
+	var completion struct {
+		Model string      `json:"model"`
+		Usage *usageBlock `json:"usage"`
+	}
+	if body.overflow {
+		record.PromptTokens = opts.PromptTokens
+		record.CompletionTokens = int((n + 3) / 4)
+		record.TokenCount = record.PromptTokens + record.CompletionTokens
+	} else if json.Unmarshal(body.Bytes(), &completion) == nil {
+		if completion.Model != "" {
+			record.Model = completion.Model
+		}
+		if completion.Usage != nil {
+			completion.Usage.apply(&record)
+		}
+	}
+
+	record.Partial = truncated
+	opts.price(&record)
+	dispatchUsage(record, usageChan, opts.DeadLetter)
+	return record
+}
+
+// forwardUpstreamError relays an upstream error response verbatim, with its
+// status and Content-Type, without looking for usage in it.
+func forwardUpstreamError(w http.ResponseWriter, resp *http.Response) {
+	copyResponseHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// limitedBuffer keeps written bytes until limit is exceeded, then discards them.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if !b.overflow {
+		if b.Len()+len(p) > b.limit {
+			b.overflow = true
+			b.Reset()
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,184 @@
+package gateway_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+const completionJSON = `{"id":"chatcmpl-1","object":"chat.completion","model":"legacy-model",` +
+	`"choices":[{"index":0,"message":{"role":"assistant","content":"Hi"}}],` +
+	`"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`
+
+func TestProxyHandler_NonStreamingModel(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := decodePayload(t, r)
+		if _, ok := payload["stream"]; ok {
+			t.Errorf("expected stream not to be forced for a non-streaming model, got %v", payload["stream"])
+		}
+		if _, ok := payload["stream_options"]; ok {
+			t.Errorf("expected no stream_options for a non-streaming model")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, completionJSON)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.NonStreamingModels = map[string]bool{"legacy-model": true}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "legacy-model"}`)))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Body.String() != completionJSON {
+		t.Errorf("expected the JSON response to pass through unchanged, got %q", rr.Body.String())
+	}
+
+	select {
+	case record := <-usageChan:
+		if record.TokenCount != 15 || record.PromptTokens != 12 || record.CompletionTokens != 3 {
+			t.Errorf("expected usage from the JSON body, got %+v", record)
+		}
+	default:
+		t.Error("expected usage to be recorded from the JSON response")
+	}
+}
+
+func TestProxyHandler_NonStreamingRequest(t *testing.T) {
+	reqBody := `{"model": "gpt-4o", "stream": false, "messages": [{"role": "user", "content": "Hi"}]}`
+	var forwarded string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, completionJSON)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(reqBody)))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if forwarded != reqBody {
+		t.Errorf("expected the non-streaming request to be forwarded untouched, got %s", forwarded)
+	}
+	if rr.Body.String() != completionJSON {
+		t.Errorf("expected the JSON response to pass through unchanged, got %q", rr.Body.String())
+	}
+
+	select {
+	case record := <-usageChan:
+		if record.TokenCount != 15 || record.PromptTokens != 12 || record.CompletionTokens != 3 {
+			t.Errorf("expected usage from the JSON body, got %+v", record)
+		}
+	default:
+		t.Error("expected usage to be recorded from the JSON response")
+	}
+}
+
+func TestProxyHandler_ForceStream(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := decodePayload(t, r)
+		if payload["stream"] != true {
+			t.Errorf("expected ForceStream to turn the request into a stream, got %v", payload["stream"])
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.ForceStream = true
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4o"}`)))
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestProxyHandler_UpstreamErrorPassthrough(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusBadRequest, `{"error":{"message":"The model 'gpt-5-nope' does not exist","type":"invalid_request_error","param":"model","code":"model_not_found"}}`},
+		{http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached for gpt-4o","type":"requests","param":null,"code":"rate_limit_exceeded"}}`},
+	}
+
+	for _, tt := range tests {
+		upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(tt.status)
+			io.WriteString(w, tt.body)
+		}))
+
+		upstreamURL, _ := url.Parse(upstreamServer.URL)
+		usageChan := make(chan gateway.UsageRecord, 1)
+		proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+		proxyHandler.UsageEvent = true
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4o", "stream": true}`)))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		upstreamServer.Close()
+
+		if rr.Code != tt.status {
+			t.Errorf("expected the upstream status %d, got %d", tt.status, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+			t.Errorf("expected the upstream Content-Type, got %q", got)
+		}
+		if rr.Body.String() != tt.body {
+			t.Errorf("expected the error JSON unmodified, got %q", rr.Body.String())
+		}
+		if len(usageChan) != 0 {
+			t.Errorf("expected no usage recorded for a %d", tt.status)
+		}
+	}
+}
+
+func TestProxyHandler_NonStreamingTruncatedIsEstimated(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, completionJSON)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.MaxResponseBytes = 40
+
+	reqBody := `{"model": "gpt-4o", "stream": false, "messages": [{"role": "user", "content": "Hi"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(reqBody)))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Body.Len() != 40 {
+		t.Fatalf("expected the body to be cut off at 40 bytes, got %d", rr.Body.Len())
+	}
+	select {
+	case record := <-usageChan:
+		// The usage object was cut off, so the 40 relayed bytes are billed as 10 tokens
+		if !record.Partial || record.CompletionTokens != 10 || record.PromptTokens == 0 || record.CostMicroDollars == 0 {
+			t.Errorf("expected an estimate of the prompt and relayed bytes, got %+v", record)
+		}
+	default:
+		t.Error("expected the truncated response to be billed")
+	}
+}
@@ -0,0 +1,235 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultMilestones are the budget percentages notified when none are configured.
+var DefaultMilestones = []int{50, 90, 100}
+
+// MilestoneConfig says where and at which budget percentages a key is notified.
+type MilestoneConfig struct {
+	URL        string
+	Thresholds []int
+}
+
+// MilestoneEvent is the JSON webhook body sent when a key crosses a milestone.
+// APIKeyHash identifies the key as in metrics, for receivers that shouldn't
+// hold the key itself.
+type MilestoneEvent struct {
+	APIKey       string  `json:"api_key"`
+	APIKeyHash   string  `json:"api_key_hash"`
+	Percent      int     `json:"percent"`
+	UsageDollars float64 `json:"usage_dollars"`
+	LimitDollars float64 `json:"limit_dollars"`
+}
+
+// ThresholdNotifier fires a webhook the first time a key's usage crosses each
+// configured percentage of its limit. A milestone re-arms once usage falls back
+// below it, e.g. when the key's budget is reset. Webhooks are delivered in the
+// background, retrying failures up to MaxAttempts times.
+type ThresholdNotifier struct {
+	Default MilestoneConfig
+	Keys    map[string]MilestoneConfig
+	Client  *http.Client
+
+	// Store remembers which milestones have fired. Defaults to process memory;
+	// RedisMilestones shares it between replicas so each fires once overall.
+	Store MilestoneStore
+
+	// MaxAttempts bounds delivery attempts per webhook, and RetryBackoff is
+	// the wait before the first retry, doubling after each.
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+// DefaultWebhookAttempts is how many times a milestone webhook is tried.
+const DefaultWebhookAttempts = 3
+
+// NewThresholdNotifier creates a notifier using def for keys without their own config.
+func NewThresholdNotifier(def MilestoneConfig) *ThresholdNotifier {
+	return &ThresholdNotifier{
+		Default:      def,
+		Keys:         make(map[string]MilestoneConfig),
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		Store:        NewMemoryMilestones(),
+		MaxAttempts:  DefaultWebhookAttempts,
+		RetryBackoff: time.Second,
+	}
+}
+
+// MilestoneStore tracks the milestones each key has been notified of.
+type MilestoneStore interface {
+	// Update marks the reached milestones fired and re-arms the others,
+	// returning the reached milestones that hadn't fired before.
+	Update(apiKey string, reached, unreached []int) ([]int, error)
+}
+
+// MemoryMilestones implements MilestoneStore in process memory.
+type MemoryMilestones struct {
+	mu    sync.Mutex
+	fired map[string]map[int]bool // apiKey -> milestones already notified
+}
+
+func NewMemoryMilestones() *MemoryMilestones {
+	return &MemoryMilestones{fired: make(map[string]map[int]bool)}
+}
+
+// Update implements MilestoneStore.
+func (m *MemoryMilestones) Update(apiKey string, reached, unreached []int) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fired, ok := m.fired[apiKey]
+	if !ok {
+		fired = make(map[int]bool)
+		m.fired[apiKey] = fired
+	}
+	var crossed []int
+	for _, pct := range reached {
+		if !fired[pct] {
+			fired[pct] = true
+			crossed = append(crossed, pct)
+		}
+	}
+	for _, pct := range unreached {
+		delete(fired, pct)
+	}
+	return crossed, nil
+}
+
+// RedisMilestones implements MilestoneStore with a set per key,
+// `apikey:<key>:milestones`, so a milestone fires once across replicas.
+type RedisMilestones struct {
+	client *redis.Client
+}
+
+func NewRedisMilestones(client *redis.Client) *RedisMilestones {
+	return &RedisMilestones{client: client}
+}
+
+func (r *RedisMilestones) getMilestonesKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:milestones", apiKey)
+}
+
+// Update implements MilestoneStore in one round trip. SADD only reports a
+// milestone as added to the replica that added it first.
+func (r *RedisMilestones) Update(apiKey string, reached, unreached []int) ([]int, error) {
+	ctx := context.Background()
+	key := r.getMilestonesKey(apiKey)
+	pipe := r.client.Pipeline()
+	added := make([]*redis.IntCmd, len(reached))
+	for i, pct := range reached {
+		added[i] = pipe.SAdd(ctx, key, pct)
+	}
+	if len(unreached) > 0 {
+		members := make([]interface{}, len(unreached))
+		for i, pct := range unreached {
+			members[i] = pct
+		}
+		pipe.SRem(ctx, key, members...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("redis milestones error: %w", err)
+	}
+	var crossed []int
+	for i, pct := range reached {
+		if added[i].Val() == 1 {
+			crossed = append(crossed, pct)
+		}
+	}
+	return crossed, nil
+}
+
+func (n *ThresholdNotifier) configFor(apiKey string) MilestoneConfig {
+	cfg, ok := n.Keys[apiKey]
+	if !ok {
+		cfg = n.Default
+	}
+	if cfg.URL == "" {
+		cfg.URL = n.Default.URL
+	}
+	if len(cfg.Thresholds) == 0 {
+		cfg.Thresholds = DefaultMilestones
+	}
+	return cfg
+}
+
+// Observe checks a key's usage after it was charged and asynchronously notifies
+// every milestone newly crossed. It returns the milestones it fired.
+func (n *ThresholdNotifier) Observe(apiKey string, usage, limit int64) []int {
+	cfg := n.configFor(apiKey)
+	if cfg.URL == "" || limit <= 0 {
+		return nil
+	}
+
+	var reached, unreached []int
+	for _, pct := range cfg.Thresholds {
+		if usage*100 >= limit*int64(pct) {
+			reached = append(reached, pct)
+		} else {
+			unreached = append(unreached, pct)
+		}
+	}
+	crossed, err := n.Store.Update(apiKey, reached, unreached)
+	if err != nil {
+		slog.Error("Failed to track usage milestones", observability.APIKeyAttr(apiKey), "error", err)
+		return nil
+	}
+
+	sort.Ints(crossed)
+	for _, pct := range crossed {
+		go n.send(cfg.URL, MilestoneEvent{
+			APIKey:       apiKey,
+			APIKeyHash:   metrics.HashAPIKey(apiKey),
+			Percent:      pct,
+			UsageDollars: float64(usage) / 1000000.0,
+			LimitDollars: float64(limit) / 1000000.0,
+		})
+	}
+	return crossed
+}
+
+// send delivers the webhook, retrying connection errors, 5xx and 429 with
+// exponential backoff. Other 4xx are the receiver rejecting the event, so
+// retrying wouldn't help.
+func (n *ThresholdNotifier) send(url string, event MilestoneEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	backoff := n.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		resp, err := n.Client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			retryable = true
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+				retryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+			}
+		}
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= n.MaxAttempts {
+			slog.Error("Failed to deliver usage milestone webhook", observability.APIKeyAttr(event.APIKey), "percent", event.Percent, "attempts", attempt, "error", err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
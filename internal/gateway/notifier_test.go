@@ -0,0 +1,174 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"aura-ai-gateway/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestThresholdNotifier(t *testing.T) {
+	events := make(chan gateway.MilestoneEvent, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event gateway.MilestoneEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer webhook.Close()
+
+	notifier := gateway.NewThresholdNotifier(gateway.MilestoneConfig{URL: webhook.URL})
+	notifier.Keys["vip"] = gateway.MilestoneConfig{Thresholds: []int{75}}
+	limit := int64(10000000)
+
+	if got := notifier.Observe("test-key", 4000000, limit); got != nil {
+		t.Errorf("expected no milestone at 40%%, got %v", got)
+	}
+	// A single large charge can cross several milestones at once
+	if got := notifier.Observe("test-key", 9500000, limit); !reflect.DeepEqual(got, []int{50, 90}) {
+		t.Errorf("expected milestones [50 90] at 95%%, got %v", got)
+	}
+	// Each milestone fires only once
+	if got := notifier.Observe("test-key", 9600000, limit); got != nil {
+		t.Errorf("expected no repeat notifications, got %v", got)
+	}
+	// Per-key thresholds replace the defaults
+	if got := notifier.Observe("vip", 8000000, limit); !reflect.DeepEqual(got, []int{75}) {
+		t.Errorf("expected the key's own milestone [75], got %v", got)
+	}
+	// Milestones re-arm once usage is reset below them
+	notifier.Observe("test-key", 0, limit)
+	if got := notifier.Observe("test-key", 5000000, limit); !reflect.DeepEqual(got, []int{50}) {
+		t.Errorf("expected milestone 50 to fire again after a reset, got %v", got)
+	}
+
+	received := make(map[int]int)
+	for i := 0; i < 4; i++ {
+		select {
+		case event := <-events:
+			received[event.Percent]++
+			if event.LimitDollars != 10 {
+				t.Errorf("expected a $10 limit in the webhook, got %v", event.LimitDollars)
+			}
+			if event.APIKeyHash != metrics.HashAPIKey(event.APIKey) {
+				t.Errorf("expected the key's hash in the webhook, got %q", event.APIKeyHash)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 4 webhooks, got %v", received)
+		}
+	}
+	if !reflect.DeepEqual(received, map[int]int{50: 2, 90: 1, 75: 1}) {
+		t.Errorf("unexpected webhooks delivered: %v", received)
+	}
+}
+
+func TestThresholdNotifier_RetriesFailedWebhooks(t *testing.T) {
+	var attempts int32
+	delivered := make(chan gateway.MilestoneEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event gateway.MilestoneEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		delivered <- event
+	}))
+	defer webhook.Close()
+
+	notifier := gateway.NewThresholdNotifier(gateway.MilestoneConfig{URL: webhook.URL, Thresholds: []int{50}})
+	notifier.RetryBackoff = time.Millisecond
+	notifier.Observe("retry-key", 6000000, 10000000)
+
+	select {
+	case event := <-delivered:
+		if event.Percent != 50 {
+			t.Errorf("expected milestone 50, got %d", event.Percent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the webhook to be delivered after retries")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestThresholdNotifier_DoesNotRetryRejectedWebhooks(t *testing.T) {
+	var attempts int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer webhook.Close()
+
+	notifier := gateway.NewThresholdNotifier(gateway.MilestoneConfig{URL: webhook.URL, Thresholds: []int{50}})
+	notifier.RetryBackoff = time.Millisecond
+	notifier.Observe("rejected-key", 6000000, 10000000)
+
+	time.Sleep(100 * time.Millisecond)
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("expected a single attempt for a 400, got %d", got)
+	}
+}
+
+func TestRedisMilestones(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	apiKey := "test-redis-milestones-key"
+	client.Del(ctx, "apikey:"+apiKey+":milestones")
+	defer client.Del(ctx, "apikey:"+apiKey+":milestones")
+
+	var webhooks int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&webhooks, 1)
+	}))
+	defer webhook.Close()
+
+	// Two replicas sharing the store fire each crossing once between them
+	replicas := make([]*gateway.ThresholdNotifier, 2)
+	for i := range replicas {
+		replicas[i] = gateway.NewThresholdNotifier(gateway.MilestoneConfig{URL: webhook.URL, Thresholds: []int{50, 90}})
+		replicas[i].Store = gateway.NewRedisMilestones(client)
+	}
+	limit := int64(10000000)
+
+	if got := replicas[0].Observe(apiKey, 6000000, limit); !reflect.DeepEqual(got, []int{50}) {
+		t.Errorf("expected milestone [50] on the first replica, got %v", got)
+	}
+	if got := replicas[1].Observe(apiKey, 6500000, limit); got != nil {
+		t.Errorf("expected the second replica not to repeat milestone 50, got %v", got)
+	}
+	if got := replicas[1].Observe(apiKey, 9500000, limit); !reflect.DeepEqual(got, []int{90}) {
+		t.Errorf("expected milestone [90] on the second replica, got %v", got)
+	}
+	// A reset seen by either replica re-arms the milestones for both
+	replicas[0].Observe(apiKey, 0, limit)
+	if got := replicas[1].Observe(apiKey, 5000000, limit); !reflect.DeepEqual(got, []int{50}) {
+		t.Errorf("expected milestone 50 to fire again after a reset, got %v", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&webhooks) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&webhooks); got != 3 {
+		t.Errorf("expected exactly 3 webhooks, got %d", got)
+	}
+}
@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PassthroughRoutes are the asynchronous OpenAI endpoints forwarded verbatim.
+// Batch jobs run later from uploaded files, so their usage only appears in the
+// results file and can't be billed as the request passes through.
+var PassthroughRoutes = []string{"/v1/batches", "/v1/batches/", "/v1/files", "/v1/files/"}
+
+// PassthroughHandler forwards requests to the upstream API untouched: the body
+// is streamed as is, with no stream injection and no usage recorded. Requests
+// still need an API key, and a key over its budget can't start new work.
+type PassthroughHandler struct {
+	Client         *http.Client
+	RequestHeaders *RequestHeaderPolicy
+
+	// UpgradeURL is included in 402 responses, as for completions.
+	UpgradeURL string
+
+	base           *url.URL
+	circuitBreaker CircuitBreaker
+}
+
+// NewPassthroughHandler forwards requests for /v1/<path> to <base>/<path>.
+func NewPassthroughHandler(base *url.URL, cb CircuitBreaker) *PassthroughHandler {
+	return &PassthroughHandler{
+		Client:         &http.Client{Transport: NewUpstreamTransport(nil)},
+		RequestHeaders: DefaultRequestHeaderPolicy,
+		base:           base,
+		circuitBreaker: cb,
+	}
+}
+
+// UpstreamAPIBase derives the API root, e.g. https://api.openai.com/v1, from
+// the chat completions endpoint the gateway is configured with.
+func UpstreamAPIBase(completions *url.URL) *url.URL {
+	base := *completions
+	base.Path = strings.TrimSuffix(strings.TrimSuffix(base.Path, "/"), "/chat/completions")
+	base.RawPath = ""
+	base.RawQuery = ""
+	return &base
+}
+
+// preservedPath maps a request path onto the API root of the completions
+// endpoint, e.g. /v1/completions to https://host/openai/v1/completions. The
+// endpoint's query, such as an api-version, is kept.
+func preservedPath(completions *url.URL, requestPath string) *url.URL {
+	endpoint := UpstreamAPIBase(completions)
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + relativePath(requestPath)
+	endpoint.RawQuery = completions.RawQuery
+	return endpoint
+}
+
+func (h *PassthroughHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	apiKey := ExtractAPIKey(r)
+	if apiKey == "" {
+		WriteError(w, http.StatusUnauthorized, "missing_api_key", "Unauthorized: provide API Key")
+		return
+	}
+
+	if h.circuitBreaker != nil {
+		allowed, err := h.circuitBreaker.CheckLimit(apiKey)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "rate_limit_check_failed", "Error validating rate limit")
+			return
+		}
+		if !allowed {
+			writeLimitExceeded(w, h.circuitBreaker, apiKey, h.UpgradeURL)
+			return
+		}
+	}
+
+	target := *h.base
+	target.Path = strings.TrimSuffix(h.base.Path, "/") + strings.TrimPrefix(r.URL.Path, "/v1")
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+
+	upstreamReq, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), r.Body)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "internal_error", "Error creating upstream request")
+		return
+	}
+	copyRequestHeaders(upstreamReq.Header, r.Header, h.RequestHeaders)
+	forwardAPIKey(upstreamReq, apiKey)
+	upstreamReq.ContentLength = r.ContentLength
+	if r.ContentLength == 0 {
+		upstreamReq.Body = nil
+	}
+
+	resp, err := h.Client.Do(upstreamReq)
+	if err != nil {
+		WriteError(w, http.StatusBadGateway, "upstream_error", "Bad Gateway")
+		return
+	}
+	defer resp.Body.Close()
+
+	copyResponseHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
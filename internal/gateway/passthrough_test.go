@@ -0,0 +1,64 @@
+package gateway_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestPassthroughHandler(t *testing.T) {
+	const batch = `{"input_file_id": "file-abc", "endpoint": "/v1/chat/completions", "completion_window": "24h"}`
+	var gotPath, gotQuery, gotBody, gotAuth string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotQuery, gotBody, gotAuth = r.URL.Path, r.URL.RawQuery, string(body), r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id": "batch_abc", "status": "validating"}`)
+	}))
+	defer upstreamServer.Close()
+
+	completionsURL, _ := url.Parse(upstreamServer.URL + "/v1/chat/completions")
+	cb := &MockCircuitBreaker{Allowed: true}
+	handler := gateway.NewPassthroughHandler(gateway.UpstreamAPIBase(completionsURL), cb)
+
+	req := httptest.NewRequest("POST", "/v1/batches?limit=1", strings.NewReader(batch))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "batch_abc") {
+		t.Fatalf("expected the upstream response to be relayed, got %d %q", rr.Code, rr.Body.String())
+	}
+	if gotPath != "/v1/batches" || gotQuery != "limit=1" {
+		t.Errorf("expected /v1/batches?limit=1 upstream, got %s?%s", gotPath, gotQuery)
+	}
+	if gotBody != batch {
+		t.Errorf("expected the body forwarded verbatim, got %s", gotBody)
+	}
+	if gotAuth != "Bearer test-key" {
+		t.Errorf("expected the key to be forwarded, got %q", gotAuth)
+	}
+
+	// No key, no access
+	req = httptest.NewRequest("GET", "/v1/files/file-abc", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without an API key, got %d", rr.Code)
+	}
+
+	// Keys over budget can't start new work
+	cb.Allowed = false
+	req = httptest.NewRequest("GET", "/v1/files/file-abc", nil)
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("expected 402 for a key over budget, got %d", rr.Code)
+	}
+}
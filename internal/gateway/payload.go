@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Payloads are decoded with UseNumber so integers such as `seed` survive the
+// round trip exactly. Numeric fields therefore arrive as json.Number, not
+// float64; these accessors read them safely whatever the concrete type is.
+
+// PayloadInt reads an integer field. It reports false if the field is missing,
+// not numeric, or has a fractional part.
+func PayloadInt(payload map[string]interface{}, key string) (int64, bool) {
+	switch v := payload[key].(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return int64(f), true
+		}
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), true
+		}
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+// PayloadFloat reads a numeric field as a float64. It reports false if the
+// field is missing or not numeric.
+func PayloadFloat(payload map[string]interface{}, key string) (float64, bool) {
+	switch v := payload[key].(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, true
+		}
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// streamsWithUsage reports whether the payload already requests a stream that
+// ends with a usage chunk, so the gateway has nothing to inject.
+func streamsWithUsage(payload map[string]interface{}) bool {
+	stream, _ := payload["stream"].(bool)
+	options, _ := payload["stream_options"].(map[string]interface{})
+	includeUsage, _ := options["include_usage"].(bool)
+	return stream && includeUsage
+}
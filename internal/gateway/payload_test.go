@@ -0,0 +1,198 @@
+package gateway_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestPayloadAccessors(t *testing.T) {
+	payload := map[string]interface{}{
+		"max_tokens":  json.Number("256"),
+		"temperature": json.Number("0.7"),
+		"seed":        json.Number("9007199254740993"),
+		"top_p":       1.0,
+		"n":           2,
+		"model":       "gpt-4o",
+	}
+
+	if v, ok := gateway.PayloadInt(payload, "max_tokens"); !ok || v != 256 {
+		t.Errorf("expected max_tokens 256, got %d (ok=%v)", v, ok)
+	}
+	if v, ok := gateway.PayloadInt(payload, "seed"); !ok || v != 9007199254740993 {
+		t.Errorf("expected seed to keep full precision, got %d (ok=%v)", v, ok)
+	}
+	if _, ok := gateway.PayloadInt(payload, "temperature"); ok {
+		t.Errorf("expected fractional temperature not to read as an int")
+	}
+	if v, ok := gateway.PayloadFloat(payload, "temperature"); !ok || v != 0.7 {
+		t.Errorf("expected temperature 0.7, got %v (ok=%v)", v, ok)
+	}
+	if v, ok := gateway.PayloadInt(payload, "n"); !ok || v != 2 {
+		t.Errorf("expected native int n to be read, got %d (ok=%v)", v, ok)
+	}
+	if v, ok := gateway.PayloadFloat(payload, "top_p"); !ok || v != 1 {
+		t.Errorf("expected float64 top_p to be read, got %v (ok=%v)", v, ok)
+	}
+	if _, ok := gateway.PayloadInt(payload, "model"); ok {
+		t.Errorf("expected non-numeric field to be rejected")
+	}
+	if _, ok := gateway.PayloadFloat(payload, "missing"); ok {
+		t.Errorf("expected missing field to be rejected")
+	}
+}
+
+func TestProxyHandler_NumbersRoundTrip(t *testing.T) {
+	var forwarded string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodyBytes, _ := io.ReadAll(r.Body)
+		forwarded = string(bodyBytes)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+
+	// 2^53 + 1 can't be represented as a float64
+	// Streaming, so the body is re-encoded with stream_options
+	reqBody := []byte(`{"model": "gpt-4o", "stream": true, "seed": 9007199254740993, "temperature": 0.7, "max_tokens": 256}`)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(reqBody))
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, field := range []string{`"seed":9007199254740993`, `"temperature":0.7`, `"max_tokens":256`} {
+		if !strings.Contains(forwarded, field) {
+			t.Errorf("expected %s to reach the upstream unchanged, got %s", field, forwarded)
+		}
+	}
+}
+
+func TestProxyHandler_ForwardsCompatibleBodyUnchanged(t *testing.T) {
+	var forwarded []byte
+	var contentLength int64
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = io.ReadAll(r.Body)
+		contentLength = r.ContentLength
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+
+	compatible := `{"stream": true, "model": "gpt-4o", "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "<b>"}]}`
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(compatible)))
+	if string(forwarded) != compatible {
+		t.Errorf("expected a compatible body to be forwarded byte for byte, got %s", forwarded)
+	}
+	if contentLength != int64(len(compatible)) {
+		t.Errorf("expected Content-Length %d, got %d", len(compatible), contentLength)
+	}
+
+	// A client asking for a stream without usage still gets include_usage injected
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"stream": true, "model": "gpt-4o", "stream_options": {"include_usage": false}}`)))
+	if !strings.Contains(string(forwarded), `"stream_options":{"include_usage":true}`) {
+		t.Errorf("expected include_usage to be injected, got %s", forwarded)
+	}
+
+	// The client's other stream options are kept
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"stream": true, "model": "gpt-4o", "stream_options": {"include_obfuscation": false}}`)))
+	if !strings.Contains(string(forwarded), `"stream_options":{"include_obfuscation":false,"include_usage":true}`) {
+		t.Errorf("expected include_usage merged into the client's stream_options, got %s", forwarded)
+	}
+}
+
+func TestProxyHandler_RawBodies(t *testing.T) {
+	var forwarded []byte
+	var encoding string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = io.ReadAll(r.Body)
+		encoding = r.Header.Get("Content-Encoding")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"gpt-4o","usage":{"prompt_tokens":10,"completion_tokens":8,"total_tokens":18}}`)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 2)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.ForceStream = true
+
+	send := func(body []byte, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// A gzipped body isn't JSON, so it's forwarded as is rather than rejected
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(`{"model": "gpt-4o"}`))
+	zw.Close()
+	rr := send(gzipped.Bytes(), http.Header{"Content-Encoding": {"gzip"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if !bytes.Equal(forwarded, gzipped.Bytes()) || encoding != "gzip" {
+		t.Errorf("expected the body to reach the upstream unmodified, got %q with encoding %q", forwarded, encoding)
+	}
+	if record := <-usageChan; record.TokenCount != 18 {
+		t.Errorf("expected usage to be read from the response, got %+v", record)
+	}
+
+	// With Raw set, even JSON bodies are never rewritten
+	proxyHandler.Raw = true
+	body := []byte(`{"model": "gpt-4o", "messages": []}`)
+	if rr := send(body, nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if string(forwarded) != string(body) {
+		t.Errorf("expected no stream injection in raw mode, got %s", forwarded)
+	}
+	if record := <-usageChan; record.TokenCount != 18 {
+		t.Errorf("expected usage to be read from the response, got %+v", record)
+	}
+}
+
+// BenchmarkProxyHandler_RequestBody compares forwarding a body that already
+// requests usage against one the gateway must rewrite.
+func BenchmarkProxyHandler_RequestBody(b *testing.B) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+
+	content := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 200)
+	bodies := map[string]string{
+		"compatible": `{"model": "gpt-4o", "stream": true, "stream_options": {"include_usage": true}, "messages": [{"role": "user", "content": "` + content + `"}]}`,
+		"rewritten":  `{"model": "gpt-4o", "messages": [{"role": "user", "content": "` + content + `"}]}`,
+	}
+	for name, body := range bodies {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+				proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// Replica is one of several upstreams serving the same models, such as a
+// vLLM replica. Weight sets its share of requests relative to the others.
+type Replica struct {
+	URL    *url.URL
+	Weight int
+}
+
+// ParseReplica reads a replica's completions endpoint with an optional
+// "=weight" suffix, e.g. "http://vllm-1:8000/v1/chat/completions=3". The
+// weight defaults to 1.
+func ParseReplica(s string) (Replica, error) {
+	weight := 1
+	if i := strings.LastIndex(s, "="); i >= 0 {
+		if w, err := strconv.Atoi(s[i+1:]); err == nil {
+			if w < 1 {
+				return Replica{}, fmt.Errorf("invalid weight for replica %q", s)
+			}
+			s, weight = s[:i], w
+		}
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return Replica{}, fmt.Errorf("invalid replica url: %q", s)
+	}
+	return Replica{URL: u, Weight: weight}, nil
+}
+
+// BalanceStrategy is how an UpstreamPool picks the replica for each request.
+type BalanceStrategy string
+
+const (
+	// RoundRobin cycles through replicas in proportion to their weights.
+	RoundRobin BalanceStrategy = "round_robin"
+	// LeastConnections picks the replica with the fewest requests in flight
+	// for its weight, so slow replicas receive less.
+	LeastConnections BalanceStrategy = "least_connections"
+)
+
+// errCircuitOpen is returned by a pool's send func for a replica whose
+// upstream breaker is open, so the pool moves on without marking it down.
+var errCircuitOpen = errors.New("upstream circuit open")
+
+// DefaultReplicaCooldown is how long a replica that couldn't be reached is skipped.
+const DefaultReplicaCooldown = 10 * time.Second
+
+// replica is a Replica's balancing state.
+type replica struct {
+	Replica
+	label     string
+	current   int // smooth weighted round-robin counter
+	active    int
+	downUntil time.Time
+}
+
+// UpstreamPool spreads requests to the default upstream across replicas. A
+// replica that can't be reached is skipped for Cooldown, and the request is
+// sent to another before anything reaches the client.
+type UpstreamPool struct {
+	Strategy BalanceStrategy
+	// Cooldown is how long an unreachable replica is skipped.
+	Cooldown time.Duration
+	// Now is the clock used for cooldowns, time.Now when nil.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	replicas []*replica
+}
+
+// NewUpstreamPool creates a pool over replicas, which must not be empty.
+// Weights below 1 count as 1.
+func NewUpstreamPool(replicas []Replica, strategy BalanceStrategy) (*UpstreamPool, error) {
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("upstream pool needs at least one replica")
+	}
+	switch strategy {
+	case "":
+		strategy = RoundRobin
+	case RoundRobin, LeastConnections:
+	default:
+		return nil, fmt.Errorf("unknown balance strategy: %q", strategy)
+	}
+	p := &UpstreamPool{Strategy: strategy, Cooldown: DefaultReplicaCooldown}
+	for _, r := range replicas {
+		if r.Weight < 1 {
+			r.Weight = 1
+		}
+		p.replicas = append(p.replicas, &replica{Replica: r, label: r.URL.Host})
+	}
+	return p, nil
+}
+
+func (p *UpstreamPool) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// pick chooses a replica not yet tried for the request and counts it as in
+// flight. Healthy replicas are preferred, but one in cooldown is still tried
+// rather than failing the request. It returns nil once every replica was tried.
+func (p *UpstreamPool) pick(tried map[*replica]bool) *replica {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var candidates []*replica
+	for _, r := range p.replicas {
+		if !tried[r] && !now.Before(r.downUntil) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, r := range p.replicas {
+			if !tried[r] {
+				candidates = append(candidates, r)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var chosen *replica
+	switch p.Strategy {
+	case LeastConnections:
+		for _, r := range candidates {
+			// Compare active/weight without dividing
+			if chosen == nil || r.active*chosen.Weight < chosen.active*r.Weight {
+				chosen = r
+			}
+		}
+	default:
+		// Smooth weighted round-robin interleaves replicas rather than sending
+		// a heavy one its whole share in a row
+		total := 0
+		for _, r := range candidates {
+			r.current += r.Weight
+			total += r.Weight
+			if chosen == nil || r.current > chosen.current {
+				chosen = r
+			}
+		}
+		chosen.current -= total
+	}
+	chosen.active++
+	metrics.UpstreamSelected.WithLabelValues(chosen.label).Inc()
+	return chosen
+}
+
+// done ends a request to r, marking r down if it couldn't be reached.
+func (p *UpstreamPool) done(r *replica, unreachable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r.active--
+	if unreachable {
+		r.downUntil = p.now().Add(p.Cooldown)
+	}
+}
+
+// do sends req to a replica through send, failing over to the next replica on
+// a connection error or an open circuit, with the body replayed from GetBody. The last error is
+// returned when no replica can be reached.
+func (p *UpstreamPool) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	tried := make(map[*replica]bool)
+	var err error
+	for r := p.pick(tried); r != nil; r = p.pick(tried) {
+		attempt := req.Clone(req.Context())
+		attempt.URL, attempt.Host = r.URL, r.URL.Host
+		if len(tried) > 0 {
+			if req.GetBody == nil {
+				p.done(r, false)
+				return nil, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				p.done(r, false)
+				return nil, err
+			}
+			attempt.Body = body
+		}
+		tried[r] = true
+		slog.Debug("Upstream replica selected", "replica", r.label, "strategy", p.Strategy, "attempt", len(tried))
+
+		var resp *http.Response
+		resp, err = send(attempt)
+		if err == nil {
+			resp.Body = &replicaBody{ReadCloser: resp.Body, done: func() { p.done(r, false) }}
+			return resp, nil
+		}
+		// Its breaker already fails it fast, so it's skipped without a cooldown
+		if errors.Is(err, errCircuitOpen) {
+			p.done(r, false)
+			continue
+		}
+		// The request's own deadline or cancellation says nothing about the replica
+		if req.Context().Err() != nil {
+			p.done(r, false)
+			return nil, err
+		}
+		p.done(r, true)
+		metrics.ErrorRate.WithLabelValues("replica_unreachable").Inc()
+		slog.Warn("Upstream replica unreachable, failing over", "replica", r.label, "error", err)
+	}
+	return nil, err
+}
+
+// replicaBody counts its replica's request as in flight until it is closed.
+type replicaBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *replicaBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,173 @@
+package gateway_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+// countingReplica is an upstream replica counting the requests it serves.
+func countingReplica(t *testing.T, hits *atomic.Int32, release <-chan struct{}) gateway.Replica {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if release != nil {
+			<-release
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	u, _ := url.Parse(server.URL + "/v1/chat/completions")
+	return gateway.Replica{URL: u, Weight: 1}
+}
+
+func sendPooled(proxyHandler *gateway.ProxyHandler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestParseReplica(t *testing.T) {
+	tests := []struct {
+		in      string
+		url     string
+		weight  int
+		wantErr bool
+	}{
+		{in: "http://vllm-1:8000/v1/chat/completions", url: "http://vllm-1:8000/v1/chat/completions", weight: 1},
+		{in: "http://vllm-1:8000/v1/chat/completions=3", url: "http://vllm-1:8000/v1/chat/completions", weight: 3},
+		{in: "http://vllm-1:8000/v1/chat/completions?api-version=v1", url: "http://vllm-1:8000/v1/chat/completions?api-version=v1", weight: 1},
+		{in: "http://vllm-1:8000/v1/chat/completions=0", wantErr: true},
+		{in: "vllm-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			replica, err := gateway.ParseReplica(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", replica)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if replica.URL.String() != tt.url || replica.Weight != tt.weight {
+				t.Errorf("expected %s with weight %d, got %s with weight %d", tt.url, tt.weight, replica.URL, replica.Weight)
+			}
+		})
+	}
+}
+
+func TestUpstreamPool_WeightedRoundRobin(t *testing.T) {
+	var heavyHits, lightHits atomic.Int32
+	heavy := countingReplica(t, &heavyHits, nil)
+	heavy.Weight = 3
+	light := countingReplica(t, &lightHits, nil)
+
+	pool, err := gateway.NewUpstreamPool([]gateway.Replica{heavy, light}, gateway.RoundRobin)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	upstreamURL, _ := url.Parse("http://upstream.invalid/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Upstreams = pool
+
+	for i := 0; i < 40; i++ {
+		if rr := sendPooled(proxyHandler); rr.Code != http.StatusOK {
+			t.Fatalf("expected request %d to succeed, got %d", i+1, rr.Code)
+		}
+	}
+	if heavyHits.Load() != 30 || lightHits.Load() != 10 {
+		t.Errorf("expected a 3:1 split of 30 and 10, got %d and %d", heavyHits.Load(), lightHits.Load())
+	}
+}
+
+func TestUpstreamPool_LeastConnections(t *testing.T) {
+	var busyHits, idleHits atomic.Int32
+	release := make(chan struct{})
+	busy := countingReplica(t, &busyHits, release)
+	idle := countingReplica(t, &idleHits, nil)
+
+	pool, _ := gateway.NewUpstreamPool([]gateway.Replica{busy, idle}, gateway.LeastConnections)
+	upstreamURL, _ := url.Parse("http://upstream.invalid/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Upstreams = pool
+
+	// The first request goes to the first replica and stays in flight
+	done := make(chan struct{})
+	go func() {
+		sendPooled(proxyHandler)
+		close(done)
+	}()
+	for busyHits.Load() == 0 {
+		select {
+		case <-done:
+			t.Fatal("expected the first request to be held by the busy replica")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		sendPooled(proxyHandler)
+	}
+	close(release)
+	<-done
+
+	if busyHits.Load() != 1 || idleHits.Load() != 3 {
+		t.Errorf("expected requests to avoid the busy replica, got %d busy and %d idle", busyHits.Load(), idleHits.Load())
+	}
+}
+
+func TestUpstreamPool_Failover(t *testing.T) {
+	var healthyHits atomic.Int32
+	healthy := countingReplica(t, &healthyHits, nil)
+
+	// A replica that refuses connections
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL, _ := url.Parse(down.URL + "/v1/chat/completions")
+	down.Close()
+
+	pool, _ := gateway.NewUpstreamPool([]gateway.Replica{{URL: downURL, Weight: 1}, healthy}, gateway.RoundRobin)
+	upstreamURL, _ := url.Parse("http://upstream.invalid/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Upstreams = pool
+
+	for i := 0; i < 4; i++ {
+		rr := sendPooled(proxyHandler)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected request %d to fail over to the healthy replica, got %d", i+1, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), "[DONE]") {
+			t.Errorf("expected the healthy replica's stream, got %q", rr.Body.String())
+		}
+	}
+	if healthyHits.Load() != 4 {
+		t.Errorf("expected every request to reach the healthy replica, got %d", healthyHits.Load())
+	}
+}
+
+func TestUpstreamPool_AllReplicasDown(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL, _ := url.Parse(down.URL)
+	down.Close()
+
+	pool, _ := gateway.NewUpstreamPool([]gateway.Replica{{URL: downURL}}, gateway.RoundRobin)
+	upstreamURL, _ := url.Parse("http://upstream.invalid/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Upstreams = pool
+
+	if rr := sendPooled(proxyHandler); rr.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 with no replica reachable, got %d", rr.Code)
+	}
+}
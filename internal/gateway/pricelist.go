@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PricingHandler serves GET /v1/pricing, the per-model rates a caller is billed
+// at, so clients can compute costs and choose models on their side. Callers who
+// send an API key get its marked-up rates; anonymous callers get the base rates.
+type PricingHandler struct {
+	Pricing     PricingTable
+	Multipliers *CostMultipliers
+}
+
+// NewPricingHandler initializes a pricing handler with the given rates and markups.
+func NewPricingHandler(pricing PricingTable, multipliers *CostMultipliers) *PricingHandler {
+	return &PricingHandler{
+		Pricing:     pricing,
+		Multipliers: multipliers,
+	}
+}
+
+// PricingResponse is the JSON body returned by the pricing endpoint. Models
+// not listed are billed at FallbackMicroDollarsPerToken.
+type PricingResponse struct {
+	CostMultiplier               float64               `json:"cost_multiplier"`
+	FallbackMicroDollarsPerToken int64                 `json:"fallback_micro_dollars_per_token"`
+	Models                       map[string]ModelPrice `json:"models"`
+}
+
+func (h *PricingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+
+	apiKey := ExtractAPIKey(r)
+	multiplier := 1.0
+	if apiKey != "" {
+		multiplier = h.Multipliers.For(apiKey)
+	}
+
+	resp := PricingResponse{
+		CostMultiplier:               multiplier,
+		FallbackMicroDollarsPerToken: markup(CostPerTokenMicroDollars, multiplier),
+		Models:                       make(map[string]ModelPrice, len(h.Pricing)),
+	}
+	for model, price := range h.Pricing {
+		resp.Models[model] = ModelPrice{
+			PromptMicroDollarsPer1K:          markup(price.PromptMicroDollarsPer1K, multiplier),
+			CompletionMicroDollarsPer1K:      markup(price.CompletionMicroDollarsPer1K, multiplier),
+			AudioPromptMicroDollarsPer1K:     markup(price.AudioPromptMicroDollarsPer1K, multiplier),
+			AudioCompletionMicroDollarsPer1K: markup(price.AudioCompletionMicroDollarsPer1K, multiplier),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,57 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestPricingHandler(t *testing.T) {
+	pricing := gateway.PricingTable{
+		"gpt-4o": {PromptMicroDollarsPer1K: 2500, CompletionMicroDollarsPer1K: 10000},
+	}
+	handler := gateway.NewPricingHandler(pricing, &gateway.CostMultipliers{Keys: map[string]float64{"reseller": 1.5}})
+
+	get := func(apiKey string) gateway.PricingResponse {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/v1/pricing", nil)
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+		var resp gateway.PricingResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	base := get("")
+	if base.CostMultiplier != 1 || base.Models["gpt-4o"].PromptMicroDollarsPer1K != 2500 {
+		t.Errorf("expected base rates for anonymous callers, got %+v", base)
+	}
+
+	marked := get("reseller")
+	if marked.CostMultiplier != 1.5 {
+		t.Errorf("expected the key's multiplier, got %v", marked.CostMultiplier)
+	}
+	if price := marked.Models["gpt-4o"]; price.PromptMicroDollarsPer1K != 3750 || price.CompletionMicroDollarsPer1K != 15000 {
+		t.Errorf("expected marked-up rates, got %+v", price)
+	}
+	if marked.FallbackMicroDollarsPerToken != 3 {
+		t.Errorf("expected the marked-up fallback rate, got %d", marked.FallbackMicroDollarsPerToken)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/pricing", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rr.Code)
+	}
+}
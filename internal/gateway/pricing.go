@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// ModelPrice holds the input and output rates for a model in micro-dollars per 1K tokens.
+// Audio tokens are billed at the audio rates when set, and at the text rates otherwise.
+type ModelPrice struct {
+	PromptMicroDollarsPer1K          int64 `json:"prompt_micro_dollars_per_1k"`
+	CompletionMicroDollarsPer1K      int64 `json:"completion_micro_dollars_per_1k"`
+	AudioPromptMicroDollarsPer1K     int64 `json:"audio_prompt_micro_dollars_per_1k,omitempty"`
+	AudioCompletionMicroDollarsPer1K int64 `json:"audio_completion_micro_dollars_per_1k,omitempty"`
+}
+
+// CostCalculator prices usage in micro-dollars before any per-key markup. It is
+// the single source of pricing: stores only ever add the costs it computes.
+// It takes the whole record rather than the prompt and completion counts, so
+// audio tokens can be billed at their own rates.
+type CostCalculator interface {
+	Cost(record UsageRecord) int64
+}
+
+// CostFunc adapts a function to a CostCalculator.
+type CostFunc func(record UsageRecord) int64
+
+// Cost implements CostCalculator.
+func (f CostFunc) Cost(record UsageRecord) int64 {
+	return f(record)
+}
+
+// PricingTable maps model names to their prices. Lookups match the exact model
+// name first and then the longest entry the name extends at a "-", so dated
+// snapshots such as "gpt-4o-2024-08-06" resolve to the "gpt-4o" entry while a
+// different model such as "gpt-4o1" doesn't.
+type PricingTable map[string]ModelPrice
+
+// DefaultPricing reflects OpenAI's list prices for common chat models.
+var DefaultPricing = PricingTable{
+	"gpt-3.5-turbo": {PromptMicroDollarsPer1K: 500, CompletionMicroDollarsPer1K: 1500},
+	"gpt-4":         {PromptMicroDollarsPer1K: 30000, CompletionMicroDollarsPer1K: 60000},
+	"gpt-4-turbo":   {PromptMicroDollarsPer1K: 10000, CompletionMicroDollarsPer1K: 30000},
+	"gpt-4o":        {PromptMicroDollarsPer1K: 2500, CompletionMicroDollarsPer1K: 10000},
+	"gpt-4o-mini":   {PromptMicroDollarsPer1K: 150, CompletionMicroDollarsPer1K: 600},
+	"gpt-4o-audio-preview": {
+		PromptMicroDollarsPer1K: 2500, CompletionMicroDollarsPer1K: 10000,
+		AudioPromptMicroDollarsPer1K: 40000, AudioCompletionMicroDollarsPer1K: 80000,
+	},
+	// Embeddings only consume prompt tokens
+	"text-embedding-3-small": {PromptMicroDollarsPer1K: 20},
+	"text-embedding-3-large": {PromptMicroDollarsPer1K: 130},
+	"text-embedding-ada-002": {PromptMicroDollarsPer1K: 100},
+}
+
+// LoadPricingTable reads a JSON object of model names to prices and layers it
+// over DefaultPricing, so a file only needs the models it adds or changes.
+func LoadPricingTable(r io.Reader) (PricingTable, error) {
+	var overrides PricingTable
+	if err := json.NewDecoder(r).Decode(&overrides); err != nil {
+		return nil, fmt.Errorf("invalid pricing table: %w", err)
+	}
+	table := make(PricingTable, len(DefaultPricing)+len(overrides))
+	for model, price := range DefaultPricing {
+		table[model] = price
+	}
+	for model, price := range overrides {
+		table[model] = price
+	}
+	return table, nil
+}
+
+// Lookup finds the price for a model by exact name or longest "-" delimited prefix.
+func (p PricingTable) Lookup(model string) (ModelPrice, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	var best string
+	for name := range p {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return p[best], true
+}
+
+// Cost implements CostCalculator, computing the micro-dollar cost of a usage record. Known models are billed
+// separately for prompt, completion and audio tokens (rounded up to the next micro-dollar);
+// unknown models, or records without the split, fall back to the flat
+// CostPerTokenMicroDollars rate.
+func (p PricingTable) Cost(record UsageRecord) int64 {
+	if record.PromptTokens+record.CompletionTokens > 0 {
+		if price, ok := p.Lookup(record.Model); ok {
+			textPrompt := record.PromptTokens - record.AudioPromptTokens
+			textCompletion := record.CompletionTokens - record.AudioCompletionTokens
+			total := int64(textPrompt)*price.PromptMicroDollarsPer1K +
+				int64(textCompletion)*price.CompletionMicroDollarsPer1K +
+				int64(record.AudioPromptTokens)*orRate(price.AudioPromptMicroDollarsPer1K, price.PromptMicroDollarsPer1K) +
+				int64(record.AudioCompletionTokens)*orRate(price.AudioCompletionMicroDollarsPer1K, price.CompletionMicroDollarsPer1K)
+			return (total + 999) / 1000
+		}
+	}
+	return int64(record.TokenCount) * CostPerTokenMicroDollars
+}
+
+// isUnpriced reports whether pricing bills the record at the flat fallback
+// rate because its model has no price in the table.
+func isUnpriced(pricing CostCalculator, record UsageRecord) bool {
+	table, ok := pricing.(PricingTable)
+	if !ok || record.PromptTokens+record.CompletionTokens == 0 {
+		return false
+	}
+	_, found := table.Lookup(record.Model)
+	return !found
+}
+
+// MaxUnpricedModels bounds the unpriced models tracked by name. Model names come
+// from clients, so beyond it they are counted under the "other" label instead
+// of growing the metric and the warned set without limit.
+const MaxUnpricedModels = 100
+
+// unpricedModels remembers the models already warned about, so a busy unknown
+// model logs once rather than on every request.
+var unpricedModels = struct {
+	sync.Mutex
+	seen     map[string]bool
+	overflow bool
+}{seen: make(map[string]bool)}
+
+// warnUnpriced reports a model billed at the flat fallback rate. It is called
+// once per billed record, as the record is dispatched, rather than each time
+// a cost is estimated.
+func warnUnpriced(model string) {
+	label := model
+	unpricedModels.Lock()
+	if !unpricedModels.seen[model] {
+		if len(unpricedModels.seen) < MaxUnpricedModels {
+			unpricedModels.seen[model] = true
+			slog.Warn("No price configured for model, billing at the flat fallback rate",
+				"model", model, "micro_dollars_per_token", CostPerTokenMicroDollars)
+		} else {
+			label = "other"
+			if !unpricedModels.overflow {
+				unpricedModels.overflow = true
+				slog.Warn("Too many unpriced models, counting further ones as other",
+					"model", model, "max_models", MaxUnpricedModels)
+			}
+		}
+	}
+	unpricedModels.Unlock()
+	metrics.UnpricedUsage.WithLabelValues(label).Inc()
+}
+
+// orRate returns rate, or fallback when rate is unset.
+func orRate(rate, fallback int64) int64 {
+	if rate == 0 {
+		return fallback
+	}
+	return rate
+}
+
+// CostMultipliers marks up the provider cost per key, for resellers billing
+// customers above the raw price. Unset or non-positive multipliers mean 1.0.
+type CostMultipliers struct {
+	Default float64
+	Keys    map[string]float64
+	// Registry optionally supplies the multiplier of each key's tier, which
+	// takes precedence over Keys and Default when the tier sets one.
+	Registry APIKeyRegistry
+}
+
+// For returns the key's multiplier.
+func (m *CostMultipliers) For(apiKey string) float64 {
+	if m == nil {
+		return 1
+	}
+	if m.Registry != nil {
+		if info, err := m.Registry.Lookup(apiKey); err == nil && info.CostMultiplier > 0 {
+			return info.CostMultiplier
+		}
+	}
+	if multiplier, ok := m.Keys[apiKey]; ok && multiplier > 0 {
+		return multiplier
+	}
+	if m.Default > 0 {
+		return m.Default
+	}
+	return 1
+}
+
+// Apply returns the marked-up cost for the key, rounded up to the next micro-dollar.
+func (m *CostMultipliers) Apply(apiKey string, cost int64) int64 {
+	return markup(cost, m.For(apiKey))
+}
+
+// markup scales a micro-dollar cost, rounding up to the next micro-dollar. The
+// multiplier is applied to four decimal places so the result is exact in integers.
+func markup(cost int64, multiplier float64) int64 {
+	if multiplier == 1 {
+		return cost
+	}
+	scaled := int64(math.Round(multiplier * 10000))
+	return (cost*scaled + 9999) / 10000
+}
@@ -0,0 +1,252 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+	"aura-ai-gateway/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPricingTable_Cost(t *testing.T) {
+	pricing := gateway.PricingTable{
+		"gpt-4o":      {PromptMicroDollarsPer1K: 2500, CompletionMicroDollarsPer1K: 10000},
+		"gpt-4o-mini": {PromptMicroDollarsPer1K: 150, CompletionMicroDollarsPer1K: 600},
+		"gpt-4o-audio-preview": {
+			PromptMicroDollarsPer1K: 2500, CompletionMicroDollarsPer1K: 10000,
+			AudioPromptMicroDollarsPer1K: 40000, AudioCompletionMicroDollarsPer1K: 80000,
+		},
+	}
+
+	tests := []struct {
+		name   string
+		record gateway.UsageRecord
+		want   int64
+	}{
+		{
+			name:   "split rates for known model",
+			record: gateway.UsageRecord{Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 1000, TokenCount: 2000},
+			want:   12500,
+		},
+		{
+			name:   "dated snapshot resolves to longest prefix",
+			record: gateway.UsageRecord{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1000, CompletionTokens: 1000, TokenCount: 2000},
+			want:   750,
+		},
+		{
+			name:   "prefix of another model name doesn't match",
+			record: gateway.UsageRecord{Model: "gpt-4o1-preview", PromptTokens: 10, CompletionTokens: 8, TokenCount: 18},
+			want:   18 * gateway.CostPerTokenMicroDollars,
+		},
+		{
+			name:   "fractional cost rounds up",
+			record: gateway.UsageRecord{Model: "gpt-4o-mini", PromptTokens: 1, TokenCount: 1},
+			want:   1,
+		},
+		{
+			name: "audio tokens billed at audio rates",
+			record: gateway.UsageRecord{Model: "gpt-4o-audio-preview", PromptTokens: 1000, CompletionTokens: 1000, TokenCount: 2000,
+				AudioPromptTokens: 400, AudioCompletionTokens: 500},
+			// 600*2500 + 500*10000 + 400*40000 + 500*80000, per 1K
+			want: 62500,
+		},
+		{
+			name: "audio without audio rates uses text rates",
+			record: gateway.UsageRecord{Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 1000, TokenCount: 2000,
+				AudioPromptTokens: 400},
+			want: 12500,
+		},
+		{
+			name:   "unknown model falls back to flat rate",
+			record: gateway.UsageRecord{Model: "llama-3.1-8b", PromptTokens: 10, CompletionTokens: 8, TokenCount: 18},
+			want:   18 * gateway.CostPerTokenMicroDollars,
+		},
+		{
+			name:   "missing split falls back to flat rate",
+			record: gateway.UsageRecord{Model: "gpt-4o", TokenCount: 18},
+			want:   18 * gateway.CostPerTokenMicroDollars,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pricing.Cost(tt.record); got != tt.want {
+				t.Errorf("expected cost %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// unpricedCount reads the fallback-priced records counted for model, including
+// those counted as other once the bound on tracked models is reached.
+func unpricedCount(model string) float64 {
+	return testutil.ToFloat64(metrics.UnpricedUsage.WithLabelValues(model)) +
+		testutil.ToFloat64(metrics.UnpricedUsage.WithLabelValues("other"))
+}
+
+func TestPricingTable_UnpricedModelsBounded(t *testing.T) {
+	usageChan := make(chan gateway.UsageRecord, 1)
+	for i := 0; i < 2*gateway.MaxUnpricedModels; i++ {
+		gateway.StreamResponse(httptest.NewRecorder(), newStreamResponse(usageStream), "test-key", usageChan, gateway.StreamOptions{
+			Model: fmt.Sprintf("unpriced-model-%d", i),
+		})
+		<-usageChan
+	}
+	if n := testutil.CollectAndCount(metrics.UnpricedUsage); n > gateway.MaxUnpricedModels+1 {
+		t.Errorf("expected at most %d model labels, got %d", gateway.MaxUnpricedModels+1, n)
+	}
+	if testutil.ToFloat64(metrics.UnpricedUsage.WithLabelValues("other")) == 0 {
+		t.Errorf("expected models beyond the bound to be counted as other")
+	}
+}
+
+func TestProxyHandler_UnpricedCountedOncePerRequest(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(usageStream))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	// The reservation estimate prices the request too, but only the billed record counts
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	const model = "unpriced-once-model"
+	before := unpricedCount(model)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+model+`", "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	<-usageChan
+
+	if got := unpricedCount(model) - before; got != 1 {
+		t.Errorf("expected one unpriced record counted for the request, got %v", got)
+	}
+
+	// Estimates are never billed, so they aren't counted
+	estimate := gateway.NewEstimateHandler(gateway.DefaultTokenizers, gateway.DefaultPricing)
+	req = httptest.NewRequest("POST", "/v1/estimate", strings.NewReader(`{"model": "`+model+`", "messages": [{"role": "user", "content": "Hi"}]}`))
+	estimate.ServeHTTP(httptest.NewRecorder(), req)
+	if got := unpricedCount(model) - before; got != 1 {
+		t.Errorf("expected an estimate not to be counted, got %v", got)
+	}
+}
+
+func TestStreamResponse_PricedAtZero(t *testing.T) {
+	usageChan := make(chan gateway.UsageRecord, 1)
+	gateway.StreamResponse(httptest.NewRecorder(), newStreamResponse(usageStream), "test-key", usageChan, gateway.StreamOptions{
+		Model:   "free-model",
+		Pricing: gateway.PricingTable{"free-model": {}},
+	})
+
+	// A free model is priced, not missing a price, so the processor must keep its zero
+	if record := <-usageChan; !record.Priced || record.CostMicroDollars != 0 {
+		t.Errorf("expected a record priced at zero, got %+v", record)
+	}
+}
+
+func TestCostMultipliers(t *testing.T) {
+	multipliers := &gateway.CostMultipliers{Default: 1, Keys: map[string]float64{"reseller": 1.3, "bad": -2}}
+
+	if got := multipliers.Apply("reseller", 1000); got != 1300 {
+		t.Errorf("expected 1.3x markup to give 1300, got %d", got)
+	}
+	if got := multipliers.Apply("reseller", 1); got != 2 {
+		t.Errorf("expected a fractional markup to round up, got %d", got)
+	}
+	if got := multipliers.Apply("other", 1000); got != 1000 {
+		t.Errorf("expected the default multiplier for unknown keys, got %d", got)
+	}
+	if got := multipliers.For("bad"); got != 1 {
+		t.Errorf("expected a non-positive multiplier to be ignored, got %v", got)
+	}
+
+	var unset *gateway.CostMultipliers
+	if got := unset.Apply("reseller", 1000); got != 1000 {
+		t.Errorf("expected no markup without multipliers, got %d", got)
+	}
+}
+
+func TestLoadPricingTable(t *testing.T) {
+	file := `{
+		"text-embedding-3-small": {"prompt_micro_dollars_per_1k": 20, "completion_micro_dollars_per_1k": 0},
+		"gpt-4o": {"prompt_micro_dollars_per_1k": 2000, "completion_micro_dollars_per_1k": 8000}
+	}`
+	pricing, err := gateway.LoadPricingTable(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if price, _ := pricing.Lookup("text-embedding-3-small"); price.PromptMicroDollarsPer1K != 20 {
+		t.Errorf("expected the file's model to be added, got %+v", price)
+	}
+	if price, _ := pricing.Lookup("gpt-4o"); price.PromptMicroDollarsPer1K != 2000 || price.CompletionMicroDollarsPer1K != 8000 {
+		t.Errorf("expected the file to override the default price, got %+v", price)
+	}
+	if _, ok := pricing.Lookup("gpt-4o-mini"); !ok {
+		t.Error("expected defaults missing from the file to be kept")
+	}
+	if gateway.DefaultPricing["gpt-4o"].PromptMicroDollarsPer1K != 2500 {
+		t.Error("expected DefaultPricing to be left unchanged")
+	}
+
+	if _, err := gateway.LoadPricingTable(strings.NewReader(`{"gpt-4o": 5}`)); err == nil {
+		t.Error("expected an invalid file to be rejected")
+	}
+}
+
+func TestProxyHandler_CustomCostCalculator(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"model\":\"in-house-llm\",\"usage\":{\"prompt_tokens\":100,\"completion_tokens\":50,\"total_tokens\":150}}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	// A flat micro-dollar per prompt token and three per completion token
+	var priced []string
+	calculator := gateway.CostFunc(func(record gateway.UsageRecord) int64 {
+		priced = append(priced, record.Model)
+		return int64(record.PromptTokens) + 3*int64(record.CompletionTokens)
+	})
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.Pricing = calculator
+	proxyHandler.Multipliers = &gateway.CostMultipliers{Keys: map[string]float64{"test-key": 2}}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "in-house-llm", "stream": true}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case record := <-usageChan:
+		// 250 micro-dollars from the calculator, doubled by the key's multiplier
+		if record.CostMicroDollars != 500 {
+			t.Errorf("expected the calculator's marked-up cost of 500, got %d", record.CostMicroDollars)
+		}
+	default:
+		t.Fatal("expected a usage record")
+	}
+	if len(priced) == 0 || priced[len(priced)-1] != "in-house-llm" {
+		t.Errorf("expected the calculator to price the upstream's model, got %v", priced)
+	}
+
+	// The estimate endpoint prices through the same calculator
+	estimate := gateway.NewEstimateHandler(gateway.DefaultTokenizers, calculator)
+	rr := httptest.NewRecorder()
+	estimate.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/estimate", strings.NewReader(`{"model": "in-house-llm", "messages": [{"role": "user", "content": "hi"}]}`)))
+	var resp gateway.EstimateResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.EstimatedCostMicroDollars != int64(resp.EstimatedPromptTokens) {
+		t.Errorf("expected the estimate at a micro-dollar per prompt token, got %+v", resp)
+	}
+}
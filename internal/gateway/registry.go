@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyInfo is what the key registry knows about a key.
+type KeyInfo struct {
+	Tier string
+	// LimitMicroDollars is the key's usage limit. Zero means MaxUsageMicroDollars
+	// and a negative limit is unlimited.
+	LimitMicroDollars int64
+	// CostMultiplier marks up the key's base model cost. Zero means 1.0.
+	CostMultiplier float64
+}
+
+// APIKeyRegistry resolves each key's tier, with the limit and cost markup that
+// come with it, e.g. a reseller tier paying 1.5x. Keys the registry doesn't
+// know belong to its default tier.
+type APIKeyRegistry interface {
+	Lookup(apiKey string) (KeyInfo, error)
+}
+
+// TierInfo is the limit and cost markup shared by a tier's keys.
+type TierInfo struct {
+	LimitMicroDollars int64   `json:"limit_micro_dollars"`
+	CostMultiplier    float64 `json:"cost_multiplier"`
+}
+
+// StaticKeyRegistry is a fixed registry of tiers and the keys assigned to them.
+type StaticKeyRegistry struct {
+	// DefaultTier is the tier of unknown keys, DefaultTier when empty.
+	DefaultTier string              `json:"default_tier"`
+	Tiers       map[string]TierInfo `json:"tiers"`
+	// Keys maps each key to its tier.
+	Keys map[string]string `json:"keys"`
+}
+
+// LoadKeyRegistry reads a JSON registry, e.g.
+// {"tiers": {"reseller": {"limit_micro_dollars": 100000000, "cost_multiplier": 1.5}},
+// "keys": {"sk-abc": "reseller"}}. Every tier a key names must be defined.
+func LoadKeyRegistry(r io.Reader) (*StaticKeyRegistry, error) {
+	var registry StaticKeyRegistry
+	if err := json.NewDecoder(r).Decode(&registry); err != nil {
+		return nil, fmt.Errorf("invalid key registry: %w", err)
+	}
+	for key, tier := range registry.Keys {
+		if _, ok := registry.Tiers[tier]; !ok {
+			return nil, fmt.Errorf("unknown tier for key %s: %q", key, tier)
+		}
+	}
+	for name, tier := range registry.Tiers {
+		if tier.CostMultiplier < 0 {
+			return nil, fmt.Errorf("invalid cost multiplier for tier %q: %v", name, tier.CostMultiplier)
+		}
+	}
+	return &registry, nil
+}
+
+// Lookup implements APIKeyRegistry.
+func (s *StaticKeyRegistry) Lookup(apiKey string) (KeyInfo, error) {
+	tier, ok := s.Keys[apiKey]
+	if !ok {
+		tier = s.DefaultTier
+		if tier == "" {
+			tier = DefaultTier
+		}
+	}
+	info := s.Tiers[tier]
+	return KeyInfo{Tier: tier, LimitMicroDollars: info.LimitMicroDollars, CostMultiplier: info.CostMultiplier}, nil
+}
+
+// DefaultRegistryCacheTTL is how long RedisKeyRegistry reuses a lookup.
+const DefaultRegistryCacheTTL = 30 * time.Second
+
+// RedisKeyRegistry reads the registry from Redis hashes: `apikey:<key>:info`
+// names the key's tier in its `tier` field, and `tier:<name>` holds the tier's
+// `limit_micro_dollars` and `cost_multiplier`. Either may also be set on the
+// key's own hash to override its tier. Lookups are cached for CacheTTL, so
+// registry changes take that long to apply.
+type RedisKeyRegistry struct {
+	client *redis.Client
+	// DefaultTier is the tier of keys without an info hash, DefaultTier when empty.
+	DefaultTier string
+	CacheTTL    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedKeyInfo
+}
+
+type cachedKeyInfo struct {
+	info    KeyInfo
+	expires time.Time
+}
+
+func NewRedisKeyRegistry(client *redis.Client) *RedisKeyRegistry {
+	return &RedisKeyRegistry{
+		client:   client,
+		CacheTTL: DefaultRegistryCacheTTL,
+		cache:    make(map[string]cachedKeyInfo),
+	}
+}
+
+func (r *RedisKeyRegistry) getInfoKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:info", apiKey)
+}
+
+func (r *RedisKeyRegistry) getTierKey(tier string) string {
+	return fmt.Sprintf("tier:%s", tier)
+}
+
+// Lookup implements APIKeyRegistry.
+func (r *RedisKeyRegistry) Lookup(apiKey string) (KeyInfo, error) {
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[apiKey]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.info, nil
+	}
+
+	ctx := context.Background()
+	keyFields, err := r.client.HGetAll(ctx, r.getInfoKey(apiKey)).Result()
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("redis key registry error: %w", err)
+	}
+	tier := keyFields["tier"]
+	if tier == "" {
+		tier = r.DefaultTier
+		if tier == "" {
+			tier = DefaultTier
+		}
+	}
+	tierFields, err := r.client.HGetAll(ctx, r.getTierKey(tier)).Result()
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("redis key registry error: %w", err)
+	}
+
+	info := KeyInfo{Tier: tier}
+	for _, fields := range []map[string]string{tierFields, keyFields} {
+		if v, ok := fields["limit_micro_dollars"]; ok {
+			if info.LimitMicroDollars, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return KeyInfo{}, fmt.Errorf("invalid limit in key registry: %w", err)
+			}
+		}
+		if v, ok := fields["cost_multiplier"]; ok {
+			if info.CostMultiplier, err = strconv.ParseFloat(v, 64); err != nil {
+				return KeyInfo{}, fmt.Errorf("invalid cost multiplier in key registry: %w", err)
+			}
+		}
+	}
+
+	if r.CacheTTL > 0 {
+		r.mu.Lock()
+		r.cache[apiKey] = cachedKeyInfo{info: info, expires: now.Add(r.CacheTTL)}
+		r.mu.Unlock()
+	}
+	return info, nil
+}
+
+// RegistryLimits implements LimitProvider with the limits of each key's tier.
+type RegistryLimits struct {
+	Registry APIKeyRegistry
+}
+
+// GetLimit implements LimitProvider.
+func (l RegistryLimits) GetLimit(apiKey string) (int64, error) {
+	info, err := l.Registry.Lookup(apiKey)
+	if err != nil {
+		return 0, err
+	}
+	if info.LimitMicroDollars == 0 {
+		return MaxUsageMicroDollars, nil
+	}
+	return info.LimitMicroDollars, nil
+}
+
+// RegistryTier returns the key's tier for admission, DefaultTier if it can't be read.
+func RegistryTier(registry APIKeyRegistry, apiKey string) string {
+	info, err := registry.Lookup(apiKey)
+	if err != nil || info.Tier == "" {
+		return DefaultTier
+	}
+	return info.Tier
+}
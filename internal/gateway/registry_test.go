@@ -0,0 +1,133 @@
+package gateway_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+const registryJSON = `{
+	"default_tier": "standard",
+	"tiers": {
+		"standard": {"limit_micro_dollars": 10000000, "cost_multiplier": 1.0},
+		"reseller": {"limit_micro_dollars": 100, "cost_multiplier": 1.5}
+	},
+	"keys": {"reseller-key": "reseller"}
+}`
+
+func TestLoadKeyRegistry(t *testing.T) {
+	registry, err := gateway.LoadKeyRegistry(strings.NewReader(registryJSON))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, _ := registry.Lookup("reseller-key")
+	if info.Tier != "reseller" || info.CostMultiplier != 1.5 || info.LimitMicroDollars != 100 {
+		t.Errorf("expected the reseller tier, got %+v", info)
+	}
+	info, _ = registry.Lookup("unknown-key")
+	if info.Tier != "standard" || info.CostMultiplier != 1.0 {
+		t.Errorf("expected unknown keys to fall back to the default tier, got %+v", info)
+	}
+
+	if _, err := gateway.LoadKeyRegistry(strings.NewReader(`{"tiers": {}, "keys": {"k": "gold"}}`)); err == nil {
+		t.Error("expected a key naming an undefined tier to be rejected")
+	}
+}
+
+func TestProxyHandler_TierCostMultiplier(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"model\":\"gpt-4o\",\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":1000,\"total_tokens\":2000}}\n\ndata: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	registry, _ := gateway.LoadKeyRegistry(strings.NewReader(registryJSON))
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 2)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.Multipliers = &gateway.CostMultipliers{Registry: registry}
+
+	cost := func(apiKey string) int64 {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+		return (<-usageChan).CostMicroDollars
+	}
+
+	standard, reseller := cost("standard-key"), cost("reseller-key")
+	// 1K prompt and 1K completion tokens of gpt-4o
+	if standard != 12500 {
+		t.Errorf("expected the standard tier to pay the base cost of 12500, got %d", standard)
+	}
+	if reseller != standard*3/2 {
+		t.Errorf("expected the 1.5x tier to pay 50%% more than %d, got %d", standard, reseller)
+	}
+}
+
+func TestRegistryLimits(t *testing.T) {
+	registry, _ := gateway.LoadKeyRegistry(strings.NewReader(registryJSON))
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.Limits = gateway.RegistryLimits{Registry: registry}
+
+	cb.AddUsage("reseller-key", 100)
+	cb.AddUsage("standard-key", 100)
+	if allowed, _ := cb.CheckLimit("reseller-key"); allowed {
+		t.Error("expected the reseller tier's limit of 100 to be enforced")
+	}
+	if allowed, _ := cb.CheckLimit("standard-key"); !allowed {
+		t.Error("expected the default tier's limit to leave room")
+	}
+}
+
+// TestRedisKeyRegistry requires a running Redis/Valkey instance on localhost:6379 to pass.
+func TestRedisKeyRegistry(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	keys := []string{"apikey:test-registry-key:info", "tier:test-reseller", "tier:test-standard"}
+	client.Del(ctx, keys...)
+	defer client.Del(ctx, keys...)
+	client.HSet(ctx, "tier:test-standard", "cost_multiplier", "1")
+	client.HSet(ctx, "tier:test-reseller", "limit_micro_dollars", "5000000", "cost_multiplier", "1.5")
+	// The key overrides its tier's limit
+	client.HSet(ctx, "apikey:test-registry-key:info", "tier", "test-reseller", "limit_micro_dollars", "7000000")
+
+	registry := gateway.NewRedisKeyRegistry(client)
+	registry.DefaultTier = "test-standard"
+
+	info, err := registry.Lookup("test-registry-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Tier != "test-reseller" || info.CostMultiplier != 1.5 || info.LimitMicroDollars != 7000000 {
+		t.Errorf("expected the reseller tier with the key's own limit, got %+v", info)
+	}
+
+	info, _ = registry.Lookup("test-unregistered-key")
+	if info.Tier != "test-standard" || info.CostMultiplier != 1 {
+		t.Errorf("expected an unregistered key to get the default tier, got %+v", info)
+	}
+
+	// Lookups are served from the cache until it expires
+	client.HSet(ctx, "tier:test-reseller", "cost_multiplier", "2")
+	if info, _ := registry.Lookup("test-registry-key"); info.CostMultiplier != 1.5 {
+		t.Errorf("expected the cached multiplier, got %v", info.CostMultiplier)
+	}
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CostReserver is implemented by stores that can check a key's limit and
+// charge an estimated cost in one atomic step. Checking and charging
+// separately lets a burst of concurrent requests all pass the check before
+// any of their usage is recorded.
+type CostReserver interface {
+	CheckAndReserve(apiKey string, estimatedCost int64) (bool, error)
+}
+
+// checkAndReserve reserves the cost atomically when cb supports it, and
+// otherwise falls back to a separate check and charge.
+func checkAndReserve(cb CircuitBreaker, apiKey string, estimatedCost int64) (bool, error) {
+	if reserver, ok := cb.(CostReserver); ok {
+		return reserver.CheckAndReserve(apiKey, estimatedCost)
+	}
+	allowed, err := cb.CheckLimit(apiKey)
+	if err != nil || !allowed {
+		return allowed, err
+	}
+	return true, cb.AddUsage(apiKey, estimatedCost)
+}
+
+// reserveScript charges ARGV[1] to the usage key KEYS[1] unless it's already
+// at the limit. The limit is read from KEYS[2] when ARGV[3] is "1", falling
+// back to ARGV[2]; a negative limit is unlimited. A nonzero ARGV[4] is the
+// Unix time at which the usage key expires. The charge is also counted in
+// the day's key KEYS[3], kept for ARGV[5] seconds.
+var reserveScript = redis.NewScript(`
+local usage = tonumber(redis.call('GET', KEYS[1]) or '0')
+local limit = tonumber(ARGV[2])
+if ARGV[3] == '1' then
+	limit = tonumber(redis.call('GET', KEYS[2]) or ARGV[2])
+end
+if limit >= 0 and usage >= limit then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], ARGV[1])
+if ARGV[4] ~= '0' then
+	redis.call('EXPIREAT', KEYS[1], ARGV[4])
+end
+redis.call('INCRBY', KEYS[3], ARGV[1])
+redis.call('EXPIRE', KEYS[3], ARGV[5])
+return 1
+`)
+
+// CheckAndReserve implements CostReserver in a single round trip.
+func (r *RedisCircuitBreaker) CheckAndReserve(apiKey string, estimatedCost int64) (bool, error) {
+	ctx := context.Background()
+	limit := int64(MaxUsageMicroDollars)
+	stored := "1"
+	if r.Limits != nil {
+		var err error
+		if limit, err = r.Limits.GetLimit(apiKey); err != nil {
+			return false, err
+		}
+		stored = "0"
+	}
+
+	var expireAt int64
+	if resetsAt := r.ResetsAt(); !resetsAt.IsZero() {
+		expireAt = resetsAt.Unix()
+	}
+
+	keys := []string{r.getUsageKey(apiKey), r.getLimitKey(apiKey), r.getHistoryKey(apiKey, dayOf(r.now()))}
+	reserved, err := reserveScript.Run(ctx, r.client, keys, estimatedCost, strconv.FormatInt(limit, 10), stored, expireAt,
+		int64(historyTTL.Seconds())).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis reserve error: %w", err)
+	}
+	return reserved == 1, nil
+}
+
+// CheckAndReserve implements CostReserver with a compare-and-swap loop.
+func (r *MemoryCircuitBreaker) CheckAndReserve(apiKey string, estimatedCost int64) (bool, error) {
+	limit, err := r.GetLimit(apiKey)
+	if err != nil {
+		return false, err
+	}
+	r.rollover()
+	valRef := r.usageMap.LoadOrStore(apiKey, 0)
+	for {
+		usage := atomic.LoadInt64(valRef)
+		if !withinLimit(usage, limit) {
+			return false, nil
+		}
+		if atomic.CompareAndSwapInt64(valRef, usage, usage+estimatedCost) {
+			r.recordHistory(apiKey, estimatedCost)
+			return true, nil
+		}
+	}
+}
+
+// CheckAndReserve reserves through the wrapped store, buffering the charge and
+// allowing the request when the store can't be reached.
+func (g *GracefulCircuitBreaker) CheckAndReserve(apiKey string, estimatedCost int64) (bool, error) {
+	allowed, err := checkAndReserve(g.CircuitBreaker, apiKey, estimatedCost)
+	if err != nil {
+		g.enterDegraded(err)
+		return true, g.AddUsage(apiKey, estimatedCost)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,245 @@
+package gateway_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+// reserveConcurrently fires 100 concurrent reservations of cost and returns how many were allowed.
+func reserveConcurrently(t *testing.T, reserver gateway.CostReserver, apiKey string, cost int64) int {
+	t.Helper()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := reserver.CheckAndReserve(apiKey, cost)
+			if err != nil {
+				t.Errorf("unexpected error on CheckAndReserve: %v", err)
+			}
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return allowed
+}
+
+func TestMemoryCircuitBreaker_CheckAndReserve(t *testing.T) {
+	cb := gateway.NewMemoryCircuitBreaker()
+	const cost = 300000 // $0.30 a request, so the $10 limit admits 34
+
+	allowed := reserveConcurrently(t, cb, "burst-key", cost)
+	usage, _ := cb.GetUsage("burst-key")
+	if usage > gateway.MaxUsageMicroDollars+cost {
+		t.Errorf("expected usage within one request of the limit, got %d", usage)
+	}
+	if allowed != 34 || usage != int64(allowed)*cost {
+		t.Errorf("expected 34 requests reserved, got %d with usage %d", allowed, usage)
+	}
+}
+
+func TestRedisCircuitBreaker_CheckAndReserve(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	cb := gateway.NewRedisCircuitBreaker(client)
+	apiKey := "test-redis-reserve-key"
+	client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":limit")
+	defer client.Del(ctx, "apikey:"+apiKey+":usage", "apikey:"+apiKey+":limit")
+
+	// A $1 stored limit at $0.30 a request admits 4
+	cb.SetLimit(apiKey, 1000000)
+	const cost = 300000
+	allowed := reserveConcurrently(t, cb, apiKey, cost)
+	usage, _ := cb.GetUsage(apiKey)
+	if usage > 1000000+cost {
+		t.Errorf("expected usage within one request of the limit, got %d", usage)
+	}
+	if allowed != 4 || usage != int64(allowed)*cost {
+		t.Errorf("expected 4 requests reserved, got %d with usage %d", allowed, usage)
+	}
+}
+
+func TestProxyHandler_CostReservation(t *testing.T) {
+	failUpstream := false
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failUpstream {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":1000,\"total_tokens\":2000}}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	cb := gateway.NewMemoryCircuitBreaker()
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, cb, usageChan)
+
+	serve := func() {
+		body := `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "` + strings.Repeat("word ", 400) + `"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-key")
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve()
+	record := <-usageChan
+	usage, _ := cb.GetUsage("test-key")
+	if record.ReservedMicroDollars == 0 || usage != record.ReservedMicroDollars {
+		t.Fatalf("expected the estimate to be charged up front and carried on the record, got %d reserved and %d charged",
+			record.ReservedMicroDollars, usage)
+	}
+	if record.CostMicroDollars <= record.ReservedMicroDollars {
+		t.Errorf("expected the real cost %d to exceed the prompt estimate %d", record.CostMicroDollars, record.ReservedMicroDollars)
+	}
+
+	// A request that consumed nothing gives its reservation back
+	failUpstream = true
+	serve()
+	if after, _ := cb.GetUsage("test-key"); after != usage {
+		t.Errorf("expected a failed request's reservation to be released, usage went from %d to %d", usage, after)
+	}
+}
+
+func TestProxyHandler_RejectOverBudget(t *testing.T) {
+	contacted := 0
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contacted++
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"usage\":{\"prompt_tokens\":480,\"completion_tokens\":20,\"total_tokens\":500}}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	cb := gateway.NewMemoryCircuitBreaker()
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, cb, usageChan)
+	proxyHandler.RejectOverBudget = true
+
+	serve := func() int {
+		// About 500 prompt tokens, estimated at roughly $0.00125 for gpt-4o
+		body := `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "` + strings.Repeat("word ", 400) + `"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Plenty of budget: the estimate is reserved and reconciled to the real cost
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("expected a request within budget to pass, got %d", code)
+	}
+	record := <-usageChan
+	cb.AddUsage(record.APIKey, record.CostMicroDollars-record.ReservedMicroDollars)
+	if usage, _ := cb.GetUsage("test-key"); usage != record.CostMicroDollars {
+		t.Errorf("expected usage reconciled to the real cost %d, got %d (estimated %d)",
+			record.CostMicroDollars, usage, record.ReservedMicroDollars)
+	}
+
+	// $0.001 left is less than the prompt estimate
+	cb.SetUsage("test-key", gateway.MaxUsageMicroDollars-1000)
+	if code := serve(); code != http.StatusPaymentRequired {
+		t.Fatalf("expected 402 when the estimate exceeds the remaining budget, got %d", code)
+	}
+	if contacted != 1 {
+		t.Errorf("expected the upstream not to be contacted for the rejected request, got %d calls", contacted)
+	}
+	if usage, _ := cb.GetUsage("test-key"); usage != gateway.MaxUsageMicroDollars-1000 {
+		t.Errorf("expected nothing reserved for the rejected request, got usage %d", usage)
+	}
+
+	// Without the option the same request is admitted while the key is under its limit
+	proxyHandler.RejectOverBudget = false
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("expected the request to be admitted by default, got %d", code)
+	}
+}
+
+func TestProxyHandler_ReservationAcrossWindowReset(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2026, 10, 17, 23, 59, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	failUpstream := false
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Midnight passes while the request is upstream
+		mu.Lock()
+		now = now.Add(2 * time.Minute)
+		mu.Unlock()
+		if failUpstream {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":1000,\"total_tokens\":2000}}\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.Window = gateway.WindowDaily
+	cb.Now = clock
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, cb, usageChan)
+
+	serve := func() {
+		body := `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "` + strings.Repeat("word ", 400) + `"}]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-key")
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The reservation went with yesterday's usage, so today is billed the whole cost
+	serve()
+	record := <-usageChan
+	if record.ReservedMicroDollars == 0 {
+		t.Fatal("expected a reservation to be charged")
+	}
+	cb.AddUsage(record.APIKey, record.Charge(cb))
+	if usage, _ := cb.GetUsage("test-key"); usage != record.CostMicroDollars {
+		t.Errorf("expected the full cost %d in the new window, got %d", record.CostMicroDollars, usage)
+	}
+
+	// A failed request's refund isn't taken from the next day's usage
+	failUpstream = true
+	mu.Lock()
+	now = time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC)
+	mu.Unlock()
+	serve()
+	if usage, _ := cb.GetUsage("test-key"); usage != 0 {
+		t.Errorf("expected the stale reservation's refund to be dropped, got usage %d", usage)
+	}
+}
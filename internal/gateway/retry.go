@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// RetryPolicy retries upstream requests that fail with a connection error or
+// a 5xx. Retries only happen before the response is relayed, so nothing has
+// reached the client yet; once streaming starts, failures end the stream.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling for each one after.
+	Backoff time.Duration
+	// Budget optionally caps retries to a fraction of requests.
+	Budget *RetryBudget
+}
+
+// do sends req, replaying its body from GetBody for each retry. Retries wait
+// their turn with egress like any other upstream request. The last response
+// or error is returned when every attempt fails.
+func (p *RetryPolicy) do(client *http.Client, req *http.Request, egress *EgressLimiter) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if p == nil {
+		return resp, err
+	}
+	p.Budget.Deposit()
+
+	for attempt := 1; attempt < p.MaxAttempts && retryable(req.Context(), resp, err); attempt++ {
+		if !p.Budget.Withdraw() || !p.wait(req.Context(), attempt) || !egress.Wait(req.Context()) {
+			break
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			break
+		}
+		retry := req.Clone(req.Context())
+		retry.Body = body
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		resp, err = client.Do(retry)
+		if retryable(req.Context(), resp, err) {
+			metrics.UpstreamRetries.WithLabelValues("failure").Inc()
+		} else {
+			metrics.UpstreamRetries.WithLabelValues("success").Inc()
+		}
+		slog.Debug("Retried upstream request", "attempt", attempt+1, "error", err, "status", statusOf(resp))
+	}
+	return resp, err
+}
+
+// wait sleeps for the backoff before the given retry, reporting false if ctx
+// ends first.
+func (p *RetryPolicy) wait(ctx context.Context, retry int) bool {
+	timer := time.NewTimer(p.Backoff << (retry - 1))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryable reports whether an attempt failed transiently: a connection error
+// other than the request's own deadline or cancellation, or a 5xx.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	return resp.StatusCode >= 500
+}
+
+// statusOf returns the response's status code, or 0 without a response.
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
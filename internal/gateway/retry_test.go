@@ -0,0 +1,89 @@
+package gateway_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestProxyHandler_RetriesTransientFailures(t *testing.T) {
+	var attempts atomic.Int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"gpt-4o"`) {
+			t.Errorf("expected the request body to be replayed, got %q", body)
+		}
+		switch attempts.Add(1) {
+		case 1:
+			// Drop the connection without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"choices\":[]}\n\ndata: [DONE]\n\n")
+		}
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Retry = &gateway.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the third attempt's 200, got %d", rr.Code)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts.Load())
+	}
+	if !strings.Contains(rr.Body.String(), "[DONE]") {
+		t.Errorf("expected the successful stream to be relayed, got %q", rr.Body.String())
+	}
+}
+
+func TestProxyHandler_RetriesGiveUp(t *testing.T) {
+	var attempts atomic.Int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, "upstream down")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Retry = &gateway.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o"}`))
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if attempts.Load() != 2 {
+		t.Errorf("expected MaxAttempts to bound the attempts, got %d", attempts.Load())
+	}
+	if rr.Code != http.StatusBadGateway || strings.TrimSpace(rr.Body.String()) != "upstream down" {
+		t.Errorf("expected the last failure to be relayed, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// A spent retry budget stops retries
+	attempts.Store(0)
+	proxyHandler.Retry.Budget = gateway.NewRetryBudget(0, 1)
+	proxyHandler.Retry.Budget.Withdraw()
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o"}`)))
+	if attempts.Load() != 1 {
+		t.Errorf("expected no retry with the budget spent, got %d attempts", attempts.Load())
+	}
+}
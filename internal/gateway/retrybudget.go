@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"sync"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// RetryBudget caps upstream retries to a fraction of requests, so a broad
+// outage doesn't turn every failure into several more requests. Each request
+// deposits ratio tokens, up to maxTokens, and each retry spends a whole one:
+// with ratio 0.1, at most one request in ten is retried once the burst
+// allowance is spent. A nil budget allows every retry.
+type RetryBudget struct {
+	mu        sync.Mutex
+	ratio     float64
+	maxTokens float64
+	tokens    float64
+}
+
+// NewRetryBudget creates a budget allowing retries for ratio of requests, with
+// an initial allowance of burst retries for a quiet gateway.
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	if burst < 1 {
+		burst = 1
+	}
+	b := &RetryBudget{ratio: ratio, maxTokens: float64(burst), tokens: float64(burst)}
+	b.report()
+	return b
+}
+
+// Deposit credits the budget for a request sent upstream.
+func (b *RetryBudget) Deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+	b.report()
+}
+
+// Withdraw spends a token for a retry, reporting false if the budget is exhausted.
+func (b *RetryBudget) Withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		metrics.RetryBudgetExhausted.Inc()
+		return false
+	}
+	b.tokens--
+	b.report()
+	return true
+}
+
+// report publishes how much of the budget is spent. Callers must hold b.mu.
+func (b *RetryBudget) report() {
+	metrics.RetryBudgetUtilization.Set(1 - b.tokens/b.maxTokens)
+}
@@ -0,0 +1,49 @@
+package gateway_test
+
+import (
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestRetryBudget(t *testing.T) {
+	budget := gateway.NewRetryBudget(0.25, 2)
+
+	// The burst allowance covers the first retries
+	for i := 0; i < 2; i++ {
+		if !budget.Withdraw() {
+			t.Fatalf("expected retry %d to fit the burst allowance", i)
+		}
+	}
+	if budget.Withdraw() {
+		t.Fatal("expected retries to be suppressed once the budget is spent")
+	}
+
+	// One retry is earned per four requests
+	for i := 0; i < 3; i++ {
+		budget.Deposit()
+	}
+	if budget.Withdraw() {
+		t.Error("expected three requests not to earn a retry at ratio 0.25")
+	}
+	budget.Deposit()
+	if !budget.Withdraw() {
+		t.Error("expected the fourth request to earn a retry")
+	}
+
+	// Deposits never exceed the burst allowance
+	for i := 0; i < 100; i++ {
+		budget.Deposit()
+	}
+	for i := 0; i < 2; i++ {
+		budget.Withdraw()
+	}
+	if budget.Withdraw() {
+		t.Error("expected the budget to be capped at its burst allowance")
+	}
+
+	var unlimited *gateway.RetryBudget
+	if !unlimited.Withdraw() {
+		t.Error("expected a nil budget to allow retries")
+	}
+}
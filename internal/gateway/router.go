@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Route is one upstream provider's chat completions endpoint.
+type Route struct {
+	// URL is the full completions endpoint. Placeholders are filled in per
+	// request, for providers like Azure OpenAI that put the deployment in the
+	// path: "{model}" is the request's model, "{deployment}" its deployment,
+	// "{api_version}" APIVersion, and "{path}" the request path below /v1/,
+	// e.g. "chat/completions", so one route can serve several endpoints.
+	URL string `json:"url"`
+	// Deployments maps models to the deployment serving them. Models not
+	// listed are their own deployment.
+	Deployments map[string]string `json:"deployments,omitempty"`
+	APIVersion  string            `json:"api_version,omitempty"`
+	// AuthHeader moves the client's bearer token into this header, e.g.
+	// Azure's "api-key", instead of sending it as Authorization.
+	AuthHeader string `json:"auth_header,omitempty"`
+	// Headers are set on every upstream request, replacing client values.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Adapter names the provider format to translate requests and responses
+	// to, "anthropic" or "gemini". Empty means the provider speaks OpenAI's format.
+	Adapter string `json:"adapter,omitempty"`
+	// NoStreamOptions stops stream_options being injected, for upstreams that
+	// reject it with a 400. Their streams report no usage, so it is estimated.
+	NoStreamOptions bool `json:"no_stream_options,omitempty"`
+}
+
+// Router maps model name prefixes to upstream providers, so one gateway can
+// front several of them. Lookups use the longest matching prefix; models
+// matching no route go to the handler's default upstream.
+type Router map[string]Route
+
+// LoadRouter reads a JSON object of model prefixes to routes, e.g.
+// {"gpt-": {"url": "https://api.openai.com/v1/chat/completions"}}.
+func LoadRouter(r io.Reader) (Router, error) {
+	var router Router
+	if err := json.NewDecoder(r).Decode(&router); err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+	for prefix, route := range router {
+		u, err := url.Parse(route.expand("model", "chat/completions"))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid url for route %q: %q", prefix, route.URL)
+		}
+		if _, ok := adapters[route.Adapter]; route.Adapter != "" && !ok {
+			return nil, fmt.Errorf("unknown adapter for route %q: %q", prefix, route.Adapter)
+		}
+	}
+	return router, nil
+}
+
+// Lookup finds the route for a model by longest prefix. An empty prefix
+// catches every model.
+func (rt Router) Lookup(model string) (Route, bool) {
+	route, ok := rt[longestPrefix(rt, model)]
+	return route, ok
+}
+
+// adapter returns the route's Adapter, or nil for OpenAI-compatible providers.
+func (r Route) adapter() Adapter {
+	return adapters[r.Adapter]
+}
+
+// templated reports whether the route's URL has placeholders to fill in.
+func (r Route) templated() bool {
+	return strings.Contains(r.URL, "{")
+}
+
+// expand fills in the URL's placeholders for the model and request path.
+func (r Route) expand(model, path string) string {
+	deployment, ok := r.Deployments[model]
+	if !ok {
+		deployment = model
+	}
+	return strings.NewReplacer(
+		"{model}", url.PathEscape(model),
+		"{deployment}", url.PathEscape(deployment),
+		"{api_version}", url.QueryEscape(r.APIVersion),
+		"{path}", path,
+	).Replace(r.URL)
+}
+
+// endpoint returns the route's URL for the model and the path requested
+// below /v1/, letting the adapter pick the operation for streamed or single
+// responses.
+func (r Route) endpoint(model, path string, stream bool) string {
+	endpoint := r.expand(model, path)
+	if adapter, ok := r.adapter().(endpointAdapter); ok {
+		return adapter.Endpoint(endpoint, stream)
+	}
+	return endpoint
+}
+
+// relativePath returns the request path below /v1/, e.g. "chat/completions".
+func relativePath(requestPath string) string {
+	path, _ := strings.CutPrefix(requestPath, "/v1/")
+	return strings.TrimPrefix(path, "/")
+}
+
+// rewriteHeaders applies the route's header rewrites to an upstream request.
+func (r Route) rewriteHeaders(h http.Header) {
+	if r.AuthHeader != "" {
+		if token, ok := bearerToken(h.Get("Authorization")); ok {
+			h.Del("Authorization")
+			h.Set(r.AuthHeader, token)
+		}
+	}
+	for k, v := range r.Headers {
+		h.Set(k, v)
+	}
+}
@@ -0,0 +1,218 @@
+package gateway_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestProxyHandler_RoutesModelsToProviders(t *testing.T) {
+	var openAIPath, azurePath, azureKey, azureAuth string
+	openAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openAIPath = r.URL.Path
+		io.WriteString(w, `{"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	}))
+	defer openAI.Close()
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		azurePath = r.URL.Path + "?" + r.URL.RawQuery
+		azureKey = r.Header.Get("api-key")
+		azureAuth = r.Header.Get("Authorization")
+		io.WriteString(w, `{"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	}))
+	defer azure.Close()
+
+	router, err := gateway.LoadRouter(strings.NewReader(`{
+		"gpt-": {"url": "` + openAI.URL + `/v1/chat/completions"},
+		"azure-": {"url": "` + azure.URL + `/openai/deployments/{model}/chat/completions?api-version=2024-06-01", "auth_header": "api-key"}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error loading routes: %v", err)
+	}
+
+	// The default upstream must not be reached for routed models
+	defaultURL, _ := url.Parse("http://127.0.0.1:1/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(defaultURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Router = router
+
+	for _, model := range []string{"gpt-4o", "azure-gpt-4o"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "`+model+`"}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", model, rr.Code, rr.Body.String())
+		}
+	}
+
+	if openAIPath != "/v1/chat/completions" {
+		t.Errorf("expected gpt-4o to reach the OpenAI upstream, got path %q", openAIPath)
+	}
+	if azurePath != "/openai/deployments/azure-gpt-4o/chat/completions?api-version=2024-06-01" {
+		t.Errorf("expected the model in the Azure deployment path, got %q", azurePath)
+	}
+	if azureKey != "test-key" || azureAuth != "" {
+		t.Errorf("expected the key moved to api-key, got api-key=%q Authorization=%q", azureKey, azureAuth)
+	}
+}
+
+func TestRouter_Lookup(t *testing.T) {
+	router := gateway.Router{
+		"gpt-":   {URL: "https://a.example/v1/chat/completions"},
+		"gpt-4o": {URL: "https://b.example/v1/chat/completions"},
+	}
+	if route, ok := router.Lookup("gpt-4o-mini"); !ok || route.URL != "https://b.example/v1/chat/completions" {
+		t.Errorf("expected the longest prefix to win, got %+v", route)
+	}
+	if _, ok := router.Lookup("llama-3"); ok {
+		t.Error("expected no route for an unmatched model")
+	}
+
+	if _, err := gateway.LoadRouter(strings.NewReader(`{"gpt-": {"url": "not a url"}}`)); err == nil {
+		t.Error("expected a route without an absolute URL to be rejected")
+	}
+}
+
+func TestProxyHandler_RouteWithoutStreamOptions(t *testing.T) {
+	var payload map[string]interface{}
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload = decodePayload(t, r)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"model\":\"azure-gpt-4o\",\"choices\":[{\"delta\":{\"content\":\"Hello there, friend\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer azure.Close()
+
+	router, err := gateway.LoadRouter(strings.NewReader(`{
+		"azure-": {"url": "` + azure.URL + `/chat/completions", "no_stream_options": true}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error loading routes: %v", err)
+	}
+
+	defaultURL, _ := url.Parse("http://127.0.0.1:1/v1/chat/completions")
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(defaultURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.Router = router
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions",
+		strings.NewReader(`{"model": "azure-gpt-4o", "stream": true, "messages": [{"role": "user", "content": "Hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if _, ok := payload["stream_options"]; ok {
+		t.Errorf("expected no stream_options for a route that rejects it, got %v", payload["stream_options"])
+	}
+
+	select {
+	case record := <-usageChan:
+		// "Hello there, friend" is 19 characters, 5 tokens by the heuristic
+		if record.CompletionTokens != 5 || record.PromptTokens == 0 || record.Partial {
+			t.Errorf("expected usage estimated from the streamed content, got %+v", record)
+		}
+		if record.TokenCount != record.PromptTokens+record.CompletionTokens {
+			t.Errorf("expected the estimate to total prompt and completion, got %+v", record)
+		}
+	default:
+		t.Error("expected usage to be estimated for a stream that reported none")
+	}
+}
+
+func TestProxyHandler_TemplatedRoute(t *testing.T) {
+	var paths []string
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path+"?"+r.URL.RawQuery)
+		io.WriteString(w, `{"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	}))
+	defer azure.Close()
+
+	router, err := gateway.LoadRouter(strings.NewReader(`{
+		"azure-": {
+			"url": "` + azure.URL + `/openai/deployments/{deployment}/{path}?api-version={api_version}",
+			"deployments": {"azure-gpt-4o": "prod-gpt4o"},
+			"api_version": "2024-06-01"
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error loading routes: %v", err)
+	}
+
+	defaultURL, _ := url.Parse("http://127.0.0.1:1/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(defaultURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Router = router
+
+	for _, tt := range []struct{ path, model string }{
+		{"/v1/chat/completions", "azure-gpt-4o"},
+		{"/v1/completions", "azure-gpt-35-turbo"},
+	} {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(`{"model": "`+tt.model+`"}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.path, rr.Code, rr.Body.String())
+		}
+	}
+
+	want := []string{
+		// A mapped model goes to its deployment
+		"/openai/deployments/prod-gpt4o/chat/completions?api-version=2024-06-01",
+		// An unmapped one is its own deployment, and the request path is kept
+		"/openai/deployments/azure-gpt-35-turbo/completions?api-version=2024-06-01",
+	}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("expected Azure paths %v, got %v", want, paths)
+	}
+}
+
+func TestProxyHandler_PreservePath(t *testing.T) {
+	var paths []string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path+"?"+r.URL.RawQuery)
+		io.WriteString(w, `{"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL + "/serving/v1/chat/completions?tenant=a")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	send := func(path string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"model": "gpt-4o"}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	// By default every path goes to the configured endpoint
+	send("/v1/completions")
+	proxyHandler.PreservePath = true
+	send("/v1/completions")
+	send("/v1/chat/completions")
+
+	// Replicas keep the request path too
+	pool, err := gateway.NewUpstreamPool([]gateway.Replica{{URL: upstreamURL, Weight: 1}}, gateway.RoundRobin)
+	if err != nil {
+		t.Fatalf("unexpected error creating pool: %v", err)
+	}
+	proxyHandler.Upstreams = pool
+	send("/v1/completions")
+
+	want := []string{
+		"/serving/v1/chat/completions?tenant=a",
+		"/serving/v1/completions?tenant=a",
+		"/serving/v1/chat/completions?tenant=a",
+		"/serving/v1/completions?tenant=a",
+	}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("expected upstream paths %v, got %v", want, paths)
+	}
+}
@@ -0,0 +1,21 @@
+package gateway
+
+// DefaultBilledRoutes are the completion routes billed unless configured otherwise.
+// Every other route the proxy serves, such as health checks or canary paths, is
+// passed through without checking limits or recording usage.
+var DefaultBilledRoutes = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+}
+
+// BillingRoutes overrides whether requests to each path are billed.
+type BillingRoutes map[string]bool
+
+// Bills reports whether requests to route are limit-checked and have their usage recorded.
+func (b BillingRoutes) Bills(route string) bool {
+	if billed, ok := b[route]; ok {
+		return billed
+	}
+	return DefaultBilledRoutes[route]
+}
@@ -0,0 +1,55 @@
+package gateway_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestBillingRoutes(t *testing.T) {
+	routes := gateway.BillingRoutes{"/v1/embeddings": false, "/internal/canary": true}
+
+	tests := map[string]bool{
+		"/v1/chat/completions": true,
+		"/v1/embeddings":       false,
+		"/internal/canary":     true,
+		"/healthz":             false,
+	}
+	for route, want := range tests {
+		if got := routes.Bills(route); got != want {
+			t.Errorf("Bills(%q) = %v, want %v", route, got, want)
+		}
+	}
+}
+
+func TestProxyHandler_UnbilledRoute(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"usage\":{\"total_tokens\":5}}\n\ndata: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	// The key is over its limit, which only matters on billed routes
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: false}, usageChan)
+
+	req := httptest.NewRequest("POST", "/internal/canary", bytes.NewReader([]byte(`{"model": "gpt-4"}`)))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected an unbilled route to skip the limit check, got %d", rr.Code)
+	}
+	select {
+	case record := <-usageChan:
+		t.Errorf("expected no usage recorded for an unbilled route, got %+v", record)
+	default:
+	}
+}
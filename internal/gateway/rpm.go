@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimiter throttles each key to a number of requests per minute,
+// independently of its cost budget.
+type RateLimiter interface {
+	// Allow takes one request from the key's budget, reporting false when none is left.
+	Allow(apiKey string) (bool, error)
+	// RetryAfter is how long a throttled key waits before its next request is allowed.
+	RetryAfter(apiKey string) time.Duration
+}
+
+// RPMLimits holds the requests-per-minute limit for each key. Zero means unlimited.
+type RPMLimits struct {
+	Default int
+	Keys    map[string]int
+}
+
+// For returns the RPM limit for the key.
+func (l *RPMLimits) For(apiKey string) int {
+	if l == nil {
+		return 0
+	}
+	if limit, ok := l.Keys[apiKey]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// refillInterval is how often a bucket of limit requests per minute regains one.
+func refillInterval(limit int) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Minute / time.Duration(limit)
+}
+
+// takeTokenScript refills the key's bucket for the time elapsed since it was
+// last used, then takes one request from it if one is available. The bucket
+// holds up to a minute's worth of requests, so an idle key may burst.
+var takeTokenScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+local state = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = limit
+else
+	tokens = math.min(limit, tokens + (now - ts) * limit / 60000)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', key, 60000)
+return allowed
+`)
+
+// RedisRateLimiter implements RateLimiter with a token bucket per key in Redis,
+// shared by every replica.
+type RedisRateLimiter struct {
+	client *redis.Client
+	Limits *RPMLimits
+}
+
+func NewRedisRateLimiter(client *redis.Client, limits *RPMLimits) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client: client,
+		Limits: limits,
+	}
+}
+
+func (r *RedisRateLimiter) getRPMKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:rpm", apiKey)
+}
+
+// Allow implements RateLimiter in a single round trip.
+func (r *RedisRateLimiter) Allow(apiKey string) (bool, error) {
+	limit := r.Limits.For(apiKey)
+	if limit <= 0 {
+		return true, nil
+	}
+	allowed, err := takeTokenScript.Run(context.Background(), r.client, []string{r.getRPMKey(apiKey)},
+		time.Now().UnixMilli(), limit).Int()
+	if err != nil {
+		return false, fmt.Errorf("redis rpm allow error: %w", err)
+	}
+	return allowed == 1, nil
+}
+
+// RetryAfter implements RateLimiter.
+func (r *RedisRateLimiter) RetryAfter(apiKey string) time.Duration {
+	return refillInterval(r.Limits.For(apiKey))
+}
+
+// rpmBucket is one key's token bucket.
+type rpmBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryRateLimiter implements RateLimiter with a token bucket per key in process memory.
+type MemoryRateLimiter struct {
+	Limits *RPMLimits
+	// Now is the clock used to refill buckets, time.Now when nil.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*rpmBucket
+}
+
+func NewMemoryRateLimiter(limits *RPMLimits) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		Limits:  limits,
+		buckets: make(map[string]*rpmBucket),
+	}
+}
+
+// Allow implements RateLimiter.
+func (m *MemoryRateLimiter) Allow(apiKey string) (bool, error) {
+	limit := m.Limits.For(apiKey)
+	if limit <= 0 {
+		return true, nil
+	}
+	now := time.Now()
+	if m.Now != nil {
+		now = m.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[apiKey]
+	if !ok {
+		b = &rpmBucket{tokens: float64(limit), last: now}
+		m.buckets[apiKey] = b
+	}
+	b.tokens += now.Sub(b.last).Minutes() * float64(limit)
+	if b.tokens > float64(limit) {
+		b.tokens = float64(limit)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false, nil
+	}
+	b.tokens--
+	return true, nil
+}
+
+// RetryAfter implements RateLimiter.
+func (m *MemoryRateLimiter) RetryAfter(apiKey string) time.Duration {
+	return refillInterval(m.Limits.For(apiKey))
+}
@@ -0,0 +1,128 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+func testRateLimiter(t *testing.T, limiter gateway.RateLimiter, apiKey string) {
+	for i := 0; i < 3; i++ {
+		allowed, err := limiter.Allow(apiKey)
+		if err != nil {
+			t.Fatalf("unexpected error on Allow: %v", err)
+		}
+		if !allowed {
+			t.Fatalf("expected request %d within the limit to be allowed", i+1)
+		}
+	}
+
+	allowed, err := limiter.Allow(apiKey)
+	if err != nil {
+		t.Fatalf("unexpected error on Allow: %v", err)
+	}
+	if allowed {
+		t.Errorf("expected the request over the limit to be denied")
+	}
+	if retryAfter := limiter.RetryAfter(apiKey); retryAfter != 20*time.Second {
+		t.Errorf("expected a retry after one refill interval of 20s, got %v", retryAfter)
+	}
+
+	// Keys without a limit are never throttled
+	for i := 0; i < 5; i++ {
+		if allowed, _ := limiter.Allow(apiKey + "-unlimited"); !allowed {
+			t.Fatalf("expected an unlimited key to be allowed")
+		}
+	}
+}
+
+func rpmLimits(apiKey string) *gateway.RPMLimits {
+	return &gateway.RPMLimits{Keys: map[string]int{apiKey: 3}}
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	testRateLimiter(t, gateway.NewMemoryRateLimiter(rpmLimits("test-key")), "test-key")
+}
+
+func TestMemoryRateLimiter_Refill(t *testing.T) {
+	now := time.Now()
+	limiter := gateway.NewMemoryRateLimiter(&gateway.RPMLimits{Default: 60})
+	limiter.Now = func() time.Time { return now }
+
+	for i := 0; i < 60; i++ {
+		limiter.Allow("test-key")
+	}
+	if allowed, _ := limiter.Allow("test-key"); allowed {
+		t.Fatal("expected the drained bucket to deny")
+	}
+
+	// 60 RPM refills one request per second
+	now = now.Add(time.Second)
+	if allowed, _ := limiter.Allow("test-key"); !allowed {
+		t.Error("expected one request to be allowed after a second")
+	}
+	if allowed, _ := limiter.Allow("test-key"); allowed {
+		t.Error("expected only one request to have refilled")
+	}
+}
+
+// TestRedisRateLimiter requires a running Redis/Valkey instance on localhost:6379 to pass.
+func TestRedisRateLimiter(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	apiKey := "test-redis-rpm-key"
+	client.Del(ctx, "apikey:"+apiKey+":rpm")
+	defer client.Del(ctx, "apikey:"+apiKey+":rpm")
+
+	testRateLimiter(t, gateway.NewRedisRateLimiter(client, rpmLimits(apiKey)), apiKey)
+}
+
+func TestProxyHandler_RPMLimit(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.RPM = gateway.NewMemoryRateLimiter(&gateway.RPMLimits{Default: 2})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4o"}`)))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := send(); rr.Code != http.StatusOK {
+			t.Fatalf("expected request %d to pass, got %d", i+1, rr.Code)
+		}
+	}
+
+	rr := send()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 over the RPM limit, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After of 30 seconds at 2 RPM, got %q", got)
+	}
+}
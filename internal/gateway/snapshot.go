@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSnapshotInterval is how often the in-memory store's usage is written to disk.
+const DefaultSnapshotInterval = 30 * time.Second
+
+// usageSnapshot is the on-disk form of a MemoryCircuitBreaker's usage.
+type usageSnapshot struct {
+	// ResetsAt is the end of the window the usage was counted in, zero without a window.
+	ResetsAt time.Time                   `json:"resets_at,omitempty"`
+	Keys     map[string]snapshotKeyUsage `json:"keys"`
+}
+
+type snapshotKeyUsage struct {
+	CostMicroDollars int64 `json:"cost_micro_dollars"`
+	Tokens           int64 `json:"tokens,omitempty"`
+}
+
+// SaveSnapshot writes every key's usage and token count to path as JSON, so a
+// restarted single node keeps its budgets. The file is replaced atomically,
+// so a crash mid-write leaves the previous snapshot intact.
+func (r *MemoryCircuitBreaker) SaveSnapshot(path string) error {
+	snapshot := usageSnapshot{ResetsAt: r.ResetsAt(), Keys: make(map[string]snapshotKeyUsage)}
+	r.usageMap.Range(func(apiKey string, valRef *int64) bool {
+		snapshot.Keys[apiKey] = snapshotKeyUsage{CostMicroDollars: atomic.LoadInt64(valRef)}
+		return true
+	})
+	r.tokenMap.Range(func(apiKey string, tokRef *int64) bool {
+		usage := snapshot.Keys[apiKey]
+		usage.Tokens = atomic.LoadInt64(tokRef)
+		snapshot.Keys[apiKey] = usage
+		return true
+	})
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot restores the usage saved by SaveSnapshot, replacing any usage
+// already counted for the same keys. A missing file is not an error. A corrupt
+// one returns an error and loads nothing, so the store starts empty. Usage
+// counted in a window that has since ended is dropped, as the rollover would.
+func (r *MemoryCircuitBreaker) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var snapshot usageSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid usage snapshot: %w", err)
+	}
+
+	expired := !snapshot.ResetsAt.IsZero() && !r.now().Before(snapshot.ResetsAt)
+	for apiKey, usage := range snapshot.Keys {
+		if !expired {
+			atomic.StoreInt64(r.usageMap.LoadOrStore(apiKey, 0), usage.CostMicroDollars)
+		}
+		atomic.StoreInt64(r.tokenMap.LoadOrStore(apiKey, 0), usage.Tokens)
+	}
+	return nil
+}
+
+// RunSnapshots saves a snapshot to path every interval until ctx is done.
+// The final snapshot on shutdown is left to the caller, once the last usage
+// has been recorded.
+func (r *MemoryCircuitBreaker) RunSnapshots(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.SaveSnapshot(path); err != nil {
+				slog.Error("Failed to snapshot usage", "path", path, "error", err)
+			}
+		}
+	}
+}
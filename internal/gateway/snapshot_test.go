@@ -0,0 +1,77 @@
+package gateway_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestMemoryCircuitBreaker_Snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.AddUsage("key-a", 1500)
+	cb.AddTokens("key-a", 42)
+	cb.AddUsage("key-b", 700)
+
+	if err := cb.SaveSnapshot(path); err != nil {
+		t.Fatalf("unexpected error saving the snapshot: %v", err)
+	}
+
+	restored := gateway.NewMemoryCircuitBreaker()
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("unexpected error loading the snapshot: %v", err)
+	}
+	for key, want := range map[string]int64{"key-a": 1500, "key-b": 700} {
+		if usage, _ := restored.GetUsage(key); usage != want {
+			t.Errorf("expected %s's usage of %d to survive, got %d", key, want, usage)
+		}
+	}
+	usages, _ := restored.ListUsage()
+	for _, u := range usages {
+		if u.APIKey == "key-a" && u.Tokens != 42 {
+			t.Errorf("expected key-a's 42 tokens to survive, got %d", u.Tokens)
+		}
+	}
+}
+
+func TestMemoryCircuitBreaker_SnapshotMissingOrCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	cb := gateway.NewMemoryCircuitBreaker()
+	if err := cb.LoadSnapshot(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("expected a missing snapshot to be ignored, got %v", err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte(`{"keys": {"key-a": {"cost_micro_dollars": 15`), 0o600)
+	if err := cb.LoadSnapshot(corrupt); err == nil {
+		t.Error("expected an error for a corrupt snapshot")
+	}
+	if usages, _ := cb.ListUsage(); len(usages) != 0 {
+		t.Errorf("expected a corrupt snapshot to leave usage empty, got %+v", usages)
+	}
+}
+
+func TestMemoryCircuitBreaker_SnapshotExpiredWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	now := time.Date(2024, 3, 10, 23, 0, 0, 0, time.UTC)
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.Window = gateway.WindowDaily
+	cb.Now = func() time.Time { return now }
+	cb.AddUsage("key-a", 1500)
+	cb.SaveSnapshot(path)
+
+	// Restarted after the day's budget refilled
+	now = now.Add(2 * time.Hour)
+	restored := gateway.NewMemoryCircuitBreaker()
+	restored.Window = gateway.WindowDaily
+	restored.Now = func() time.Time { return now }
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("unexpected error loading the snapshot: %v", err)
+	}
+	if usage, _ := restored.GetUsage("key-a"); usage != 0 {
+		t.Errorf("expected usage from the previous window to be dropped, got %d", usage)
+	}
+}
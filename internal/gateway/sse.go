@@ -0,0 +1,42 @@
+package gateway
+
+import "bytes"
+
+// sseEvent assembles server-sent events from the lines of a stream. Consecutive
+// data fields join into one payload with newlines, as the SSE spec requires;
+// comments, such as keepalives, and the event, id and retry fields are ignored.
+type sseEvent struct {
+	data    bytes.Buffer
+	hasData bool
+}
+
+// feed processes one line, without its line ending. When a blank line ends an
+// event that carried data, it returns the event's data, valid until the next call.
+func (e *sseEvent) feed(line []byte) ([]byte, bool) {
+	if len(line) == 0 {
+		return e.flush()
+	}
+	if line[0] == ':' {
+		return nil, false
+	}
+	field, value, _ := bytes.Cut(line, []byte(":"))
+	if string(field) == "data" {
+		if e.hasData {
+			e.data.WriteByte('\n')
+		}
+		e.data.Write(bytes.TrimPrefix(value, []byte(" ")))
+		e.hasData = true
+	}
+	return nil, false
+}
+
+// flush ends the current event, returning its data if it carried any.
+func (e *sseEvent) flush() ([]byte, bool) {
+	if !e.hasData {
+		return nil, false
+	}
+	e.hasData = false
+	data := e.data.Bytes()
+	e.data.Reset()
+	return data, true
+}
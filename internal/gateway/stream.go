@@ -3,32 +3,254 @@ package gateway
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
 )
 
 // UsageRecord represents the token usage structure sent to the background processor
 type UsageRecord struct {
-	APIKey     string
-	TokenCount int
+	APIKey           string
+	RequestID        string
+	Model            string
+	TokenCount       int
+	PromptTokens     int
+	CompletionTokens int
+
+	// CostMicroDollars is the marked-up cost priced when the request finished.
+	// ReservedMicroDollars of it were already charged when the request was
+	// admitted, so only the difference remains to be added.
+	CostMicroDollars     int64
+	ReservedMicroDollars int64
+	// ReservationResetsAt is when the window the reservation was charged in
+	// ends, zero if usage never resets. See Charge.
+	ReservationResetsAt time.Time
+	// BaseCostMicroDollars is the cost before the key's markup. Priced marks a
+	// record whose costs were set when the request finished, so the processor
+	// doesn't price it again, even when it was priced at zero.
+	BaseCostMicroDollars int64
+	Priced               bool
+
+	// Metadata holds the request fields captured for attribution, keyed by field name.
+	Metadata map[string]string
+
+	// Audio tokens are included in PromptTokens and CompletionTokens but billed separately.
+	AudioPromptTokens     int
+	AudioCompletionTokens int
+
+	// Partial marks a response that ended early, whether cut off by the gateway,
+	// dropped by the upstream or abandoned by the client. Its usage covers only
+	// what was generated and may be estimated.
+	Partial bool
+
+	// unpriced marks a record priced at the flat fallback rate, reported when it's dispatched.
+	unpriced bool
+}
+
+// StreamOptions tunes the optional behaviour of StreamResponse.
+type StreamOptions struct {
+	// EmitUsageEvent appends a terminal `event: aura.usage` SSE event with the
+	// request's total tokens and cost once the upstream has sent [DONE].
+	EmitUsageEvent bool
+
+	// RequestID correlates the usage record with the request's access log entry,
+	// and Metadata attributes it to the client's own identifiers.
+	RequestID string
+	Metadata  map[string]string
+	// Model is the model requested by the client, used when the upstream chunks don't name one.
+	Model string
+	// Pricing computes the cost reported in the usage event. Defaults to DefaultPricing.
+	// CostMultiplier marks that cost up for the key; zero means 1.0.
+	Pricing        CostCalculator
+	CostMultiplier float64
+
+	// Flush controls how often output is flushed to the client. Defaults to every line.
+	Flush FlushPolicy
+
+	// Start is when the client request arrived, used to observe time to first byte.
+	Start time.Time
+
+	// Tokenizer and PromptTokens estimate the usage of streams cut off before the
+	// upstream reported it, from the prompt estimate and the content streamed so
+	// far. Without a Tokenizer such streams record no usage.
+	Tokenizer    Tokenizer
+	PromptTokens int
+	// EstimateUsage also estimates streams that end without reporting usage,
+	// for upstreams that weren't asked for it. Without a Tokenizer the content
+	// is counted with the HeuristicTokenizer.
+	EstimateUsage bool
+
+	// MaxBytes ends the stream once this many bytes have been forwarded. Zero is
+	// unlimited. TruncationEvent appends an `error` event telling the client why.
+	MaxBytes        int64
+	TruncationEvent bool
+
+	// ErrorMessage replaces the message of the `error` events sent when a stream
+	// fails after the 200 has gone out. The error codes are kept, so clients can
+	// still tell the failures apart.
+	ErrorMessage string
+
+	// ReservedMicroDollars is the estimated cost charged when the request was
+	// admitted, in the window ending at ReservationResetsAt.
+	ReservedMicroDollars int64
+	ReservationResetsAt  time.Time
+
+	// DeadLetter keeps records that arrive while usageChan is full.
+	DeadLetter DeadLetterSink
+
+	// Gzip compresses the event stream, for clients that accept it. Upstream
+	// responses that are already encoded are passed through as they are.
+	Gzip bool
+}
+
+// newRecord starts the usage record for a request.
+func (o *StreamOptions) newRecord(apiKey string) UsageRecord {
+	return UsageRecord{
+		APIKey:               apiKey,
+		RequestID:            o.RequestID,
+		Model:                o.Model,
+		Metadata:             o.Metadata,
+		ReservedMicroDollars: o.ReservedMicroDollars,
+		ReservationResetsAt:  o.ReservationResetsAt,
+	}
+}
+
+// errorMessage returns ErrorMessage, or def when it is unset.
+func (o *StreamOptions) errorMessage(def string) string {
+	if o.ErrorMessage != "" {
+		return o.ErrorMessage
+	}
+	return def
+}
+
+// pricing returns Pricing, or DefaultPricing when it is unset.
+func (o *StreamOptions) pricing() CostCalculator {
+	if o.Pricing == nil {
+		return DefaultPricing
+	}
+	return o.Pricing
+}
+
+// cost prices a usage record, marked up by CostMultiplier.
+func (o *StreamOptions) cost(record UsageRecord) int64 {
+	cost := o.pricing().Cost(record)
+	if o.CostMultiplier > 0 {
+		cost = markup(cost, o.CostMultiplier)
+	}
+	return cost
+}
+
+// price sets the costs of a finished request's record.
+func (o *StreamOptions) price(record *UsageRecord) {
+	record.BaseCostMicroDollars = o.pricing().Cost(*record)
+	record.CostMicroDollars = record.BaseCostMicroDollars
+	if o.CostMultiplier > 0 {
+		record.CostMicroDollars = markup(record.CostMicroDollars, o.CostMultiplier)
+	}
+	record.Priced = true
+	record.unpriced = isUnpriced(o.pricing(), *record)
+}
+
+// usageEvent is the payload of the `aura.usage` SSE event.
+type usageEvent struct {
+	TotalTokens      int     `json:"total_tokens"`
+	CostMicroDollars int64   `json:"cost_micro_dollars"`
+	CostDollars      float64 `json:"cost_dollars"`
+}
+
+// usageBlock is the OpenAI `usage` object reported by the upstream. Audio
+// details appear under the chat names (prompt/completion) or the realtime
+// names (input/output) depending on the endpoint.
+type usageBlock struct {
+	PromptTokens            int           `json:"prompt_tokens"`
+	CompletionTokens        int           `json:"completion_tokens"`
+	TotalTokens             int           `json:"total_tokens"`
+	PromptTokensDetails     *tokenDetails `json:"prompt_tokens_details"`
+	CompletionTokensDetails *tokenDetails `json:"completion_tokens_details"`
+	InputTokensDetails      *tokenDetails `json:"input_tokens_details"`
+	OutputTokensDetails     *tokenDetails `json:"output_tokens_details"`
+}
+
+type tokenDetails struct {
+	AudioTokens int `json:"audio_tokens"`
+}
+
+func (d *tokenDetails) audio() int {
+	if d == nil {
+		return 0
+	}
+	return d.AudioTokens
+}
+
+// apply replaces the record's token counts with the block's. A total below
+// prompt plus completion is an upstream bug; the parts are billed instead so
+// the request isn't undercharged.
+func (u *usageBlock) apply(record *UsageRecord) {
+	record.TokenCount = u.TotalTokens
+	if sum := u.PromptTokens + u.CompletionTokens; u.TotalTokens < sum {
+		slog.Warn("Upstream reported inconsistent usage, billing prompt plus completion",
+			"request_id", record.RequestID, observability.APIKeyAttr(record.APIKey), "model", record.Model,
+			"total_tokens", u.TotalTokens, "prompt_tokens", u.PromptTokens, "completion_tokens", u.CompletionTokens)
+		metrics.InconsistentUsage.WithLabelValues(record.Model).Inc()
+		record.TokenCount = sum
+	}
+	record.PromptTokens = u.PromptTokens
+	record.CompletionTokens = u.CompletionTokens
+	record.AudioPromptTokens = u.PromptTokensDetails.audio() + u.InputTokensDetails.audio()
+	record.AudioCompletionTokens = u.CompletionTokensDetails.audio() + u.OutputTokensDetails.audio()
 }
 
 // StreamResponse streams SSE data from upstream to the client and extracts usage transparently.
-func StreamResponse(w http.ResponseWriter, resp *http.Response, apiKey string, usageChan chan<- UsageRecord) {
+// It returns the usage it extracted, which is also dispatched to usageChan. Plain JSON
+// responses from non-streaming requests are passed through with their usage read at the end.
+func StreamResponse(w http.ResponseWriter, resp *http.Response, apiKey string, usageChan chan<- UsageRecord, opts StreamOptions) UsageRecord {
+	if isJSONResponse(resp) {
+		return forwardJSONResponse(w, resp, apiKey, usageChan, opts)
+	}
+
+	logger := slog.With("request_id", opts.RequestID)
+
 	// 1. Copy Response Headers
-	for k, vv := range resp.Header {
-		for _, v := range vv {
-			w.Header().Add(k, v)
-		}
+	copyResponseHeaders(w.Header(), resp.Header)
+	if opts.EmitUsageEvent {
+		// The extra event changes the body length
+		w.Header().Del("Content-Length")
+	}
+	compress := opts.Gzip && resp.Header.Get("Content-Encoding") == ""
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Del("Content-Length")
 	}
 	w.WriteHeader(resp.StatusCode)
 
 	// Ensure we can flush immediately to client
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		// Fallback for clients/middlewares that don't support SSE streaming
-		return
+		// Buffering middlewares can't stream, but the response is still relayed
+		// in full and billed; it reaches the client when the writer sends it
+		logger.Warn("Response writer can't flush, streaming degraded to a buffered response")
+		metrics.ErrorRate.WithLabelValues("stream_unflushable").Inc()
+		flusher = nopFlusher{}
+	}
+
+	out := newStreamWriter(w, flusher, opts.Flush)
+	if compress {
+		out.compress()
 	}
+	// Whatever the policy, everything written must reach the client when the stream ends
+	defer func() {
+		out.Close()
+		metrics.ResponseBytes.Observe(float64(out.Sent()))
+	}()
 
 	// 2. Scan and stream the response line by line
 	scanner := bufio.NewScanner(resp.Body)
@@ -36,53 +258,182 @@ func StreamResponse(w http.ResponseWriter, resp *http.Response, apiKey string, u
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
 
-	var tokenCount int
-	prefix := []byte("data: ")
+	tokenizer := opts.Tokenizer
+	if tokenizer == nil && opts.EstimateUsage {
+		tokenizer = HeuristicTokenizer{}
+	}
+
+	record := opts.newRecord(apiKey)
+	var sawDone, sawUsage, truncated bool
+	var completion contentBuffer
+	var written int64
+	firstByte := true
+	var event sseEvent
 	doneSequence := []byte("[DONE]")
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	// Only complete events are parsed; the raw lines are relayed as they arrive
+	processEvent := func(data []byte) {
+		// Ignore the final "[DONE]" message
+		if bytes.HasPrefix(data, doneSequence) {
+			sawDone = true
+			return
+		}
 
-		// Write to client immediately
-		w.Write(line)
-		w.Write([]byte("\n"))
-		flusher.Flush() // Crucial for sub-10ms latency per chunk
-
-		// Look for Server-Sent Events starting with "data: "
-		if bytes.HasPrefix(line, prefix) {
-			data := bytes.TrimPrefix(line, prefix)
-			// Ignore the final "[DONE]" message
-			if bytes.HasPrefix(data, doneSequence) {
-				continue
+		// Parse chunk payload
+		// We optimize this by only looking for the `model` and `usage` fields
+		var chunk struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Content json.RawMessage `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *usageBlock `json:"usage"`
+		}
+		if err := json.Unmarshal(data, &chunk); err == nil {
+			if chunk.Model != "" {
+				record.Model = chunk.Model
 			}
-
-			// Parse chunk payload
-			// We optimize this by only looking for the `usage` object
-			var chunk struct {
-				Usage *struct {
-					TotalTokens int `json:"total_tokens"`
-				} `json:"usage"`
+			if tokenizer != nil {
+				for _, choice := range chunk.Choices {
+					completion.Append(choice.Delta.Content)
+				}
 			}
-			if err := json.Unmarshal(data, &chunk); err == nil && chunk.Usage != nil {
-				// Usage block detected
-				tokenCount = chunk.Usage.TotalTokens
+			if chunk.Usage != nil {
+				// The last chunk carrying a usage object wins outright, so an interim
+				// estimate is replaced by the final figures even if they are lower,
+				// and content streamed after the usage doesn't discard it.
+				sawUsage = true
+				chunk.Usage.apply(&record)
 			}
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		// Non-blocking log. Ideally inject an observability logger here.
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// Cut off pathological upstreams before they exhaust memory or the client
+		written += int64(len(line)) + 1
+		if opts.MaxBytes > 0 && written > opts.MaxBytes {
+			truncated = true
+			break
+		}
+
+		// Write to client, flushing per the policy (per line by default for sub-10ms latency per chunk)
+		out.WriteLine(line)
+		if firstByte && !opts.Start.IsZero() {
+			metrics.TimeToFirstByte.Observe(time.Since(opts.Start).Seconds())
+		}
+		firstByte = false
+
+		if data, complete := event.feed(line); complete {
+			processEvent(data)
+		}
+	}
+	// Upstreams that end without a trailing blank line still finish their last event
+	if !truncated && scanner.Err() == nil {
+		if data, complete := event.flush(); complete {
+			processEvent(data)
+		}
 	}
 
-	// 3. Dispatch usage record asynchronously
-	// Push to background channel to avoid blocking the client disconnecting
-	if tokenCount > 0 && apiKey != "" && usageChan != nil {
+	// The usage block comes last, so a cut-off stream usually never reports it
+	estimateUnreported := func() {
+		if !sawUsage && tokenizer != nil {
+			record.PromptTokens = opts.PromptTokens
+			record.CompletionTokens = tokenizer.CountTokens(completion.String())
+			record.TokenCount = record.PromptTokens + record.CompletionTokens
+		}
+	}
+
+	if truncated {
+		logger.Warn("Upstream response exceeded maximum size", observability.APIKeyAttr(apiKey), "max_bytes", opts.MaxBytes)
+		metrics.ResponseTruncated.Inc()
+		if opts.TruncationEvent {
+			writeStreamError(out, "response_truncated", opts.errorMessage("The response exceeded the maximum size allowed by the gateway."))
+		}
+		out.Flush()
+		estimateUnreported()
+	} else if err := scanner.Err(); errors.Is(err, context.Canceled) {
+		// The client went away and canceled the upstream request; nobody is left to tell
+		logger.Info("Client disconnected mid-stream", observability.APIKeyAttr(apiKey), "tokens_seen", record.TokenCount)
+		metrics.ErrorRate.WithLabelValues("client_canceled").Inc()
+		estimateUnreported()
+	} else if err != nil {
+		// The upstream dropped mid-stream, or we canceled it. A 200 has already been sent,
+		// so flag the truncation in-band rather than letting it look like a complete response.
+		if errors.Is(err, context.DeadlineExceeded) {
+			logger.Warn("Stream exceeded maximum duration", observability.APIKeyAttr(apiKey), "tokens_seen", record.TokenCount)
+			metrics.StreamTimeouts.Inc()
+			writeStreamError(out, "stream_timeout", opts.errorMessage("The stream exceeded the maximum duration allowed for this key."))
+		} else {
+			logger.Warn("Upstream stream interrupted", observability.APIKeyAttr(apiKey), "tokens_seen", record.TokenCount, "error", err)
+			metrics.StreamInterrupted.Inc()
+			writeStreamError(out, "stream_interrupted", opts.errorMessage("The upstream stream was interrupted before completion."))
+		}
+		out.Flush()
+		estimateUnreported()
+	} else if opts.EstimateUsage {
+		// The upstream wasn't asked for usage, so a complete stream has none either
+		estimateUnreported()
+	}
+
+	record.Partial = truncated || scanner.Err() != nil
+	opts.price(&record)
+
+	// Opt-in terminal event so clients get per-request cost without calling /v1/usage
+	if opts.EmitUsageEvent && sawDone {
+		writeUsageEvent(out, record.TokenCount, record.CostMicroDollars)
+		out.Flush()
+	}
+
+	// 3. Dispatch usage record asynchronously, including partial usage from interrupted streams
+	dispatchUsage(record, usageChan, opts.DeadLetter)
+	return record
+}
+
+// dispatchUsage pushes a usage record to the background processor without
+// blocking, so a slow billing store never holds up the client. When the
+// processor is backed up the record goes to the dead-letter sink instead.
+func dispatchUsage(record UsageRecord, usageChan chan<- UsageRecord, deadLetter DeadLetterSink) {
+	if record.TokenCount > 0 && record.APIKey != "" && usageChan != nil {
+		if record.unpriced {
+			warnUnpriced(record.Model)
+		}
 		select {
-		case usageChan <- UsageRecord{APIKey: apiKey, TokenCount: tokenCount}:
+		case usageChan <- record:
 			// Successfully pushed
 		default:
-			// Buffer full or channel blocked. In a production app, we should log a warning
-			// or have a dead-letter queue so we don't drop billing data.
+			// Buffer full or channel blocked
+			metrics.UsageDropped.Inc()
+			if deadLetter == nil {
+				slog.Error("Usage channel full, dropping usage record", "request_id", record.RequestID, observability.APIKeyAttr(record.APIKey), "tokens", record.TokenCount)
+			} else if err := deadLetter.Put(record); err != nil {
+				slog.Error("Failed to dead-letter usage record", "request_id", record.RequestID, observability.APIKeyAttr(record.APIKey), "error", err)
+			}
 		}
 	}
 }
+
+// writeUsageEvent writes the `aura.usage` SSE event for the given token count and cost.
+func writeUsageEvent(w io.Writer, tokenCount int, cost int64) {
+	data, err := json.Marshal(usageEvent{
+		TotalTokens:      tokenCount,
+		CostMicroDollars: cost,
+		CostDollars:      float64(cost) / 1000000.0,
+	})
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: aura.usage\ndata: %s\n\n", data)
+}
+
+// writeStreamError writes an OpenAI-style error as an `error` SSE event. It's the only
+// way to report a failure once the status code and some chunks have been sent.
+func writeStreamError(w io.Writer, code, message string) {
+	data, err := json.Marshal(ErrorResponse{Error: APIError{Message: message, Type: "server_error", Code: code}})
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+}
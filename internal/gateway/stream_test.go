@@ -0,0 +1,320 @@
+package gateway_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+const usageStream = "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+	"data: {\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":18}}\n\n" +
+	"data: [DONE]\n\n"
+
+func newStreamResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestStreamResponse_UsageEvent(t *testing.T) {
+	rr := httptest.NewRecorder()
+	usageChan := make(chan gateway.UsageRecord, 1)
+
+	gateway.StreamResponse(rr, newStreamResponse(usageStream), "test-key", usageChan, gateway.StreamOptions{EmitUsageEvent: true})
+
+	expected := "event: aura.usage\ndata: {\"total_tokens\":18,\"cost_micro_dollars\":36,\"cost_dollars\":0.000036}\n\n"
+	if !strings.HasSuffix(rr.Body.String(), expected) {
+		t.Errorf("expected stream to end with usage event, got %q", rr.Body.String())
+	}
+
+	record := <-usageChan
+	if record.TokenCount != 18 {
+		t.Errorf("expected 18 tokens recorded, got %d", record.TokenCount)
+	}
+}
+
+func TestStreamResponse_UsageEventDisabledByDefault(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	gateway.StreamResponse(rr, newStreamResponse(usageStream), "test-key", nil, gateway.StreamOptions{})
+
+	if strings.Contains(rr.Body.String(), "aura.usage") {
+		t.Errorf("expected no usage event without opt-in, got %q", rr.Body.String())
+	}
+	if rr.Body.String() != usageStream {
+		t.Errorf("expected stream to pass through unchanged, got %q", rr.Body.String())
+	}
+}
+
+// nonFlushingWriter hides the recorder's Flush, like a buffering middleware.
+type nonFlushingWriter struct {
+	http.ResponseWriter
+}
+
+func TestStreamResponse_NonFlushingWriter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	usageChan := make(chan gateway.UsageRecord, 1)
+
+	gateway.StreamResponse(nonFlushingWriter{rr}, newStreamResponse(usageStream), "test-key", usageChan, gateway.StreamOptions{})
+
+	if rr.Body.String() != usageStream {
+		t.Errorf("expected the full stream to be delivered, got %q", rr.Body.String())
+	}
+	select {
+	case record := <-usageChan:
+		if record.TokenCount != 18 {
+			t.Errorf("expected 18 tokens recorded, got %d", record.TokenCount)
+		}
+	default:
+		t.Fatal("expected usage to be recorded")
+	}
+}
+
+func TestStreamResponse_LastUsageWins(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want gateway.UsageRecord
+	}{
+		{
+			name: "interim then final",
+			body: "data: {\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":40,\"total_tokens\":50}}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+				"data: {\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":18}}\n\n" +
+				"data: [DONE]\n\n",
+			want: gateway.UsageRecord{TokenCount: 18, PromptTokens: 10, CompletionTokens: 8},
+		},
+		{
+			name: "usage then content",
+			body: "data: {\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":18}}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"more\"}}],\"usage\":null}\n\n" +
+				"data: [DONE]\n\n",
+			want: gateway.UsageRecord{TokenCount: 18, PromptTokens: 10, CompletionTokens: 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := gateway.StreamResponse(httptest.NewRecorder(), newStreamResponse(tt.body), "", nil, gateway.StreamOptions{})
+			if record.TokenCount != tt.want.TokenCount || record.PromptTokens != tt.want.PromptTokens ||
+				record.CompletionTokens != tt.want.CompletionTokens {
+				t.Errorf("expected usage %+v, got %+v", tt.want, record)
+			}
+		})
+	}
+}
+
+func TestStreamResponse_MultiLineEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "data split across lines",
+			body: "data: {\"model\":\"gpt-4o\",\n" +
+				"data: \"usage\":{\"prompt_tokens\":10,\n" +
+				"data:\"completion_tokens\":8,\"total_tokens\":18}}\n\n" +
+				"data: [DONE]\n\n",
+		},
+		{
+			name: "comments and other fields",
+			body: ": keepalive\n\n" +
+				"event: message\nid: 1\nretry: 1000\n" +
+				": interleaved comment\n" +
+				"data: {\"model\":\"gpt-4o\",\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":18}}\n\n" +
+				": keepalive\n\n" +
+				"data: [DONE]\n\n",
+		},
+		{
+			name: "crlf line endings",
+			body: "data: {\"model\":\"gpt-4o\",\r\n" +
+				"data: \"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":18}}\r\n\r\n",
+		},
+		{
+			name: "no trailing blank line",
+			body: "data: {\"model\":\"gpt-4o\",\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":8,\"total_tokens\":18}}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			record := gateway.StreamResponse(rr, newStreamResponse(tt.body), "", nil, gateway.StreamOptions{})
+			if record.TokenCount != 18 || record.PromptTokens != 10 || record.CompletionTokens != 8 {
+				t.Errorf("expected 10 prompt and 8 completion tokens, got %+v", record)
+			}
+			if record.Model != "gpt-4o" {
+				t.Errorf("expected model gpt-4o, got %q", record.Model)
+			}
+			if !strings.HasPrefix(rr.Body.String(), strings.ReplaceAll(tt.body, "\r\n", "\n")) {
+				t.Errorf("expected the raw lines to pass through unchanged, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestStreamResponse_InconsistentUsage(t *testing.T) {
+	body := "data: {\"model\":\"gpt-4o\",\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":1000,\"total_tokens\":500}}\n\n" +
+		"data: [DONE]\n\n"
+
+	record := gateway.StreamResponse(httptest.NewRecorder(), newStreamResponse(body), "", nil, gateway.StreamOptions{RequestID: "req_1"})
+	if record.TokenCount != 2000 {
+		t.Errorf("expected prompt plus completion to be billed over the lower total, got %d", record.TokenCount)
+	}
+	if record.CostMicroDollars != 12500 {
+		t.Errorf("expected the split to be priced in full, got %d", record.CostMicroDollars)
+	}
+}
+
+func TestStreamResponse_AudioUsage(t *testing.T) {
+	body := "data: {\"usage\":{\"prompt_tokens\":120,\"completion_tokens\":300,\"total_tokens\":420," +
+		"\"prompt_tokens_details\":{\"audio_tokens\":100,\"cached_tokens\":0}," +
+		"\"completion_tokens_details\":{\"audio_tokens\":250,\"reasoning_tokens\":0}}}\n\n" +
+		"data: [DONE]\n\n"
+
+	record := gateway.StreamResponse(httptest.NewRecorder(), newStreamResponse(body), "", nil, gateway.StreamOptions{})
+	if record.AudioPromptTokens != 100 || record.AudioCompletionTokens != 250 {
+		t.Errorf("expected 100 input and 250 output audio tokens, got %+v", record)
+	}
+	if record.TokenCount != 420 {
+		t.Errorf("expected audio tokens to stay in the total, got %d", record.TokenCount)
+	}
+
+	// The realtime API names the same details input/output
+	body = "data: {\"usage\":{\"prompt_tokens\":50,\"completion_tokens\":80,\"total_tokens\":130," +
+		"\"input_tokens_details\":{\"audio_tokens\":40},\"output_tokens_details\":{\"audio_tokens\":70}}}\n\n"
+	record = gateway.StreamResponse(httptest.NewRecorder(), newStreamResponse(body), "", nil, gateway.StreamOptions{})
+	if record.AudioPromptTokens != 40 || record.AudioCompletionTokens != 70 {
+		t.Errorf("expected 40 input and 70 output audio tokens, got %+v", record)
+	}
+}
+
+func TestStreamResponse_Interrupted(t *testing.T) {
+	partial := "data: {\"usage\":{\"total_tokens\":7}}\n\n"
+	resp := newStreamResponse("")
+	resp.Body = io.NopCloser(io.MultiReader(strings.NewReader(partial), iotest.ErrReader(errors.New("connection reset by peer"))))
+
+	rr := httptest.NewRecorder()
+	usageChan := make(chan gateway.UsageRecord, 1)
+	gateway.StreamResponse(rr, resp, "test-key", usageChan, gateway.StreamOptions{})
+
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, partial) {
+		t.Errorf("expected partial stream to be forwarded, got %q", body)
+	}
+	if !strings.Contains(body, "event: error\ndata: {\"error\":{") || !strings.Contains(body, "stream_interrupted") {
+		t.Errorf("expected truncation to be signalled with an error event, got %q", body)
+	}
+
+	select {
+	case record := <-usageChan:
+		if record.TokenCount != 7 {
+			t.Errorf("expected partial usage of 7 tokens, got %d", record.TokenCount)
+		}
+	default:
+		t.Errorf("expected partial usage to be recorded")
+	}
+}
+
+func TestStreamResponse_MaxBytes(t *testing.T) {
+	chunk := "data: {\"choices\":[{\"delta\":{\"content\":\"aaaaaaaaaaaaaaaa\"}}]}\n\n"
+	resp := newStreamResponse(strings.Repeat(chunk, 100) + usageStream)
+
+	rr := httptest.NewRecorder()
+	usageChan := make(chan gateway.UsageRecord, 1)
+	record := gateway.StreamResponse(rr, resp, "test-key", usageChan, gateway.StreamOptions{
+		MaxBytes:        512,
+		TruncationEvent: true,
+		Tokenizer:       gateway.HeuristicTokenizer{},
+		PromptTokens:    10,
+	})
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "response_truncated") {
+		t.Errorf("expected a truncation event, got %q", body)
+	}
+	if strings.Contains(body, "[DONE]") {
+		t.Error("expected the stream to be cut off before [DONE]")
+	}
+	if forwarded := strings.Index(body, "event: error"); forwarded > 512 {
+		t.Errorf("expected at most 512 bytes forwarded before the event, got %d", forwarded)
+	}
+	if record.PromptTokens != 10 || record.CompletionTokens == 0 {
+		t.Errorf("expected usage estimated from the content seen so far, got %+v", record)
+	}
+	if len(usageChan) != 1 {
+		t.Error("expected the partial usage to be recorded")
+	}
+}
+
+func TestStreamResponse_SingletonHeaders(t *testing.T) {
+	resp := newStreamResponse(usageStream)
+	resp.Header.Add("Vary", "Origin")
+	resp.Header.Add("Vary", "Accept-Encoding")
+	resp.Header.Set("Connection", "keep-alive")
+
+	rr := httptest.NewRecorder()
+	// Simulate a handler or middleware that already set its own Content-Type
+	rr.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+
+	gateway.StreamResponse(rr, resp, "", nil, gateway.StreamOptions{})
+
+	if got := rr.Result().Header.Values("Content-Type"); len(got) != 1 || got[0] != "text/event-stream" {
+		t.Errorf("expected exactly one upstream Content-Type, got %v", got)
+	}
+	if got := rr.Result().Header.Values("Vary"); len(got) != 2 {
+		t.Errorf("expected multi-valued Vary header to be preserved, got %v", got)
+	}
+	if got := rr.Result().Header.Get("Connection"); got != "" {
+		t.Errorf("expected hop-by-hop Connection header to be dropped, got %q", got)
+	}
+}
+
+// recordingTokenizer remembers the text it was asked to count.
+type recordingTokenizer struct{ text *string }
+
+func (r recordingTokenizer) CountTokens(text string) int {
+	*r.text = text
+	return len(text)
+}
+
+func TestStreamResponse_SplitMultibyteContent(t *testing.T) {
+	// "é" split across two chunks as raw UTF-8, then "😀" split as an escaped surrogate pair
+	body := "data: {\"choices\":[{\"delta\":{\"content\":\"caf\xc3\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"\xa9 \\ud83d\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"\\ude00\\n\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":null}}]}\n\n"
+	// Cut off before any usage is reported so the completion is estimated from the content
+	resp := newStreamResponse(body)
+	resp.Body = io.NopCloser(io.MultiReader(strings.NewReader(body), iotest.ErrReader(errors.New("connection reset"))))
+
+	var text string
+	gateway.StreamResponse(httptest.NewRecorder(), resp, "test-key", nil, gateway.StreamOptions{
+		Tokenizer: recordingTokenizer{&text},
+	})
+
+	if text != "café 😀\n" {
+		t.Errorf("expected the split characters to be rejoined, got %q", text)
+	}
+}
+
+func TestStreamResponse_ErrorMessage(t *testing.T) {
+	resp := newStreamResponse("")
+	resp.Body = io.NopCloser(iotest.ErrReader(errors.New("connection reset by peer")))
+
+	rr := httptest.NewRecorder()
+	gateway.StreamResponse(rr, resp, "test-key", nil, gateway.StreamOptions{ErrorMessage: "Generation failed, please retry."})
+
+	want := "event: error\ndata: {\"error\":{\"message\":\"Generation failed, please retry.\",\"type\":\"server_error\",\"code\":\"stream_interrupted\"}}\n\n"
+	if rr.Body.String() != want {
+		t.Errorf("expected the configured message with the original code, got %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,21 @@
+package gateway
+
+import "time"
+
+// StreamDurationLimits holds the maximum stream duration for each key, enforced
+// even when the client sets no timeout of its own. Zero means unlimited.
+type StreamDurationLimits struct {
+	Default time.Duration
+	Keys    map[string]time.Duration
+}
+
+// For returns the maximum stream duration for the key.
+func (l *StreamDurationLimits) For(apiKey string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	if d, ok := l.Keys[apiKey]; ok {
+		return d
+	}
+	return l.Default
+}
@@ -0,0 +1,170 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestProxyHandler_MaxStreamDuration(t *testing.T) {
+	// An upstream that starts streaming and then stalls without ever finishing
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello there, \"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"how can I help?\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+	proxyHandler.StreamDurations = &gateway.StreamDurationLimits{
+		Default: time.Minute,
+		Keys:    map[string]time.Duration{"test-key": 100 * time.Millisecond},
+	}
+
+	reqBody := []byte(`{"model": "gpt-4", "messages": [{"role": "user", "content": "Say hello"}]}`)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(reqBody))
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		proxyHandler.ServeHTTP(rr, req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stream to be canceled at the key's maximum duration")
+	}
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "how can I help?") {
+		t.Errorf("expected content streamed before the timeout to be forwarded, got %q", body)
+	}
+	if !strings.Contains(body, "event: error") || !strings.Contains(body, "stream_timeout") {
+		t.Errorf("expected the timeout to be signalled with an error event, got %q", body)
+	}
+
+	select {
+	case record := <-usageChan:
+		if record.PromptTokens == 0 || record.CompletionTokens == 0 {
+			t.Errorf("expected estimated prompt and completion usage, got %+v", record)
+		}
+		if record.TokenCount != record.PromptTokens+record.CompletionTokens {
+			t.Errorf("expected total to be prompt+completion, got %+v", record)
+		}
+	default:
+		t.Errorf("expected partial usage to be recorded")
+	}
+}
+
+// cancelingRecorder cancels the request as soon as the first bytes reach the client.
+type cancelingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (c *cancelingRecorder) Write(b []byte) (int, error) {
+	c.cancel()
+	return c.ResponseRecorder.Write(b)
+}
+
+func TestProxyHandler_ClientCancellation(t *testing.T) {
+	upstreamClosed := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello there, \"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(upstreamClosed)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	usageChan := make(chan gateway.UsageRecord, 1)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, usageChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reqBody := []byte(`{"model": "gpt-4", "stream": true, "messages": [{"role": "user", "content": "Say hello"}]}`)
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(reqBody)).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := &cancelingRecorder{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+
+	done := make(chan struct{})
+	go func() {
+		proxyHandler.ServeHTTP(rr, req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stream to stop once the client went away")
+	}
+	select {
+	case <-upstreamClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the upstream request to be canceled with the client's")
+	}
+
+	if strings.Contains(rr.Body.String(), "event: error") {
+		t.Errorf("expected no error event for a client that left, got %q", rr.Body.String())
+	}
+	select {
+	case record := <-usageChan:
+		if !record.Partial {
+			t.Errorf("expected the abandoned stream's usage to be marked partial, got %+v", record)
+		}
+		if record.CompletionTokens == 0 {
+			t.Errorf("expected the content generated so far to be billed, got %+v", record)
+		}
+	default:
+		t.Errorf("expected the usage generated before the disconnect to be recorded")
+	}
+}
+
+func TestProxyHandler_EgressWaitBoundedByStreamDuration(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.StreamDurations = &gateway.StreamDurationLimits{Default: 50 * time.Millisecond}
+	// One request a second with queueing allowed for up to five
+	proxyHandler.Egress = gateway.NewEgressLimiter(1, 1, 5*time.Second)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "messages": []}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	send()
+	start := time.Now()
+	// The second request would queue for a second, past its own 50ms limit
+	if rr := send(); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 once the stream duration ran out in the egress queue, got %d", rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the wait to end at the stream duration, took %v", elapsed)
+	}
+}
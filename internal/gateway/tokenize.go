@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// TokenizeHandler serves POST /v1/tokenize, counting the tokens of a text or a
+// messages array with the model's tokenizer. It never contacts the upstream or bills.
+type TokenizeHandler struct {
+	Tokenizers *TokenizerRegistry
+}
+
+// NewTokenizeHandler initializes a tokenize handler with the given tokenizers.
+func NewTokenizeHandler(tokenizers *TokenizerRegistry) *TokenizeHandler {
+	return &TokenizeHandler{
+		Tokenizers: tokenizers,
+	}
+}
+
+// TokenizeResponse is the JSON body returned by the tokenize endpoint. Messages
+// holds each message's count; TotalTokens also includes the reply priming.
+type TokenizeResponse struct {
+	Model       string `json:"model"`
+	TotalTokens int    `json:"total_tokens"`
+	Messages    []int  `json:"messages,omitempty"`
+}
+
+func (h *TokenizeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+
+	var payload struct {
+		Model    string        `json:"model"`
+		Text     *string       `json:"text"`
+		Messages []interface{} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON payload")
+		return
+	}
+	if payload.Text == nil && payload.Messages == nil {
+		WriteError(w, http.StatusBadRequest, "missing_required_parameter", "Provide either text or messages")
+		return
+	}
+
+	tok := h.Tokenizers.For(payload.Model)
+	resp := TokenizeResponse{Model: payload.Model}
+	if payload.Text != nil {
+		resp.TotalTokens = tok.CountTokens(*payload.Text)
+	} else {
+		resp.Messages = make([]int, 0, len(payload.Messages))
+		for _, m := range payload.Messages {
+			var count int
+			if msg, ok := m.(map[string]interface{}); ok {
+				count = EstimateMessageTokens(tok, msg)
+			}
+			resp.Messages = append(resp.Messages, count)
+		}
+		resp.TotalTokens = EstimatePromptTokens(tok, payload.Messages)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
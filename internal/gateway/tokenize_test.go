@@ -0,0 +1,101 @@
+package gateway_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func tokenize(t *testing.T, body string) (*httptest.ResponseRecorder, gateway.TokenizeResponse) {
+	t.Helper()
+	handler := gateway.NewTokenizeHandler(gateway.DefaultTokenizers)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/tokenize", bytes.NewReader([]byte(body))))
+
+	var resp gateway.TokenizeResponse
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return rr, resp
+}
+
+func TestTokenizeHandler_Messages(t *testing.T) {
+	// system: 3 overhead + "system" (2) + "Be brief." (3); user: 3 + "user" (1) + "Hello!" (2); 3 reply priming
+	rr, resp := tokenize(t, `{"model": "gpt-4o", "messages": [{"role": "system", "content": "Be brief."}, {"role": "user", "content": "Hello!"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if !reflect.DeepEqual(resp.Messages, []int{8, 6}) {
+		t.Errorf("expected per-message counts [8 6], got %v", resp.Messages)
+	}
+	if resp.TotalTokens != 17 {
+		t.Errorf("expected 17 total tokens, got %d", resp.TotalTokens)
+	}
+}
+
+func TestTokenizeHandler_Text(t *testing.T) {
+	rr, resp := tokenize(t, `{"model": "gpt-4o", "text": "aaaaaaaaaaaaaaaaaaaa"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if resp.TotalTokens != 5 || resp.Messages != nil {
+		t.Errorf("expected 5 tokens and no per-message counts, got %+v", resp)
+	}
+}
+
+func TestTokenizeHandler_RequiresInput(t *testing.T) {
+	rr, _ := tokenize(t, `{"model": "gpt-4o"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without text or messages, got %d", rr.Code)
+	}
+}
+
+func TestProxyHandler_ContextWindow(t *testing.T) {
+	upstreamCalls := 0
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Tokenizers = &gateway.TokenizerRegistry{
+		Default:        gateway.HeuristicTokenizer{},
+		ContextWindows: map[string]int{"gpt-4": 1000},
+	}
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+	// About 500 prompt tokens
+	messages := `"messages": [{"role": "user", "content": "` + strings.Repeat("abcd", 500) + `"}]`
+
+	rr := serve(`{"model": "gpt-4-0613", "max_tokens": 600, ` + messages + `}`)
+	if rr.Code != http.StatusBadRequest || upstreamCalls != 0 {
+		t.Fatalf("expected an over-long request to be rejected locally, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "context_length_exceeded") || !strings.Contains(rr.Body.String(), "maximum context length is 1000 tokens") {
+		t.Errorf("expected an error with the numbers, got %q", rr.Body.String())
+	}
+
+	if rr := serve(`{"model": "gpt-4-0613", "max_tokens": 400, ` + messages + `}`); rr.Code != http.StatusOK {
+		t.Errorf("expected a request that fits to be forwarded, got %d", rr.Code)
+	}
+	if rr := serve(`{"model": "mystery-model", "max_tokens": 600, ` + messages + `}`); rr.Code != http.StatusOK {
+		t.Errorf("expected an unknown model to be forwarded, got %d", rr.Code)
+	}
+}
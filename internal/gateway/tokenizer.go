@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens in a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// HeuristicTokenizer approximates BPE tokenizers at roughly four characters per token.
+// It is cheap and model-agnostic, which makes it the default estimator.
+type HeuristicTokenizer struct{}
+
+// CountTokens implements Tokenizer.
+func (HeuristicTokenizer) CountTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// TokenizerRegistry selects a Tokenizer per model by longest prefix match.
+// ContextWindows holds each model's context window in tokens, matched the same way.
+type TokenizerRegistry struct {
+	Default        Tokenizer
+	Models         map[string]Tokenizer
+	ContextWindows map[string]int
+}
+
+// DefaultTokenizers estimates every model with the HeuristicTokenizer.
+var DefaultTokenizers = &TokenizerRegistry{Default: HeuristicTokenizer{}}
+
+// For returns the tokenizer for the model, falling back to the registry default.
+func (r *TokenizerRegistry) For(model string) Tokenizer {
+	if best := longestPrefix(r.Models, model); best != "" {
+		return r.Models[best]
+	}
+	if r.Default != nil {
+		return r.Default
+	}
+	return HeuristicTokenizer{}
+}
+
+// ContextWindow returns the model's context window, if one is configured.
+func (r *TokenizerRegistry) ContextWindow(model string) (int, bool) {
+	if r == nil {
+		return 0, false
+	}
+	if best := longestPrefix(r.ContextWindows, model); best != "" {
+		return r.ContextWindows[best], true
+	}
+	return 0, false
+}
+
+// longestPrefix returns the longest key of m that prefixes model.
+func longestPrefix[V any](m map[string]V, model string) string {
+	var best string
+	for name := range m {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	return best
+}
+
+const (
+	// tokensPerMessage is the chat-format overhead OpenAI adds around every message.
+	tokensPerMessage = 3
+	// tokensPerReply primes the assistant's reply.
+	tokensPerReply = 3
+)
+
+// EstimatePromptTokens estimates the prompt tokens of an OpenAI `messages` array,
+// including the chat-format overhead. Content may be a string or an array of parts.
+func EstimatePromptTokens(tok Tokenizer, messages []interface{}) int {
+	total := tokensPerReply
+	for _, m := range messages {
+		if msg, ok := m.(map[string]interface{}); ok {
+			total += EstimateMessageTokens(tok, msg)
+		}
+	}
+	return total
+}
+
+// EstimateMessageTokens estimates the tokens of a single chat message, including
+// its share of the chat-format overhead.
+func EstimateMessageTokens(tok Tokenizer, msg map[string]interface{}) int {
+	total := tokensPerMessage
+	if role, ok := msg["role"].(string); ok {
+		total += tok.CountTokens(role)
+	}
+	if name, ok := msg["name"].(string); ok {
+		total += tok.CountTokens(name)
+	}
+	return total + tok.CountTokens(MessageText(msg))
+}
+
+// MessageText returns the text content of a chat message, joining multi-part content.
+func MessageText(msg map[string]interface{}) string {
+	switch content := msg["content"].(type) {
+	case string:
+		return content
+	case []interface{}:
+		var parts []string
+		for _, p := range content {
+			if part, ok := p.(map[string]interface{}); ok {
+				if text, ok := part["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"log/slog"
+
+	"aura-ai-gateway/internal/metrics"
+	"aura-ai-gateway/internal/observability"
+)
+
+// ToolCallLimit watches agent loops. Each tool-call round trip leaves an
+// assistant message with tool_calls in the conversation the client sends
+// back, so the request's messages show how many rounds the loop has run.
+// Requests past MaxRounds are logged and counted; they are only rejected when
+// Enforce is set.
+type ToolCallLimit struct {
+	MaxRounds int
+	Enforce   bool
+}
+
+// Check records the request's tool-call rounds and reports whether it should
+// be rejected. A nil limit still records the rounds.
+func (l *ToolCallLimit) Check(apiKey, requestID string, messages []interface{}) bool {
+	rounds := ToolCallRounds(messages)
+	if rounds > 0 {
+		metrics.ToolCallRounds.Observe(float64(rounds))
+	}
+	if l == nil || l.MaxRounds <= 0 || rounds <= l.MaxRounds {
+		return false
+	}
+
+	slog.Warn("Request exceeded the tool-call round limit",
+		"request_id", requestID, observability.APIKeyAttr(apiKey), "rounds", rounds, "max_rounds", l.MaxRounds, "enforced", l.Enforce)
+	metrics.ToolCallRoundsExceeded.WithLabelValues(enforcedLabel(l.Enforce)).Inc()
+	return l.Enforce
+}
+
+// ToolCallRounds counts the assistant messages that called tools, including
+// the legacy single function_call form.
+func ToolCallRounds(messages []interface{}) int {
+	var rounds int
+	for _, m := range messages {
+		msg, ok := m.(map[string]interface{})
+		if !ok || msg["role"] != "assistant" {
+			continue
+		}
+		if calls, _ := msg["tool_calls"].([]interface{}); len(calls) > 0 {
+			rounds++
+		} else if call, _ := msg["function_call"].(map[string]interface{}); call != nil {
+			rounds++
+		}
+	}
+	return rounds
+}
+
+func enforcedLabel(enforced bool) string {
+	if enforced {
+		return "rejected"
+	}
+	return "flagged"
+}
@@ -0,0 +1,62 @@
+package gateway_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+// agentConversation has two tool-call rounds: one tool_calls message and one legacy function_call.
+const agentConversation = `{"model": "gpt-4o", "messages": [
+	{"role": "user", "content": "What's the weather in Paris and Rome?"},
+	{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{}"}}]},
+	{"role": "tool", "tool_call_id": "call_1", "content": "sunny"},
+	{"role": "assistant", "content": null, "function_call": {"name": "weather", "arguments": "{}"}},
+	{"role": "function", "name": "weather", "content": "rainy"},
+	{"role": "assistant", "content": "Sunny in Paris, rainy in Rome.", "tool_calls": []}
+]}`
+
+func TestToolCallLimit(t *testing.T) {
+	upstreamCalls := 0
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(agentConversation)))
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Advisory by default
+	proxyHandler.ToolCalls = &gateway.ToolCallLimit{MaxRounds: 1}
+	if rr := serve(); rr.Code != http.StatusOK || upstreamCalls != 1 {
+		t.Fatalf("expected an advisory limit to forward the request, got %d", rr.Code)
+	}
+
+	proxyHandler.ToolCalls.Enforce = true
+	rr := serve()
+	if rr.Code != http.StatusBadRequest || upstreamCalls != 1 {
+		t.Fatalf("expected an enforced limit to reject the request, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "tool_call_rounds_exceeded") {
+		t.Errorf("expected a tool_call_rounds_exceeded error, got %q", rr.Body.String())
+	}
+
+	proxyHandler.ToolCalls.MaxRounds = 2
+	if rr := serve(); rr.Code != http.StatusOK {
+		t.Errorf("expected a request at the limit to be forwarded, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,267 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tpmWindowSeconds is the length of the tokens-per-minute sliding window.
+const tpmWindowSeconds = 60
+
+// TokenRateLimiter enforces a per-key tokens-per-minute budget over a sliding window.
+type TokenRateLimiter interface {
+	// Reserve counts tokens against the key's window if they fit under limit. If
+	// they don't, it returns false and how long until enough of the window expires.
+	Reserve(apiKey string, tokens, limit int) (allowed bool, retryAfter time.Duration, err error)
+	// Adjust reconciles a reservation with the actual token count; delta may be negative.
+	Adjust(apiKey string, delta int) error
+	// Usage returns the tokens counted in the key's current window.
+	Usage(apiKey string) (int, error)
+}
+
+// TPMLimits holds the tokens-per-minute limit for each key. Zero means unlimited.
+type TPMLimits struct {
+	Default int
+	Keys    map[string]int
+}
+
+// For returns the TPM limit for the key.
+func (l *TPMLimits) For(apiKey string) int {
+	if l == nil {
+		return 0
+	}
+	if limit, ok := l.Keys[apiKey]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// reserveTPMScript atomically expires old buckets from the key's hash of
+// per-second token counts, then either records the new tokens or reports how
+// many seconds until enough of the window rolls off to fit them.
+var reserveTPMScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local tokens = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local window = tonumber(ARGV[4])
+
+local fields = redis.call('HGETALL', key)
+local total = 0
+local buckets = {}
+for i = 1, #fields, 2 do
+	local sec = tonumber(fields[i])
+	local count = tonumber(fields[i + 1])
+	if sec <= now - window then
+		redis.call('HDEL', key, fields[i])
+	else
+		total = total + count
+		table.insert(buckets, {sec, count})
+	end
+end
+
+if total + tokens > limit then
+	table.sort(buckets, function(a, b) return a[1] < b[1] end)
+	local need = total + tokens - limit
+	local freed = 0
+	for _, b in ipairs(buckets) do
+		freed = freed + b[2]
+		if freed >= need then
+			return {0, b[1] + window - now}
+		end
+	end
+	return {0, window}
+end
+
+redis.call('HINCRBY', key, now, tokens)
+redis.call('EXPIRE', key, window + 1)
+return {1, 0}
+`)
+
+// RedisTokenRateLimiter implements TokenRateLimiter with a Redis hash of per-second buckets.
+type RedisTokenRateLimiter struct {
+	client *redis.Client
+}
+
+func NewRedisTokenRateLimiter(client *redis.Client) *RedisTokenRateLimiter {
+	return &RedisTokenRateLimiter{
+		client: client,
+	}
+}
+
+func (r *RedisTokenRateLimiter) getTPMKey(apiKey string) string {
+	return fmt.Sprintf("apikey:%s:tpm", apiKey)
+}
+
+// Reserve implements TokenRateLimiter in a single round trip.
+func (r *RedisTokenRateLimiter) Reserve(apiKey string, tokens, limit int) (bool, time.Duration, error) {
+	ctx := context.Background()
+	res, err := reserveTPMScript.Run(ctx, r.client, []string{r.getTPMKey(apiKey)},
+		time.Now().Unix(), tokens, limit, tpmWindowSeconds).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis tpm reserve error: %w", err)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Second, nil
+}
+
+// Adjust implements TokenRateLimiter by correcting the current second's bucket.
+func (r *RedisTokenRateLimiter) Adjust(apiKey string, delta int) error {
+	ctx := context.Background()
+	key := r.getTPMKey(apiKey)
+	pipe := r.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, strconv.FormatInt(time.Now().Unix(), 10), int64(delta))
+	pipe.Expire(ctx, key, (tpmWindowSeconds+1)*time.Second)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Usage implements TokenRateLimiter.
+func (r *RedisTokenRateLimiter) Usage(apiKey string) (int, error) {
+	ctx := context.Background()
+	fields, err := r.client.HGetAll(ctx, r.getTPMKey(apiKey)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis hgetall error: %w", err)
+	}
+
+	cutoff := time.Now().Unix() - tpmWindowSeconds
+	var total int
+	for sec, count := range fields {
+		s, err1 := strconv.ParseInt(sec, 10, 64)
+		c, err2 := strconv.Atoi(count)
+		if err1 == nil && err2 == nil && s > cutoff {
+			total += c
+		}
+	}
+	return total, nil
+}
+
+// tpmWindow is a ring of per-second token counts covering the last minute.
+type tpmWindow struct {
+	secs   [tpmWindowSeconds]int64
+	counts [tpmWindowSeconds]int
+}
+
+// total sums the buckets that are still inside the window at now.
+func (w *tpmWindow) total(now int64) int {
+	var total int
+	for i, sec := range w.secs {
+		if sec > now-tpmWindowSeconds {
+			total += w.counts[i]
+		}
+	}
+	return total
+}
+
+func (w *tpmWindow) add(now int64, tokens int) {
+	i := now % tpmWindowSeconds
+	if w.secs[i] != now {
+		w.secs[i] = now
+		w.counts[i] = 0
+	}
+	w.counts[i] += tokens
+}
+
+// MemoryTokenRateLimiter implements TokenRateLimiter in process memory. Keys
+// whose window has emptied are dropped once a minute.
+type MemoryTokenRateLimiter struct {
+	// Now is the clock used for the windows, time.Now when nil.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*tpmWindow
+	lastSweep int64
+}
+
+func NewMemoryTokenRateLimiter() *MemoryTokenRateLimiter {
+	return &MemoryTokenRateLimiter{
+		windows: make(map[string]*tpmWindow),
+	}
+}
+
+// now returns the current second, sweeping idle keys at most once a window.
+func (m *MemoryTokenRateLimiter) now() int64 {
+	now := time.Now()
+	if m.Now != nil {
+		now = m.Now()
+	}
+	sec := now.Unix()
+	if sec-m.lastSweep >= tpmWindowSeconds {
+		for apiKey, w := range m.windows {
+			if w.total(sec) == 0 {
+				delete(m.windows, apiKey)
+			}
+		}
+		m.lastSweep = sec
+	}
+	return sec
+}
+
+func (m *MemoryTokenRateLimiter) window(apiKey string) *tpmWindow {
+	w, ok := m.windows[apiKey]
+	if !ok {
+		w = &tpmWindow{}
+		m.windows[apiKey] = w
+	}
+	return w
+}
+
+// Len returns the number of keys being tracked.
+func (m *MemoryTokenRateLimiter) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.windows)
+}
+
+// Reserve implements TokenRateLimiter.
+func (m *MemoryTokenRateLimiter) Reserve(apiKey string, tokens, limit int) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	w := m.window(apiKey)
+	total := w.total(now)
+	if total+tokens <= limit {
+		w.add(now, tokens)
+		return true, 0, nil
+	}
+
+	// Walk the buckets oldest first until enough tokens would have expired
+	need := total + tokens - limit
+	freed := 0
+	for sec := now - tpmWindowSeconds + 1; sec <= now; sec++ {
+		i := sec % tpmWindowSeconds
+		if w.secs[i] == sec {
+			freed += w.counts[i]
+		}
+		if freed >= need {
+			return false, time.Duration(sec+tpmWindowSeconds-now) * time.Second, nil
+		}
+	}
+	return false, tpmWindowSeconds * time.Second, nil
+}
+
+// Adjust implements TokenRateLimiter.
+func (m *MemoryTokenRateLimiter) Adjust(apiKey string, delta int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.window(apiKey).add(now, delta)
+	return nil
+}
+
+// Usage implements TokenRateLimiter.
+func (m *MemoryTokenRateLimiter) Usage(apiKey string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	w, ok := m.windows[apiKey]
+	if !ok {
+		return 0, nil
+	}
+	return w.total(now), nil
+}
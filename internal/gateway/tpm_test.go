@@ -0,0 +1,142 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"github.com/redis/go-redis/v9"
+)
+
+func testTokenRateLimiter(t *testing.T, limiter gateway.TokenRateLimiter, apiKey string) {
+	allowed, _, err := limiter.Reserve(apiKey, 600, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error on Reserve: %v", err)
+	}
+	if !allowed {
+		t.Fatalf("expected reservation under the limit to be allowed")
+	}
+
+	allowed, retryAfter, err := limiter.Reserve(apiKey, 600, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error on Reserve: %v", err)
+	}
+	if allowed {
+		t.Errorf("expected reservation over the limit to be denied")
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("expected retry-after within the window, got %v", retryAfter)
+	}
+
+	// Actual usage came in lower than the estimate, freeing capacity
+	if err := limiter.Adjust(apiKey, -300); err != nil {
+		t.Fatalf("unexpected error on Adjust: %v", err)
+	}
+	usage, err := limiter.Usage(apiKey)
+	if err != nil {
+		t.Fatalf("unexpected error on Usage: %v", err)
+	}
+	if usage != 300 {
+		t.Errorf("expected window usage 300, got %d", usage)
+	}
+
+	allowed, _, _ = limiter.Reserve(apiKey, 600, 1000)
+	if !allowed {
+		t.Errorf("expected reservation to fit after reconciliation")
+	}
+}
+
+func TestMemoryTokenRateLimiter(t *testing.T) {
+	testTokenRateLimiter(t, gateway.NewMemoryTokenRateLimiter(), "test-key")
+}
+
+func TestMemoryTokenRateLimiter_DropsIdleKeys(t *testing.T) {
+	now := time.Now()
+	limiter := gateway.NewMemoryTokenRateLimiter()
+	limiter.Now = func() time.Time { return now }
+
+	limiter.Reserve("idle-key", 100, 1000)
+	limiter.Reserve("busy-key", 100, 1000)
+	now = now.Add(45 * time.Second)
+	limiter.Reserve("busy-key", 100, 1000)
+
+	// A window later only the key with tokens still in it is kept
+	now = now.Add(30 * time.Second)
+	if usage, _ := limiter.Usage("busy-key"); usage != 100 {
+		t.Errorf("expected the busy key's recent tokens to be kept, got %d", usage)
+	}
+	if limiter.Len() != 1 {
+		t.Errorf("expected the idle key to be dropped, got %d keys", limiter.Len())
+	}
+}
+
+// TestRedisTokenRateLimiter requires a running Redis/Valkey instance on localhost:6379 to pass.
+func TestRedisTokenRateLimiter(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	ctx := context.Background()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		t.Skip("Skipping Redis integration test because Redis is not active at localhost:6379")
+	}
+
+	apiKey := "test-redis-tpm-key"
+	client.Del(ctx, "apikey:"+apiKey+":tpm")
+	defer client.Del(ctx, "apikey:"+apiKey+":tpm")
+
+	testTokenRateLimiter(t, gateway.NewRedisTokenRateLimiter(client), apiKey)
+}
+
+func TestProxyHandler_TPMLimit(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.TPM = gateway.NewMemoryTokenRateLimiter()
+	proxyHandler.TPMLimits = &gateway.TPMLimits{Default: 20}
+
+	// Each request is estimated at roughly 15 prompt tokens
+	reqBody := []byte(`{"model": "gpt-4o", "messages": [{"role": "user", "content": "Tell me a short story."}]}`)
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(reqBody))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(); rr.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", rr.Code)
+	}
+
+	rr := send()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 once the TPM window is saturated, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a Retry-After header")
+	}
+
+	// A prompt over the whole limit could never be admitted, so it isn't a 429
+	proxyHandler.TPMLimits = &gateway.TPMLimits{Default: 10}
+	rr = send()
+	if rr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rr.Body.String(), "tpm_limit_exceeded") {
+		t.Errorf("expected status 413 for a prompt over the TPM limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") != "" {
+		t.Errorf("expected no Retry-After for a request that can't succeed")
+	}
+}
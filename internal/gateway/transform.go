@@ -0,0 +1,42 @@
+package gateway
+
+import "aura-ai-gateway/internal/metrics"
+
+// JSONModePolicy forces `response_format: {"type": "json_object"}` onto requests
+// from selected API keys or routes, so integrations that need structured output
+// don't depend on every client setting it.
+type JSONModePolicy struct {
+	Keys   map[string]bool // API keys that always get JSON mode
+	Routes map[string]bool // Request paths that always get JSON mode
+
+	// Override replaces any client-provided response_format. Otherwise a JSON
+	// format the client asked for (json_object or json_schema) is kept and only
+	// a missing or plain-text format is clamped to json_object.
+	Override bool
+}
+
+// Applies reports whether JSON mode is enforced for the key or route.
+func (p *JSONModePolicy) Applies(apiKey, route string) bool {
+	return p != nil && (p.Keys[apiKey] || p.Routes[route])
+}
+
+// Apply enforces JSON mode on the payload and reports whether it was modified.
+func (p *JSONModePolicy) Apply(payload map[string]interface{}) bool {
+	jsonObject := map[string]interface{}{"type": "json_object"}
+
+	existing, ok := payload["response_format"].(map[string]interface{})
+	if !ok {
+		payload["response_format"] = jsonObject
+		metrics.JSONModeEnforced.WithLabelValues("injected").Inc()
+		return true
+	}
+
+	formatType, _ := existing["type"].(string)
+	if formatType == "json_object" || (formatType == "json_schema" && !p.Override) {
+		return false
+	}
+
+	payload["response_format"] = jsonObject
+	metrics.JSONModeEnforced.WithLabelValues("overridden").Inc()
+	return true
+}
@@ -0,0 +1,73 @@
+package gateway_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestJSONModePolicy_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		override bool
+		format   interface{}
+		want     string
+		modified bool
+	}{
+		{name: "missing is injected", format: nil, want: "json_object", modified: true},
+		{name: "text is clamped", format: map[string]interface{}{"type": "text"}, want: "json_object", modified: true},
+		{name: "json_schema is kept", format: map[string]interface{}{"type": "json_schema"}, want: "json_schema", modified: false},
+		{name: "json_schema is overridden", override: true, format: map[string]interface{}{"type": "json_schema"}, want: "json_object", modified: true},
+		{name: "json_object is untouched", override: true, format: map[string]interface{}{"type": "json_object"}, want: "json_object", modified: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &gateway.JSONModePolicy{Override: tt.override}
+			payload := map[string]interface{}{}
+			if tt.format != nil {
+				payload["response_format"] = tt.format
+			}
+
+			if modified := policy.Apply(payload); modified != tt.modified {
+				t.Errorf("expected modified=%v, got %v", tt.modified, modified)
+			}
+			got := payload["response_format"].(map[string]interface{})["type"]
+			if got != tt.want {
+				t.Errorf("expected response_format type %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_JSONModeForKey(t *testing.T) {
+	var received map[string]interface{}
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodyBytes, _ := io.ReadAll(r.Body)
+		json.Unmarshal(bodyBytes, &received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.JSONMode = &gateway.JSONModePolicy{Keys: map[string]bool{"json-key": true}}
+
+	for _, key := range []string{"json-key", "other-key"} {
+		received = nil
+		req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4o"}`)))
+		req.Header.Set("Authorization", "Bearer "+key)
+		proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+		_, enforced := received["response_format"]
+		if enforced != (key == "json-key") {
+			t.Errorf("key %s: expected response_format enforced=%v, got %v", key, key == "json-key", enforced)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// NewUpstreamTransport returns the transport shared by all upstream requests.
+// Egress goes through proxyURL when set; otherwise HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY are honoured as usual. Open connections are reported per host; set
+// MaxConnsPerHost on the result to bound them.
+func NewUpstreamTransport(proxyURL *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		metrics.UpstreamConnections.WithLabelValues(addr).Inc()
+		return &countedConn{Conn: conn, addr: addr}, nil
+	}
+	return transport
+}
+
+// UpstreamTimeouts bound how long an upstream request may take to connect and
+// start responding. Zero leaves a phase with the transport's default. Nothing
+// bounds the response body, so long streams aren't cut off.
+type UpstreamTimeouts struct {
+	Dial           time.Duration
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration
+}
+
+// Apply sets the timeouts on transport.
+func (t UpstreamTimeouts) Apply(transport *http.Transport) {
+	if t.Dial > 0 {
+		dial := transport.DialContext
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, t.Dial)
+			defer cancel()
+			return dial(ctx, network, addr)
+		}
+	}
+	if t.TLSHandshake > 0 {
+		transport.TLSHandshakeTimeout = t.TLSHandshake
+	}
+	if t.ResponseHeader > 0 {
+		transport.ResponseHeaderTimeout = t.ResponseHeader
+	}
+}
+
+// countedConn keeps the open connection gauge for its address up to date.
+type countedConn struct {
+	net.Conn
+	addr   string
+	closed sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closed.Do(func() {
+		metrics.UpstreamConnections.WithLabelValues(c.addr).Dec()
+	})
+	return c.Conn.Close()
+}
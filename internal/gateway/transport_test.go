@@ -0,0 +1,101 @@
+package gateway_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"aura-ai-gateway/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProxyHandler_UpstreamProxy(t *testing.T) {
+	// The mock proxy answers on behalf of an upstream that doesn't resolve,
+	// so the request can only succeed if it went through the proxy.
+	var proxiedHost string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: {\"usage\":{\"total_tokens\":5}}\n\ndata: [DONE]\n\n")
+	}))
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	upstreamURL, _ := url.Parse("http://upstream.invalid/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Client = &http.Client{Transport: gateway.NewUpstreamTransport(proxyURL)}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4"}`)))
+	rr := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 through the proxy, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if proxiedHost != "upstream.invalid" {
+		t.Errorf("expected the proxy to receive a request for upstream.invalid, got %q", proxiedHost)
+	}
+}
+
+func TestUpstreamTransport_ConnectionGauge(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	transport := gateway.NewUpstreamTransport(nil)
+	transport.MaxConnsPerHost = 1
+	client := &http.Client{Transport: transport}
+	addr := upstreamServer.Listener.Addr().String()
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(upstreamServer.URL)
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	if got := testutil.ToFloat64(metrics.UpstreamConnections.WithLabelValues(addr)); got != 1 {
+		t.Errorf("expected requests to share one connection, gauge is %v", got)
+	}
+
+	transport.CloseIdleConnections()
+	if got := testutil.ToFloat64(metrics.UpstreamConnections.WithLabelValues(addr)); got != 0 {
+		t.Errorf("expected the gauge to drop when the connection closes, got %v", got)
+	}
+}
+
+func TestProxyHandler_ResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Never send headers until the test is over
+		<-release
+	}))
+	defer upstreamServer.Close()
+	defer close(release)
+
+	transport := gateway.NewUpstreamTransport(nil)
+	gateway.UpstreamTimeouts{ResponseHeader: 50 * time.Millisecond}.Apply(transport)
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Client = &http.Client{Transport: transport}
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader([]byte(`{"model": "gpt-4"}`)))
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	proxyHandler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 after the header timeout, got %d", rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the handler to give up promptly, took %v", elapsed)
+	}
+}
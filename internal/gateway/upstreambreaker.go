@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// CircuitState is the state of an upstream's health circuit.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets a single probe through to test a recovering upstream.
+	CircuitHalfOpen
+	// CircuitOpen fails every request fast until the cooldown has passed.
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half_open"
+	case CircuitOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// DefaultBreakerCooldown is how long a circuit stays open before a probe is let through.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// UpstreamBreaker is a health circuit breaker for each upstream, unrelated to
+// the budget CircuitBreaker. After Threshold consecutive failures (connection
+// errors or 5xx responses) the upstream's circuit opens and requests fail fast
+// instead of piling onto it. Once Cooldown has passed, one probe request is
+// let through: its success closes the circuit and its failure reopens it.
+// A nil breaker lets every request through.
+type UpstreamBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	// Now is the clock used for cooldowns, time.Now when nil.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is one upstream's state.
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewUpstreamBreaker opens an upstream's circuit after threshold consecutive
+// failures, for cooldown.
+func NewUpstreamBreaker(threshold int, cooldown time.Duration) *UpstreamBreaker {
+	return &UpstreamBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+func (b *UpstreamBreaker) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
+
+// get returns the upstream's circuit, creating it closed. b.mu must be held.
+func (b *UpstreamBreaker) get(upstream string) *circuit {
+	c, ok := b.circuits[upstream]
+	if !ok {
+		c = &circuit{}
+		b.circuits[upstream] = c
+	}
+	return c
+}
+
+// set moves the circuit to state, updating the gauge. b.mu must be held.
+func (b *UpstreamBreaker) set(upstream string, c *circuit, state CircuitState) {
+	if c.state != state {
+		slog.Warn("Upstream circuit changed state", "upstream", upstream, "from", c.state.String(), "to", state.String())
+	}
+	c.state = state
+	metrics.CircuitState.WithLabelValues(upstream).Set(float64(state))
+}
+
+// Allow reports whether a request may be sent to the upstream, and otherwise
+// how long until the circuit lets a probe through. A request it allows must
+// be followed by exactly one of Success, Failure or Cancel.
+func (b *UpstreamBreaker) Allow(upstream string) (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.get(upstream)
+	switch c.state {
+	case CircuitOpen:
+		if wait := c.openedAt.Add(b.Cooldown).Sub(b.now()); wait > 0 {
+			return false, wait
+		}
+		b.set(upstream, c, CircuitHalfOpen)
+		c.probing = true
+		return true, 0
+	case CircuitHalfOpen:
+		if c.probing {
+			return false, b.Cooldown
+		}
+		c.probing = true
+		return true, 0
+	}
+	return true, 0
+}
+
+// Success records a healthy response, closing the circuit.
+func (b *UpstreamBreaker) Success(upstream string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.get(upstream)
+	c.failures = 0
+	c.probing = false
+	b.set(upstream, c, CircuitClosed)
+}
+
+// Failure records a failed request, opening the circuit once Threshold
+// failures have happened in a row, or at once if it was the probe.
+func (b *UpstreamBreaker) Failure(upstream string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.get(upstream)
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= b.Threshold {
+		c.probing = false
+		c.openedAt = b.now()
+		b.set(upstream, c, CircuitOpen)
+	}
+}
+
+// Cancel records a request that ended without saying anything about the
+// upstream's health, e.g. because the client went away, so another probe
+// may be sent.
+func (b *UpstreamBreaker) Cancel(upstream string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.get(upstream).probing = false
+}
+
+// observe records the outcome of a request Allow let through: connection
+// errors and 5xx responses are failures, unless ctx ended first, as the client
+// leaving or running out of time says nothing about the upstream.
+func (b *UpstreamBreaker) observe(ctx context.Context, upstream string, resp *http.Response, err error) {
+	switch {
+	case err != nil && ctx.Err() != nil:
+		b.Cancel(upstream)
+	case err != nil || resp.StatusCode >= 500:
+		b.Failure(upstream)
+	default:
+		b.Success(upstream)
+	}
+}
+
+// State returns the upstream's circuit state.
+func (b *UpstreamBreaker) State(upstream string) CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.get(upstream).state
+}
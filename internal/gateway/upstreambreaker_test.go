@@ -0,0 +1,212 @@
+package gateway_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+	"aura-ai-gateway/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpstreamBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := gateway.NewUpstreamBreaker(3, 30*time.Second)
+	breaker.Now = func() time.Time { return now }
+	const upstream = "api.test"
+
+	for i := 0; i < 2; i++ {
+		breaker.Allow(upstream)
+		breaker.Failure(upstream)
+	}
+	if state := breaker.State(upstream); state != gateway.CircuitClosed {
+		t.Fatalf("expected the circuit to stay closed below the threshold, got %v", state)
+	}
+	breaker.Allow(upstream)
+	breaker.Failure(upstream)
+	if state := breaker.State(upstream); state != gateway.CircuitOpen {
+		t.Fatalf("expected the circuit to open after 3 failures, got %v", state)
+	}
+	if allowed, wait := breaker.Allow(upstream); allowed || wait != 30*time.Second {
+		t.Errorf("expected requests to fail fast for the cooldown, got allowed=%v wait=%v", allowed, wait)
+	}
+	if got := testutil.ToFloat64(metrics.CircuitState.WithLabelValues(upstream)); got != 2 {
+		t.Errorf("expected the gauge to report open (2), got %v", got)
+	}
+
+	// After the cooldown a single probe is let through
+	now = now.Add(30 * time.Second)
+	if allowed, _ := breaker.Allow(upstream); !allowed {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	if state := breaker.State(upstream); state != gateway.CircuitHalfOpen {
+		t.Errorf("expected the circuit to be half-open, got %v", state)
+	}
+	if allowed, _ := breaker.Allow(upstream); allowed {
+		t.Error("expected only one probe at a time")
+	}
+
+	// A failed probe reopens the circuit at once
+	breaker.Failure(upstream)
+	if allowed, _ := breaker.Allow(upstream); allowed {
+		t.Error("expected the failed probe to reopen the circuit")
+	}
+
+	// A successful probe closes it
+	now = now.Add(30 * time.Second)
+	breaker.Allow(upstream)
+	breaker.Success(upstream)
+	if state := breaker.State(upstream); state != gateway.CircuitClosed {
+		t.Errorf("expected the successful probe to close the circuit, got %v", state)
+	}
+	if allowed, _ := breaker.Allow(upstream); !allowed {
+		t.Error("expected requests to flow once the circuit closed")
+	}
+	if got := testutil.ToFloat64(metrics.CircuitState.WithLabelValues(upstream)); got != 0 {
+		t.Errorf("expected the gauge to report closed (0), got %v", got)
+	}
+}
+
+func TestUpstreamBreaker_CancelledProbe(t *testing.T) {
+	now := time.Now()
+	breaker := gateway.NewUpstreamBreaker(1, time.Second)
+	breaker.Now = func() time.Time { return now }
+
+	breaker.Allow("api.test")
+	breaker.Failure("api.test")
+	now = now.Add(time.Second)
+	breaker.Allow("api.test")
+	breaker.Cancel("api.test")
+
+	if allowed, _ := breaker.Allow("api.test"); !allowed {
+		t.Error("expected another probe once the first was cancelled")
+	}
+}
+
+func TestProxyHandler_UpstreamBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var hits atomic.Int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	now := time.Now()
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Breaker = gateway.NewUpstreamBreaker(2, 10*time.Second)
+	proxyHandler.Breaker.Now = func() time.Time { return now }
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-4o", "stream": true}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := send(); rr.Code != http.StatusBadGateway {
+			t.Fatalf("expected the upstream's 502, got %d", rr.Code)
+		}
+	}
+
+	rr := send()
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the open circuit to fail fast with 503, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "10" {
+		t.Errorf("expected Retry-After of the 10s cooldown, got %q", rr.Header().Get("Retry-After"))
+	}
+	if hits.Load() != 2 {
+		t.Errorf("expected the open circuit to spare the upstream, got %d requests", hits.Load())
+	}
+
+	// The upstream recovers and the probe after the cooldown closes the circuit
+	healthy.Store(true)
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 2; i++ {
+		if rr := send(); rr.Code != http.StatusOK {
+			t.Fatalf("expected recovery after the cooldown, got %d", rr.Code)
+		}
+	}
+}
+
+func TestProxyHandler_UpstreamBreakerPerReplica(t *testing.T) {
+	var failingHits, healthyHits atomic.Int32
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingHits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+	failingURL, _ := url.Parse(failingServer.URL + "/v1/chat/completions")
+	healthy := countingReplica(t, &healthyHits, nil)
+
+	pool, _ := gateway.NewUpstreamPool([]gateway.Replica{{URL: failingURL, Weight: 1}, healthy}, gateway.RoundRobin)
+	upstreamURL, _ := url.Parse("http://upstream.invalid/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Upstreams = pool
+	proxyHandler.Breaker = gateway.NewUpstreamBreaker(1, 10*time.Second)
+
+	// The failing replica's 500 opens its own circuit only
+	if rr := sendPooled(proxyHandler); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the failing replica's 500, got %d", rr.Code)
+	}
+	for i := 0; i < 3; i++ {
+		if rr := sendPooled(proxyHandler); rr.Code != http.StatusOK {
+			t.Fatalf("expected request %d to be served by the healthy replica, got %d", i+1, rr.Code)
+		}
+	}
+	if failingHits.Load() != 1 || healthyHits.Load() != 3 {
+		t.Errorf("expected the open replica to be skipped, got %d failing and %d healthy requests", failingHits.Load(), healthyHits.Load())
+	}
+}
+
+func TestProxyHandler_UpstreamBreakerAllReplicasOpen(t *testing.T) {
+	failing := func() gateway.Replica {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(server.Close)
+		u, _ := url.Parse(server.URL + "/v1/chat/completions")
+		return gateway.Replica{URL: u, Weight: 1}
+	}
+
+	now := time.Now()
+	pool, _ := gateway.NewUpstreamPool([]gateway.Replica{failing(), failing()}, gateway.RoundRobin)
+	upstreamURL, _ := url.Parse("http://upstream.invalid/v1/chat/completions")
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.Upstreams = pool
+	proxyHandler.Breaker = gateway.NewUpstreamBreaker(1, 30*time.Second)
+	proxyHandler.Breaker.Now = func() time.Time { return now }
+
+	sendPooled(proxyHandler)
+	now = now.Add(10 * time.Second)
+	sendPooled(proxyHandler)
+	now = now.Add(5 * time.Second)
+
+	// The first circuit lets a probe through 15s from now, the second in 25s
+	rr := sendPooled(proxyHandler)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with every replica's circuit open, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "15" {
+		t.Errorf("expected Retry-After of the soonest probe, got %q", got)
+	}
+	if !strings.Contains(rr.Body.String(), "all_circuits_open") {
+		t.Errorf("expected the error to say every replica is open, got %q", rr.Body.String())
+	}
+}
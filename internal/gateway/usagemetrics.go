@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// UsageScraper publishes fleet usage gauges: the number of active keys and
+// the usage per tier. Listing walks the whole store, so it runs on a timer in
+// the background rather than on the request path.
+type UsageScraper struct {
+	Lister UsageLister
+	// TierFor maps a key to its tier, DefaultTier for every key when nil.
+	TierFor func(apiKey string) string
+}
+
+// NewUsageScraper initializes a scraper over the given store.
+func NewUsageScraper(lister UsageLister, tierFor func(apiKey string) string) *UsageScraper {
+	return &UsageScraper{Lister: lister, TierFor: tierFor}
+}
+
+// Scrape lists every key's usage once and updates the gauges. Tiers that no
+// longer have any keys are dropped.
+func (s *UsageScraper) Scrape() error {
+	usages, err := s.Lister.ListUsage()
+	if err != nil {
+		return err
+	}
+
+	active := 0
+	tiers := make(map[string]int64)
+	for _, u := range usages {
+		if u.CostMicroDollars <= 0 {
+			continue
+		}
+		active++
+		tier := DefaultTier
+		if s.TierFor != nil {
+			tier = s.TierFor(u.APIKey)
+		}
+		tiers[tier] += u.CostMicroDollars
+	}
+
+	metrics.ActiveKeys.Set(float64(active))
+	metrics.TierUsage.Reset()
+	for tier, usage := range tiers {
+		metrics.TierUsage.WithLabelValues(tier).Set(float64(usage))
+	}
+	return nil
+}
+
+// Run scrapes immediately and then every interval until ctx is cancelled.
+func (s *UsageScraper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Scrape(); err != nil {
+			slog.Error("Failed to scrape usage metrics", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package gateway_test
+
+import (
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+	"aura-ai-gateway/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUsageScraper(t *testing.T) {
+	cb := gateway.NewMemoryCircuitBreaker()
+	cb.AddUsage("premium-key", 4000)
+	cb.AddUsage("free-key-1", 1000)
+	cb.AddUsage("free-key-2", 500)
+	cb.SetUsage("idle-key", 0)
+
+	tiers := map[string]string{"premium-key": "premium"}
+	scraper := gateway.NewUsageScraper(cb, func(apiKey string) string {
+		if tier, ok := tiers[apiKey]; ok {
+			return tier
+		}
+		return gateway.DefaultTier
+	})
+	if err := scraper.Scrape(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.ActiveKeys); got != 3 {
+		t.Errorf("expected 3 active keys, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.TierUsage.WithLabelValues("premium")); got != 4000 {
+		t.Errorf("expected 4000 micro-dollars for the premium tier, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.TierUsage.WithLabelValues(gateway.DefaultTier)); got != 1500 {
+		t.Errorf("expected 1500 micro-dollars for the default tier, got %v", got)
+	}
+
+	// Added usage shows up on the next scrape
+	cb.AddUsage("idle-key", 250)
+	scraper.Scrape()
+	if got := testutil.ToFloat64(metrics.ActiveKeys); got != 4 {
+		t.Errorf("expected 4 active keys after new usage, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.TierUsage.WithLabelValues(gateway.DefaultTier)); got != 1750 {
+		t.Errorf("expected 1750 micro-dollars for the default tier, got %v", got)
+	}
+}
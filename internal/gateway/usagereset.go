@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"aura-ai-gateway/internal/observability"
+)
+
+// UsageResetRequest is the body of POST /v1/admin/usage/reset.
+type UsageResetRequest struct {
+	APIKey          string `json:"api_key"`
+	SetMicroDollars *int64 `json:"set_micro_dollars"`
+}
+
+// UsageResetResponse reports a key's usage before and after an adjustment.
+type UsageResetResponse struct {
+	APIKey               string `json:"api_key"`
+	PreviousMicroDollars int64  `json:"previous_micro_dollars"`
+	UsageMicroDollars    int64  `json:"usage_micro_dollars"`
+}
+
+// UsageResetHandler serves POST /v1/admin/usage/reset, overwriting a key's
+// usage so support can settle billing disputes without editing the store by
+// hand. Every adjustment is logged with the previous figure. Requests in flight
+// settle their reservations against the new figure; the stores clamp usage at
+// zero, so a refund after a reset can't leave the key with free budget.
+type UsageResetHandler struct {
+	CircuitBreaker CircuitBreaker
+	AdminToken     string
+}
+
+// NewUsageResetHandler initializes a reset handler over the given store.
+func NewUsageResetHandler(cb CircuitBreaker, adminToken string) *UsageResetHandler {
+	return &UsageResetHandler{
+		CircuitBreaker: cb,
+		AdminToken:     adminToken,
+	}
+}
+
+func (h *UsageResetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+		return
+	}
+	if !requireAdmin(w, r, h.AdminToken) {
+		return
+	}
+
+	var req UsageResetRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_json", "Bad Request: invalid JSON")
+		return
+	}
+	if req.APIKey == "" || req.SetMicroDollars == nil || *req.SetMicroDollars < 0 {
+		WriteError(w, http.StatusBadRequest, "missing_required_parameter", "Bad Request: api_key and a non-negative set_micro_dollars are required")
+		return
+	}
+
+	previous, err := h.CircuitBreaker.GetUsage(req.APIKey)
+	if err != nil {
+		slog.Error("Failed to read usage for reset", observability.APIKeyAttr(req.APIKey), "error", err)
+		WriteError(w, http.StatusInternalServerError, "usage_store_error", "Failed to retrieve usage")
+		return
+	}
+	if err := h.CircuitBreaker.SetUsage(req.APIKey, *req.SetMicroDollars); err != nil {
+		slog.Error("Failed to reset usage", observability.APIKeyAttr(req.APIKey), "error", err)
+		WriteError(w, http.StatusInternalServerError, "usage_store_error", "Failed to write usage")
+		return
+	}
+	slog.Info("Usage adjusted by admin", observability.APIKeyAttr(req.APIKey),
+		"previous_micro_dollars", previous, "usage_micro_dollars", *req.SetMicroDollars)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UsageResetResponse{
+		APIKey:               req.APIKey,
+		PreviousMicroDollars: previous,
+		UsageMicroDollars:    *req.SetMicroDollars,
+	})
+}
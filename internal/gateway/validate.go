@@ -0,0 +1,18 @@
+package gateway
+
+import "strings"
+
+// validateRequest returns why a completion request can't be served, or "" if
+// it can: every request needs a model to be routed and priced, and chat
+// completions need at least one message.
+func validateRequest(route string, payload map[string]interface{}) string {
+	if model, _ := payload["model"].(string); model == "" {
+		return "model is required"
+	}
+	if strings.HasSuffix(route, "/chat/completions") {
+		if messages, _ := payload["messages"].([]interface{}); len(messages) == 0 {
+			return "messages is required and must not be empty"
+		}
+	}
+	return ""
+}
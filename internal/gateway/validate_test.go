@@ -0,0 +1,92 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestProxyHandler_ValidateRequests(t *testing.T) {
+	var hits atomic.Int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+	proxyHandler.ValidateRequests = true
+
+	tests := []struct {
+		name    string
+		route   string
+		body    string
+		message string
+	}{
+		{name: "missing model", route: "/v1/chat/completions", body: `{"messages": [{"role": "user", "content": "hi"}]}`, message: "model is required"},
+		{name: "empty model", route: "/v1/chat/completions", body: `{"model": "", "messages": [{"role": "user", "content": "hi"}]}`, message: "model is required"},
+		{name: "missing messages", route: "/v1/chat/completions", body: `{"model": "gpt-4o"}`, message: "messages is required and must not be empty"},
+		{name: "empty messages", route: "/v1/chat/completions", body: `{"model": "gpt-4o", "messages": []}`, message: "messages is required and must not be empty"},
+		{name: "valid chat", route: "/v1/chat/completions", body: `{"model": "gpt-4o", "stream": true, "messages": [{"role": "user", "content": "hi"}]}`},
+		{name: "completion without messages", route: "/v1/completions", body: `{"model": "gpt-3.5-turbo-instruct", "stream": true, "prompt": "hi"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := hits.Load()
+			req := httptest.NewRequest("POST", tt.route, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer test-key")
+			rr := httptest.NewRecorder()
+			proxyHandler.ServeHTTP(rr, req)
+
+			if tt.message == "" {
+				if rr.Code != http.StatusOK {
+					t.Errorf("expected the request to be forwarded, got %d: %s", rr.Code, rr.Body.String())
+				}
+				return
+			}
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d", rr.Code)
+			}
+			var body gateway.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("expected a JSON error body: %v", err)
+			}
+			if body.Error.Message != tt.message || body.Error.Type != "invalid_request_error" {
+				t.Errorf("expected invalid_request_error %q, got %+v", tt.message, body.Error)
+			}
+			if hits.Load() != before {
+				t.Error("expected the invalid request not to reach the upstream")
+			}
+		})
+	}
+}
+
+func TestProxyHandler_ValidateRequestsDisabled(t *testing.T) {
+	var hits atomic.Int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer upstreamServer.Close()
+
+	upstreamURL, _ := url.Parse(upstreamServer.URL)
+	proxyHandler := gateway.NewProxyHandler(upstreamURL, &MockCircuitBreaker{Allowed: true}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"messages": []}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	proxyHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if hits.Load() != 1 {
+		t.Error("expected requests to be forwarded unvalidated by default")
+	}
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"fmt"
+	"time"
+)
+
+// UsageWindow is the billing period after which every key's usage resets.
+// Windows are aligned to calendar boundaries in UTC, so all keys reset together.
+type UsageWindow string
+
+const (
+	WindowNone    UsageWindow = "none"
+	WindowDaily   UsageWindow = "daily"
+	WindowMonthly UsageWindow = "monthly"
+)
+
+// ParseUsageWindow validates a window name. An empty name means WindowNone.
+func ParseUsageWindow(s string) (UsageWindow, error) {
+	switch w := UsageWindow(s); w {
+	case "", WindowNone:
+		return WindowNone, nil
+	case WindowDaily, WindowMonthly:
+		return w, nil
+	}
+	return "", fmt.Errorf("unknown usage window %q: expected daily, monthly or none", s)
+}
+
+// ResetsAt returns the end of the window containing now, or the zero time
+// when usage never resets.
+func (w UsageWindow) ResetsAt(now time.Time) time.Time {
+	now = now.UTC()
+	switch w {
+	case WindowDaily:
+		return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	case WindowMonthly:
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// UsageResetter is implemented by stores whose usage resets each window.
+type UsageResetter interface {
+	// ResetsAt returns when the current window ends, or the zero time if never.
+	ResetsAt() time.Time
+}
+
+// windowEnded reports whether the window ending at resetsAt, as read from
+// ResetTime when a reservation was charged, has since ended in cb.
+func windowEnded(cb interface{}, resetsAt time.Time) bool {
+	if resetsAt.IsZero() {
+		return false
+	}
+	current := ResetTime(cb)
+	return current != nil && current.After(resetsAt)
+}
+
+// Charge returns what the record still adds to the key's usage in cb: its cost
+// less the reservation already charged, or the whole cost once the window the
+// reservation was charged in has ended, since the reservation was cleared
+// with that window and subtracting it would leave the new one short.
+func (u UsageRecord) Charge(cb CircuitBreaker) int64 {
+	if windowEnded(cb, u.ReservationResetsAt) {
+		return u.CostMicroDollars
+	}
+	return u.CostMicroDollars - u.ReservedMicroDollars
+}
+
+// ResetTime returns when the key's usage in cb next resets, or nil if it never does.
+func ResetTime(cb interface{}) *time.Time {
+	if resetter, ok := cb.(UsageResetter); ok {
+		if resetsAt := resetter.ResetsAt(); !resetsAt.IsZero() {
+			return &resetsAt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package gateway_test
+
+import (
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/gateway"
+)
+
+func TestUsageWindow_ResetsAt(t *testing.T) {
+	now := time.Date(2026, time.December, 31, 17, 4, 5, 0, time.FixedZone("PST", -8*3600))
+	cases := map[gateway.UsageWindow]time.Time{
+		// 17:04 PST is already the next day in UTC
+		gateway.WindowDaily:   time.Date(2027, time.January, 2, 0, 0, 0, 0, time.UTC),
+		gateway.WindowMonthly: time.Date(2027, time.February, 1, 0, 0, 0, 0, time.UTC),
+		gateway.WindowNone:    {},
+	}
+	for window, want := range cases {
+		if got := window.ResetsAt(now); !got.Equal(want) {
+			t.Errorf("%s: expected reset at %v, got %v", window, want, got)
+		}
+	}
+}
+
+func TestParseUsageWindow(t *testing.T) {
+	if w, err := gateway.ParseUsageWindow(""); err != nil || w != gateway.WindowNone {
+		t.Errorf("expected an empty window to mean none, got %q (err=%v)", w, err)
+	}
+	if w, err := gateway.ParseUsageWindow("monthly"); err != nil || w != gateway.WindowMonthly {
+		t.Errorf("expected monthly, got %q (err=%v)", w, err)
+	}
+	if _, err := gateway.ParseUsageWindow("weekly"); err == nil {
+		t.Error("expected an unknown window to be rejected")
+	}
+}
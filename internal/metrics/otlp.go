@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	prometheusbridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// OTLPConfig configures exporting metrics to an OpenTelemetry collector over OTLP/HTTP.
+type OTLPConfig struct {
+	// EndpointURL is the collector's metrics URL, e.g. http://otel-collector:4318/v1/metrics.
+	EndpointURL string
+	// Interval is how often metrics are pushed. Defaults to one minute.
+	Interval time.Duration
+}
+
+// StartOTLPExport periodically pushes every metric registered with the default
+// Prometheus registry to an OTLP collector. Bridging the registry means both
+// pipelines report the same measurements. The returned function flushes any
+// pending export and stops the exporter.
+func StartOTLPExport(ctx context.Context, cfg OTLPConfig) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(cfg.EndpointURL))
+	if err != nil {
+		return nil, err
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(prometheusbridge.NewMetricProducer()),
+	)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return provider.Shutdown, nil
+}
@@ -1,19 +1,43 @@
 package metrics
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
-	// RequestLatency tracks the latency of incoming completions requests.
+	// StreamingLatencyBuckets suit total request duration, where streams routinely run for minutes.
+	StreamingLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 45, 60, 90, 120, 180, 240, 300}
+
+	// TTFBBuckets are fine-grained, mostly sub-second buckets for time to first byte.
+	TTFBBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2, 3, 5, 10}
+)
+
+var (
+	// RequestLatency tracks the total duration of incoming completions requests.
+	// Buckets can be overridden with LATENCY_BUCKETS (comma-separated seconds).
 	RequestLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "aura_ai_gateway_request_latency_seconds",
 		Help:    "Latency of /v1/chat/completions requests.",
-		Buckets: prometheus.DefBuckets,
+		Buckets: bucketsFromEnv("LATENCY_BUCKETS", StreamingLatencyBuckets),
 	}, []string{"status"})
 
-	// TotalTokens tracks total token usage per API key.
+	// TimeToFirstByte tracks how long clients wait for the first streamed byte.
+	// Buckets can be overridden with TTFB_BUCKETS (comma-separated seconds).
+	TimeToFirstByte = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "aura_ai_gateway_time_to_first_byte_seconds",
+		Help:    "Time from receiving a request to streaming its first byte to the client.",
+		Buckets: bucketsFromEnv("TTFB_BUCKETS", TTFBBuckets),
+	})
+
+	// TotalTokens tracks total token usage per API key, labeled by HashAPIKey.
 	TotalTokens = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "aura_ai_gateway_total_tokens",
 		Help: "Total tokens consumed through the proxy.",
@@ -25,3 +49,304 @@ var (
 		Help: "Total errors encountered by the proxy.",
 	}, []string{"type"})
 )
+
+var (
+	// AdmissionQueueDepth tracks requests waiting for a connection slot per priority tier.
+	AdmissionQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aura_ai_gateway_admission_queue_depth",
+		Help: "Requests currently queued for a connection slot.",
+	}, []string{"tier"})
+
+	// AdmissionQueueWait tracks how long admitted requests waited for a slot per priority tier.
+	AdmissionQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aura_ai_gateway_admission_queue_wait_seconds",
+		Help:    "Time requests spent queued before being admitted.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"tier"})
+
+	// AdmissionRejections tracks requests rejected by admission control per priority tier.
+	AdmissionRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aura_ai_gateway_admission_rejections_total",
+		Help: "Requests rejected because no connection slot became available.",
+	}, []string{"tier", "reason"})
+)
+
+// JSONModeEnforced tracks requests whose response_format was forced to JSON mode.
+var JSONModeEnforced = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_json_mode_enforced_total",
+	Help: "Requests whose response_format was injected or overridden to json_object.",
+}, []string{"action"})
+
+// StreamInterrupted tracks upstream streams that failed after the response had started.
+var StreamInterrupted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_stream_interrupted_total",
+	Help: "Upstream streams interrupted mid-response.",
+})
+
+// TPMUtilization tracks each key's share of its tokens-per-minute limit in use,
+// labeled by HashAPIKey.
+var TPMUtilization = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_tpm_utilization_ratio",
+	Help: "Fraction of the key's tokens-per-minute limit used in the current window.",
+}, []string{"api_key"})
+
+// StaleResponses tracks cached responses served because the upstream failed.
+var StaleResponses = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_stale_responses_total",
+	Help: "Stale cached responses served in place of a failed upstream call.",
+})
+
+// CacheLookups tracks response cache lookups for deterministic requests, by result (hit or miss).
+var CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_cache_lookups_total",
+	Help: "Response cache lookups for deterministic requests, by result.",
+}, []string{"result"})
+
+// ClientSDKRequests tracks requests by normalized client SDK.
+var ClientSDKRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_client_sdk_requests_total",
+	Help: "Requests by client SDK parsed from the User-Agent header.",
+}, []string{"sdk"})
+
+var (
+	// DegradedMode is 1 while the usage store is unavailable and billing is buffered locally.
+	DegradedMode = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "aura_ai_gateway_degraded_mode",
+		Help: "Whether the gateway is failing open with buffered billing (1) or not (0).",
+	})
+
+	// BufferedUsage tracks usage cost held in memory until the usage store recovers.
+	BufferedUsage = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "aura_ai_gateway_buffered_usage_micro_dollars",
+		Help: "Usage cost buffered locally while the usage store is unavailable.",
+	})
+)
+
+// StreamTimeouts tracks streams cut off for exceeding their maximum duration.
+var StreamTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_stream_timeouts_total",
+	Help: "Upstream requests canceled by the gateway's maximum stream duration.",
+})
+
+// BufferedBytes tracks request and response bytes currently held in memory.
+var BufferedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_buffered_bytes",
+	Help: "Request and response bytes buffered in memory across in-flight requests.",
+})
+
+// PayloadSizeBuckets span a one-line prompt to a long multimodal conversation, in bytes.
+var PayloadSizeBuckets = prometheus.ExponentialBuckets(256, 4, 10)
+
+// RequestBytes tracks the size of request bodies as forwarded upstream.
+var RequestBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "aura_ai_gateway_request_bytes",
+	Help:    "Size of request bodies sent to the upstream, in bytes.",
+	Buckets: PayloadSizeBuckets,
+})
+
+// ResponseBytes tracks the size of response bodies as written to the client,
+// after any compression.
+var ResponseBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "aura_ai_gateway_response_bytes",
+	Help:    "Size of response bodies relayed to the client, in bytes.",
+	Buckets: PayloadSizeBuckets,
+})
+
+// IngestInFlight tracks request bodies currently being read.
+var IngestInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_ingest_in_flight",
+	Help: "Request bodies currently being read from clients.",
+})
+
+// PromptFilterRejections tracks requests rejected by the prompt denylist per rule.
+var PromptFilterRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_prompt_filter_rejections_total",
+	Help: "Requests rejected because their prompt matched a denylist rule.",
+}, []string{"rule"})
+
+// ResponseTruncated tracks upstream responses cut off at the maximum response size.
+var ResponseTruncated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_response_truncated_total",
+	Help: "Upstream responses cut off for exceeding the maximum response size.",
+})
+
+// AudioTokens tracks audio tokens billed, by direction (input or output).
+var AudioTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_audio_tokens_total",
+	Help: "Audio tokens consumed through the proxy.",
+}, []string{"direction"})
+
+// InjectedFieldRejections tracks upstream 400s rejecting a field the gateway injected.
+var InjectedFieldRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_injected_field_rejections_total",
+	Help: "Upstream 400 responses that reference a field injected by the gateway.",
+}, []string{"field"})
+
+// EgressRateLimit reports the sustained rate at which requests are dispatched upstream.
+var EgressRateLimit = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_egress_rate_limit",
+	Help: "Configured sustained rate of upstream requests per second.",
+})
+
+// EgressQueueWait tracks how long requests waited for the egress rate limiter.
+var EgressQueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "aura_ai_gateway_egress_queue_wait_seconds",
+	Help:    "Time requests waited before being dispatched upstream.",
+	Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+})
+
+// EgressRejections tracks requests rejected because the egress queue wait was too long.
+var EgressRejections = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_egress_rejections_total",
+	Help: "Requests rejected because dispatching them upstream would have waited too long.",
+})
+
+// UpstreamConnections tracks open connections to each upstream (or proxy) address.
+var UpstreamConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_upstream_connections",
+	Help: "Open TCP connections to each upstream host.",
+}, []string{"host"})
+
+// InconsistentUsage tracks upstream usage blocks whose total is below prompt plus completion.
+var InconsistentUsage = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_inconsistent_usage_total",
+	Help: "Upstream usage reports with total_tokens below prompt_tokens plus completion_tokens.",
+}, []string{"model"})
+
+// RetryBudgetUtilization reports the fraction of the retry budget currently spent.
+var RetryBudgetUtilization = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_retry_budget_utilization",
+	Help: "Fraction of the upstream retry budget currently spent, from 0 to 1.",
+})
+
+// RetryBudgetExhausted tracks retries suppressed because the retry budget was spent.
+var RetryBudgetExhausted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_retry_budget_exhausted_total",
+	Help: "Upstream retries suppressed because the retry budget was exhausted.",
+})
+
+// UpstreamRetries tracks upstream retries by whether the retried attempt succeeded.
+var UpstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_upstream_retries_total",
+	Help: "Upstream request attempts retried after a connection error or 5xx, by outcome.",
+}, []string{"outcome"})
+
+// ActiveKeys tracks keys with usage in the current window, as of the last usage scrape.
+var ActiveKeys = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_active_keys",
+	Help: "Keys with non-zero usage in the current window, as of the last usage scrape.",
+})
+
+// TierUsage tracks the usage in the current window summed per tier, as of the last usage scrape.
+var TierUsage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_usage_micro_dollars",
+	Help: "Usage in the current window in micro-dollars, summed per tier as of the last usage scrape.",
+}, []string{"tier"})
+
+// CircuitState tracks each upstream's health circuit: 0 closed, 1 half-open, 2 open.
+var CircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_circuit_state",
+	Help: "State of each upstream's health circuit breaker: 0 closed, 1 half-open, 2 open.",
+}, []string{"upstream"})
+
+// UpstreamSelected tracks requests sent to each replica of the upstream pool,
+// including failover attempts.
+var UpstreamSelected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_upstream_selected_total",
+	Help: "Upstream requests sent to each replica of the upstream pool, by replica host.",
+}, []string{"replica"})
+
+// UsageDropped tracks usage records that didn't fit the usage channel, whether
+// they were dead-lettered or lost.
+var UsageDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_usage_dropped_total",
+	Help: "Usage records that couldn't be queued for billing because the usage channel was full.",
+})
+
+// PromptTokens and CompletionTokens split billed tokens by direction per model,
+// for invoices and pricing that treat input and output differently.
+var (
+	PromptTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aura_ai_gateway_prompt_tokens",
+		Help: "Prompt tokens consumed through the proxy.",
+	}, []string{"model"})
+	CompletionTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aura_ai_gateway_completion_tokens",
+		Help: "Completion tokens generated through the proxy.",
+	}, []string{"model"})
+)
+
+// RateLimited tracks requests rejected with a 429 by the per-key rate limits,
+// by limit (rpm, tpm or concurrency).
+var RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_ratelimited_total",
+	Help: "Requests rejected because the key exceeded a rate limit.",
+}, []string{"limit"})
+
+// ConcurrentRequests tracks each key's requests in flight on this replica,
+// labeled by HashAPIKey.
+var ConcurrentRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aura_ai_gateway_concurrent_requests",
+	Help: "Requests the key currently has in flight.",
+}, []string{"api_key"})
+
+// LimitExceeded tracks requests rejected with a 402 per key, labeled by HashAPIKey.
+var LimitExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_limit_exceeded_total",
+	Help: "Requests rejected because the key exceeded its usage limit.",
+}, []string{"api_key"})
+
+// HashAPIKey returns the label value identifying a key in metrics: the first
+// 8 hex characters of its SHA-256. Raw keys are secrets and must never become
+// label values, and the short hash is enough to pick a key out of a dashboard.
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:4])
+}
+
+// ToolCallRounds tracks how many tool-call rounds agent requests have run.
+var ToolCallRounds = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "aura_ai_gateway_tool_call_rounds",
+	Help:    "Tool-call rounds in the conversation of requests that used tools.",
+	Buckets: []float64{1, 2, 3, 5, 10, 20, 50, 100},
+})
+
+// ToolCallRoundsExceeded tracks requests over the tool-call round limit, by
+// whether they were only flagged or rejected.
+var ToolCallRoundsExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_tool_call_rounds_exceeded_total",
+	Help: "Requests exceeding the configured tool-call round limit.",
+}, []string{"action"})
+
+// UnpricedUsage tracks usage billed at the flat fallback rate because the model has no price.
+var UnpricedUsage = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "aura_ai_gateway_unpriced_usage_total",
+	Help: "Usage records priced at the flat fallback rate because their model has no configured price.",
+}, []string{"model"})
+
+// bucketsFromEnv reads histogram buckets from a comma-separated environment
+// variable, falling back to def when it is unset or invalid.
+func bucketsFromEnv(name string, def []float64) []float64 {
+	buckets, ok := parseBuckets(os.Getenv(name))
+	if !ok {
+		return def
+	}
+	return buckets
+}
+
+// parseBuckets parses comma-separated bucket bounds into sorted order.
+func parseBuckets(s string) ([]float64, bool) {
+	if strings.TrimSpace(s) == "" {
+		return nil, false
+	}
+	var buckets []float64
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, false
+		}
+		buckets = append(buckets, v)
+	}
+	sort.Float64s(buckets)
+	return buckets, true
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []float64
+		ok   bool
+	}{
+		{in: "0.5, 1,30,300", want: []float64{0.5, 1, 30, 300}, ok: true},
+		{in: "60,1,10", want: []float64{1, 10, 60}, ok: true},
+		{in: "", ok: false},
+		{in: "1,fast", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseBuckets(tt.in)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseBuckets(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	// First 8 hex characters of sha256("test-key")
+	got := HashAPIKey("test-key")
+	if got != "62af8704" {
+		t.Errorf("HashAPIKey(test-key) = %q, want 62af8704", got)
+	}
+	if HashAPIKey("other-key") == got {
+		t.Error("expected different keys to hash differently")
+	}
+}
@@ -0,0 +1,94 @@
+package observability
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// AccessLogPolicy controls which requests the access log records. Failed and
+// slow requests are always logged; the rest are sampled.
+type AccessLogPolicy struct {
+	// SampleRate is the fraction of ordinary requests logged, from 0 to 1.
+	SampleRate float64
+	// SlowThreshold marks requests that are always logged. Zero disables it.
+	SlowThreshold time.Duration
+}
+
+// AccessLog logs requests served by next according to the policy. Requests
+// without a RequestIDHeader are assigned one before next sees them.
+func AccessLog(logger *slog.Logger, policy AccessLogPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = NewRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		sw := NewStatusWriter(w)
+		next.ServeHTTP(sw, r)
+		duration := time.Since(start)
+
+		status := sw.Status()
+		sdk := ParseUserAgent(r.UserAgent())
+		attrs := []any{"request_id", requestID, "method", r.Method, "path", r.URL.Path, "status", status, "latency_sec", duration.Seconds(),
+			"sdk", sdk.Name, "sdk_version", sdk.Version}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.Error("Request failed", attrs...)
+		case status >= http.StatusBadRequest:
+			logger.Warn("Request rejected", attrs...)
+		case policy.SlowThreshold > 0 && duration >= policy.SlowThreshold:
+			logger.Warn("Slow request", attrs...)
+		case policy.SampleRate >= 1 || rand.Float64() < policy.SampleRate:
+			logger.Info("Request processed", attrs...)
+		}
+	})
+}
+
+// StatusWriter records the status code written through it. It passes flushes
+// through so streamed responses keep working.
+type StatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// NewStatusWriter wraps w to record its status code.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w}
+}
+
+func (w *StatusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *StatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *StatusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the status code sent, or 200 if the handler wrote nothing.
+func (w *StatusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
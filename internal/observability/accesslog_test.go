@@ -0,0 +1,68 @@
+package observability_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aura-ai-gateway/internal/observability"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		delay   time.Duration
+		policy  observability.AccessLogPolicy
+		message string // empty when nothing should be logged
+	}{
+		{name: "sampled out", status: http.StatusOK, policy: observability.AccessLogPolicy{SampleRate: 0}},
+		{name: "sampled in", status: http.StatusOK, policy: observability.AccessLogPolicy{SampleRate: 1}, message: "Request processed"},
+		{name: "server error", status: http.StatusBadGateway, policy: observability.AccessLogPolicy{SampleRate: 0}, message: "Request failed"},
+		{name: "client error", status: http.StatusPaymentRequired, policy: observability.AccessLogPolicy{SampleRate: 0}, message: "Request rejected"},
+		{
+			name:    "slow",
+			status:  http.StatusOK,
+			delay:   20 * time.Millisecond,
+			policy:  observability.AccessLogPolicy{SampleRate: 0, SlowThreshold: 10 * time.Millisecond},
+			message: "Slow request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&buf, nil))
+			handler := observability.AccessLog(logger, tt.policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.delay)
+				w.WriteHeader(tt.status)
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", nil))
+
+			if tt.message == "" {
+				if buf.Len() != 0 {
+					t.Errorf("expected nothing to be logged, got %s", buf.String())
+				}
+				return
+			}
+			if !strings.Contains(buf.String(), tt.message) {
+				t.Errorf("expected %q to be logged, got %s", tt.message, buf.String())
+			}
+		})
+	}
+}
+
+func TestAccessLog_PreservesFlusher(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	handler := observability.AccessLog(logger, observability.AccessLogPolicy{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("expected the wrapped writer to support flushing for SSE")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -1,13 +1,55 @@
 package observability
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 )
 
-// SetupLogger configures the global structured logger for the app.
+// SetupLogger configures the global structured logger for the app. LOG_LEVEL
+// (debug, info, warn or error) sets the verbosity and LOG_FORMAT (json or
+// text) the output, defaulting to JSON at info level. Invalid values fall back
+// to the defaults with a warning.
 func SetupLogger() *slog.Logger {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler, err := NewLogHandler(os.Stdout, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	logger := slog.New(handler)
 	slog.SetDefault(logger)
+	if err != nil {
+		logger.Warn("Invalid logging configuration, using defaults", "error", err)
+	}
 	return logger
 }
+
+// NewLogHandler creates the handler for a level and format, both of which may
+// be empty for the defaults. On an invalid value it still returns a usable
+// handler, with that setting at its default, along with the error.
+func NewLogHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	var errs []string
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid LOG_LEVEL %q", level))
+			lvl = slog.LevelInfo
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		errs = append(errs, fmt.Sprintf("invalid LOG_FORMAT %q", format))
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	if len(errs) > 0 {
+		return handler, errors.New(strings.Join(errs, "; "))
+	}
+	return handler, nil
+}
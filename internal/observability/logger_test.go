@@ -0,0 +1,74 @@
+package observability_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/observability"
+)
+
+func TestNewLogHandler_Level(t *testing.T) {
+	tests := []struct {
+		level     string
+		wantDebug bool
+	}{
+		{level: "", wantDebug: false},
+		{level: "info", wantDebug: false},
+		{level: "debug", wantDebug: true},
+		{level: "DEBUG", wantDebug: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler, err := observability.NewLogHandler(&buf, tt.level, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			logger := slog.New(handler)
+			logger.Debug("debug message")
+			logger.Info("info message")
+
+			if got := strings.Contains(buf.String(), "debug message"); got != tt.wantDebug {
+				t.Errorf("expected debug message emitted to be %v, got %q", tt.wantDebug, buf.String())
+			}
+			if !strings.Contains(buf.String(), "info message") {
+				t.Errorf("expected info message to be emitted, got %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestNewLogHandler_Format(t *testing.T) {
+	var buf bytes.Buffer
+	handler, _ := observability.NewLogHandler(&buf, "", "")
+	slog.New(handler).Info("hello", "key", "value")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["key"] != "value" {
+		t.Errorf("expected a JSON log line by default, got %q", buf.String())
+	}
+
+	buf.Reset()
+	handler, _ = observability.NewLogHandler(&buf, "", "text")
+	slog.New(handler).Info("hello", "key", "value")
+	if !strings.Contains(buf.String(), "msg=hello key=value") {
+		t.Errorf("expected a text log line, got %q", buf.String())
+	}
+}
+
+func TestNewLogHandler_InvalidFallsBack(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := observability.NewLogHandler(&buf, "verbose", "xml")
+	if err == nil || !strings.Contains(err.Error(), "LOG_LEVEL") || !strings.Contains(err.Error(), "LOG_FORMAT") {
+		t.Errorf("expected both invalid settings to be reported, got %v", err)
+	}
+	logger := slog.New(handler)
+	logger.Debug("debug message")
+	logger.Info("info message")
+	if strings.Contains(buf.String(), "debug message") || !json.Valid(bytes.TrimSpace(buf.Bytes())) {
+		t.Errorf("expected JSON at info level, got %q", buf.String())
+	}
+}
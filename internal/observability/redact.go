@@ -0,0 +1,94 @@
+package observability
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"aura-ai-gateway/internal/metrics"
+)
+
+// Redacted replaces prompt content and credentials in log output.
+const Redacted = "[REDACTED]"
+
+// APIKeyAttr identifies a key in logs by the same short hash used for metric
+// labels, so the raw key never appears in log output.
+func APIKeyAttr(apiKey string) slog.Attr {
+	return slog.String("api_key_hash", metrics.HashAPIKey(apiKey))
+}
+
+// sensitiveHeaders carry credentials and are masked by RedactHeaders.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Api-Key", "X-Api-Key", "Cookie"}
+
+// RedactHeaders returns a copy of h that is safe to log, with credentials masked.
+func RedactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range sensitiveHeaders {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out.Set(name, Redacted)
+		}
+	}
+	return out
+}
+
+// promptFields hold prompt text outside of messages, in the legacy
+// completions and embeddings formats.
+var promptFields = []string{"prompt", "input", "suffix"}
+
+// RedactPayload returns a copy of a request payload that is safe to log. The
+// content of each message, and of any tool call arguments, is replaced with a
+// placeholder noting its size, keeping the shape of the conversation; other
+// fields are kept. The payload itself is not modified.
+func RedactPayload(payload map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		out[k] = v
+	}
+	for _, field := range promptFields {
+		if v, ok := out[field]; ok {
+			out[field] = redactValue(v)
+		}
+	}
+
+	messages, ok := payload["messages"].([]interface{})
+	if !ok {
+		if _, present := payload["messages"]; present {
+			out["messages"] = Redacted
+		}
+		return out
+	}
+	redacted := make([]interface{}, len(messages))
+	for i, m := range messages {
+		msg, ok := m.(map[string]interface{})
+		if !ok {
+			redacted[i] = Redacted
+			continue
+		}
+		copied := make(map[string]interface{}, len(msg))
+		for k, v := range msg {
+			switch k {
+			case "content", "tool_calls", "function_call", "refusal", "audio":
+				copied[k] = redactValue(v)
+			default:
+				copied[k] = v
+			}
+		}
+		redacted[i] = copied
+	}
+	out["messages"] = redacted
+	return out
+}
+
+// redactValue returns the placeholder for a sensitive value, with the length
+// of text so oversized prompts can still be spotted. Nulls stay null.
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return fmt.Sprintf("%s (%d chars)", Redacted, len(v))
+	case []interface{}:
+		return fmt.Sprintf("%s (%d parts)", Redacted, len(v))
+	}
+	return Redacted
+}
@@ -0,0 +1,74 @@
+package observability_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"aura-ai-gateway/internal/observability"
+)
+
+func TestRedactPayload(t *testing.T) {
+	var payload map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"model": "gpt-4o",
+		"temperature": 0.2,
+		"messages": [
+			{"role": "system", "content": "You are a secret agent."},
+			{"role": "user", "content": [{"type": "text", "text": "My SSN is 123-45-6789"}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"function": {"arguments": "{\"ssn\":\"123-45-6789\"}"}}]}
+		]
+	}`), &payload)
+
+	redacted := observability.RedactPayload(payload)
+	out, _ := json.Marshal(redacted)
+	for _, secret := range []string{"secret agent", "123-45-6789"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("expected %q to be redacted, got %s", secret, out)
+		}
+	}
+
+	messages := redacted["messages"].([]interface{})
+	first := messages[0].(map[string]interface{})
+	if first["content"] != "[REDACTED] (23 chars)" || first["role"] != "system" {
+		t.Errorf("expected content replaced with a placeholder and the role kept, got %v", first)
+	}
+	if messages[2].(map[string]interface{})["content"] != nil {
+		t.Errorf("expected null content to stay null, got %v", messages[2])
+	}
+	if redacted["model"] != "gpt-4o" || redacted["temperature"] != 0.2 {
+		t.Errorf("expected other fields to be kept, got %v", redacted)
+	}
+
+	// The original payload is still forwarded, so it must be untouched
+	original := payload["messages"].([]interface{})[0].(map[string]interface{})
+	if original["content"] != "You are a secret agent." {
+		t.Errorf("expected the payload not to be modified, got %v", original)
+	}
+}
+
+func TestRedactPayload_LegacyPrompt(t *testing.T) {
+	redacted := observability.RedactPayload(map[string]interface{}{"prompt": "top secret", "input": []interface{}{"a", "b"}})
+	if redacted["prompt"] != "[REDACTED] (10 chars)" || redacted["input"] != "[REDACTED] (2 parts)" {
+		t.Errorf("expected prompt fields to be redacted, got %v", redacted)
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer sk-secret")
+	h.Set("Api-Key", "sk-secret")
+	h.Set("Content-Type", "application/json")
+
+	redacted := observability.RedactHeaders(h)
+	if redacted.Get("Authorization") != observability.Redacted || redacted.Get("Api-Key") != observability.Redacted {
+		t.Errorf("expected credentials to be masked, got %v", redacted)
+	}
+	if redacted.Get("Content-Type") != "application/json" {
+		t.Errorf("expected other headers to be kept, got %v", redacted)
+	}
+	if h.Get("Authorization") != "Bearer sk-secret" {
+		t.Errorf("expected the original headers not to be modified")
+	}
+}
@@ -0,0 +1,35 @@
+package observability
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID that correlates a request's access log entry
+// with its billing record. Clients may supply their own.
+const RequestIDHeader = "X-Request-Id"
+
+// NewRequestID returns a random 128-bit request ID in hex.
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestID assigns each request without a RequestIDHeader a new ID before
+// next sees it. With echo set, the ID is also returned in the response header,
+// so even requests rejected before reaching a handler can be traced.
+func RequestID(echo bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" {
+			requestID = NewRequestID()
+			r.Header.Set(RequestIDHeader, requestID)
+		}
+		if echo {
+			w.Header().Set(RequestIDHeader, requestID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
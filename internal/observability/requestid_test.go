@@ -0,0 +1,37 @@
+package observability_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aura-ai-gateway/internal/observability"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(observability.RequestIDHeader)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+
+	rr := httptest.NewRecorder()
+	observability.RequestID(true, next).ServeHTTP(rr, httptest.NewRequest("GET", "/v1/usage", nil))
+	if seen == "" {
+		t.Fatal("expected a request ID to be assigned")
+	}
+	if got := rr.Header().Get(observability.RequestIDHeader); got != seen {
+		t.Errorf("expected the ID %q to be echoed on the error, got %q", seen, got)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/usage", nil)
+	req.Header.Set(observability.RequestIDHeader, "client-supplied")
+	rr = httptest.NewRecorder()
+	observability.RequestID(false, next).ServeHTTP(rr, req)
+	if seen != "client-supplied" {
+		t.Errorf("expected the client's request ID to be kept, got %q", seen)
+	}
+	if got := rr.Header().Get(observability.RequestIDHeader); got != "" {
+		t.Errorf("expected no echo when disabled, got %q", got)
+	}
+}
@@ -0,0 +1,48 @@
+package observability
+
+import "strings"
+
+// OtherSDK buckets unrecognized user agents to keep metric label cardinality bounded.
+const OtherSDK = "other"
+
+// knownSDKs maps case-insensitive User-Agent product prefixes to normalized SDK names.
+// More specific prefixes must come first.
+var knownSDKs = []struct {
+	prefix string
+	name   string
+}{
+	{"openai/python ", "openai-python"},
+	{"openai/js ", "openai-node"},
+	{"openai/go ", "openai-go"},
+	{"openai/java ", "openai-java"},
+	{"python-httpx/", "httpx"},
+	{"python-requests/", "python-requests"},
+	{"aiohttp/", "aiohttp"},
+	{"axios/", "axios"},
+	{"node-fetch/", "node-fetch"},
+	{"go-http-client/", "go-http-client"},
+	{"curl/", "curl"},
+}
+
+// ClientSDK is the normalized client library parsed from a User-Agent header.
+type ClientSDK struct {
+	Name    string
+	Version string
+}
+
+// ParseUserAgent normalizes a User-Agent header into an SDK name and version.
+// Agents that aren't recognized are reported as OtherSDK with no version.
+func ParseUserAgent(ua string) ClientSDK {
+	lower := strings.ToLower(ua)
+	for _, sdk := range knownSDKs {
+		if !strings.HasPrefix(lower, sdk.prefix) {
+			continue
+		}
+		version := ua[len(sdk.prefix):]
+		if end := strings.IndexAny(version, " ;()"); end >= 0 {
+			version = version[:end]
+		}
+		return ClientSDK{Name: sdk.name, Version: version}
+	}
+	return ClientSDK{Name: OtherSDK}
+}
@@ -0,0 +1,31 @@
+package observability_test
+
+import (
+	"testing"
+
+	"aura-ai-gateway/internal/observability"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want observability.ClientSDK
+	}{
+		{"OpenAI/Python 1.30.1", observability.ClientSDK{Name: "openai-python", Version: "1.30.1"}},
+		{"OpenAI/JS 4.47.1", observability.ClientSDK{Name: "openai-node", Version: "4.47.1"}},
+		{"OpenAI/Go 0.1.0-alpha.38", observability.ClientSDK{Name: "openai-go", Version: "0.1.0-alpha.38"}},
+		{"curl/8.4.0", observability.ClientSDK{Name: "curl", Version: "8.4.0"}},
+		{"python-requests/2.31.0", observability.ClientSDK{Name: "python-requests", Version: "2.31.0"}},
+		{"Go-http-client/1.1", observability.ClientSDK{Name: "go-http-client", Version: "1.1"}},
+		{"Mozilla/5.0 (X11; Linux x86_64)", observability.ClientSDK{Name: observability.OtherSDK}},
+		{"", observability.ClientSDK{Name: observability.OtherSDK}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ua, func(t *testing.T) {
+			if got := observability.ParseUserAgent(tt.ua); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}